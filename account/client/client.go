@@ -3,11 +3,16 @@ package client
 import (
 	"context"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/rasadov/EcommerceAPI/account/models"
 	"github.com/rasadov/EcommerceAPI/account/proto/pb"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -17,7 +22,10 @@ type Client struct {
 }
 
 func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(middleware.UnaryClientAuthInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -32,27 +40,104 @@ func (client *Client) Close() {
 	}
 }
 
-func (client *Client) Register(ctx context.Context, name, email, password string) (string, error) {
+func (client *Client) Register(ctx context.Context, name, email, password string, role auth.Role) (*models.TokenPair, error) {
 	response, err := client.service.Register(ctx, &pb.RegisterRequest{
 		Name:     name,
 		Email:    email,
 		Password: password,
+		Role:     string(role),
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return response.Value, nil
+	return &models.TokenPair{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+	}, nil
 }
 
-func (client *Client) Login(ctx context.Context, email, password string) (string, error) {
+// Login forwards clientIP, the address of the end user, which is used to
+// throttle repeated failures from one address.
+func (client *Client) Login(ctx context.Context, email, password, clientIP string) (*models.LoginResult, error) {
 	response, err := client.service.Login(ctx, &pb.LoginRequest{
 		Email:    email,
 		Password: password,
+		ClientIp: clientIP,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if response.ChallengeToken != "" {
+		return &models.LoginResult{ChallengeToken: response.ChallengeToken}, nil
 	}
-	return response.Value, nil
+	return &models.LoginResult{Tokens: &models.TokenPair{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+	}}, nil
+}
+
+func (client *Client) VerifyTwoFactor(ctx context.Context, challengeToken, code string) (*models.TokenPair, error) {
+	response, err := client.service.VerifyTwoFactor(ctx, &pb.VerifyTwoFactorRequest{
+		ChallengeToken: challengeToken,
+		Code:           code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+	}, nil
+}
+
+// EnrollTwoFactor, ConfirmTwoFactor and DisableTwoFactor act on the account
+// whose access token is forwarded with ctx.
+func (client *Client) EnrollTwoFactor(ctx context.Context) (*models.TwoFactorEnrollment, error) {
+	response, err := client.service.EnrollTwoFactor(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorEnrollment{
+		Secret: response.GetSecret(),
+		URI:    response.GetUri(),
+	}, nil
+}
+
+func (client *Client) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	response, err := client.service.ConfirmTwoFactor(ctx, &wrapperspb.StringValue{
+		Value: code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetCodes(), nil
+}
+
+func (client *Client) DisableTwoFactor(ctx context.Context, code string) error {
+	_, err := client.service.DisableTwoFactor(ctx, &wrapperspb.StringValue{
+		Value: code,
+	})
+	return err
+}
+
+func (client *Client) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	response, err := client.service.RefreshToken(ctx, &wrapperspb.StringValue{
+		Value: refreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+	}, nil
+}
+
+func (client *Client) Logout(ctx context.Context, refreshToken string) error {
+	_, err := client.service.Logout(ctx, &wrapperspb.StringValue{
+		Value: refreshToken,
+	})
+	return err
 }
 
 func (client *Client) GetAccount(ctx context.Context, Id uint64) (*models.Account, error) {
@@ -66,9 +151,12 @@ func (client *Client) GetAccount(ctx context.Context, Id uint64) (*models.Accoun
 		return nil, err
 	}
 	return &models.Account{
-		ID:    r.Account.GetId(),
-		Name:  r.Account.GetName(),
-		Email: r.Account.GetEmail(),
+		ID:               r.Account.GetId(),
+		Name:             r.Account.GetName(),
+		Email:            r.Account.GetEmail(),
+		EmailVerified:    r.Account.GetEmailVerified(),
+		Role:             auth.Role(r.Account.GetRole()),
+		TwoFactorEnabled: r.Account.GetTwoFactorEnabled(),
 	}, nil
 }
 
@@ -83,10 +171,231 @@ func (client *Client) GetAccounts(ctx context.Context, skip, take uint64) ([]mod
 	var accounts []models.Account
 	for _, a := range r.Accounts {
 		accounts = append(accounts, models.Account{
-			ID:    a.GetId(),
-			Name:  a.GetName(),
-			Email: a.GetEmail(),
+			ID:               a.GetId(),
+			Name:             a.GetName(),
+			Email:            a.GetEmail(),
+			EmailVerified:    a.GetEmailVerified(),
+			Role:             auth.Role(a.GetRole()),
+			TwoFactorEnabled: a.GetTwoFactorEnabled(),
 		})
 	}
 	return accounts, nil
 }
+
+func (client *Client) SetAccountRole(ctx context.Context, accountID uint64, role auth.Role) (*models.Account, error) {
+	r, err := client.service.SetAccountRole(ctx, &pb.SetAccountRoleRequest{
+		AccountId: accountID,
+		Role:      string(role),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Account{
+		ID:               r.Account.GetId(),
+		Name:             r.Account.GetName(),
+		Email:            r.Account.GetEmail(),
+		EmailVerified:    r.Account.GetEmailVerified(),
+		Role:             auth.Role(r.Account.GetRole()),
+		TwoFactorEnabled: r.Account.GetTwoFactorEnabled(),
+	}, nil
+}
+
+// UpdateAccount, ChangePassword and DeleteAccount act on the account whose
+// access token is forwarded with ctx.
+func (client *Client) UpdateAccount(ctx context.Context, name, email string) (*models.Account, error) {
+	r, err := client.service.UpdateAccount(ctx, &pb.UpdateAccountRequest{
+		Name:  name,
+		Email: email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Account{
+		ID:               r.Account.GetId(),
+		Name:             r.Account.GetName(),
+		Email:            r.Account.GetEmail(),
+		EmailVerified:    r.Account.GetEmailVerified(),
+		Role:             auth.Role(r.Account.GetRole()),
+		TwoFactorEnabled: r.Account.GetTwoFactorEnabled(),
+	}, nil
+}
+
+// ChangePassword keeps the session of refreshToken signed in and revokes the others.
+func (client *Client) ChangePassword(ctx context.Context, currentPassword, newPassword, refreshToken string) error {
+	_, err := client.service.ChangePassword(ctx, &pb.ChangePasswordRequest{
+		CurrentPassword: currentPassword,
+		NewPassword:     newPassword,
+		RefreshToken:    refreshToken,
+	})
+	return err
+}
+
+func (client *Client) DeleteAccount(ctx context.Context, password string) error {
+	_, err := client.service.DeleteAccount(ctx, &wrapperspb.StringValue{
+		Value: password,
+	})
+	return err
+}
+
+// CreateAPIKey returns the new key together with its only copy in clear.
+func (client *Client) CreateAPIKey(ctx context.Context, name string, scopes []auth.Scope) (*models.APIKey, string, error) {
+	request := &pb.CreateAPIKeyRequest{Name: name}
+	for _, scope := range scopes {
+		request.Scopes = append(request.Scopes, string(scope))
+	}
+	r, err := client.service.CreateAPIKey(ctx, request)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey, err := apiKeyFromProto(r.GetApiKey())
+	if err != nil {
+		return nil, "", err
+	}
+	return apiKey, r.GetKey(), nil
+}
+
+func (client *Client) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	r, err := client.service.ListAPIKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	var keys []*models.APIKey
+	for _, k := range r.ApiKeys {
+		apiKey, err := apiKeyFromProto(k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, apiKey)
+	}
+	return keys, nil
+}
+
+func (client *Client) RevokeAPIKey(ctx context.Context, keyID uint64) error {
+	_, err := client.service.RevokeAPIKey(ctx, &wrapperspb.UInt64Value{
+		Value: keyID,
+	})
+	return err
+}
+
+// ResolveAPIKey exchanges an API key for an access token limited to its scopes.
+// It matches middleware.APIKeyResolver.
+func (client *Client) ResolveAPIKey(ctx context.Context, key string) (string, error) {
+	r, err := client.service.ResolveAPIKey(ctx, &wrapperspb.StringValue{
+		Value: key,
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.GetValue(), nil
+}
+
+func (client *Client) StartOIDCLogin(ctx context.Context, provider string) (string, error) {
+	r, err := client.service.StartOIDCLogin(ctx, &wrapperspb.StringValue{
+		Value: provider,
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.GetValue(), nil
+}
+
+func (client *Client) CompleteOIDCLogin(ctx context.Context, provider, code, state string) (*models.LoginResult, error) {
+	response, err := client.service.CompleteOIDCLogin(ctx, &pb.CompleteOIDCLoginRequest{
+		Provider: provider,
+		Code:     code,
+		State:    state,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.ChallengeToken != "" {
+		return &models.LoginResult{ChallengeToken: response.ChallengeToken}, nil
+	}
+	return &models.LoginResult{Tokens: &models.TokenPair{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+	}}, nil
+}
+
+func (client *Client) RequestPasswordReset(ctx context.Context, email string) error {
+	_, err := client.service.RequestPasswordReset(ctx, &wrapperspb.StringValue{
+		Value: email,
+	})
+	return err
+}
+
+func (client *Client) ResetPassword(ctx context.Context, token, password string) error {
+	_, err := client.service.ResetPassword(ctx, &pb.ResetPasswordRequest{
+		Token:    token,
+		Password: password,
+	})
+	return err
+}
+
+func (client *Client) SendVerificationEmail(ctx context.Context, accountID uint64) error {
+	_, err := client.service.SendVerificationEmail(ctx, &wrapperspb.UInt64Value{
+		Value: accountID,
+	})
+	return err
+}
+
+func (client *Client) VerifyEmail(ctx context.Context, token string) error {
+	_, err := client.service.VerifyEmail(ctx, &wrapperspb.StringValue{
+		Value: token,
+	})
+	return err
+}
+
+// GetJWKS returns the public keys used to verify access tokens.
+// It matches auth.JWKSFetcher so it can back an auth.RemoteKeySet.
+func (client *Client) GetJWKS(ctx context.Context) (*auth.JWKS, error) {
+	r, err := client.service.GetJWKS(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	jwks := &auth.JWKS{Keys: []auth.JWK{}}
+	for _, key := range r.Keys {
+		jwks.Keys = append(jwks.Keys, auth.JWK{
+			Kty: key.GetKty(),
+			Kid: key.GetKid(),
+			Alg: key.GetAlg(),
+			Use: key.GetUse(),
+			N:   key.GetN(),
+			E:   key.GetE(),
+			Crv: key.GetCrv(),
+			X:   key.GetX(),
+		})
+	}
+	return jwks, nil
+}
+
+func apiKeyFromProto(k *pb.APIKey) (*models.APIKey, error) {
+	apiKey := &models.APIKey{
+		ID:     k.GetId(),
+		Name:   k.GetName(),
+		Prefix: k.GetPrefix(),
+		Scopes: strings.Join(k.GetScopes(), " "),
+	}
+	if err := apiKey.CreatedAt.UnmarshalBinary(k.GetCreatedAt()); err != nil {
+		return nil, err
+	}
+	var err error
+	if apiKey.LastUsedAt, err = optionalTime(k.GetLastUsedAt()); err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt, err = optionalTime(k.GetRevokedAt()); err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func optionalTime(data []byte) (*time.Time, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var t time.Time
+	if err := t.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/rasadov/EcommerceAPI/account/config"
 	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"github.com/tinrab/retry"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -13,9 +16,26 @@ import (
 
 func main() {
 	var repository internal.Repository
+	var db *gorm.DB
+
+	keys, err := loadKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	producer, err := sarama.NewAsyncProducer([]string{config.BootstrapServers}, nil)
+	if err != nil {
+		log.Println(err)
+	}
+	defer func(producer sarama.AsyncProducer) {
+		err := producer.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}(producer)
 
 	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
-		db, err := gorm.Open(postgres.Open(config.DatabaseURL), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(config.DatabaseURL), &gorm.Config{})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -26,7 +46,51 @@ func main() {
 		return
 	})
 	defer repository.Close()
-	log.Println("Listening on port 8080...")
-	service := internal.NewService(repository)
-	log.Fatal(internal.ListenGRPC(service, 8080))
+
+	attempts, err := newAttemptStore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Listening on port %d...", config.GrpcPort)
+	service := internal.NewService(repository, keys, newMailer(), attempts, producer, newOIDCProviders())
+	log.Fatal(internal.StartServers(service, keys, config.GrpcPort, config.HTTPPort))
+}
+
+func loadKeys() (*auth.KeySet, error) {
+	if config.SigningKeysDir != "" {
+		return auth.LoadKeySet(config.SigningKeysDir, config.SigningKeyID)
+	}
+	// Without configured keys tokens stop validating after a restart, which is fine for local development only
+	log.Println("SIGNING_KEYS_DIR is not set, using an ephemeral signing key")
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewKeySet(key), nil
+}
+
+func newMailer() internal.Mailer {
+	if config.SMTPHost == "" {
+		log.Println("SMTP_HOST is not set, emails will only be logged")
+		return internal.NewLogMailer()
+	}
+	return internal.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+}
+
+func newAttemptStore(db *gorm.DB) (internal.AttemptStore, error) {
+	if config.LoginAttemptStore == "memory" {
+		return internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil
+	}
+	return internal.NewPostgresAttemptStore(db, internal.LoginAttemptWindow)
+}
+
+// newOIDCProviders configures the providers users can sign in with. The frontend
+// serves the redirect URL and passes the code and state on to completeOidcLogin.
+func newOIDCProviders() []*internal.OIDCProvider {
+	var providers []*internal.OIDCProvider
+	for _, provider := range config.OIDCProviders {
+		redirectURL := fmt.Sprintf("%s/oidc/callback/%s", config.AppURL, provider.Name)
+		providers = append(providers, internal.NewOIDCProvider(provider.Name, provider.Issuer, provider.ClientID, provider.ClientSecret, redirectURL))
+	}
+	return providers
 }
@@ -1,15 +1,67 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OIDCProvider is a provider users can sign in with. Providers are listed in
+// OIDC_PROVIDERS and configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID
+// and OIDC_<NAME>_CLIENT_SECRET.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
 
 var (
-	DatabaseURL string
-	SecretKey   string
-	Issuer      string
+	DatabaseURL    string
+	Issuer         string
+	SigningKeysDir string
+	SigningKeyID   string
+	AppURL         string
+	SMTPHost       string
+	SMTPPort       int
+	SMTPUsername   string
+	SMTPPassword   string
+	MailFrom       string
+	// LoginAttemptStore selects where failed logins are counted, "postgres" or "memory"
+	LoginAttemptStore string
+	BootstrapServers  string
+	OIDCProviders     []OIDCProvider
+)
+
+const (
+	GrpcPort int = 8080
+	HTTPPort int = 8081
 )
 
 func init() {
 	DatabaseURL = os.Getenv("DATABASE_URL")
-	SecretKey = os.Getenv("SECRET_KEY")
 	Issuer = os.Getenv("ISSUER")
+	SigningKeysDir = os.Getenv("SIGNING_KEYS_DIR")
+	SigningKeyID = os.Getenv("SIGNING_KEY_ID")
+	AppURL = os.Getenv("APP_URL")
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPPort, _ = strconv.Atoi(os.Getenv("SMTP_PORT"))
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	MailFrom = os.Getenv("MAIL_FROM")
+	LoginAttemptStore = os.Getenv("LOGIN_ATTEMPT_STORE")
+	BootstrapServers = os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		OIDCProviders = append(OIDCProviders, OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		})
+	}
 }
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/account/models"
+	"gorm.io/gorm"
+)
+
+// AttemptStore tracks failed logins. Failures older than the store window are
+// forgotten, so counters reset on their own after a quiet period.
+type AttemptStore interface {
+	// Get returns the attempts recorded for key, or nil if there are none.
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure atomically adds a failure at the given time and returns the new state.
+	RecordFailure(ctx context.Context, key string, at time.Time) (*models.LoginAttempt, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryAttemptStore struct {
+	mu         sync.Mutex
+	window     time.Duration
+	attempts   map[string]models.LoginAttempt
+	lastPruned time.Time
+}
+
+// NewMemoryAttemptStore keeps attempts in process memory. Counters are not shared
+// between replicas, so use it only when a single account service runs.
+func NewMemoryAttemptStore(window time.Duration) AttemptStore {
+	return &memoryAttemptStore{
+		window:     window,
+		attempts:   map[string]models.LoginAttempt{},
+		lastPruned: time.Now(),
+	}
+}
+
+func (store *memoryAttemptStore) Get(_ context.Context, key string) (*models.LoginAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	attempt, ok := store.attempts[key]
+	if !ok || time.Since(attempt.LastFailureAt) > store.window {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (store *memoryAttemptStore) RecordFailure(_ context.Context, key string, at time.Time) (*models.LoginAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.prune(at)
+
+	attempt, ok := store.attempts[key]
+	if !ok || at.Sub(attempt.LastFailureAt) > store.window {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	store.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (store *memoryAttemptStore) Reset(_ context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.attempts, key)
+	return nil
+}
+
+// prune drops expired entries once per window so the map does not grow forever.
+func (store *memoryAttemptStore) prune(now time.Time) {
+	if now.Sub(store.lastPruned) < store.window {
+		return
+	}
+	for key, attempt := range store.attempts {
+		if now.Sub(attempt.LastFailureAt) > store.window {
+			delete(store.attempts, key)
+		}
+	}
+	store.lastPruned = now
+}
+
+type postgresAttemptStore struct {
+	db     *gorm.DB
+	window time.Duration
+}
+
+// NewPostgresAttemptStore shares counters between every account service replica.
+func NewPostgresAttemptStore(db *gorm.DB, window time.Duration) (AttemptStore, error) {
+	if err := db.AutoMigrate(&models.LoginAttempt{}); err != nil {
+		return nil, err
+	}
+	return &postgresAttemptStore{db, window}, nil
+}
+
+func (store *postgresAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := store.db.WithContext(ctx).
+		First(&attempt, "key = ? AND last_failure_at > ?", key, time.Now().Add(-store.window).UTC()).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordFailure upserts the counter in a single statement so concurrent failures
+// are all counted.
+func (store *postgresAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := store.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING key, failures, last_failure_at`,
+		key, at.UTC(), at.Add(-store.window).UTC(),
+	).Scan(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (store *postgresAttemptStore) Reset(ctx context.Context, key string) error {
+	return store.db.WithContext(ctx).Delete(&models.LoginAttempt{}, "key = ?", key).Error
+}
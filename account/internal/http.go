@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+)
+
+const JWKSPath = "/.well-known/jwks.json"
+
+func listenHTTP(keys *auth.KeySet, port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(JWKSPath, JWKSHandler(keys))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	log.Printf("JWKS server listening on port %d", port)
+	return server.ListenAndServe()
+}
+
+// JWKSHandler serves the public keys so that other services can verify tokens.
+func JWKSHandler(keys *auth.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Short cache so that verifiers notice a rotation quickly
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+			log.Println("Failed to encode JWKS:", err)
+		}
+	}
+}
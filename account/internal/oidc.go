@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+)
+
+const oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown OIDC provider")
+	ErrInvalidIDToken      = errors.New("invalid ID token")
+)
+
+// OIDCClaims are the ID token claims used to find or create the account.
+type OIDCClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider is an OpenID Connect provider users can sign in with, such as
+// Google. Its endpoints and keys are discovered from the issuer on first use.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back with the code and state
+	RedirectURL string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      *auth.RemoteKeySet
+}
+
+func NewOIDCProvider(name, issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		Name:         name,
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// AuthorizationURL returns the provider page the user signs in on. codeVerifier
+// is sent as an S256 PKCE challenge and must be passed again to Exchange.
+func (provider *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the verified
+// ID token.
+func (provider *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCClaims, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	// client_secret_basic, the credentials are form encoded first (RFC 6749 section 2.3.1)
+	request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected token status from %s: %s", provider.Name, response.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no ID token", ErrInvalidIDToken)
+	}
+	return provider.verifyIDToken(tokens.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an
+// ID token.
+func (provider *OIDCProvider) verifyIDToken(encodedToken, nonce string) (*OIDCClaims, error) {
+	claims := &OIDCClaims{}
+	_, err := jwt.ParseWithClaims(
+		encodedToken,
+		claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return provider.keys.PublicKey(kid)
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	// The nonce ties the token to the login started by this browser, so a token
+	// issued for another login cannot be replayed
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// discover fetches the provider metadata once and keeps it for the life of the process.
+func (provider *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(provider.Issuer, "/")+oidcDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected discovery status from %s: %s", provider.Name, response.Status)
+	}
+	var discovery oidcDiscovery
+	if err = json.NewDecoder(response.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != provider.Issuer {
+		return nil, fmt.Errorf("%s discovery document is for issuer %q", provider.Name, discovery.Issuer)
+	}
+	provider.discovery = &discovery
+	provider.keys = auth.NewRemoteKeySet(auth.HTTPJWKSFetcher(discovery.JWKSURI))
+	return provider.discovery, nil
+}
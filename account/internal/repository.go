@@ -2,10 +2,13 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"gorm.io/gorm"
 )
 
@@ -15,8 +18,47 @@ type Repository interface {
 	GetAccountByEmail(ctx context.Context, email string) (*models.Account, error)
 	GetAccountByID(ctx context.Context, id uint64) (*models.Account, error)
 	ListAccounts(ctx context.Context, skip uint64, take uint64) ([]*models.Account, error)
+	PutRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, current *models.RefreshToken, next *models.RefreshToken) error
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+	RevokeAccountSessions(ctx context.Context, accountID uint64) error
+	PutAccountToken(ctx context.Context, token *models.AccountToken) error
+	ConsumeAccountToken(ctx context.Context, tokenHash string, purpose models.TokenPurpose) (*models.AccountToken, error)
+	InvalidateAccountTokens(ctx context.Context, accountID uint64, purpose models.TokenPurpose) error
+	UpdatePassword(ctx context.Context, accountID uint64, passwordHash string) error
+	SetEmailVerified(ctx context.Context, accountID uint64) error
+	UpdateRole(ctx context.Context, accountID uint64, role auth.Role) error
+	SetTwoFactorSecret(ctx context.Context, accountID uint64, secret string) error
+	EnableTwoFactor(ctx context.Context, accountID uint64, recoveryCodeHashes []string) error
+	DisableTwoFactor(ctx context.Context, accountID uint64) error
+	UseRecoveryCode(ctx context.Context, accountID uint64, codeHash string) error
+	UpdateAccount(ctx context.Context, account *models.Account) error
+	RevokeOtherSessions(ctx context.Context, accountID uint64, keepFamilyID string) error
+	DeleteAccount(ctx context.Context, accountID uint64) error
+	PutAPIKey(ctx context.Context, key *models.APIKey) error
+	ListAPIKeys(ctx context.Context, accountID uint64) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID, keyID uint64) error
+	UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error)
+	PutOIDCLogin(ctx context.Context, login *models.OIDCLogin) error
+	ConsumeOIDCLogin(ctx context.Context, stateHash, provider string) (*models.OIDCLogin, error)
+	GetExternalIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error)
+	PutExternalIdentity(ctx context.Context, identity *models.ExternalIdentity) error
 }
 
+var (
+	ErrRefreshTokenRevoked      = errors.New("refresh token has been revoked")
+	ErrInvalidAccountToken      = errors.New("invalid or expired token")
+	ErrInvalidRecoveryCode      = errors.New("invalid recovery code")
+	ErrAPIKeyNotFound           = errors.New("API key not found")
+	ErrInvalidOIDCState         = errors.New("invalid or expired login state")
+	ErrExternalIdentityNotFound = errors.New("external identity not found")
+)
+
+// apiKeyUsageResolution is how precisely the last use of an API key is recorded.
+// Coarser updates spare a write on every request.
+const apiKeyUsageResolution = time.Minute
+
 type postgresRepository struct {
 	db *gorm.DB
 }
@@ -32,7 +74,7 @@ func NewPostgresRepository(db *gorm.DB) (Repository, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&models.Account{})
+	err = db.AutoMigrate(&models.Account{}, &models.RefreshToken{}, &models.AccountToken{}, &models.RecoveryCode{}, &models.APIKey{}, &models.OIDCLogin{}, &models.ExternalIdentity{})
 	if err != nil {
 		log.Println("Error during migrations:", err)
 	}
@@ -89,3 +131,295 @@ func (repository *postgresRepository) ListAccounts(ctx context.Context, skip uin
 	}
 	return accounts, nil
 }
+
+func (repository *postgresRepository) PutRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return repository.db.WithContext(ctx).Create(token).Error
+}
+
+func (repository *postgresRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := repository.db.WithContext(ctx).First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes current and stores next in a single transaction.
+// It returns ErrRefreshTokenRevoked if current was already revoked, which happens
+// when two requests race to use the same token.
+func (repository *postgresRepository) RotateRefreshToken(ctx context.Context, current *models.RefreshToken, next *models.RefreshToken) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", time.Now().UTC())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenRevoked
+		}
+		return tx.Create(next).Error
+	})
+}
+
+func (repository *postgresRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return repository.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+func (repository *postgresRepository) RevokeAccountSessions(ctx context.Context, accountID uint64) error {
+	return repository.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("account_id = ? AND revoked_at IS NULL", accountID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+// RevokeOtherSessions revokes every session of the account except the keepFamilyID one.
+func (repository *postgresRepository) RevokeOtherSessions(ctx context.Context, accountID uint64, keepFamilyID string) error {
+	return repository.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("account_id = ? AND family_id <> ? AND revoked_at IS NULL", accountID, keepFamilyID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+func (repository *postgresRepository) PutAccountToken(ctx context.Context, token *models.AccountToken) error {
+	return repository.db.WithContext(ctx).Create(token).Error
+}
+
+// ConsumeAccountToken marks a valid token as used and returns it. Marking it used
+// is conditional, so a token can only be consumed once even under concurrent requests.
+func (repository *postgresRepository) ConsumeAccountToken(ctx context.Context, tokenHash string, purpose models.TokenPurpose) (*models.AccountToken, error) {
+	var token models.AccountToken
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.First(&token, "token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, now).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidAccountToken
+		}
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&models.AccountToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidAccountToken
+		}
+		token.UsedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repository *postgresRepository) InvalidateAccountTokens(ctx context.Context, accountID uint64, purpose models.TokenPurpose) error {
+	return repository.db.WithContext(ctx).Model(&models.AccountToken{}).
+		Where("account_id = ? AND purpose = ? AND used_at IS NULL", accountID, purpose).
+		Update("used_at", time.Now().UTC()).Error
+}
+
+func (repository *postgresRepository) UpdatePassword(ctx context.Context, accountID uint64, passwordHash string) error {
+	return repository.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ?", accountID).
+		Update("password", passwordHash).Error
+}
+
+func (repository *postgresRepository) SetEmailVerified(ctx context.Context, accountID uint64) error {
+	return repository.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ?", accountID).
+		Update("email_verified", true).Error
+}
+
+func (repository *postgresRepository) UpdateRole(ctx context.Context, accountID uint64, role auth.Role) error {
+	return repository.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ?", accountID).
+		Update("role", role).Error
+}
+
+// SetTwoFactorSecret stores the secret of a pending enrollment. It has no effect
+// on login until EnableTwoFactor is called.
+func (repository *postgresRepository) SetTwoFactorSecret(ctx context.Context, accountID uint64, secret string) error {
+	return repository.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ?", accountID).
+		Update("two_factor_secret", secret).Error
+}
+
+// EnableTwoFactor turns on two-factor authentication and replaces the recovery codes.
+func (repository *postgresRepository) EnableTwoFactor(ctx context.Context, accountID uint64, recoveryCodeHashes []string) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", accountID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, models.RecoveryCode{AccountID: accountID, CodeHash: hash})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Account{}).
+			Where("id = ?", accountID).
+			Update("two_factor_enabled", true).Error
+	})
+}
+
+func (repository *postgresRepository) DisableTwoFactor(ctx context.Context, accountID uint64) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", accountID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Account{}).
+			Where("id = ?", accountID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "two_factor_secret": ""}).Error
+	})
+}
+
+// UseRecoveryCode marks an unused recovery code as used, or returns ErrInvalidRecoveryCode.
+func (repository *postgresRepository) UseRecoveryCode(ctx context.Context, accountID uint64, codeHash string) error {
+	res := repository.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("account_id = ? AND code_hash = ? AND used_at IS NULL", accountID, codeHash).
+		Update("used_at", time.Now().UTC())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
+
+// UpdateAccount saves the profile fields of account.
+func (repository *postgresRepository) UpdateAccount(ctx context.Context, account *models.Account) error {
+	return repository.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ?", account.ID).
+		Updates(map[string]interface{}{
+			"name":           account.Name,
+			"email":          account.Email,
+			"email_verified": account.EmailVerified,
+		}).Error
+}
+
+// DeleteAccount removes the account together with its sessions, emailed tokens,
+// recovery codes, API keys and linked external identities.
+func (repository *postgresRepository) DeleteAccount(ctx context.Context, accountID uint64) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.RefreshToken{}, &models.AccountToken{}, &models.RecoveryCode{}, &models.APIKey{}, &models.ExternalIdentity{}} {
+			if err := tx.Where("account_id = ?", accountID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		res := tx.Delete(&models.Account{}, "id = ?", accountID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (repository *postgresRepository) PutAPIKey(ctx context.Context, key *models.APIKey) error {
+	return repository.db.WithContext(ctx).Create(key).Error
+}
+
+func (repository *postgresRepository) ListAPIKeys(ctx context.Context, accountID uint64) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	if err := repository.db.WithContext(ctx).Where("account_id = ?", accountID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key of the account, or returns ErrAPIKeyNotFound.
+func (repository *postgresRepository) RevokeAPIKey(ctx context.Context, accountID, keyID uint64) error {
+	res := repository.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND account_id = ? AND revoked_at IS NULL", keyID, accountID).
+		Update("revoked_at", time.Now().UTC())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// UseAPIKey returns the unrevoked key with keyHash and records that it was used.
+func (repository *postgresRepository) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := repository.db.WithContext(ctx).First(&key, "key_hash = ? AND revoked_at IS NULL", keyHash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageResolution {
+		err = repository.db.WithContext(ctx).Model(&models.APIKey{}).
+			Where("id = ?", key.ID).
+			Update("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return &key, nil
+}
+
+func (repository *postgresRepository) PutOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	return repository.db.WithContext(ctx).Create(login).Error
+}
+
+// ConsumeOIDCLogin marks a pending login of provider as used and returns it, like
+// ConsumeAccountToken, so a state can only complete one login.
+func (repository *postgresRepository) ConsumeOIDCLogin(ctx context.Context, stateHash, provider string) (*models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.First(&login, "state_hash = ? AND provider = ? AND used_at IS NULL AND expires_at > ?", stateHash, provider, now).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidOIDCState
+		}
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&models.OIDCLogin{}).
+			Where("id = ? AND used_at IS NULL", login.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidOIDCState
+		}
+		login.UsedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (repository *postgresRepository) GetExternalIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	err := repository.db.WithContext(ctx).First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExternalIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (repository *postgresRepository) PutExternalIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	return repository.db.WithContext(ctx).Create(identity).Error
+}
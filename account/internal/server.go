@@ -2,62 +2,206 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
 
+	"github.com/rasadov/EcommerceAPI/account/models"
 	"github.com/rasadov/EcommerceAPI/account/proto/pb"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// methodRoles lists the RPCs restricted to some roles, every other RPC is public.
+var methodRoles = middleware.MethodRoles{
+	pb.AccountService_GetAccounts_FullMethodName:    {auth.RoleAdmin},
+	pb.AccountService_SetAccountRole_FullMethodName: {auth.RoleAdmin},
+	// Two-factor management acts on the caller's own account
+	pb.AccountService_EnrollTwoFactor_FullMethodName:  {},
+	pb.AccountService_ConfirmTwoFactor_FullMethodName: {},
+	pb.AccountService_DisableTwoFactor_FullMethodName: {},
+	// So does profile management
+	pb.AccountService_UpdateAccount_FullMethodName:  {},
+	pb.AccountService_ChangePassword_FullMethodName: {},
+	pb.AccountService_DeleteAccount_FullMethodName:  {},
+	// API keys are meant for sellers syncing their catalog
+	pb.AccountService_CreateAPIKey_FullMethodName: {auth.RoleSeller},
+	pb.AccountService_ListAPIKeys_FullMethodName:  {},
+	pb.AccountService_RevokeAPIKey_FullMethodName: {},
+}
+
 type grpcServer struct {
 	pb.UnimplementedAccountServiceServer
 	service Service
+	keys    *auth.KeySet
 }
 
-func ListenGRPC(service Service, port int) error {
+// StartServers runs the gRPC server and the HTTP server publishing the JWKS concurrently
+func StartServers(service Service, keys *auth.KeySet, grpcPort, httpPort int) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, 2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := ListenGRPC(service, keys, grpcPort); err != nil {
+			errCh <- fmt.Errorf("gRPC server error: %w", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := listenHTTP(keys, httpPort); err != nil {
+			errCh <- fmt.Errorf("HTTP server error: %w", err)
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(errCh)
+	}()
+
+	return <-errCh
+}
+
+func ListenGRPC(service Service, keys *auth.KeySet, port int) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	serv := grpc.NewServer()
+	serv := grpc.NewServer(grpc.UnaryInterceptor(middleware.UnaryServerAuthInterceptor(keys, methodRoles)))
 
 	pb.RegisterAccountServiceServer(serv, &grpcServer{
 		UnimplementedAccountServiceServer: pb.UnimplementedAccountServiceServer{},
-		service:                           service})
+		service:                           service,
+		keys:                              keys})
 	reflection.Register(serv)
 	return serv.Serve(lis)
 }
 
-func (server *grpcServer) Register(ctx context.Context, request *pb.RegisterRequest) (*wrapperspb.StringValue, error) {
-	token, err := server.service.Register(ctx, request.Name, request.Email, request.Password)
+func (server *grpcServer) Register(ctx context.Context, request *pb.RegisterRequest) (*pb.AuthResponse, error) {
+	role, err := auth.ParseRole(request.Role)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	tokens, err := server.service.Register(ctx, request.Name, request.Email, request.Password, role)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (server *grpcServer) Login(ctx context.Context, request *pb.LoginRequest) (*pb.AuthResponse, error) {
+	result, err := server.service.Login(ctx, request.Email, request.Password, clientIP(ctx, request.ClientIp))
+	if errors.Is(err, ErrTooManyAttempts) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Tokens == nil {
+		return &pb.AuthResponse{ChallengeToken: result.ChallengeToken}, nil
+	}
+	return &pb.AuthResponse{
+		AccessToken:  result.Tokens.AccessToken,
+		RefreshToken: result.Tokens.RefreshToken,
+	}, nil
+}
+
+func (server *grpcServer) VerifyTwoFactor(ctx context.Context, request *pb.VerifyTwoFactorRequest) (*pb.AuthResponse, error) {
+	tokens, err := server.service.VerifyTwoFactor(ctx, request.ChallengeToken, request.Code)
 	if err != nil {
 		return nil, err
 	}
-	return &wrapperspb.StringValue{
-		Value: token,
+	return &pb.AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
-func (server *grpcServer) Login(ctx context.Context, request *pb.LoginRequest) (*wrapperspb.StringValue, error) {
-	token, err := server.service.Login(ctx, request.Email, request.Password)
+func (server *grpcServer) EnrollTwoFactor(ctx context.Context, _ *emptypb.Empty) (*pb.TwoFactorEnrollment, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enrollment, err := server.service.EnrollTwoFactor(ctx, accountID)
 	if err != nil {
 		return nil, err
 	}
-	return &wrapperspb.StringValue{
-		Value: token,
+	return &pb.TwoFactorEnrollment{
+		Secret: enrollment.Secret,
+		Uri:    enrollment.URI,
 	}, nil
 }
 
+func (server *grpcServer) ConfirmTwoFactor(ctx context.Context, request *wrapperspb.StringValue) (*pb.RecoveryCodes, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := server.service.ConfirmTwoFactor(ctx, accountID, request.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RecoveryCodes{Codes: codes}, nil
+}
+
+func (server *grpcServer) DisableTwoFactor(ctx context.Context, request *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = server.service.DisableTwoFactor(ctx, accountID, request.Value); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) RefreshToken(ctx context.Context, request *wrapperspb.StringValue) (*pb.AuthResponse, error) {
+	tokens, err := server.service.RefreshToken(ctx, request.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (server *grpcServer) Logout(ctx context.Context, request *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := server.service.Logout(ctx, request.Value); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func (server *grpcServer) GetAccount(ctx context.Context, r *wrapperspb.UInt64Value) (*pb.AccountResponse, error) {
 	a, err := server.service.GetAccount(ctx, r.Value)
 	if err != nil {
 		return nil, err
 	}
 	return &pb.AccountResponse{Account: &pb.Account{
-		Id:   uint64(a.ID),
-		Name: a.Name,
+		Id:               uint64(a.ID),
+		Name:             a.Name,
+		Email:            a.Email,
+		EmailVerified:    a.EmailVerified,
+		Role:             string(a.Role),
+		TwoFactorEnabled: a.TwoFactorEnabled,
 	}}, nil
 }
 
@@ -69,10 +213,291 @@ func (server *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequ
 	var accounts []*pb.Account
 	for _, p := range res {
 		accounts = append(accounts, &pb.Account{
-			Id:   uint64(int(p.ID)),
-			Name: p.Name,
+			Id:               uint64(int(p.ID)),
+			Name:             p.Name,
+			Email:            p.Email,
+			EmailVerified:    p.EmailVerified,
+			Role:             string(p.Role),
+			TwoFactorEnabled: p.TwoFactorEnabled,
 		},
 		)
 	}
 	return &pb.GetAccountsResponse{Accounts: accounts}, nil
 }
+
+func (server *grpcServer) SetAccountRole(ctx context.Context, request *pb.SetAccountRoleRequest) (*pb.AccountResponse, error) {
+	role, err := auth.ParseRole(request.Role)
+	if err != nil || request.Role == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid role %q", request.Role)
+	}
+	a, err := server.service.SetAccountRole(ctx, request.AccountId, role)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AccountResponse{Account: &pb.Account{
+		Id:               a.ID,
+		Name:             a.Name,
+		Email:            a.Email,
+		EmailVerified:    a.EmailVerified,
+		Role:             string(a.Role),
+		TwoFactorEnabled: a.TwoFactorEnabled,
+	}}, nil
+}
+
+func (server *grpcServer) UpdateAccount(ctx context.Context, request *pb.UpdateAccountRequest) (*pb.AccountResponse, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a, err := server.service.UpdateAccount(ctx, accountID, request.Name, request.Email)
+	if errors.Is(err, ErrEmailTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AccountResponse{Account: &pb.Account{
+		Id:               a.ID,
+		Name:             a.Name,
+		Email:            a.Email,
+		EmailVerified:    a.EmailVerified,
+		Role:             string(a.Role),
+		TwoFactorEnabled: a.TwoFactorEnabled,
+	}}, nil
+}
+
+func (server *grpcServer) ChangePassword(ctx context.Context, request *pb.ChangePasswordRequest) (*emptypb.Empty, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = server.service.ChangePassword(ctx, accountID, request.CurrentPassword, request.NewPassword, request.RefreshToken)
+	if err != nil {
+		return nil, passwordCheckError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) DeleteAccount(ctx context.Context, request *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = server.service.DeleteAccount(ctx, accountID, request.Value); err != nil {
+		return nil, passwordCheckError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) CreateAPIKey(ctx context.Context, request *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]auth.Scope, 0, len(request.Scopes))
+	for _, name := range request.Scopes {
+		scope, err := auth.ParseScope(name)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		scopes = append(scopes, scope)
+	}
+	apiKey, key, err := server.service.CreateAPIKey(ctx, accountID, request.Name, scopes)
+	if errors.Is(err, ErrAPIKeyNameRequired) || errors.Is(err, ErrAPIKeyScopesRequired) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	response, err := apiKeyToProto(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateAPIKeyResponse{ApiKey: response, Key: key}, nil
+}
+
+func (server *grpcServer) ListAPIKeys(ctx context.Context, _ *emptypb.Empty) (*pb.APIKeysResponse, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := server.service.ListAPIKeys(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	var apiKeys []*pb.APIKey
+	for _, key := range keys {
+		apiKey, err := apiKeyToProto(key)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return &pb.APIKeysResponse{ApiKeys: apiKeys}, nil
+}
+
+func (server *grpcServer) RevokeAPIKey(ctx context.Context, request *wrapperspb.UInt64Value) (*emptypb.Empty, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = server.service.RevokeAPIKey(ctx, accountID, request.Value)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) ResolveAPIKey(ctx context.Context, request *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	token, err := server.service.ResolveAPIKey(ctx, request.Value)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperspb.StringValue{Value: token}, nil
+}
+
+func (server *grpcServer) StartOIDCLogin(ctx context.Context, request *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	authURL, err := server.service.StartOIDCLogin(ctx, request.Value)
+	if errors.Is(err, ErrUnknownOIDCProvider) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperspb.StringValue{Value: authURL}, nil
+}
+
+func (server *grpcServer) CompleteOIDCLogin(ctx context.Context, request *pb.CompleteOIDCLoginRequest) (*pb.AuthResponse, error) {
+	result, err := server.service.CompleteOIDCLogin(ctx, request.Provider, request.Code, request.State)
+	switch {
+	case errors.Is(err, ErrUnknownOIDCProvider):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidOIDCState), errors.Is(err, ErrInvalidIDToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrOIDCEmailNotVerified):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, err
+	}
+	if result.Tokens == nil {
+		return &pb.AuthResponse{ChallengeToken: result.ChallengeToken}, nil
+	}
+	return &pb.AuthResponse{
+		AccessToken:  result.Tokens.AccessToken,
+		RefreshToken: result.Tokens.RefreshToken,
+	}, nil
+}
+
+func (server *grpcServer) RequestPasswordReset(ctx context.Context, request *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := server.service.RequestPasswordReset(ctx, request.Value); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) ResetPassword(ctx context.Context, request *pb.ResetPasswordRequest) (*emptypb.Empty, error) {
+	if err := server.service.ResetPassword(ctx, request.Token, request.Password); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) SendVerificationEmail(ctx context.Context, request *wrapperspb.UInt64Value) (*emptypb.Empty, error) {
+	if err := server.service.SendVerificationEmail(ctx, request.Value); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) VerifyEmail(ctx context.Context, request *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := server.service.VerifyEmail(ctx, request.Value); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (server *grpcServer) GetJWKS(ctx context.Context, _ *emptypb.Empty) (*pb.JWKSResponse, error) {
+	var keys []*pb.JWK
+	for _, key := range server.keys.JWKS().Keys {
+		keys = append(keys, &pb.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Alg: key.Alg,
+			Use: key.Use,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+		})
+	}
+	return &pb.JWKSResponse{Keys: keys}, nil
+}
+
+func apiKeyToProto(key *models.APIKey) (*pb.APIKey, error) {
+	createdAt, err := key.CreatedAt.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &pb.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		CreatedAt: createdAt,
+	}
+	for _, scope := range key.ScopeList() {
+		apiKey.Scopes = append(apiKey.Scopes, string(scope))
+	}
+	if key.LastUsedAt != nil {
+		if apiKey.LastUsedAt, err = key.LastUsedAt.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	if key.RevokedAt != nil {
+		if apiKey.RevokedAt, err = key.RevokedAt.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	return apiKey, nil
+}
+
+// callerID returns the account authenticated by the interceptor.
+func callerID(ctx context.Context) (uint64, error) {
+	accountID, err := auth.GetUserIdInt(ctx, false)
+	if err != nil {
+		return 0, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return uint64(accountID), nil
+}
+
+// passwordCheckError maps failures to confirm the current password to status codes.
+func passwordCheckError(err error) error {
+	switch {
+	case errors.Is(err, ErrTooManyAttempts):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrIncorrectPassword):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrPasswordRequired):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+// clientIP returns the end user address forwarded by the gateway, or the
+// address of the direct caller when nothing was forwarded.
+func clientIP(ctx context.Context, forwarded string) string {
+	if forwarded != "" {
+		return forwarded
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+	}
+	return ""
+}
@@ -3,68 +3,390 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/IBM/sarama"
+
+	"github.com/rasadov/EcommerceAPI/account/config"
 	"github.com/rasadov/EcommerceAPI/account/models"
 	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"github.com/rasadov/EcommerceAPI/pkg/crypt"
+	"github.com/rasadov/EcommerceAPI/pkg/kafka"
+)
+
+const (
+	passwordResetTokenDuration     = time.Hour
+	emailVerificationTokenDuration = 24 * time.Hour
+	twoFactorChallengeDuration     = 5 * time.Minute
+	recoveryCodeCount              = 10
+	twoFactorIssuer                = "EcommerceAPI"
+
+	// oidcLoginDuration is how long the user has to sign in with the provider
+	oidcLoginDuration = 10 * time.Minute
+
+	// apiKeyPrefixLength is how much of an API key is stored in clear to identify it
+	apiKeyPrefixLength = len(auth.APIKeyPrefix) + 6
+
+	// LoginAttemptWindow is how long failed logins are remembered.
+	LoginAttemptWindow = 24 * time.Hour
+	// Failed logins allowed before backoff starts. IPs get more room because
+	// many users can share one address.
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+	loginBackoffBase    = time.Second
+	// maxLoginBackoff caps the exponential backoff, at which point the key is
+	// effectively locked out until the delay passes.
+	maxLoginBackoff = 15 * time.Minute
+	// dummyPasswordHash is compared against for unknown emails so they take as
+	// long to reject as wrong passwords.
+	dummyPasswordHash = "$2a$10$7wO6u1Wpf3CZuQlrmfLeSOZkhIze87Q2yRi1WUR7qGStX5zpuzQRK"
+)
+
+var (
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrPasswordRequired     = errors.New("password must not be empty")
+	ErrRoleNotAllowed       = errors.New("admin accounts cannot be registered")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication enrollment was not started")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrTooManyAttempts      = errors.New("too many failed login attempts, try again later")
+	ErrIncorrectPassword    = errors.New("incorrect password")
+	ErrEmailTaken           = errors.New("email is already in use")
+	ErrAPIKeyNameRequired   = errors.New("API key name must not be empty")
+	ErrAPIKeyScopesRequired = errors.New("API key needs at least one scope")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+	ErrOIDCEmailNotVerified = errors.New("the provider did not return a verified email")
 )
 
 type Service interface {
-	Register(ctx context.Context, name, email, password string) (string, error)
-	Login(ctx context.Context, email, password string) (string, error)
+	Register(ctx context.Context, name, email, password string, role auth.Role) (*models.TokenPair, error)
+	Login(ctx context.Context, email, password, clientIP string) (*models.LoginResult, error)
+	VerifyTwoFactor(ctx context.Context, challengeToken, code string) (*models.TokenPair, error)
+	EnrollTwoFactor(ctx context.Context, accountID uint64) (*models.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, accountID uint64, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, accountID uint64, code string) error
+	RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	SendVerificationEmail(ctx context.Context, accountID uint64) error
+	VerifyEmail(ctx context.Context, token string) error
 	GetAccount(ctx context.Context, id uint64) (*models.Account, error)
 	GetAccounts(ctx context.Context, skip uint64, take uint64) ([]*models.Account, error)
+	SetAccountRole(ctx context.Context, accountID uint64, role auth.Role) (*models.Account, error)
+	UpdateAccount(ctx context.Context, accountID uint64, name, email string) (*models.Account, error)
+	ChangePassword(ctx context.Context, accountID uint64, currentPassword, newPassword, refreshToken string) error
+	DeleteAccount(ctx context.Context, accountID uint64, password string) error
+	CreateAPIKey(ctx context.Context, accountID uint64, name string, scopes []auth.Scope) (*models.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, accountID uint64) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID, keyID uint64) error
+	ResolveAPIKey(ctx context.Context, key string) (string, error)
+	StartOIDCLogin(ctx context.Context, provider string) (string, error)
+	CompleteOIDCLogin(ctx context.Context, provider, code, state string) (*models.LoginResult, error)
+	Producer() sarama.AsyncProducer
 }
 
 type accountService struct {
 	repository Repository
+	keys       *auth.KeySet
+	mailer     Mailer
+	attempts   AttemptStore
+	producer   sarama.AsyncProducer
+	// oidcProviders are the providers users can sign in with, by name
+	oidcProviders map[string]*OIDCProvider
+}
+
+func NewService(r Repository, keys *auth.KeySet, mailer Mailer, attempts AttemptStore, producer sarama.AsyncProducer, oidcProviders []*OIDCProvider) Service {
+	providers := make(map[string]*OIDCProvider, len(oidcProviders))
+	for _, provider := range oidcProviders {
+		providers[provider.Name] = provider
+	}
+	return &accountService{r, keys, mailer, attempts, producer, providers}
 }
 
-func NewService(r Repository) Service {
-	return &accountService{r}
+func (service accountService) Producer() sarama.AsyncProducer {
+	return service.producer
 }
 
-func (service accountService) Register(ctx context.Context, name, email, password string) (string, error) {
+// loginAttemptKey identifies a failed login counter and how many failures it
+// tolerates before backing off.
+type loginAttemptKey struct {
+	name         string
+	freeAttempts int
+}
+
+// Register creates a customer or seller account. Admins can only be appointed
+// by another admin through SetAccountRole.
+func (service accountService) Register(ctx context.Context, name, email, password string, role auth.Role) (*models.TokenPair, error) {
+	if role == "" {
+		role = auth.RoleCustomer
+	}
+	if role == auth.RoleAdmin {
+		return nil, ErrRoleNotAllowed
+	}
+
 	_, err := service.repository.GetAccountByEmail(ctx, email)
 	if err == nil {
-		return "", errors.New("account already exists")
+		return nil, errors.New("account already exists")
 	}
 
 	hashedPass, err := crypt.HashPassword(password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	acc := models.Account{
 		Name:     name,
 		Email:    email,
 		Password: hashedPass,
+		Role:     role,
 	}
 	account, err := service.repository.PutAccount(ctx, acc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	token, err := auth.GenerateToken(account.ID)
-	if err != nil {
-		return "", err
+	// The account is usable before verification, so a mail failure must not fail registration
+	if err = service.sendVerificationEmail(ctx, account); err != nil {
+		log.Println("Failed to send verification email:", err)
 	}
-	return token, nil
+	return service.startSession(ctx, account)
 }
 
-func (service accountService) Login(ctx context.Context, email, password string) (string, error) {
+// Login checks the password and starts a session. Accounts with two-factor
+// authentication get a challenge token instead, to exchange with VerifyTwoFactor.
+// Failures are counted per account and per client IP, and both back off
+// exponentially. Unknown emails and wrong passwords fail the same way.
+func (service accountService) Login(ctx context.Context, email, password, clientIP string) (*models.LoginResult, error) {
+	keys := loginAttemptKeys(email, clientIP)
+	if err := service.checkLoginAllowed(ctx, keys); err != nil {
+		return nil, err
+	}
+
 	account, err := service.repository.GetAccountByEmail(ctx, email)
 	if err != nil {
-		return "", err
+		_ = crypt.VerifyPassword(password, dummyPasswordHash)
+		service.recordLoginFailure(ctx, keys...)
+		return nil, ErrInvalidCredentials
 	}
 	err = crypt.VerifyPassword(password, account.Password)
 	if err != nil {
-		return "", err
+		service.recordLoginFailure(ctx, keys...)
+		return nil, ErrInvalidCredentials
+	}
+
+	// With two-factor authentication the counter is only reset once the code is verified
+	if account.TwoFactorEnabled {
+		challenge, err := service.issueAccountToken(ctx, account.ID, models.TwoFactorChallengePurpose, twoFactorChallengeDuration)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResult{ChallengeToken: challenge}, nil
 	}
 
-	token, err := auth.GenerateToken(account.ID)
+	service.resetLoginFailures(ctx, keys[0])
+	tokens, err := service.startSession(ctx, account)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return token, nil
+	return &models.LoginResult{Tokens: tokens}, nil
+}
+
+// VerifyTwoFactor completes a login with a TOTP or recovery code. The challenge
+// is consumed even when the code is wrong, so every guess costs a password check.
+func (service accountService) VerifyTwoFactor(ctx context.Context, challengeToken, code string) (*models.TokenPair, error) {
+	challenge, err := service.repository.ConsumeAccountToken(ctx, crypt.HashToken(challengeToken), models.TwoFactorChallengePurpose)
+	if err != nil {
+		return nil, err
+	}
+	account, err := service.repository.GetAccountByID(ctx, challenge.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	key := accountAttemptKey(account.Email)
+	if err = service.checkTwoFactorCode(ctx, account, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			service.recordLoginFailure(ctx, key)
+		}
+		return nil, err
+	}
+	service.resetLoginFailures(ctx, key)
+	return service.startSession(ctx, account)
+}
+
+// EnrollTwoFactor generates a new secret. It is only used for login once a code
+// generated from it is confirmed with ConfirmTwoFactor.
+func (service accountService) EnrollTwoFactor(ctx context.Context, accountID uint64) (*models.TwoFactorEnrollment, error) {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := crypt.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err = service.repository.SetTwoFactorSecret(ctx, account.ID, secret); err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    crypt.TOTPURI(twoFactorIssuer, account.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the recovery codes.
+// The codes are only stored hashed, so this is the only time they can be shown.
+func (service accountService) ConfirmTwoFactor(ctx context.Context, accountID uint64, code string) ([]string, error) {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if account.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if !crypt.ValidateTOTP(account.TwoFactorSecret, code, time.Now()) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := crypt.RecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, crypt.HashToken(code))
+	}
+	if err = service.repository.EnableTwoFactor(ctx, account.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (service accountService) DisableTwoFactor(ctx context.Context, accountID uint64, code string) error {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err = service.checkTwoFactorCode(ctx, account, code); err != nil {
+		return err
+	}
+	return service.repository.DisableTwoFactor(ctx, account.ID)
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The presented token
+// is revoked and replaced by a new one from the same family. Presenting a token
+// that was already rotated means it was leaked, so the whole family is revoked.
+func (service accountService) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	current, err := service.repository.GetRefreshTokenByHash(ctx, crypt.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.RevokedAt != nil {
+		service.revokeReusedFamily(ctx, current)
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// The role is read again on every refresh, so role changes apply within one access token lifetime
+	account, err := service.repository.GetAccountByID(ctx, current.AccountID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, next, err := service.issueTokens(account, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	err = service.repository.RotateRefreshToken(ctx, current, next)
+	if errors.Is(err, ErrRefreshTokenRevoked) {
+		service.revokeReusedFamily(ctx, current)
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Logout revokes every refresh token of the session the given token belongs to.
+// Unknown tokens are ignored so that logging out twice is not an error.
+func (service accountService) Logout(ctx context.Context, refreshToken string) error {
+	current, err := service.repository.GetRefreshTokenByHash(ctx, crypt.HashToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+	return service.repository.RevokeTokenFamily(ctx, current.FamilyID)
+}
+
+// RequestPasswordReset emails a reset link if the account exists. It never reports
+// whether the email is registered, so it cannot be used to enumerate accounts.
+func (service accountService) RequestPasswordReset(ctx context.Context, email string) error {
+	account, err := service.repository.GetAccountByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	token, err := service.issueAccountToken(ctx, account.ID, models.PasswordResetPurpose, passwordResetTokenDuration)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(
+		"Hi %s,\n\nUse the link below to reset your password. It expires in %s.\n\n%s\n\nIf you did not request a reset, you can ignore this email.",
+		account.Name, passwordResetTokenDuration, actionLink("reset-password", token))
+	return service.mailer.Send(ctx, account.Email, "Reset your password", body)
+}
+
+// ResetPassword sets a new password and signs the account out everywhere.
+func (service accountService) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	accountToken, err := service.repository.ConsumeAccountToken(ctx, crypt.HashToken(token), models.PasswordResetPurpose)
+	if err != nil {
+		return err
+	}
+	hashedPass, err := crypt.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err = service.repository.UpdatePassword(ctx, accountToken.AccountID, hashedPass); err != nil {
+		return err
+	}
+	return service.repository.RevokeAccountSessions(ctx, accountToken.AccountID)
+}
+
+func (service accountService) SendVerificationEmail(ctx context.Context, accountID uint64) error {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return service.sendVerificationEmail(ctx, account)
+}
+
+func (service accountService) VerifyEmail(ctx context.Context, token string) error {
+	accountToken, err := service.repository.ConsumeAccountToken(ctx, crypt.HashToken(token), models.EmailVerificationPurpose)
+	if err != nil {
+		return err
+	}
+	return service.repository.SetEmailVerified(ctx, accountToken.AccountID)
 }
 
 func (service accountService) GetAccount(ctx context.Context, id uint64) (*models.Account, error) {
@@ -79,3 +401,502 @@ func (service accountService) GetAccounts(ctx context.Context, skip uint64, take
 	return service.repository.ListAccounts(ctx, skip, take)
 
 }
+
+func (service accountService) SetAccountRole(ctx context.Context, accountID uint64, role auth.Role) (*models.Account, error) {
+	if err := service.repository.UpdateRole(ctx, accountID, role); err != nil {
+		return nil, err
+	}
+	return service.repository.GetAccountByID(ctx, accountID)
+}
+
+// UpdateAccount changes the name and email of an account, empty values are left
+// unchanged. A new email has to be verified again.
+func (service accountService) UpdateAccount(ctx context.Context, accountID uint64, name, email string) (*models.Account, error) {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		account.Name = name
+	}
+	emailChanged := email != "" && !strings.EqualFold(email, account.Email)
+	if emailChanged {
+		if _, err = service.repository.GetAccountByEmail(ctx, email); err == nil {
+			return nil, ErrEmailTaken
+		}
+		account.Email = email
+		account.EmailVerified = false
+	}
+	if err = service.repository.UpdateAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	if emailChanged {
+		if err = service.sendVerificationEmail(ctx, account); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
+	}
+	return account, nil
+}
+
+// ChangePassword sets a new password and signs out every other session. The
+// session refreshToken belongs to stays signed in, pass an empty token to sign
+// out everywhere.
+func (service accountService) ChangePassword(ctx context.Context, accountID uint64, currentPassword, newPassword, refreshToken string) error {
+	if newPassword == "" {
+		return ErrPasswordRequired
+	}
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err = service.checkCurrentPassword(ctx, account, currentPassword); err != nil {
+		return err
+	}
+	hashedPass, err := crypt.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err = service.repository.UpdatePassword(ctx, account.ID, hashedPass); err != nil {
+		return err
+	}
+	// A reset link sent before the change would otherwise undo it
+	if err = service.repository.InvalidateAccountTokens(ctx, account.ID, models.PasswordResetPurpose); err != nil {
+		return err
+	}
+
+	current, err := service.repository.GetRefreshTokenByHash(ctx, crypt.HashToken(refreshToken))
+	if refreshToken == "" || err != nil || current.AccountID != account.ID || current.RevokedAt != nil {
+		return service.repository.RevokeAccountSessions(ctx, account.ID)
+	}
+	return service.repository.RevokeOtherSessions(ctx, account.ID, current.FamilyID)
+}
+
+// DeleteAccount permanently deletes an account after confirming its password,
+// and publishes an account_deleted event so other services can anonymize the
+// data they keep about it.
+func (service accountService) DeleteAccount(ctx context.Context, accountID uint64, password string) error {
+	account, err := service.repository.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err = service.checkCurrentPassword(ctx, account, password); err != nil {
+		return err
+	}
+	if err = service.repository.DeleteAccount(ctx, account.ID); err != nil {
+		return err
+	}
+	service.resetLoginFailures(ctx, accountAttemptKey(account.Email))
+
+	go func() {
+		err := kafka.SendMessageToRecommender(service, models.Event{
+			Type: "account_deleted",
+			Data: models.EventData{
+				AccountID: account.ID,
+			},
+		}, "account_events")
+		if err != nil {
+			log.Println("Failed to send account deleted event:", err)
+		}
+	}()
+
+	return nil
+}
+
+// CreateAPIKey issues a key limited to scopes. Only its hash is stored, so the
+// returned key cannot be shown again.
+func (service accountService) CreateAPIKey(ctx context.Context, accountID uint64, name string, scopes []auth.Scope) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrAPIKeyNameRequired
+	}
+	var scopeNames []string
+	for _, scope := range scopes {
+		if _, err := auth.ParseScope(string(scope)); err != nil {
+			return nil, "", err
+		}
+		if !slices.Contains(scopeNames, string(scope)) {
+			scopeNames = append(scopeNames, string(scope))
+		}
+	}
+	if len(scopeNames) == 0 {
+		return nil, "", ErrAPIKeyScopesRequired
+	}
+
+	secret, err := crypt.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := auth.APIKeyPrefix + secret
+	apiKey := &models.APIKey{
+		AccountID: accountID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   crypt.HashToken(key),
+		Scopes:    strings.Join(scopeNames, " "),
+	}
+	if err = service.repository.PutAPIKey(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+func (service accountService) ListAPIKeys(ctx context.Context, accountID uint64) ([]*models.APIKey, error) {
+	return service.repository.ListAPIKeys(ctx, accountID)
+}
+
+func (service accountService) RevokeAPIKey(ctx context.Context, accountID, keyID uint64) error {
+	return service.repository.RevokeAPIKey(ctx, accountID, keyID)
+}
+
+// ResolveAPIKey exchanges an API key for an access token limited to the key's
+// scopes. The role is read from the account, so a demoted seller's keys stop
+// working for seller operations.
+func (service accountService) ResolveAPIKey(ctx context.Context, key string) (string, error) {
+	if !auth.IsAPIKey(key) {
+		return "", ErrInvalidAPIKey
+	}
+	apiKey, err := service.repository.UseAPIKey(ctx, crypt.HashToken(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return "", ErrInvalidAPIKey
+	}
+	if err != nil {
+		return "", err
+	}
+	account, err := service.repository.GetAccountByID(ctx, apiKey.AccountID)
+	if err != nil {
+		return "", ErrInvalidAPIKey
+	}
+	return service.keys.GenerateScopedToken(account.ID, account.Role, apiKey.ScopeList())
+}
+
+// StartOIDCLogin begins a login with an OIDC provider and returns the URL to send
+// the user to. The nonce and PKCE verifier stay on the server, the provider
+// redirects back with the state and a code to pass to CompleteOIDCLogin.
+func (service accountService) StartOIDCLogin(ctx context.Context, providerName string) (string, error) {
+	provider, ok := service.oidcProviders[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+	state, err := crypt.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := crypt.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := crypt.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := provider.AuthorizationURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+	err = service.repository.PutOIDCLogin(ctx, &models.OIDCLogin{
+		Provider:     provider.Name,
+		StateHash:    crypt.HashToken(state),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginDuration).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// CompleteOIDCLogin redeems the code the provider redirected back with and signs
+// in the account linked to the provider identity. Like Login, accounts with
+// two-factor authentication get a challenge token instead of a session.
+func (service accountService) CompleteOIDCLogin(ctx context.Context, providerName, code, state string) (*models.LoginResult, error) {
+	provider, ok := service.oidcProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	login, err := service.repository.ConsumeOIDCLogin(ctx, crypt.HashToken(state), provider.Name)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	account, err := service.oidcAccount(ctx, provider.Name, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.TwoFactorEnabled {
+		challenge, err := service.issueAccountToken(ctx, account.ID, models.TwoFactorChallengePurpose, twoFactorChallengeDuration)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResult{ChallengeToken: challenge}, nil
+	}
+	tokens, err := service.startSession(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{Tokens: tokens}, nil
+}
+
+// oidcAccount returns the account linked to the provider identity. An unknown
+// identity is linked to the account registered with its email, or to a new
+// account, but only if the provider verified the email.
+func (service accountService) oidcAccount(ctx context.Context, provider string, claims *OIDCClaims) (*models.Account, error) {
+	identity, err := service.repository.GetExternalIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return service.repository.GetAccountByID(ctx, identity.AccountID)
+	}
+	if !errors.Is(err, ErrExternalIdentityNotFound) {
+		return nil, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	account, err := service.repository.GetAccountByEmail(ctx, claims.Email)
+	if err == nil && !account.EmailVerified {
+		err = service.claimUnverifiedAccount(ctx, account)
+	} else if err != nil {
+		account, err = service.createOIDCAccount(ctx, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.repository.PutExternalIdentity(ctx, &models.ExternalIdentity{
+		AccountID: account.ID,
+		Provider:  provider,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// claimUnverifiedAccount hands an account whose email was never verified to the
+// owner of the email. Whoever registered it did not prove they own the address,
+// so their password, two-factor secret and sessions stop working.
+func (service accountService) claimUnverifiedAccount(ctx context.Context, account *models.Account) error {
+	hashedPass, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+	if err = service.repository.UpdatePassword(ctx, account.ID, hashedPass); err != nil {
+		return err
+	}
+	if account.TwoFactorEnabled {
+		if err = service.repository.DisableTwoFactor(ctx, account.ID); err != nil {
+			return err
+		}
+		account.TwoFactorEnabled = false
+	}
+	if err = service.repository.RevokeAccountSessions(ctx, account.ID); err != nil {
+		return err
+	}
+	if err = service.repository.SetEmailVerified(ctx, account.ID); err != nil {
+		return err
+	}
+	account.EmailVerified = true
+	return nil
+}
+
+// createOIDCAccount registers a customer for a provider identity. It has no
+// usable password until one is set with a password reset.
+func (service accountService) createOIDCAccount(ctx context.Context, claims *OIDCClaims) (*models.Account, error) {
+	hashedPass, err := unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return service.repository.PutAccount(ctx, models.Account{
+		Name:          name,
+		Email:         claims.Email,
+		Password:      hashedPass,
+		EmailVerified: true,
+		Role:          auth.RoleCustomer,
+	})
+}
+
+func (service accountService) startSession(ctx context.Context, account *models.Account) (*models.TokenPair, error) {
+	familyID, err := crypt.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	pair, refreshToken, err := service.issueTokens(account, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.repository.PutRefreshToken(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (service accountService) issueTokens(account *models.Account, familyID string) (*models.TokenPair, *models.RefreshToken, error) {
+	accessToken, err := service.keys.GenerateToken(account.ID, account.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, err := crypt.RandomToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	pair := &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+	stored := &models.RefreshToken{
+		AccountID: account.ID,
+		FamilyID:  familyID,
+		TokenHash: crypt.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(auth.RefreshTokenDuration).UTC(),
+	}
+	return pair, stored, nil
+}
+
+func (service accountService) revokeReusedFamily(ctx context.Context, token *models.RefreshToken) {
+	log.Printf("Refresh token reuse detected for account %d, revoking session", token.AccountID)
+	if err := service.repository.RevokeTokenFamily(ctx, token.FamilyID); err != nil {
+		log.Println("Failed to revoke refresh token family:", err)
+	}
+}
+
+func accountAttemptKey(email string) loginAttemptKey {
+	return loginAttemptKey{"account:" + strings.ToLower(strings.TrimSpace(email)), accountFreeAttempts}
+}
+
+// loginAttemptKeys returns the account key first, followed by the IP key when known.
+func loginAttemptKeys(email, clientIP string) []loginAttemptKey {
+	keys := []loginAttemptKey{accountAttemptKey(email)}
+	if clientIP != "" {
+		keys = append(keys, loginAttemptKey{"ip:" + clientIP, ipFreeAttempts})
+	}
+	return keys
+}
+
+// loginBackoff returns how long to wait after the last failure before trying again.
+func loginBackoff(failures, freeAttempts int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+	exponent := failures - freeAttempts
+	if exponent >= 30 {
+		return maxLoginBackoff
+	}
+	return min(loginBackoffBase<<exponent, maxLoginBackoff)
+}
+
+func (service accountService) checkLoginAllowed(ctx context.Context, keys []loginAttemptKey) error {
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := service.attempts.Get(ctx, key.name)
+		if err != nil {
+			return err
+		}
+		if attempt != nil && now.Before(attempt.LastFailureAt.Add(loginBackoff(attempt.Failures, key.freeAttempts))) {
+			return ErrTooManyAttempts
+		}
+	}
+	return nil
+}
+
+func (service accountService) recordLoginFailure(ctx context.Context, keys ...loginAttemptKey) {
+	for _, key := range keys {
+		if _, err := service.attempts.RecordFailure(ctx, key.name, time.Now()); err != nil {
+			log.Println("Failed to record login failure:", err)
+		}
+	}
+}
+
+// resetLoginFailures clears the account counter after a successful login. IP
+// counters are left to expire, otherwise an attacker could reset them with
+// their own account.
+func (service accountService) resetLoginFailures(ctx context.Context, key loginAttemptKey) {
+	if err := service.attempts.Reset(ctx, key.name); err != nil {
+		log.Println("Failed to reset login failures:", err)
+	}
+}
+
+// checkCurrentPassword confirms a sensitive change with the account password.
+// Failures count towards the login backoff, so it cannot be used to guess
+// passwords faster than Login.
+func (service accountService) checkCurrentPassword(ctx context.Context, account *models.Account, password string) error {
+	key := accountAttemptKey(account.Email)
+	if err := service.checkLoginAllowed(ctx, []loginAttemptKey{key}); err != nil {
+		return err
+	}
+	if err := crypt.VerifyPassword(password, account.Password); err != nil {
+		service.recordLoginFailure(ctx, key)
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// checkTwoFactorCode accepts a current TOTP code or an unused recovery code.
+func (service accountService) checkTwoFactorCode(ctx context.Context, account *models.Account, code string) error {
+	if !account.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if crypt.ValidateTOTP(account.TwoFactorSecret, code, time.Now()) {
+		return nil
+	}
+	err := service.repository.UseRecoveryCode(ctx, account.ID, crypt.HashToken(crypt.NormalizeRecoveryCode(code)))
+	if errors.Is(err, ErrInvalidRecoveryCode) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+func (service accountService) sendVerificationEmail(ctx context.Context, account *models.Account) error {
+	token, err := service.issueAccountToken(ctx, account.ID, models.EmailVerificationPurpose, emailVerificationTokenDuration)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s",
+		account.Name, emailVerificationTokenDuration, actionLink("verify-email", token))
+	return service.mailer.Send(ctx, account.Email, "Verify your email address", body)
+}
+
+// issueAccountToken creates a new emailed token and invalidates older ones with the
+// same purpose, so only the most recent link works.
+func (service accountService) issueAccountToken(ctx context.Context, accountID uint64, purpose models.TokenPurpose, duration time.Duration) (string, error) {
+	if err := service.repository.InvalidateAccountTokens(ctx, accountID, purpose); err != nil {
+		return "", err
+	}
+	token, err := crypt.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = service.repository.PutAccountToken(ctx, &models.AccountToken{
+		AccountID: accountID,
+		Purpose:   purpose,
+		TokenHash: crypt.HashToken(token),
+		ExpiresAt: time.Now().Add(duration).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// unusablePassword returns the hash of a random password nobody knows.
+func unusablePassword() (string, error) {
+	password, err := crypt.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return crypt.HashPassword(password)
+}
+
+func actionLink(path, token string) string {
+	return fmt.Sprintf("%s/%s?token=%s", config.AppURL, path, url.QueryEscape(token))
+}
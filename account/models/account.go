@@ -1,8 +1,15 @@
 package models
 
+import "github.com/rasadov/EcommerceAPI/pkg/auth"
+
 type Account struct {
-	ID       uint64 `gorm:"primaryKey;autoIncrement"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID            uint64    `gorm:"primaryKey;autoIncrement"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	Password      string    `json:"password"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          auth.Role `gorm:"type:varchar(16);default:customer" json:"role"`
+	// TwoFactorSecret is set on enrollment and only used once TwoFactorEnabled is confirmed
+	TwoFactorSecret  string `json:"-"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
 }
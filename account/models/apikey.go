@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+)
+
+// APIKey lets a seller's systems call the API without a session. Only the hash
+// of the key is stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	AccountID uint64 `gorm:"index"`
+	Name      string
+	// Prefix is the start of the key, shown to tell keys apart
+	Prefix  string
+	KeyHash string `gorm:"uniqueIndex"`
+	// Scopes is a space separated list of auth.Scope
+	Scopes     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (key APIKey) ScopeList() []auth.Scope {
+	var scopes []auth.Scope
+	for _, scope := range strings.Fields(key.Scopes) {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+	return scopes
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// LoginAttempt counts recent failed logins for one key, an email address or a client IP.
+type LoginAttempt struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+type EventData struct {
+	AccountID uint64 `json:"account_id"`
+}
+
+type Event struct {
+	Type string    `json:"type"`
+	Data EventData `json:"data"`
+}
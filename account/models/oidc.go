@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ExternalIdentity links an account to a user of an OIDC provider, identified
+// by the provider's subject claim.
+type ExternalIdentity struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	AccountID uint64 `gorm:"index"`
+	Provider  string `gorm:"uniqueIndex:idx_external_identity"`
+	Subject   string `gorm:"uniqueIndex:idx_external_identity"`
+	// Email is the address the provider reported when the identity was linked
+	Email     string
+	CreatedAt time.Time
+}
+
+// OIDCLogin is a login started with an OIDC provider. It is looked up by the
+// state parameter when the provider redirects back, and holds the PKCE verifier
+// and nonce that the code exchange and ID token are checked against.
+type OIDCLogin struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	Provider     string
+	StateHash    string `gorm:"uniqueIndex"`
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
+
+func (OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token that can be exchanged for a new access token.
+// Every rotation issues a new token in the same family, so replaying an already
+// used token lets us revoke the whole chain.
+type RefreshToken struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	AccountID uint64 `gorm:"index"`
+	FamilyID  string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// LoginResult holds either a session or, for accounts with two-factor authentication,
+// the challenge token to exchange together with a code for a session.
+type LoginResult struct {
+	Tokens         *TokenPair
+	ChallengeToken string
+}
+
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the device is lost.
+type RecoveryCode struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	AccountID uint64 `gorm:"index"`
+	CodeHash  string `gorm:"uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type TokenPurpose string
+
+const (
+	PasswordResetPurpose      = TokenPurpose("password_reset")
+	EmailVerificationPurpose  = TokenPurpose("email_verification")
+	TwoFactorChallengePurpose = TokenPurpose("two_factor_challenge")
+)
+
+// AccountToken is a single-use token sent by email to prove control of the address.
+// Only the hash is stored, the token itself exists only in the email.
+type AccountToken struct {
+	ID        uint64       `gorm:"primaryKey;autoIncrement"`
+	AccountID uint64       `gorm:"index"`
+	Purpose   TokenPurpose `gorm:"type:varchar(32)"`
+	TokenHash string       `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
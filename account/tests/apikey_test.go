@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountService_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	_, err := service.Register(ctx, "Seller", "erp@example.com", "password123", auth.RoleSeller)
+	require.NoError(t, err)
+	seller, err := repo.GetAccountByEmail(ctx, "erp@example.com")
+	require.NoError(t, err)
+
+	t.Run("validation", func(t *testing.T) {
+		_, _, err := service.CreateAPIKey(ctx, seller.ID, " ", []auth.Scope{auth.ScopeProductsWrite})
+		assert.ErrorIs(t, err, internal.ErrAPIKeyNameRequired)
+		_, _, err = service.CreateAPIKey(ctx, seller.ID, "ERP", nil)
+		assert.ErrorIs(t, err, internal.ErrAPIKeyScopesRequired)
+		_, _, err = service.CreateAPIKey(ctx, seller.ID, "ERP", []auth.Scope{"orders:delete"})
+		assert.Error(t, err)
+	})
+
+	apiKey, key, err := service.CreateAPIKey(ctx, seller.ID, "ERP", []auth.Scope{auth.ScopeProductsWrite, auth.ScopeProductsWrite})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, apiKey.Prefix))
+	assert.NotContains(t, apiKey.KeyHash, key)
+	assert.Equal(t, []auth.Scope{auth.ScopeProductsWrite}, apiKey.ScopeList())
+
+	t.Run("resolve issues a scoped token", func(t *testing.T) {
+		token, err := service.ResolveAPIKey(ctx, key)
+		require.NoError(t, err)
+		parsed, err := auth.ValidateToken(token, testKeys)
+		require.NoError(t, err)
+		claims := parsed.Claims.(*auth.JWTCustomClaims)
+		assert.Equal(t, seller.ID, claims.UserID)
+		assert.Equal(t, auth.RoleSeller, claims.Role)
+		assert.Equal(t, []auth.Scope{auth.ScopeProductsWrite}, claims.Scopes)
+
+		keys, err := service.ListAPIKeys(ctx, seller.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.NotNil(t, keys[0].LastUsedAt)
+	})
+
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		_, err := service.ResolveAPIKey(ctx, auth.APIKeyPrefix+"unknown")
+		assert.ErrorIs(t, err, internal.ErrInvalidAPIKey)
+		_, err = service.ResolveAPIKey(ctx, "not-a-key")
+		assert.ErrorIs(t, err, internal.ErrInvalidAPIKey)
+	})
+
+	t.Run("only the owner can revoke", func(t *testing.T) {
+		err := service.RevokeAPIKey(ctx, seller.ID+1, apiKey.ID)
+		assert.ErrorIs(t, err, internal.ErrAPIKeyNotFound)
+
+		require.NoError(t, service.RevokeAPIKey(ctx, seller.ID, apiKey.ID))
+		_, err = service.ResolveAPIKey(ctx, key)
+		assert.ErrorIs(t, err, internal.ErrInvalidAPIKey)
+
+		err = service.RevokeAPIKey(ctx, seller.ID, apiKey.ID)
+		assert.ErrorIs(t, err, internal.ErrAPIKeyNotFound)
+	})
+}
+
+type fakeAPIKeyResolver map[string]string
+
+func (keys fakeAPIKeyResolver) ResolveAPIKey(_ context.Context, key string) (string, error) {
+	token, ok := keys[key]
+	if !ok {
+		return "", errors.New("invalid API key")
+	}
+	return token, nil
+}
+
+func TestAuthorizeJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scopedToken, err := testKeys.GenerateScopedToken(7, auth.RoleSeller, []auth.Scope{auth.ScopeProductsWrite})
+	require.NoError(t, err)
+	sessionToken, err := testKeys.GenerateToken(8, auth.RoleCustomer)
+	require.NoError(t, err)
+	key := auth.APIKeyPrefix + "secret"
+
+	engine := gin.New()
+	engine.GET("/", middleware.AuthorizeJWT(testKeys, fakeAPIKeyResolver{key: scopedToken}), func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID, _ := auth.GetUserIdInt(ctx, false)
+		_, limited := auth.GetScopes(ctx)
+		c.JSON(http.StatusOK, gin.H{
+			"user":    userID,
+			"limited": limited,
+			"write":   auth.HasScope(ctx, auth.ScopeProductsWrite),
+			"read":    auth.HasScope(ctx, auth.ScopeProductsRead),
+		})
+	})
+	call := func(header, value string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("X-API-Key header", func(t *testing.T) {
+		response := call("X-API-Key", key)
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"user":7,"limited":true,"write":true,"read":false}`, response.Body.String())
+	})
+
+	t.Run("API key as bearer token", func(t *testing.T) {
+		response := call("Authorization", "Bearer "+key)
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"user":7,"limited":true,"write":true,"read":false}`, response.Body.String())
+	})
+
+	t.Run("access token as bearer token", func(t *testing.T) {
+		response := call("Authorization", "Bearer "+sessionToken)
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"user":8,"limited":false,"write":true,"read":true}`, response.Body.String())
+	})
+
+	t.Run("invalid API key", func(t *testing.T) {
+		response := call("X-API-Key", auth.APIKeyPrefix+"wrong")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		response := call("", "")
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"user":0,"limited":false,"write":true,"read":true}`, response.Body.String())
+	})
+}
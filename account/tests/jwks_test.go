@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSASigningKey(t *testing.T, id string) *auth.SigningKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := auth.NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key
+}
+
+func TestKeySet_GenerateAndValidate(t *testing.T) {
+	t.Run("RS256 key", func(t *testing.T) {
+		keys := auth.NewKeySet(newRSASigningKey(t, "rsa-key"))
+
+		token, err := keys.GenerateToken(42, auth.RoleCustomer)
+		require.NoError(t, err)
+
+		parsed, err := auth.ValidateToken(token, keys)
+		require.NoError(t, err)
+		assert.Equal(t, "RS256", parsed.Method.Alg())
+		assert.Equal(t, "rsa-key", parsed.Header["kid"])
+		assert.Equal(t, uint64(42), parsed.Claims.(*auth.JWTCustomClaims).UserID)
+	})
+
+	t.Run("EdDSA key", func(t *testing.T) {
+		key, err := auth.GenerateSigningKey()
+		require.NoError(t, err)
+		keys := auth.NewKeySet(key)
+
+		token, err := keys.GenerateToken(7, auth.RoleCustomer)
+		require.NoError(t, err)
+
+		parsed, err := auth.ValidateToken(token, keys)
+		require.NoError(t, err)
+		assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	})
+
+	t.Run("HMAC tokens are rejected", func(t *testing.T) {
+		keys := auth.NewKeySet(newRSASigningKey(t, "rsa-key"))
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.JWTCustomClaims{UserID: 1})
+		token.Header["kid"] = "rsa-key"
+		encoded, err := token.SignedString([]byte("shared-secret"))
+		require.NoError(t, err)
+
+		_, err = auth.ValidateToken(encoded, keys)
+		assert.Error(t, err)
+	})
+
+	t.Run("tokens signed by an unknown key are rejected", func(t *testing.T) {
+		keys := auth.NewKeySet(newRSASigningKey(t, "trusted"))
+		other := auth.NewKeySet(newRSASigningKey(t, "attacker"))
+
+		token, err := other.GenerateToken(1, auth.RoleCustomer)
+		require.NoError(t, err)
+
+		_, err = auth.ValidateToken(token, keys)
+		assert.ErrorIs(t, err, auth.ErrUnknownKey)
+	})
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey := newRSASigningKey(t, "2025-01")
+	keys := auth.NewKeySet(oldKey)
+
+	oldToken, err := keys.GenerateToken(1, auth.RoleCustomer)
+	require.NoError(t, err)
+
+	newKey, err := auth.GenerateSigningKey()
+	require.NoError(t, err)
+	keys.Rotate(newKey)
+
+	t.Run("new tokens use the new key", func(t *testing.T) {
+		token, err := keys.GenerateToken(1, auth.RoleCustomer)
+		require.NoError(t, err)
+		parsed, err := auth.ValidateToken(token, keys)
+		require.NoError(t, err)
+		assert.Equal(t, newKey.ID, parsed.Header["kid"])
+	})
+
+	t.Run("old tokens stay valid until the key is retired", func(t *testing.T) {
+		_, err := auth.ValidateToken(oldToken, keys)
+		assert.NoError(t, err)
+
+		assert.Error(t, keys.Retire(newKey.ID))
+		require.NoError(t, keys.Retire(oldKey.ID))
+
+		_, err = auth.ValidateToken(oldToken, keys)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"2025-01", "2025-06"} {
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600))
+	}
+
+	t.Run("newest key is active by default", func(t *testing.T) {
+		keys, err := auth.LoadKeySet(dir, "")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-06", keys.Active().ID)
+		assert.Len(t, keys.JWKS().Keys, 2)
+	})
+
+	t.Run("explicit active key", func(t *testing.T) {
+		keys, err := auth.LoadKeySet(dir, "2025-01")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-01", keys.Active().ID)
+	})
+
+	t.Run("missing active key", func(t *testing.T) {
+		_, err := auth.LoadKeySet(dir, "2024-01")
+		assert.Error(t, err)
+	})
+
+	t.Run("empty directory", func(t *testing.T) {
+		_, err := auth.LoadKeySet(t.TempDir(), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestJWKSHandler(t *testing.T) {
+	edKey, err := auth.GenerateSigningKey()
+	require.NoError(t, err)
+	keys := auth.NewKeySet(edKey, newRSASigningKey(t, "rsa-key"))
+
+	server := httptest.NewServer(internal.JWKSHandler(keys))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var jwks auth.JWKS
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 2)
+	for _, jwk := range jwks.Keys {
+		assert.Equal(t, "sig", jwk.Use)
+		_, err := jwk.PublicKey()
+		assert.NoError(t, err)
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	keys := auth.NewKeySet(newRSASigningKey(t, "first"))
+
+	fetches := 0
+	remote := auth.NewRemoteKeySet(func(ctx context.Context) (*auth.JWKS, error) {
+		fetches++
+		return keys.JWKS(), nil
+	})
+
+	t.Run("verifies with fetched public keys", func(t *testing.T) {
+		token, err := keys.GenerateToken(1, auth.RoleCustomer)
+		require.NoError(t, err)
+
+		_, err = auth.ValidateToken(token, remote)
+		assert.NoError(t, err)
+		_, err = auth.ValidateToken(token, remote)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, fetches)
+	})
+
+	t.Run("unknown kids do not trigger a refetch storm", func(t *testing.T) {
+		_, err := remote.PublicKey("forged")
+		assert.ErrorIs(t, err, auth.ErrUnknownKey)
+		assert.Equal(t, 1, fetches)
+	})
+
+	t.Run("picks up rotated keys over HTTP", func(t *testing.T) {
+		server := httptest.NewServer(internal.JWKSHandler(keys))
+		defer server.Close()
+		httpRemote := auth.NewRemoteKeySet(auth.HTTPJWKSFetcher(server.URL))
+		httpRemote.RefreshInterval = 0
+
+		token, err := keys.GenerateToken(1, auth.RoleCustomer)
+		require.NoError(t, err)
+		_, err = auth.ValidateToken(token, httpRemote)
+		require.NoError(t, err)
+
+		rotated, err := auth.GenerateSigningKey()
+		require.NoError(t, err)
+		keys.Rotate(rotated)
+
+		token, err = keys.GenerateToken(1, auth.RoleCustomer)
+		require.NoError(t, err)
+		_, err = auth.ValidateToken(token, httpRemote)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountService_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	email := "locked@example.com"
+	password := "password123"
+	_, err := service.Register(ctx, "Locked", email, password, auth.RoleCustomer)
+	require.NoError(t, err)
+
+	t.Run("unknown email and wrong password fail the same way", func(t *testing.T) {
+		_, unknownErr := service.Login(ctx, "nobody@example.com", password, "")
+		_, wrongErr := service.Login(ctx, email, "wrong-password", "")
+		assert.ErrorIs(t, unknownErr, internal.ErrInvalidCredentials)
+		assert.Equal(t, unknownErr, wrongErr)
+	})
+
+	t.Run("repeated failures lock the account", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			_, err := service.Login(ctx, email, "wrong-password", "")
+			require.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		}
+
+		_, err := service.Login(ctx, email, password, "")
+		assert.ErrorIs(t, err, internal.ErrTooManyAttempts)
+	})
+
+	t.Run("lockout expires and success resets the counter", func(t *testing.T) {
+		time.Sleep(1100 * time.Millisecond)
+		result, err := service.Login(ctx, email, password, "")
+		require.NoError(t, err)
+		assert.NotNil(t, result.Tokens)
+
+		_, err = service.Login(ctx, email, "wrong-password", "")
+		assert.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		_, err = service.Login(ctx, email, password, "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("failures from one IP throttle that IP only", func(t *testing.T) {
+		const attacker = "203.0.113.7"
+		for i := 0; i < 20; i++ {
+			_, err := service.Login(ctx, fmt.Sprintf("victim%d@example.com", i), "guess", attacker)
+			require.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		}
+
+		_, err := service.Login(ctx, email, password, attacker)
+		assert.ErrorIs(t, err, internal.ErrTooManyAttempts)
+		_, err = service.Login(ctx, email, password, "198.51.100.1")
+		assert.NoError(t, err)
+	})
+}
+
+func TestAttemptStores(t *testing.T) {
+	const window = time.Hour
+	postgresStore, err := internal.NewPostgresAttemptStore(setupTestDB(t), window)
+	require.NoError(t, err)
+	stores := map[string]internal.AttemptStore{
+		"memory":   internal.NewMemoryAttemptStore(window),
+		"postgres": postgresStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			attempt, err := store.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Nil(t, attempt)
+
+			_, err = store.RecordFailure(ctx, "key", now.Add(-2*window))
+			require.NoError(t, err)
+			attempt, err = store.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Nil(t, attempt, "failures outside the window are forgotten")
+
+			attempt, err = store.RecordFailure(ctx, "key", now)
+			require.NoError(t, err)
+			assert.Equal(t, 1, attempt.Failures)
+			attempt, err = store.RecordFailure(ctx, "key", now)
+			require.NoError(t, err)
+			assert.Equal(t, 2, attempt.Failures)
+
+			attempt, err = store.Get(ctx, "key")
+			require.NoError(t, err)
+			require.NotNil(t, attempt)
+			assert.Equal(t, 2, attempt.Failures)
+
+			require.NoError(t, store.Reset(ctx, "key"))
+			attempt, err = store.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Nil(t, attempt)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeClientID     = "ecommerce"
+	fakeClientSecret = "s3cret"
+	fakeRedirectURL  = "http://localhost:3000/oidc/callback/fake"
+)
+
+// fakeOIDCProvider is a minimal OpenID provider. Instead of a sign-in page, the
+// test approves an authorization request with authorize and gets the code back.
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *auth.SigningKey
+
+	mu    sync.Mutex
+	codes map[string]fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := auth.NewSigningKey("fake-key", private)
+	require.NoError(t, err)
+
+	provider := &fakeOIDCProvider{key: key, codes: map[string]fakeAuthorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(auth.NewKeySet(key).JWKS())
+	})
+	mux.HandleFunc("/token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (provider *fakeOIDCProvider) relyingParty() *internal.OIDCProvider {
+	return internal.NewOIDCProvider("fake", provider.server.URL, fakeClientID, fakeClientSecret, fakeRedirectURL)
+}
+
+// authorize checks the authorization URL like the provider would and returns the
+// code and state it redirects back with. claims are added to the ID token.
+func (provider *fakeOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (string, string) {
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	require.Equal(t, provider.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, fakeClientID, query.Get("client_id"))
+	require.Equal(t, fakeRedirectURL, query.Get("redirect_uri"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.Contains(t, query.Get("scope"), "openid")
+	require.NotEmpty(t, query.Get("state"))
+	require.NotEmpty(t, query.Get("nonce"))
+
+	code := "code-" + query.Get("state")[:8]
+	provider.mu.Lock()
+	provider.codes[code] = fakeAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	provider.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (provider *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != fakeClientID || secret != fakeClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	provider.mu.Lock()
+	authorization, ok := provider.codes[r.PostFormValue("code")]
+	delete(provider.codes, r.PostFormValue("code"))
+	provider.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != fakeRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   provider.server.URL,
+		"aud":   fakeClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for name, value := range authorization.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(provider.key.Method, claims)
+	token.Header["kid"] = provider.key.ID
+	idToken, err := token.SignedString(provider.key.PrivateKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func TestAccountService_OIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	provider := newFakeOIDCProvider(t)
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, []*internal.OIDCProvider{provider.relyingParty()})
+
+	login := func(t *testing.T, claims jwt.MapClaims) (*models.LoginResult, error) {
+		authURL, err := service.StartOIDCLogin(ctx, "fake")
+		require.NoError(t, err)
+		code, state := provider.authorize(t, authURL, claims)
+		return service.CompleteOIDCLogin(ctx, "fake", code, state)
+	}
+
+	t.Run("first login creates a verified account", func(t *testing.T) {
+		result, err := login(t, jwt.MapClaims{"sub": "new-user", "email": "new@example.com", "email_verified": true, "name": "New User"})
+		require.NoError(t, err)
+		require.NotNil(t, result.Tokens)
+
+		account, err := repo.GetAccountByEmail(ctx, "new@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "New User", account.Name)
+		assert.True(t, account.EmailVerified)
+		assert.Equal(t, auth.RoleCustomer, account.Role)
+		assertAccessTokenFor(t, result.Tokens.AccessToken, account.ID)
+
+		// The subject identifies the user from then on, even if the email changes
+		result, err = login(t, jwt.MapClaims{"sub": "new-user", "email": "renamed@example.com", "email_verified": true})
+		require.NoError(t, err)
+		assertAccessTokenFor(t, result.Tokens.AccessToken, account.ID)
+	})
+
+	t.Run("links an existing verified account by email", func(t *testing.T) {
+		_, err := service.Register(ctx, "Alice", "alice@example.com", "password123", auth.RoleSeller)
+		require.NoError(t, err)
+		alice, err := repo.GetAccountByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		require.NoError(t, repo.SetEmailVerified(ctx, alice.ID))
+
+		result, err := login(t, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+		require.NoError(t, err)
+		assertAccessTokenFor(t, result.Tokens.AccessToken, alice.ID)
+		assertRole(t, result.Tokens.AccessToken, auth.RoleSeller)
+
+		_, err = service.Login(ctx, "alice@example.com", "password123", "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("claims an unverified account for the email owner", func(t *testing.T) {
+		squatter, err := service.Register(ctx, "Squatter", "bob@example.com", "password123", auth.RoleCustomer)
+		require.NoError(t, err)
+
+		result, err := login(t, jwt.MapClaims{"sub": "bob", "email": "bob@example.com", "email_verified": true})
+		require.NoError(t, err)
+		require.NotNil(t, result.Tokens)
+
+		bob, err := repo.GetAccountByEmail(ctx, "bob@example.com")
+		require.NoError(t, err)
+		assert.True(t, bob.EmailVerified)
+		_, err = service.Login(ctx, "bob@example.com", "password123", "")
+		assert.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		_, err = service.RefreshToken(ctx, squatter.RefreshToken)
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+	})
+
+	t.Run("requires a verified email to link", func(t *testing.T) {
+		_, err := login(t, jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": false})
+		assert.ErrorIs(t, err, internal.ErrOIDCEmailNotVerified)
+		_, err = repo.GetAccountByEmail(ctx, "carol@example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("state can only be used once", func(t *testing.T) {
+		authURL, err := service.StartOIDCLogin(ctx, "fake")
+		require.NoError(t, err)
+		code, state := provider.authorize(t, authURL, jwt.MapClaims{"sub": "new-user"})
+		_, err = service.CompleteOIDCLogin(ctx, "fake", code, state)
+		require.NoError(t, err)
+		_, err = service.CompleteOIDCLogin(ctx, "fake", code, state)
+		assert.ErrorIs(t, err, internal.ErrInvalidOIDCState)
+	})
+
+	t.Run("code of another login fails PKCE", func(t *testing.T) {
+		firstURL, err := service.StartOIDCLogin(ctx, "fake")
+		require.NoError(t, err)
+		code, _ := provider.authorize(t, firstURL, jwt.MapClaims{"sub": "new-user"})
+		secondURL, err := service.StartOIDCLogin(ctx, "fake")
+		require.NoError(t, err)
+		_, state := provider.authorize(t, secondURL, jwt.MapClaims{"sub": "new-user"})
+
+		_, err = service.CompleteOIDCLogin(ctx, "fake", code, state)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects an ID token with another nonce", func(t *testing.T) {
+		_, err := login(t, jwt.MapClaims{"sub": "new-user", "nonce": "replayed"})
+		assert.ErrorIs(t, err, internal.ErrInvalidIDToken)
+	})
+
+	t.Run("rejects an ID token for another client", func(t *testing.T) {
+		_, err := login(t, jwt.MapClaims{"sub": "new-user", "aud": "someone-else"})
+		assert.ErrorIs(t, err, internal.ErrInvalidIDToken)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := service.StartOIDCLogin(ctx, "myspace")
+		assert.ErrorIs(t, err, internal.ErrUnknownOIDCProvider)
+	})
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountService_UpdateAccount(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	mailer := internal.NewMemoryMailer()
+	service := internal.NewService(repo, testKeys, mailer, internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	_, err := service.Register(ctx, "Alice", "alice@example.com", "password123", auth.RoleCustomer)
+	require.NoError(t, err)
+	_, err = service.Register(ctx, "Bob", "bob@example.com", "password123", auth.RoleCustomer)
+	require.NoError(t, err)
+	account, err := repo.GetAccountByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.NoError(t, repo.SetEmailVerified(ctx, account.ID))
+
+	t.Run("name only", func(t *testing.T) {
+		updated, err := service.UpdateAccount(ctx, account.ID, "Alice Smith", "")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice Smith", updated.Name)
+		assert.Equal(t, "alice@example.com", updated.Email)
+		assert.True(t, updated.EmailVerified)
+	})
+
+	t.Run("email in use", func(t *testing.T) {
+		_, err := service.UpdateAccount(ctx, account.ID, "", "bob@example.com")
+		assert.ErrorIs(t, err, internal.ErrEmailTaken)
+	})
+
+	t.Run("new email must be verified again", func(t *testing.T) {
+		updated, err := service.UpdateAccount(ctx, account.ID, "", "alice@example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.org", updated.Email)
+		assert.False(t, updated.EmailVerified)
+
+		require.NoError(t, service.VerifyEmail(ctx, tokenFromMail(t, mailer, "alice@example.org")))
+		stored, err := repo.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Alice Smith", stored.Name)
+		assert.True(t, stored.EmailVerified)
+	})
+}
+
+func TestAccountService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	email := "change@example.com"
+	current, err := service.Register(ctx, "Change User", email, "old-password", auth.RoleCustomer)
+	require.NoError(t, err)
+	result, err := service.Login(ctx, email, "old-password", "")
+	require.NoError(t, err)
+	other := result.Tokens
+	account, err := repo.GetAccountByEmail(ctx, email)
+	require.NoError(t, err)
+
+	err = service.ChangePassword(ctx, account.ID, "wrong-password", "new-password", current.RefreshToken)
+	assert.ErrorIs(t, err, internal.ErrIncorrectPassword)
+
+	err = service.ChangePassword(ctx, account.ID, "old-password", "new-password", current.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = service.Login(ctx, email, "old-password", "")
+	assert.Error(t, err)
+	_, err = service.Login(ctx, email, "new-password", "")
+	assert.NoError(t, err)
+
+	_, err = service.RefreshToken(ctx, current.RefreshToken)
+	assert.NoError(t, err, "the current session stays signed in")
+	_, err = service.RefreshToken(ctx, other.RefreshToken)
+	assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+}
+
+func TestAccountService_DeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	producer := mocks.NewAsyncProducer(t, nil)
+	defer producer.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), producer, nil)
+
+	email := "delete@example.com"
+	tokens, err := service.Register(ctx, "Delete User", email, "password123", auth.RoleCustomer)
+	require.NoError(t, err)
+	account, err := repo.GetAccountByEmail(ctx, email)
+	require.NoError(t, err)
+
+	err = service.DeleteAccount(ctx, account.ID, "wrong-password")
+	assert.ErrorIs(t, err, internal.ErrIncorrectPassword)
+
+	published := make(chan models.Event, 1)
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "account_events", msg.Topic)
+		value, err := msg.Value.Encode()
+		require.NoError(t, err)
+		var event models.Event
+		require.NoError(t, json.Unmarshal(value, &event))
+		published <- event
+		return nil
+	})
+	require.NoError(t, service.DeleteAccount(ctx, account.ID, "password123"))
+
+	event := <-published
+	assert.Equal(t, "account_deleted", event.Type)
+	assert.Equal(t, account.ID, event.Data.AccountID)
+
+	_, err = repo.GetAccountByID(ctx, account.ID)
+	assert.Error(t, err)
+	_, err = service.RefreshToken(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+	_, err = service.Login(ctx, email, "password123", "")
+	assert.ErrorIs(t, err, internal.ErrInvalidCredentials)
+}
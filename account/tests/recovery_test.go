@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tokenLinkPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// tokenFromMail extracts the token from the action link in the last email sent.
+func tokenFromMail(t *testing.T, mailer *internal.MemoryMailer, to string) string {
+	message, ok := mailer.Last()
+	require.True(t, ok, "no email sent")
+	assert.Equal(t, to, message.To)
+
+	match := tokenLinkPattern.FindStringSubmatch(message.Body)
+	require.Len(t, match, 2, "no link in email body")
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestAccountService_PasswordReset(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	mailer := internal.NewMemoryMailer()
+	service := internal.NewService(repo, testKeys, mailer, internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	email := "reset@example.com"
+	session, err := service.Register(ctx, "Reset User", email, "old-password", auth.RoleCustomer)
+	require.NoError(t, err)
+
+	t.Run("unknown email is not reported", func(t *testing.T) {
+		sent := len(mailer.Messages())
+		err := service.RequestPasswordReset(ctx, "nobody@example.com")
+		assert.NoError(t, err)
+		assert.Len(t, mailer.Messages(), sent)
+	})
+
+	t.Run("only the latest link works", func(t *testing.T) {
+		require.NoError(t, service.RequestPasswordReset(ctx, email))
+		stale := tokenFromMail(t, mailer, email)
+		require.NoError(t, service.RequestPasswordReset(ctx, email))
+
+		err := service.ResetPassword(ctx, stale, "new-password")
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+
+	t.Run("successful reset", func(t *testing.T) {
+		require.NoError(t, service.RequestPasswordReset(ctx, email))
+		token := tokenFromMail(t, mailer, email)
+
+		err := service.ResetPassword(ctx, token, "new-password")
+		require.NoError(t, err)
+
+		_, err = service.Login(ctx, email, "old-password", "")
+		assert.Error(t, err)
+		_, err = service.Login(ctx, email, "new-password", "")
+		assert.NoError(t, err)
+
+		_, err = service.RefreshToken(ctx, session.RefreshToken)
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+
+		err = service.ResetPassword(ctx, token, "another-password")
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+
+	t.Run("empty password", func(t *testing.T) {
+		require.NoError(t, service.RequestPasswordReset(ctx, email))
+		token := tokenFromMail(t, mailer, email)
+
+		err := service.ResetPassword(ctx, token, "")
+		assert.ErrorIs(t, err, internal.ErrPasswordRequired)
+	})
+}
+
+func TestAccountService_VerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	mailer := internal.NewMemoryMailer()
+	service := internal.NewService(repo, testKeys, mailer, internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	email := "verify@example.com"
+	_, err := service.Register(ctx, "Verify User", email, "password123", auth.RoleCustomer)
+	require.NoError(t, err)
+	account, err := repo.GetAccountByEmail(ctx, email)
+	require.NoError(t, err)
+	assert.False(t, account.EmailVerified)
+
+	t.Run("registration sends a verification email", func(t *testing.T) {
+		token := tokenFromMail(t, mailer, email)
+
+		err := service.VerifyEmail(ctx, token)
+		require.NoError(t, err)
+
+		verified, err := service.GetAccount(ctx, account.ID)
+		require.NoError(t, err)
+		assert.True(t, verified.EmailVerified)
+
+		err = service.VerifyEmail(ctx, token)
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+
+	t.Run("already verified", func(t *testing.T) {
+		err := service.SendVerificationEmail(ctx, account.ID)
+		assert.ErrorIs(t, err, internal.ErrEmailAlreadyVerified)
+	})
+
+	t.Run("reset tokens cannot verify an email", func(t *testing.T) {
+		require.NoError(t, service.RequestPasswordReset(ctx, email))
+		token := tokenFromMail(t, mailer, email)
+
+		err := service.VerifyEmail(ctx, token)
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+}
+
+func TestRepository_ConsumeAccountToken(t *testing.T) {
+	repo := setupTestRepository(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	require.NoError(t, repo.PutAccountToken(ctx, &models.AccountToken{
+		AccountID: 1,
+		Purpose:   models.PasswordResetPurpose,
+		TokenHash: "expired-hash",
+	}))
+
+	_, err := repo.ConsumeAccountToken(ctx, "expired-hash", models.PasswordResetPurpose)
+	assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+}
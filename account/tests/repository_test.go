@@ -286,6 +286,83 @@ func TestRepository_Close(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestRepository_RotateRefreshToken(t *testing.T) {
+	repo := setupTestRepository(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	current := &models.RefreshToken{
+		AccountID: 1,
+		FamilyID:  "family",
+		TokenHash: "current-hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	require.NoError(t, repo.PutRefreshToken(ctx, current))
+
+	t.Run("successful rotation", func(t *testing.T) {
+		next := &models.RefreshToken{
+			AccountID: 1,
+			FamilyID:  "family",
+			TokenHash: "next-hash",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		err := repo.RotateRefreshToken(ctx, current, next)
+		assert.NoError(t, err)
+
+		revoked, err := repo.GetRefreshTokenByHash(ctx, "current-hash")
+		assert.NoError(t, err)
+		assert.NotNil(t, revoked.RevokedAt)
+
+		stored, err := repo.GetRefreshTokenByHash(ctx, "next-hash")
+		assert.NoError(t, err)
+		assert.Nil(t, stored.RevokedAt)
+	})
+
+	t.Run("rotating a revoked token fails", func(t *testing.T) {
+		other := &models.RefreshToken{
+			AccountID: 1,
+			FamilyID:  "family",
+			TokenHash: "other-hash",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		err := repo.RotateRefreshToken(ctx, current, other)
+		assert.ErrorIs(t, err, internal.ErrRefreshTokenRevoked)
+
+		_, err = repo.GetRefreshTokenByHash(ctx, "other-hash")
+		assert.Error(t, err)
+	})
+}
+
+func TestRepository_RevokeTokenFamily(t *testing.T) {
+	repo := setupTestRepository(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	tokens := []*models.RefreshToken{
+		{AccountID: 1, FamilyID: "revoked", TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour)},
+		{AccountID: 1, FamilyID: "revoked", TokenHash: "hash-2", ExpiresAt: time.Now().Add(time.Hour)},
+		{AccountID: 1, FamilyID: "kept", TokenHash: "hash-3", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		require.NoError(t, repo.PutRefreshToken(ctx, token))
+	}
+
+	err := repo.RevokeTokenFamily(ctx, "revoked")
+	assert.NoError(t, err)
+
+	for _, hash := range []string{"hash-1", "hash-2"} {
+		token, err := repo.GetRefreshTokenByHash(ctx, hash)
+		assert.NoError(t, err)
+		assert.NotNil(t, token.RevokedAt)
+	}
+
+	kept, err := repo.GetRefreshTokenByHash(ctx, "hash-3")
+	assert.NoError(t, err)
+	assert.Nil(t, kept.RevokedAt)
+}
+
 // Benchmark tests
 func BenchmarkPostgresRepository_PutAccount(b *testing.B) {
 	repo := setupBenchmarkRepository(b)
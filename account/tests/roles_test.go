@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRole_Satisfies(t *testing.T) {
+	assert.True(t, auth.RoleSeller.Satisfies(auth.RoleSeller))
+	assert.False(t, auth.RoleCustomer.Satisfies(auth.RoleSeller, auth.RoleAdmin))
+	assert.True(t, auth.RoleAdmin.Satisfies(auth.RoleSeller))
+
+	role, err := auth.ParseRole("")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.RoleCustomer, role)
+	_, err = auth.ParseRole("superuser")
+	assert.Error(t, err)
+}
+
+func TestAccountService_Roles(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	t.Run("sellers can register", func(t *testing.T) {
+		tokens, err := service.Register(ctx, "Seller", "seller@example.com", "password123", auth.RoleSeller)
+		require.NoError(t, err)
+		assertRole(t, tokens.AccessToken, auth.RoleSeller)
+	})
+
+	t.Run("admins cannot register", func(t *testing.T) {
+		_, err := service.Register(ctx, "Admin", "admin@example.com", "password123", auth.RoleAdmin)
+		assert.ErrorIs(t, err, internal.ErrRoleNotAllowed)
+		_, err = repo.GetAccountByEmail(ctx, "admin@example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("role changes apply on refresh", func(t *testing.T) {
+		tokens, err := service.Register(ctx, "Customer", "customer@example.com", "password123", "")
+		require.NoError(t, err)
+		assertRole(t, tokens.AccessToken, auth.RoleCustomer)
+
+		account, err := repo.GetAccountByEmail(ctx, "customer@example.com")
+		require.NoError(t, err)
+		updated, err := service.SetAccountRole(ctx, account.ID, auth.RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, auth.RoleAdmin, updated.Role)
+
+		tokens, err = service.RefreshToken(ctx, tokens.RefreshToken)
+		require.NoError(t, err)
+		assertRole(t, tokens.AccessToken, auth.RoleAdmin)
+	})
+}
+
+func TestRepository_DefaultRole(t *testing.T) {
+	repo := setupTestRepository(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	account, err := repo.PutAccount(ctx, models.Account{Name: "Legacy", Email: "legacy@example.com"})
+	require.NoError(t, err)
+
+	stored, err := repo.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleCustomer, stored.Role)
+}
+
+func TestUnaryServerAuthInterceptor(t *testing.T) {
+	const adminMethod = "/pb.AccountService/GetAccounts"
+	interceptor := middleware.UnaryServerAuthInterceptor(testKeys, middleware.MethodRoles{
+		adminMethod: {auth.RoleAdmin},
+	})
+	handler := func(ctx context.Context, req any) (any, error) {
+		role, _ := auth.GetRole(ctx)
+		return role, nil
+	}
+	call := func(method, token string) (any, error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+	tokenFor := func(role auth.Role) string {
+		token, err := testKeys.GenerateToken(1, role)
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("public methods do not need a token", func(t *testing.T) {
+		_, err := call("/pb.AccountService/GetAccount", "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("restricted methods need a token", func(t *testing.T) {
+		_, err := call(adminMethod, "")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("invalid tokens are rejected", func(t *testing.T) {
+		_, err := call("/pb.AccountService/GetAccount", "not-a-token")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("wrong role is denied", func(t *testing.T) {
+		_, err := call(adminMethod, tokenFor(auth.RoleSeller))
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("caller role reaches the handler", func(t *testing.T) {
+		role, err := call(adminMethod, tokenFor(auth.RoleAdmin))
+		assert.NoError(t, err)
+		assert.Equal(t, auth.RoleAdmin, role)
+	})
+}
+
+func TestUnaryClientAuthInterceptor(t *testing.T) {
+	interceptor := middleware.UnaryClientAuthInterceptor()
+	var forwarded []string
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		forwarded = md.Get("authorization")
+		return nil
+	}
+
+	ctx := context.WithValue(context.Background(), contextkeys.TokenKey, "access-token")
+	require.NoError(t, interceptor(ctx, "/pb.AccountService/GetAccounts", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"Bearer access-token"}, forwarded)
+
+	require.NoError(t, interceptor(context.Background(), "/pb.AccountService/GetAccounts", nil, nil, nil, invoker))
+	assert.Empty(t, forwarded)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/rasadov/EcommerceAPI/account/internal"
 	"github.com/rasadov/EcommerceAPI/account/models"
@@ -14,6 +15,30 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+var testKeys = newTestKeySet()
+
+func newTestKeySet() *auth.KeySet {
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return auth.NewKeySet(key)
+}
+
+func assertAccessTokenFor(t *testing.T, token string, accountID uint64) {
+	parsed, err := auth.ValidateToken(token, testKeys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, accountID, parsed.Claims.(*auth.JWTCustomClaims).UserID)
+	}
+}
+
+func assertRole(t *testing.T, token string, role auth.Role) {
+	parsed, err := auth.ValidateToken(token, testKeys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, role, parsed.Claims.(*auth.JWTCustomClaims).Role)
+	}
+}
+
 // MockRepository implements the Repository interface for testing
 type MockRepository struct {
 	mock.Mock
@@ -39,6 +64,145 @@ func (m *MockRepository) ListAccounts(ctx context.Context, skip, take uint64) ([
 	return args.Get(0).([]*models.Account), args.Error(1)
 }
 
+func (m *MockRepository) PutRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockRepository) RotateRefreshToken(ctx context.Context, current *models.RefreshToken, next *models.RefreshToken) error {
+	args := m.Called(ctx, current, next)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RevokeAccountSessions(ctx context.Context, accountID uint64) error {
+	args := m.Called(ctx, accountID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PutAccountToken(ctx context.Context, token *models.AccountToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ConsumeAccountToken(ctx context.Context, tokenHash string, purpose models.TokenPurpose) (*models.AccountToken, error) {
+	args := m.Called(ctx, tokenHash, purpose)
+	return args.Get(0).(*models.AccountToken), args.Error(1)
+}
+
+func (m *MockRepository) InvalidateAccountTokens(ctx context.Context, accountID uint64, purpose models.TokenPurpose) error {
+	args := m.Called(ctx, accountID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdatePassword(ctx context.Context, accountID uint64, passwordHash string) error {
+	args := m.Called(ctx, accountID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetEmailVerified(ctx context.Context, accountID uint64) error {
+	args := m.Called(ctx, accountID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateRole(ctx context.Context, accountID uint64, role auth.Role) error {
+	args := m.Called(ctx, accountID, role)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetTwoFactorSecret(ctx context.Context, accountID uint64, secret string) error {
+	args := m.Called(ctx, accountID, secret)
+	return args.Error(0)
+}
+
+func (m *MockRepository) EnableTwoFactor(ctx context.Context, accountID uint64, recoveryCodeHashes []string) error {
+	args := m.Called(ctx, accountID, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DisableTwoFactor(ctx context.Context, accountID uint64) error {
+	args := m.Called(ctx, accountID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, accountID uint64, codeHash string) error {
+	args := m.Called(ctx, accountID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateAccount(ctx context.Context, account *models.Account) error {
+	args := m.Called(ctx, account)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RevokeOtherSessions(ctx context.Context, accountID uint64, keepFamilyID string) error {
+	args := m.Called(ctx, accountID, keepFamilyID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteAccount(ctx context.Context, accountID uint64) error {
+	args := m.Called(ctx, accountID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PutAPIKey(ctx context.Context, key *models.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListAPIKeys(ctx context.Context, accountID uint64) ([]*models.APIKey, error) {
+	args := m.Called(ctx, accountID)
+	return args.Get(0).([]*models.APIKey), args.Error(1)
+}
+
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, accountID, keyID uint64) error {
+	args := m.Called(ctx, accountID, keyID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	args := m.Called(ctx, keyHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockRepository) PutOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ConsumeOIDCLogin(ctx context.Context, stateHash, provider string) (*models.OIDCLogin, error) {
+	args := m.Called(ctx, stateHash, provider)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OIDCLogin), args.Error(1)
+}
+
+func (m *MockRepository) GetExternalIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	args := m.Called(ctx, provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExternalIdentity), args.Error(1)
+}
+
+func (m *MockRepository) PutExternalIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
 func (m *MockRepository) Close() {
 
 }
@@ -46,7 +210,7 @@ func (m *MockRepository) Close() {
 func TestAccountService_Register(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockRepository)
-	service := internal.NewService(mockRepo)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
 
 	t.Run("Successful registration", func(t *testing.T) {
 		// Setup
@@ -58,17 +222,17 @@ func TestAccountService_Register(t *testing.T) {
 
 		mockRepo.On("GetAccountByEmail", ctx, email).Return((*models.Account)(nil), errors.New("not found")).Once()
 		mockRepo.On("PutAccount", ctx, mock.AnythingOfType("models.Account")).Return(account, nil).Once()
-		token, err := auth.GenerateToken(account.ID)
-		if err != nil {
-			log.Fatal(err)
-		}
+		mockRepo.On("InvalidateAccountTokens", ctx, account.ID, models.EmailVerificationPurpose).Return(nil).Once()
+		mockRepo.On("PutAccountToken", ctx, mock.AnythingOfType("*models.AccountToken")).Return(nil).Once()
+		mockRepo.On("PutRefreshToken", ctx, mock.AnythingOfType("*models.RefreshToken")).Return(nil).Once()
 
 		// Execute
-		result, err := service.Register(ctx, name, email, password)
+		result, err := service.Register(ctx, name, email, password, auth.RoleCustomer)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, token, result)
+		assertAccessTokenFor(t, result.AccessToken, account.ID)
+		assert.NotEmpty(t, result.RefreshToken)
 		mockRepo.AssertExpectations(t)
 	})
 
@@ -80,7 +244,7 @@ func TestAccountService_Register(t *testing.T) {
 		mockRepo.On("GetAccountByEmail", ctx, email).Return(account, nil).Once()
 
 		// Execute
-		_, err := service.Register(ctx, "Test User", email, "password123")
+		_, err := service.Register(ctx, "Test User", email, "password123", auth.RoleCustomer)
 
 		// Assert
 		assert.Error(t, err)
@@ -92,7 +256,7 @@ func TestAccountService_Register(t *testing.T) {
 func TestAccountService_Login(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockRepository)
-	service := internal.NewService(mockRepo)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
 
 	t.Run("Successful login", func(t *testing.T) {
 		// Setup
@@ -100,19 +264,43 @@ func TestAccountService_Login(t *testing.T) {
 		password := "password123"
 		hashedPassword, _ := crypt.HashPassword(password)
 		account := &models.Account{ID: 1, Email: email, Password: hashedPassword}
-		token, err := auth.GenerateToken(account.ID)
-		if err != nil {
-			log.Fatal(err)
-		}
 
 		mockRepo.On("GetAccountByEmail", ctx, email).Return(account, nil).Once()
+		mockRepo.On("PutRefreshToken", ctx, mock.MatchedBy(func(rt *models.RefreshToken) bool {
+			return rt.AccountID == account.ID && rt.FamilyID != "" && rt.ExpiresAt.After(time.Now())
+		})).Return(nil).Once()
 
 		// Execute
-		result, err := service.Login(ctx, email, password)
+		result, err := service.Login(ctx, email, password, "")
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, token, result)
+		assert.Empty(t, result.ChallengeToken)
+		assertAccessTokenFor(t, result.Tokens.AccessToken, account.ID)
+		assert.NotEmpty(t, result.Tokens.RefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Two-factor accounts get a challenge", func(t *testing.T) {
+		// Setup
+		email := "2fa@example.com"
+		password := "password123"
+		hashedPassword, _ := crypt.HashPassword(password)
+		account := &models.Account{ID: 2, Email: email, Password: hashedPassword, TwoFactorEnabled: true}
+
+		mockRepo.On("GetAccountByEmail", ctx, email).Return(account, nil).Once()
+		mockRepo.On("InvalidateAccountTokens", ctx, account.ID, models.TwoFactorChallengePurpose).Return(nil).Once()
+		mockRepo.On("PutAccountToken", ctx, mock.MatchedBy(func(token *models.AccountToken) bool {
+			return token.Purpose == models.TwoFactorChallengePurpose && token.ExpiresAt.Before(time.Now().Add(10*time.Minute))
+		})).Return(nil).Once()
+
+		// Execute
+		result, err := service.Login(ctx, email, password, "")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Nil(t, result.Tokens)
+		assert.NotEmpty(t, result.ChallengeToken)
 		mockRepo.AssertExpectations(t)
 	})
 
@@ -126,10 +314,173 @@ func TestAccountService_Login(t *testing.T) {
 		mockRepo.On("GetAccountByEmail", ctx, email).Return(account, nil).Once()
 
 		// Execute
-		_, err := service.Login(ctx, email, password)
+		_, err := service.Login(ctx, email, password, "")
 
 		// Assert
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown email", func(t *testing.T) {
+		// Setup
+		email := "unknown@example.com"
+		mockRepo.On("GetAccountByEmail", ctx, email).Return((*models.Account)(nil), errors.New("not found")).Once()
+
+		// Execute
+		_, err := service.Login(ctx, email, "password123", "")
+
+		// Assert
+		assert.ErrorIs(t, err, internal.ErrInvalidCredentials)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAccountService_RefreshToken(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockRepository)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	t.Run("Successful rotation", func(t *testing.T) {
+		// Setup
+		refreshToken := "valid-refresh-token"
+		current := &models.RefreshToken{
+			ID:        1,
+			AccountID: 7,
+			FamilyID:  "family",
+			TokenHash: crypt.HashToken(refreshToken),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		account := &models.Account{ID: 7, Role: auth.RoleSeller}
+
+		mockRepo.On("GetRefreshTokenByHash", ctx, current.TokenHash).Return(current, nil).Once()
+		mockRepo.On("GetAccountByID", ctx, current.AccountID).Return(account, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, current, mock.MatchedBy(func(next *models.RefreshToken) bool {
+			return next.AccountID == current.AccountID && next.FamilyID == current.FamilyID && next.TokenHash != current.TokenHash
+		})).Return(nil).Once()
+
+		// Execute
+		result, err := service.RefreshToken(ctx, refreshToken)
+
+		// Assert
+		assert.NoError(t, err)
+		assertAccessTokenFor(t, result.AccessToken, account.ID)
+		assertRole(t, result.AccessToken, auth.RoleSeller)
+		assert.NotEqual(t, refreshToken, result.RefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		// Setup
+		mockRepo.On("GetRefreshTokenByHash", ctx, crypt.HashToken("unknown")).
+			Return((*models.RefreshToken)(nil), errors.New("not found")).Once()
+
+		// Execute
+		_, err := service.RefreshToken(ctx, "unknown")
+
+		// Assert
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		// Setup
+		refreshToken := "expired-refresh-token"
+		current := &models.RefreshToken{
+			ID:        2,
+			AccountID: 7,
+			FamilyID:  "family",
+			TokenHash: crypt.HashToken(refreshToken),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}
+		mockRepo.On("GetRefreshTokenByHash", ctx, current.TokenHash).Return(current, nil).Once()
+
+		// Execute
+		_, err := service.RefreshToken(ctx, refreshToken)
+
+		// Assert
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reused token revokes family", func(t *testing.T) {
+		// Setup
+		refreshToken := "already-used-refresh-token"
+		revokedAt := time.Now().Add(-time.Minute)
+		current := &models.RefreshToken{
+			ID:        3,
+			AccountID: 7,
+			FamilyID:  "stolen-family",
+			TokenHash: crypt.HashToken(refreshToken),
+			ExpiresAt: time.Now().Add(time.Hour),
+			RevokedAt: &revokedAt,
+		}
+		mockRepo.On("GetRefreshTokenByHash", ctx, current.TokenHash).Return(current, nil).Once()
+		mockRepo.On("RevokeTokenFamily", ctx, "stolen-family").Return(nil).Once()
+
+		// Execute
+		_, err := service.RefreshToken(ctx, refreshToken)
+
+		// Assert
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Concurrent rotation revokes family", func(t *testing.T) {
+		// Setup
+		refreshToken := "raced-refresh-token"
+		current := &models.RefreshToken{
+			ID:        4,
+			AccountID: 7,
+			FamilyID:  "raced-family",
+			TokenHash: crypt.HashToken(refreshToken),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		mockRepo.On("GetRefreshTokenByHash", ctx, current.TokenHash).Return(current, nil).Once()
+		mockRepo.On("GetAccountByID", ctx, current.AccountID).Return(&models.Account{ID: 7}, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, current, mock.AnythingOfType("*models.RefreshToken")).
+			Return(internal.ErrRefreshTokenRevoked).Once()
+		mockRepo.On("RevokeTokenFamily", ctx, "raced-family").Return(nil).Once()
+
+		// Execute
+		_, err := service.RefreshToken(ctx, refreshToken)
+
+		// Assert
+		assert.ErrorIs(t, err, internal.ErrInvalidRefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAccountService_Logout(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockRepository)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	t.Run("Revokes session", func(t *testing.T) {
+		// Setup
+		refreshToken := "session-refresh-token"
+		current := &models.RefreshToken{ID: 1, AccountID: 7, FamilyID: "session", TokenHash: crypt.HashToken(refreshToken)}
+		mockRepo.On("GetRefreshTokenByHash", ctx, current.TokenHash).Return(current, nil).Once()
+		mockRepo.On("RevokeTokenFamily", ctx, "session").Return(nil).Once()
+
+		// Execute
+		err := service.Logout(ctx, refreshToken)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown token is ignored", func(t *testing.T) {
+		// Setup
+		mockRepo.On("GetRefreshTokenByHash", ctx, crypt.HashToken("unknown")).
+			Return((*models.RefreshToken)(nil), errors.New("not found")).Once()
+
+		// Execute
+		err := service.Logout(ctx, "unknown")
+
+		// Assert
+		assert.NoError(t, err)
 		mockRepo.AssertExpectations(t)
 	})
 }
@@ -137,7 +488,7 @@ func TestAccountService_Login(t *testing.T) {
 func TestAccountService_GetAccount(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockRepository)
-	service := internal.NewService(mockRepo)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
 
 	t.Run("Successful get account", func(t *testing.T) {
 		// Setup
@@ -172,7 +523,7 @@ func TestAccountService_GetAccount(t *testing.T) {
 func TestAccountService_GetAccounts(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockRepository)
-	service := internal.NewService(mockRepo)
+	service := internal.NewService(mockRepo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
 
 	t.Run("Successful get accounts with valid parameters", func(t *testing.T) {
 		// Setup
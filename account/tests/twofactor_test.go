@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/account/internal"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 test vectors for SHA1, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := crypt.TOTPCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code)
+	}
+
+	now := time.Unix(1111111109, 0)
+	assert.True(t, crypt.ValidateTOTP(secret, "081804", now.Add(30*time.Second)))
+	assert.False(t, crypt.ValidateTOTP(secret, "081804", now.Add(90*time.Second)))
+	assert.False(t, crypt.ValidateTOTP(secret, "", now))
+
+	uri := crypt.TOTPURI("EcommerceAPI", "alice@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/EcommerceAPI:alice@example.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+}
+
+func TestAccountService_TwoFactor(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	defer repo.Close()
+	service := internal.NewService(repo, testKeys, internal.NewMemoryMailer(), internal.NewMemoryAttemptStore(internal.LoginAttemptWindow), nil, nil)
+
+	email := "seller2fa@example.com"
+	password := "password123"
+	_, err := service.Register(ctx, "Seller", email, password, auth.RoleSeller)
+	require.NoError(t, err)
+	account, err := repo.GetAccountByEmail(ctx, email)
+	require.NoError(t, err)
+
+	_, err = service.ConfirmTwoFactor(ctx, account.ID, "123456")
+	assert.ErrorIs(t, err, internal.ErrTwoFactorNotEnrolled)
+
+	enrollment, err := service.EnrollTwoFactor(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, enrollment.Secret)
+	currentCode := func() string {
+		code, err := crypt.TOTPCode(enrollment.Secret, time.Now())
+		require.NoError(t, err)
+		return code
+	}
+
+	t.Run("pending enrollment does not change login", func(t *testing.T) {
+		result, err := service.Login(ctx, email, password, "")
+		require.NoError(t, err)
+		assert.NotNil(t, result.Tokens)
+	})
+
+	_, err = service.ConfirmTwoFactor(ctx, account.ID, "000000")
+	assert.ErrorIs(t, err, internal.ErrInvalidTwoFactorCode)
+	recoveryCodes, err := service.ConfirmTwoFactor(ctx, account.ID, currentCode())
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, err = service.EnrollTwoFactor(ctx, account.ID)
+	assert.ErrorIs(t, err, internal.ErrTwoFactorEnabled)
+
+	login := func() string {
+		result, err := service.Login(ctx, email, password, "")
+		require.NoError(t, err)
+		require.Nil(t, result.Tokens)
+		return result.ChallengeToken
+	}
+
+	t.Run("login with a TOTP code", func(t *testing.T) {
+		challenge := login()
+		tokens, err := service.VerifyTwoFactor(ctx, challenge, currentCode())
+		require.NoError(t, err)
+		assertAccessTokenFor(t, tokens.AccessToken, account.ID)
+
+		_, err = service.VerifyTwoFactor(ctx, challenge, currentCode())
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+
+	t.Run("a wrong code burns the challenge", func(t *testing.T) {
+		challenge := login()
+		_, err := service.VerifyTwoFactor(ctx, challenge, "000000")
+		assert.ErrorIs(t, err, internal.ErrInvalidTwoFactorCode)
+
+		_, err = service.VerifyTwoFactor(ctx, challenge, currentCode())
+		assert.ErrorIs(t, err, internal.ErrInvalidAccountToken)
+	})
+
+	t.Run("recovery codes are single-use", func(t *testing.T) {
+		tokens, err := service.VerifyTwoFactor(ctx, login(), " "+strings.ToUpper(recoveryCodes[0])+" ")
+		require.NoError(t, err)
+		assertAccessTokenFor(t, tokens.AccessToken, account.ID)
+
+		_, err = service.VerifyTwoFactor(ctx, login(), recoveryCodes[0])
+		assert.ErrorIs(t, err, internal.ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("disable requires a valid code", func(t *testing.T) {
+		err := service.DisableTwoFactor(ctx, account.ID, "000000")
+		assert.ErrorIs(t, err, internal.ErrInvalidTwoFactorCode)
+
+		err = service.DisableTwoFactor(ctx, account.ID, recoveryCodes[1])
+		require.NoError(t, err)
+
+		result, err := service.Login(ctx, email, password, "")
+		require.NoError(t, err)
+		assert.NotNil(t, result.Tokens)
+
+		err = service.DisableTwoFactor(ctx, account.ID, currentCode())
+		assert.ErrorIs(t, err, internal.ErrTwoFactorNotEnabled)
+	})
+}
@@ -5,7 +5,6 @@ go 1.23.4
 require (
 	github.com/99designs/gqlgen v0.17.70
 	github.com/IBM/sarama v1.45.1
-	github.com/deckarep/golang-set/v2 v2.8.0
 	github.com/dodopayments/dodopayments-go v1.38.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/golang-jwt/jwt/v5 v5.2.2
@@ -2,27 +2,57 @@ package main
 
 import (
 	"log"
+	"strings"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gin-gonic/gin"
+	account "github.com/rasadov/EcommerceAPI/account/client"
 	"github.com/rasadov/EcommerceAPI/graphql/config"
 	"github.com/rasadov/EcommerceAPI/graphql/graph"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
 )
 
 func main() {
-	server, err := graph.NewGraphQLServer(config.AccountUrl, config.ProductUrl, config.OrderUrl, config.PaymentUrl, config.RecommenderUrl)
+	var mediaStorage storage.Storage
+	var err error
+	switch config.MediaStorage {
+	case "local":
+		mediaStorage, err = storage.NewLocalStorage(config.MediaDir, config.MediaURL)
+	case "s3":
+		mediaStorage, err = storage.NewS3Storage(config.S3Config)
+	default:
+		log.Fatalf("Unknown media storage %q", config.MediaStorage)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	server, err := graph.NewGraphQLServer(config.AccountUrl, config.ProductUrl, config.OrderUrl, config.PaymentUrl, config.RecommenderUrl, config.ReviewUrl, config.ExportDir, mediaStorage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Tokens are verified with the account service public keys, fetched over gRPC
+	accountClient, err := account.NewClient(config.AccountUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer accountClient.Close()
+	keys := auth.NewRemoteKeySet(accountClient.GetJWKS)
+
 	srv := handler.New(server.ToExecutableSchema())
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.MultipartForm{})
+	srv.AroundFields(graph.RestrictAPIKeys)
 
 	engine := gin.Default()
+	if err = engine.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
 
 	engine.Use(middleware.GinContextToContextMiddleware())
 
@@ -32,9 +62,16 @@ func main() {
 		})
 	})
 	engine.POST("/graphql",
-		middleware.AuthorizeJWT(),
+		middleware.AuthorizeJWT(keys, accountClient),
 		gin.WrapH(srv),
 	)
+	engine.GET("/exports/:id",
+		middleware.AuthorizeJWT(keys, nil),
+		server.Exports().DownloadHandler(),
+	)
+	if config.MediaStorage == "local" && strings.HasPrefix(config.MediaURL, "/") {
+		engine.Static(config.MediaURL, config.MediaDir)
+	}
 	engine.GET("/playground", gin.WrapH(playground.Handler("Playground", "/graphql")))
 
 	log.Fatal(engine.Run(":8080"))
@@ -1,15 +1,33 @@
 package config
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+)
 
 var (
 	AccountUrl     string
 	ProductUrl     string
 	OrderUrl       string
 	PaymentUrl     string
+	ReviewUrl      string
 	RecommenderUrl string
-	SecretKey      string
 	Issuer         string
+	// TrustedProxies lists the proxies allowed to set X-Forwarded-For. Client IPs
+	// are used to throttle logins, so they must not be spoofable.
+	TrustedProxies []string
+	// ExportDir is where data export archives are kept until they expire
+	ExportDir string
+	// MediaStorage selects where product images are kept, "local" or "s3"
+	MediaStorage string
+	// MediaDir is where images are kept with local storage. The gateway serves
+	// them at MediaURL.
+	MediaDir string
+	MediaURL string
+	S3Config storage.S3Config
 )
 
 func init() {
@@ -17,7 +35,35 @@ func init() {
 	ProductUrl = os.Getenv("PRODUCT_SERVICE_URL")
 	OrderUrl = os.Getenv("ORDER_SERVICE_URL")
 	PaymentUrl = os.Getenv("PAYMENT_SERVICE_URL")
+	ReviewUrl = os.Getenv("REVIEW_SERVICE_URL")
 	RecommenderUrl = os.Getenv("RECOMMENDER_SERVICE_URL")
-	SecretKey = os.Getenv("SECRET_KEY")
 	Issuer = os.Getenv("ISSUER")
+	ExportDir = os.Getenv("EXPORT_DIR")
+	if ExportDir == "" {
+		ExportDir = filepath.Join(os.TempDir(), "exports")
+	}
+	MediaStorage = os.Getenv("MEDIA_STORAGE")
+	if MediaStorage == "" {
+		MediaStorage = "local"
+	}
+	MediaDir = os.Getenv("MEDIA_DIR")
+	if MediaDir == "" {
+		MediaDir = filepath.Join(os.TempDir(), "media")
+	}
+	MediaURL = os.Getenv("MEDIA_URL")
+	if MediaURL == "" {
+		MediaURL = "/media"
+	}
+	S3Config = storage.S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		TrustedProxies = strings.Split(proxies, ",")
+	}
 }
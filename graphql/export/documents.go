@@ -0,0 +1,137 @@
+package export
+
+import (
+	"time"
+
+	accountModels "github.com/rasadov/EcommerceAPI/account/models"
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
+	paymentModels "github.com/rasadov/EcommerceAPI/payment/models"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+// The documents below define the archive format. They are kept separate from
+// the service models so internal fields never end up in an export.
+
+type manifestDocument struct {
+	AccountID   uint64    `json:"account_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+type account struct {
+	ID               uint64 `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	EmailVerified    bool   `json:"email_verified"`
+	Role             string `json:"role"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+}
+
+type order struct {
+	ID         uint             `json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	TotalPrice float64          `json:"total_price"`
+	Status     string           `json:"status"`
+	Products   []orderedProduct `json:"products"`
+}
+
+type orderedProduct struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Quantity    uint32  `json:"quantity"`
+}
+
+type product struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type payments struct {
+	CustomerID   string        `json:"customer_id,omitempty"`
+	CreatedAt    *time.Time    `json:"created_at,omitempty"`
+	Transactions []transaction `json:"transactions"`
+}
+
+type transaction struct {
+	OrderID   uint64    `json:"order_id"`
+	ProductID string    `json:"product_id"`
+	PaymentID string    `json:"payment_id"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func accountDocument(a *accountModels.Account) account {
+	return account{
+		ID:               a.ID,
+		Name:             a.Name,
+		Email:            a.Email,
+		EmailVerified:    a.EmailVerified,
+		Role:             string(a.Role),
+		TwoFactorEnabled: a.TwoFactorEnabled,
+	}
+}
+
+func orderDocuments(orders []orderModels.Order) []order {
+	documents := make([]order, 0, len(orders))
+	for _, o := range orders {
+		products := make([]orderedProduct, 0, len(o.Products))
+		for _, p := range o.Products {
+			products = append(products, orderedProduct{
+				ID:          p.ID,
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       p.Price,
+				Quantity:    p.Quantity,
+			})
+		}
+		documents = append(documents, order{
+			ID:         o.ID,
+			CreatedAt:  o.CreatedAt,
+			TotalPrice: o.TotalPrice,
+			Status:     string(o.Status),
+			Products:   products,
+		})
+	}
+	return documents
+}
+
+func productDocuments(products []productModels.Product) []product {
+	documents := make([]product, 0, len(products))
+	for _, p := range products {
+		documents = append(documents, product{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+		})
+	}
+	return documents
+}
+
+func paymentDocument(customer *paymentModels.Customer) payments {
+	document := payments{
+		CustomerID:   customer.CustomerId,
+		Transactions: make([]transaction, 0, len(customer.Transactions)),
+	}
+	if !customer.CreatedAt.IsZero() {
+		document.CreatedAt = &customer.CreatedAt
+	}
+	for _, t := range customer.Transactions {
+		document.Transactions = append(document.Transactions, transaction{
+			OrderID:   t.OrderId,
+			ProductID: t.ProductId,
+			PaymentID: t.PaymentId,
+			Amount:    t.Amount,
+			Currency:  t.Currency,
+			Status:    t.Status,
+			CreatedAt: t.CreatedAt,
+		})
+	}
+	return document
+}
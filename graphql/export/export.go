@@ -0,0 +1,276 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	accountModels "github.com/rasadov/EcommerceAPI/account/models"
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
+	paymentModels "github.com/rasadov/EcommerceAPI/payment/models"
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+const (
+	// ArchiveTTL is how long a finished export can be downloaded.
+	ArchiveTTL = 24 * time.Hour
+	// jobTimeout bounds the calls made to the services for one export.
+	jobTimeout = 2 * time.Minute
+	// productPageSize is how many products are fetched per call, the most the
+	// product service returns at once.
+	productPageSize = 100
+)
+
+var (
+	ErrNotFound = errors.New("export not found")
+)
+
+// Job is an export of the data held about one account.
+type Job struct {
+	ID          string
+	AccountID   uint64
+	RequestedBy uint64
+	Status      Status
+	Error       string
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+type AccountSource interface {
+	GetAccount(ctx context.Context, id uint64) (*accountModels.Account, error)
+}
+
+type OrderSource interface {
+	GetOrdersForAccount(ctx context.Context, accountID uint64) ([]orderModels.Order, error)
+}
+
+type ProductSource interface {
+	ListProductsByAccount(ctx context.Context, accountId int64, skip, take uint64) ([]productModels.Product, error)
+}
+
+type PaymentSource interface {
+	GetCustomerData(ctx context.Context, userId uint64) (*paymentModels.Customer, error)
+}
+
+// Sources are the services an export collects data from. The service clients
+// implement these interfaces.
+type Sources struct {
+	Accounts AccountSource
+	Orders   OrderSource
+	Products ProductSource
+	Payments PaymentSource
+}
+
+// Orchestrator runs exports in the background and keeps the archives in dir
+// until they expire. Jobs are kept in memory, so they are lost on restart.
+type Orchestrator struct {
+	sources Sources
+	dir     string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewOrchestrator(sources Sources, dir string) (*Orchestrator, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Orchestrator{
+		sources: sources,
+		dir:     dir,
+		jobs:    make(map[string]*Job),
+	}, nil
+}
+
+// Start queues an export of accountID. An export of the same account by the same
+// caller that is still in progress is returned instead of starting another one.
+func (o *Orchestrator) Start(ctx context.Context, accountID, requestedBy uint64) (*Job, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.removeExpired()
+
+	for _, job := range o.jobs {
+		if job.AccountID == accountID && job.RequestedBy == requestedBy && (job.Status == StatusPending || job.Status == StatusRunning) {
+			copied := *job
+			return &copied, nil
+		}
+	}
+
+	id, err := crypt.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:          id,
+		AccountID:   accountID,
+		RequestedBy: requestedBy,
+		Status:      StatusPending,
+		CreatedAt:   time.Now().UTC(),
+	}
+	o.jobs[id] = job
+
+	// The export outlives the request, but keeps its values such as the caller's token
+	go o.run(context.WithoutCancel(ctx), id)
+
+	copied := *job
+	return &copied, nil
+}
+
+// Get returns a snapshot of the job.
+func (o *Orchestrator) Get(id string) (*Job, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.removeExpired()
+
+	job, ok := o.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (o *Orchestrator) run(ctx context.Context, id string) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	job := o.setStatus(id, StatusRunning, nil)
+	err := o.writeArchive(ctx, job.AccountID, o.archivePath(id))
+	if err != nil {
+		log.Printf("Export %s for account %d failed: %v", id, job.AccountID, err)
+		_ = os.Remove(o.archivePath(id))
+		o.setStatus(id, StatusFailed, err)
+		return
+	}
+	o.setStatus(id, StatusCompleted, nil)
+}
+
+func (o *Orchestrator) setStatus(id string, status Status, err error) Job {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	job := o.jobs[id]
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == StatusCompleted || status == StatusFailed {
+		now := time.Now().UTC()
+		job.CompletedAt = &now
+	}
+	return *job
+}
+
+// removeExpired forgets finished jobs older than ArchiveTTL and deletes their
+// archives. The caller must hold o.mu.
+func (o *Orchestrator) removeExpired() {
+	for id, job := range o.jobs {
+		if job.CompletedAt == nil || time.Since(*job.CompletedAt) < ArchiveTTL {
+			continue
+		}
+		if err := os.Remove(o.archivePath(id)); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove expired export:", err)
+		}
+		delete(o.jobs, id)
+	}
+}
+
+func (o *Orchestrator) archivePath(id string) string {
+	return filepath.Join(o.dir, id+".zip")
+}
+
+// writeArchive collects the data of every source and writes it as a ZIP of
+// JSON documents, one per service, plus a manifest.
+func (o *Orchestrator) writeArchive(ctx context.Context, accountID uint64, path string) error {
+	account, err := o.sources.Accounts.GetAccount(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("account service: %w", err)
+	}
+	orders, err := o.sources.Orders.GetOrdersForAccount(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("order service: %w", err)
+	}
+	products, err := o.listProducts(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("product service: %w", err)
+	}
+	customer, err := o.sources.Payments.GetCustomerData(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("payment service: %w", err)
+	}
+
+	documents := []struct {
+		name string
+		data any
+	}{
+		{"account.json", accountDocument(account)},
+		{"orders.json", orderDocuments(orders)},
+		{"products.json", productDocuments(products)},
+		{"payments.json", paymentDocument(customer)},
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+
+	manifest := manifestDocument{AccountID: accountID, GeneratedAt: time.Now().UTC()}
+	for _, document := range documents {
+		if err = writeJSON(archive, document.name, document.data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, document.name)
+	}
+	if err = writeJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// listProducts pages through the catalog of the account, which is empty unless
+// it is a seller.
+func (o *Orchestrator) listProducts(ctx context.Context, accountID uint64) ([]productModels.Product, error) {
+	var products []productModels.Product
+	for skip := uint64(0); ; skip += productPageSize {
+		page, err := o.sources.Products.ListProductsByAccount(ctx, int64(accountID), skip, productPageSize)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, page...)
+		if len(page) < productPageSize {
+			return products, nil
+		}
+	}
+}
+
+func writeJSON(archive *zip.Writer, name string, data any) error {
+	writer, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,351 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	accountModels "github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/graphql/export"
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
+	paymentModels "github.com/rasadov/EcommerceAPI/payment/models"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+var (
+	orderedAt = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	paidAt    = time.Date(2025, 3, 1, 12, 5, 0, 0, time.UTC)
+)
+
+// fakeSources answers for account 7, a seller with 250 products. Calls wait
+// for release when it is set, and fail with err when it is set.
+type fakeSources struct {
+	release chan struct{}
+	err     error
+}
+
+func (f *fakeSources) wait(ctx context.Context) error {
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (f *fakeSources) GetAccount(ctx context.Context, id uint64) (*accountModels.Account, error) {
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &accountModels.Account{
+		ID:               id,
+		Name:             "Ada",
+		Email:            "ada@example.com",
+		Password:         "$2a$10$hash",
+		EmailVerified:    true,
+		Role:             auth.RoleSeller,
+		TwoFactorSecret:  "JBSWY3DPEHPK3PXP",
+		TwoFactorEnabled: true,
+	}, nil
+}
+
+func (f *fakeSources) GetOrdersForAccount(ctx context.Context, accountID uint64) ([]orderModels.Order, error) {
+	return []orderModels.Order{{
+		ID:         3,
+		CreatedAt:  orderedAt,
+		TotalPrice: 85,
+		AccountID:  accountID,
+		Status:     orderModels.StatusPaid,
+		Products: []*orderModels.OrderedProduct{
+			{ID: "lamp", Name: "Lamp", Description: "A desk lamp", Price: 40, Quantity: 2},
+			{ID: "pen", Name: "Pen", Price: 5, Quantity: 1},
+		},
+	}}, nil
+}
+
+func (f *fakeSources) ListProductsByAccount(ctx context.Context, accountID int64, skip, take uint64) ([]productModels.Product, error) {
+	var products []productModels.Product
+	for i := skip; i < min(skip+take, 250); i++ {
+		products = append(products, productModels.Product{
+			ID:        fmt.Sprintf("product-%d", i),
+			Name:      fmt.Sprintf("Product %d", i),
+			Price:     float64(i),
+			AccountID: int(accountID),
+		})
+	}
+	return products, nil
+}
+
+func (f *fakeSources) GetCustomerData(ctx context.Context, userID uint64) (*paymentModels.Customer, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &paymentModels.Customer{
+		UserId:     userID,
+		CustomerId: "cus_123",
+		CreatedAt:  orderedAt,
+		Transactions: []paymentModels.Transaction{{
+			CreatedAt:  paidAt,
+			OrderId:    3,
+			UserId:     userID,
+			CustomerId: "cus_123",
+			ProductId:  "lamp",
+			PaymentId:  "pay_456",
+			Amount:     8500,
+			Currency:   "USD",
+			Status:     "Success",
+		}},
+	}, nil
+}
+
+func setupOrchestrator(t *testing.T, sources *fakeSources) *export.Orchestrator {
+	t.Helper()
+	o, err := export.NewOrchestrator(export.Sources{
+		Accounts: sources,
+		Orders:   sources,
+		Products: sources,
+		Payments: sources,
+	}, t.TempDir())
+	require.NoError(t, err)
+	return o
+}
+
+// waitForJob polls the job until it is finished.
+func waitForJob(t *testing.T, o *export.Orchestrator, id string) *export.Job {
+	t.Helper()
+	var job *export.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = o.Get(id)
+		require.NoError(t, err)
+		return job.Status == export.StatusCompleted || job.Status == export.StatusFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+// download requests an archive as callerID.
+func download(o *export.Orchestrator, id string, callerID uint64) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/exports/:id", func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), contextkeys.UserIDKey, callerID)
+		c.Request = c.Request.WithContext(ctx)
+	}, o.DownloadHandler())
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/exports/"+id, nil))
+	return recorder
+}
+
+// readArchive returns the files of a ZIP archive by name.
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		files[file.Name] = content
+	}
+	return files
+}
+
+func TestOrchestrator_Archive(t *testing.T) {
+	ctx := context.Background()
+	o := setupOrchestrator(t, &fakeSources{})
+
+	job, err := o.Start(ctx, 7, 7)
+	require.NoError(t, err)
+	job = waitForJob(t, o, job.ID)
+	require.Equal(t, export.StatusCompleted, job.Status, job.Error)
+	require.NotNil(t, job.CompletedAt)
+
+	res := download(o, job.ID, 7)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Header().Get("Content-Disposition"), `filename="account-7-export.zip"`)
+	files := readArchive(t, res.Body.Bytes())
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"account.json", "manifest.json", "orders.json", "payments.json", "products.json"}, names)
+
+	// Credentials never end up in an export
+	assert.JSONEq(t, `{
+		"id": 7,
+		"name": "Ada",
+		"email": "ada@example.com",
+		"email_verified": true,
+		"role": "seller",
+		"two_factor_enabled": true
+	}`, string(files["account.json"]))
+
+	assert.JSONEq(t, `[{
+		"id": 3,
+		"created_at": "2025-03-01T12:00:00Z",
+		"total_price": 85,
+		"status": "paid",
+		"products": [
+			{"id": "lamp", "name": "Lamp", "description": "A desk lamp", "price": 40, "quantity": 2},
+			{"id": "pen", "name": "Pen", "description": "", "price": 5, "quantity": 1}
+		]
+	}]`, string(files["orders.json"]))
+
+	assert.JSONEq(t, `{
+		"customer_id": "cus_123",
+		"created_at": "2025-03-01T12:00:00Z",
+		"transactions": [{
+			"order_id": 3,
+			"product_id": "lamp",
+			"payment_id": "pay_456",
+			"amount": 8500,
+			"currency": "USD",
+			"status": "Success",
+			"created_at": "2025-03-01T12:05:00Z"
+		}]
+	}`, string(files["payments.json"]))
+
+	// Every page of the catalog is exported
+	var products []map[string]any
+	require.NoError(t, json.Unmarshal(files["products.json"], &products))
+	require.Len(t, products, 250)
+	assert.Equal(t, map[string]any{"id": "product-249", "name": "Product 249", "description": "", "price": 249.0}, products[249])
+
+	var manifest struct {
+		AccountID   uint64    `json:"account_id"`
+		GeneratedAt time.Time `json:"generated_at"`
+		Files       []string  `json:"files"`
+	}
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, uint64(7), manifest.AccountID)
+	assert.WithinDuration(t, time.Now(), manifest.GeneratedAt, time.Minute)
+	assert.Equal(t, []string{"account.json", "orders.json", "products.json", "payments.json"}, manifest.Files)
+}
+
+func TestOrchestrator_EmptyAccount(t *testing.T) {
+	ctx := context.Background()
+	sources := &fakeSources{}
+	o, err := export.NewOrchestrator(export.Sources{
+		Accounts: sources,
+		Orders:   emptyOrders{},
+		Products: emptyProducts{},
+		Payments: noCustomer{},
+	}, t.TempDir())
+	require.NoError(t, err)
+
+	job, err := o.Start(ctx, 8, 8)
+	require.NoError(t, err)
+	require.Equal(t, export.StatusCompleted, waitForJob(t, o, job.ID).Status)
+
+	files := readArchive(t, download(o, job.ID, 8).Body.Bytes())
+	// Empty lists are exported as such rather than as null
+	assert.JSONEq(t, `[]`, string(files["orders.json"]))
+	assert.JSONEq(t, `[]`, string(files["products.json"]))
+	assert.JSONEq(t, `{"transactions": []}`, string(files["payments.json"]))
+}
+
+type emptyOrders struct{}
+
+func (emptyOrders) GetOrdersForAccount(ctx context.Context, accountID uint64) ([]orderModels.Order, error) {
+	return nil, nil
+}
+
+type emptyProducts struct{}
+
+func (emptyProducts) ListProductsByAccount(ctx context.Context, accountID int64, skip, take uint64) ([]productModels.Product, error) {
+	return nil, nil
+}
+
+type noCustomer struct{}
+
+func (noCustomer) GetCustomerData(ctx context.Context, userID uint64) (*paymentModels.Customer, error) {
+	return &paymentModels.Customer{}, nil
+}
+
+func TestOrchestrator_SourceFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sources := &fakeSources{err: errors.New("connection refused")}
+	o, err := export.NewOrchestrator(export.Sources{
+		Accounts: sources,
+		Orders:   sources,
+		Products: sources,
+		Payments: sources,
+	}, dir)
+	require.NoError(t, err)
+
+	job, err := o.Start(ctx, 7, 7)
+	require.NoError(t, err)
+	job = waitForJob(t, o, job.ID)
+	assert.Equal(t, export.StatusFailed, job.Status)
+	assert.Equal(t, "payment service: connection refused", job.Error)
+
+	// No partial archive is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, http.StatusConflict, download(o, job.ID, 7).Code)
+}
+
+func TestOrchestrator_Start(t *testing.T) {
+	ctx := context.Background()
+	sources := &fakeSources{release: make(chan struct{})}
+	o := setupOrchestrator(t, sources)
+
+	first, err := o.Start(ctx, 7, 7)
+	require.NoError(t, err)
+	assert.Equal(t, export.StatusPending, first.Status)
+
+	// An export in progress is reused by the same caller only
+	again, err := o.Start(ctx, 7, 7)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID)
+	byAdmin, err := o.Start(ctx, 7, 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, byAdmin.ID)
+
+	// The archive is only served once complete, and only to its requester
+	assert.Equal(t, http.StatusConflict, download(o, first.ID, 7).Code)
+	assert.Equal(t, http.StatusNotFound, download(o, first.ID, 1).Code)
+	assert.Equal(t, http.StatusNotFound, download(o, "missing", 7).Code)
+
+	close(sources.release)
+	waitForJob(t, o, first.ID)
+	waitForJob(t, o, byAdmin.ID)
+	assert.Equal(t, http.StatusOK, download(o, first.ID, 7).Code)
+	assert.Equal(t, http.StatusNotFound, download(o, first.ID, 1).Code)
+	assert.Equal(t, http.StatusOK, download(o, byAdmin.ID, 1).Code)
+
+	// A finished export does not stop a new one
+	next, err := o.Start(ctx, 7, 7)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, next.ID)
+	waitForJob(t, o, next.ID)
+
+	_, err = o.Get("missing")
+	assert.ErrorIs(t, err, export.ErrNotFound)
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+)
+
+// DownloadHandler serves a completed archive to the account that requested it.
+// It expects the caller to be authenticated by middleware.AuthorizeJWT.
+func (o *Orchestrator) DownloadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		callerID, err := auth.GetUserIdInt(c.Request.Context(), false)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		// Exports of other accounts are reported as missing so their IDs cannot be probed
+		job, err := o.Get(c.Param("id"))
+		if err != nil || job.RequestedBy != uint64(callerID) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": ErrNotFound.Error()})
+			return
+		}
+		if job.Status != StatusCompleted {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("export is %s", job.Status)})
+			return
+		}
+		c.FileAttachment(o.archivePath(job.ID), fmt.Sprintf("account-%d-export.zip", job.AccountID))
+	}
+}
@@ -3,7 +3,10 @@ package graph
 import (
 	"context"
 	"log"
+	"strings"
 	"time"
+
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
 )
 
 type accountResolver struct {
@@ -25,24 +28,86 @@ func (resolver *accountResolver) Orders(ctx context.Context, obj *Account) ([]*O
 	}
 
 	var orders []*Order
-	for _, order := range orderList {
-		var products []*OrderedProduct
-		for _, orderedProduct := range order.Products {
-			products = append(products, &OrderedProduct{
-				ID:          orderedProduct.ID,
-				Name:        orderedProduct.Name,
-				Description: orderedProduct.Description,
-				Price:       orderedProduct.Price,
-				Quantity:    int(orderedProduct.Quantity),
-			})
-		}
-		orders = append(orders, &Order{
-			ID:         int(order.ID),
-			CreatedAt:  order.CreatedAt,
-			TotalPrice: order.TotalPrice,
-			Products:   products,
-		})
+	for i := range orderList {
+		orders = append(orders, orderFromModel(&orderList[i]))
 	}
 
 	return orders, nil
 }
+
+func (status OrderStatus) toModel() orderModels.OrderStatus {
+	return orderModels.OrderStatus(strings.ToLower(string(status)))
+}
+
+func orderStatusFromModel(status orderModels.OrderStatus) OrderStatus {
+	return OrderStatus(strings.ToUpper(string(status)))
+}
+
+func orderFromModel(order *orderModels.Order) *Order {
+	res := &Order{
+		ID:            int(order.ID),
+		CreatedAt:     order.CreatedAt,
+		TotalPrice:    order.TotalPrice,
+		Status:        orderStatusFromModel(order.Status),
+		Products:      make([]*OrderedProduct, 0, len(order.Products)),
+		StatusHistory: make([]*OrderStatusChange, 0, len(order.StatusHistory)),
+	}
+	for _, orderedProduct := range order.Products {
+		res.Products = append(res.Products, orderedProductFromModel(orderedProduct))
+	}
+	for _, change := range order.StatusHistory {
+		c := &OrderStatusChange{
+			To:        orderStatusFromModel(change.To),
+			ChangedAt: change.ChangedAt,
+		}
+		if change.From != "" {
+			from := orderStatusFromModel(change.From)
+			c.From = &from
+		}
+		if change.Reason != "" {
+			c.Reason = &change.Reason
+		}
+		res.StatusHistory = append(res.StatusHistory, c)
+	}
+	return res
+}
+
+func orderedProductFromModel(orderedProduct *orderModels.OrderedProduct) *OrderedProduct {
+	res := &OrderedProduct{
+		ID:          orderedProduct.ID,
+		Name:        orderedProduct.Name,
+		Description: orderedProduct.Description,
+		Price:       orderedProduct.Price,
+		Quantity:    int(orderedProduct.Quantity),
+	}
+	if orderedProduct.SKU != "" {
+		res.Sku = &orderedProduct.SKU
+	}
+	if orderedProduct.Currency != "" {
+		res.Currency = &orderedProduct.Currency
+	}
+	return res
+}
+
+// Products lists the catalog of a seller. Its drafts and archived products are
+// only listed when the seller asks for them. Other accounts have no products.
+func (resolver *accountResolver) Products(ctx context.Context, obj *Account, pagination *PaginationInput) ([]*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+	productList, err := resolver.server.productClient.ListProductsByAccount(ctx, int64(obj.ID), skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	products := make([]*Product, 0, len(productList))
+	for _, product := range productList {
+		products = append(products, productFromModel(&product))
+	}
+	return products, nil
+}
@@ -0,0 +1,50 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"time"
+
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+type categoryResolver struct {
+	server *Server
+}
+
+func (resolver *categoryResolver) Children(ctx context.Context, obj *Category) ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	categoryList, err := resolver.server.productClient.GetCategories(ctx, obj.ID, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoriesFromModels(categoryList), nil
+}
+
+func categoryFromModel(category *productModels.Category) *Category {
+	var parentID *string
+	if category.ParentID != "" {
+		parentID = &category.ParentID
+	}
+	path := category.Path
+	if path == nil {
+		path = []string{}
+	}
+	return &Category{
+		ID:       category.ID,
+		Name:     category.Name,
+		ParentID: parentID,
+		Path:     path,
+	}
+}
+
+func categoriesFromModels(categoryList []productModels.Category) []*Category {
+	categories := make([]*Category, 0, len(categoryList))
+	for i := range categoryList {
+		categories = append(categories, categoryFromModel(&categoryList[i]))
+	}
+	return categories
+}
@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+)
+
+// hasRole implements the @hasRole directive. The services enforce the same
+// roles on their RPCs, this rejects the request before any of them is called.
+func hasRole(ctx context.Context, obj interface{}, next graphql.Resolver, roles []Role) (interface{}, error) {
+	required := make([]auth.Role, 0, len(roles))
+	for _, role := range roles {
+		required = append(required, role.toAuth())
+	}
+	if err := middleware.RequireRole(ctx, required...); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// hasScope implements the @hasScope directive. Callers authenticated with a
+// session are not limited by scopes.
+func hasScope(ctx context.Context, obj interface{}, next graphql.Resolver, scopes []Scope) (interface{}, error) {
+	for _, scope := range scopes {
+		if auth.HasScope(ctx, scope.toAuth()) {
+			return next(ctx)
+		}
+	}
+	return nil, middleware.ErrForbidden
+}
+
+// RestrictAPIKeys only lets callers authenticated with an API key use the Query
+// and Mutation fields marked with @hasScope, so new fields are not exposed to
+// API keys by accident. It is installed with handler.Server.AroundFields.
+func RestrictAPIKeys(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	if _, limited := auth.GetScopes(ctx); !limited {
+		return next(ctx)
+	}
+	field := graphql.GetFieldContext(ctx)
+	if field == nil || (field.Object != "Query" && field.Object != "Mutation") || strings.HasPrefix(field.Field.Name, "__") {
+		return next(ctx)
+	}
+	if field.Field.Definition == nil || field.Field.Definition.Directives.ForName("hasScope") == nil {
+		return nil, middleware.ErrForbidden
+	}
+	return next(ctx)
+}
+
+func (scope Scope) toAuth() auth.Scope {
+	return auth.Scope(strings.ReplaceAll(strings.ToLower(string(scope)), "_", ":"))
+}
+
+func scopeFromAuth(scope auth.Scope) Scope {
+	return Scope(strings.ReplaceAll(strings.ToUpper(string(scope)), ":", "_"))
+}
+
+func (role Role) toAuth() auth.Role {
+	return auth.Role(strings.ToLower(string(role)))
+}
+
+func roleFromAuth(role auth.Role) Role {
+	if role == "" {
+		return RoleCustomer
+	}
+	return Role(strings.ToUpper(string(role)))
+}
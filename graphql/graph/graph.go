@@ -4,10 +4,14 @@ import (
 	"github.com/99designs/gqlgen/graphql"
 
 	account "github.com/rasadov/EcommerceAPI/account/client"
+	"github.com/rasadov/EcommerceAPI/graphql/export"
+	"github.com/rasadov/EcommerceAPI/graphql/media"
 	order "github.com/rasadov/EcommerceAPI/order/client"
 	payment "github.com/rasadov/EcommerceAPI/payment/client"
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
 	product "github.com/rasadov/EcommerceAPI/product/client"
 	recommender "github.com/rasadov/EcommerceAPI/recommender/client"
+	review "github.com/rasadov/EcommerceAPI/review/client"
 )
 
 type Server struct {
@@ -16,9 +20,12 @@ type Server struct {
 	orderClient       *order.Client
 	paymentClient     *payment.Client
 	recommenderClient *recommender.Client
+	reviewClient      *review.Client
+	exports           *export.Orchestrator
+	media             *media.Store
 }
 
-func NewGraphQLServer(accountUrl, productUrl, orderUrl, paymentUrl, recommenderUrl string) (*Server, error) {
+func NewGraphQLServer(accountUrl, productUrl, orderUrl, paymentUrl, recommenderUrl, reviewUrl, exportDir string, mediaStorage storage.Storage) (*Server, error) {
 	accClient, err := account.NewClient(accountUrl)
 	if err != nil {
 		return nil, err
@@ -53,15 +60,49 @@ func NewGraphQLServer(accountUrl, productUrl, orderUrl, paymentUrl, recommenderU
 		return nil, err
 	}
 
+	revClient, err := review.NewClient(reviewUrl)
+	if err != nil {
+		accClient.Close()
+		prodClient.Close()
+		ordClient.Close()
+		paymentClient.Close()
+		recClient.Close()
+		return nil, err
+	}
+
+	exports, err := export.NewOrchestrator(export.Sources{
+		Accounts: accClient,
+		Orders:   ordClient,
+		Products: prodClient,
+		Payments: paymentClient,
+	}, exportDir)
+	if err != nil {
+		accClient.Close()
+		prodClient.Close()
+		ordClient.Close()
+		paymentClient.Close()
+		recClient.Close()
+		revClient.Close()
+		return nil, err
+	}
+
 	return &Server{
 		accountClient:     accClient,
 		productClient:     prodClient,
 		orderClient:       ordClient,
 		paymentClient:     paymentClient,
 		recommenderClient: recClient,
+		reviewClient:      revClient,
+		exports:           exports,
+		media:             media.NewStore(mediaStorage),
 	}, nil
 }
 
+// Exports returns the orchestrator running the data exports requested through the API.
+func (server *Server) Exports() *export.Orchestrator {
+	return server.exports
+}
+
 func (server *Server) Mutation() MutationResolver {
 	return &mutationResolver{
 		server: server,
@@ -80,8 +121,36 @@ func (server *Server) Account() AccountResolver {
 	}
 }
 
+func (server *Server) Product() ProductResolver {
+	return &productResolver{
+		server: server,
+	}
+}
+
+func (server *Server) Variant() VariantResolver {
+	return &variantResolver{
+		server: server,
+	}
+}
+
+func (server *Server) ProductImage() ProductImageResolver {
+	return &productImageResolver{
+		server: server,
+	}
+}
+
+func (server *Server) Category() CategoryResolver {
+	return &categoryResolver{
+		server: server,
+	}
+}
+
 func (server *Server) ToExecutableSchema() graphql.ExecutableSchema {
 	return NewExecutableSchema(Config{
 		Resolvers: server,
+		Directives: DirectiveRoot{
+			HasRole:  hasRole,
+			HasScope: hasScope,
+		},
 	})
 }
@@ -1,8 +1,53 @@
 package graph
 
 type Account struct {
-	ID     uint64  `json:"id"`
-	Name   string  `json:"name"`
-	Email  string  `json:"email"`
-	Orders []Order `json:"orders"`
+	ID               uint64  `json:"id"`
+	Name             string  `json:"name"`
+	Email            string  `json:"email"`
+	EmailVerified    bool    `json:"emailVerified"`
+	Role             Role    `json:"role"`
+	TwoFactorEnabled bool    `json:"twoFactorEnabled"`
+	Orders           []Order `json:"orders"`
+}
+
+type Product struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Price       float64          `json:"price"`
+	AccountID   int              `json:"accountId"`
+	Status      ProductStatus    `json:"status"`
+	Options     []*ProductOption `json:"options"`
+	Variants    []*Variant       `json:"variants"`
+	Images      []*ProductImage  `json:"images"`
+	// AverageRating is nil for products without published reviews
+	AverageRating *float64 `json:"averageRating"`
+	ReviewCount   int      `json:"reviewCount"`
+	// CategoryIDs are resolved into categories only when the query asks for them
+	CategoryIDs []string `json:"-"`
+}
+
+type ProductImage struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	// Keys are resolved into URLs by the media storage
+	Key          string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+type Variant struct {
+	SKU     string           `json:"sku"`
+	Options []*VariantOption `json:"options"`
+	Price   float64          `json:"price"`
+	// ProductID is needed to resolve the stock of the variant
+	ProductID string `json:"-"`
+}
+
+type Category struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	ParentID *string  `json:"parentId,omitempty"`
+	Path     []string `json:"path"`
 }
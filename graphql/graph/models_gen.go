@@ -3,11 +3,32 @@
 package graph
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token             *string `json:"token,omitempty"`
+	RefreshToken      *string `json:"refreshToken,omitempty"`
+	TwoFactorRequired bool    `json:"twoFactorRequired"`
+	ChallengeToken    *string `json:"challengeToken,omitempty"`
+}
+
+type CategoryFacet struct {
+	Category *Category `json:"category"`
+	Count    int       `json:"count"`
 }
 
 type CheckoutInput struct {
@@ -24,6 +45,14 @@ type CreateProductInput struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	// PUBLISHED when not set, a product can also be created as a DRAFT
+	Status *ProductStatus `json:"status,omitempty"`
+}
+
+type CreatedAPIKey struct {
+	// The key itself, it cannot be retrieved again
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"apiKey"`
 }
 
 type CustomerPortalSessionInput struct {
@@ -32,6 +61,16 @@ type CustomerPortalSessionInput struct {
 	Name      string `json:"name"`
 }
 
+type DataExport struct {
+	ID          string           `json:"id"`
+	AccountID   int              `json:"accountId"`
+	Status      DataExportStatus `json:"status"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	DownloadURL *string          `json:"downloadUrl,omitempty"`
+	Error       *string          `json:"error,omitempty"`
+}
+
 type LoginInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -45,23 +84,49 @@ type Order struct {
 	CreatedAt  time.Time         `json:"createdAt"`
 	TotalPrice float64           `json:"totalPrice"`
 	Products   []*OrderedProduct `json:"products"`
+	Status     OrderStatus       `json:"status"`
+	// Oldest first
+	StatusHistory []*OrderStatusChange `json:"statusHistory"`
 }
 
 type OrderInput struct {
 	Products []*OrderedProductInput `json:"products"`
 }
 
+type OrderStatusChange struct {
+	// Not set for the first status of an order
+	From      *OrderStatus `json:"from,omitempty"`
+	To        OrderStatus  `json:"to"`
+	Reason    *string      `json:"reason,omitempty"`
+	ChangedAt time.Time    `json:"changedAt"`
+}
+
+// The product as it was when the order was placed
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Unit price paid
+	Price float64 `json:"price"`
+	// Not set for orders placed before snapshots that were not backfilled yet
+	Currency *string `json:"currency,omitempty"`
+	Quantity int     `json:"quantity"`
+	Sku      *string `json:"sku,omitempty"`
 }
 
 type OrderedProductInput struct {
 	ID       string `json:"id"`
 	Quantity int    `json:"quantity"`
+	// Required for products with variants
+	Sku *string `json:"sku,omitempty"`
+}
+
+type PageInfo struct {
+	HasNextPage bool `json:"hasNextPage"`
+	// Set when matching products come before the page
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
 }
 
 type PaginationInput struct {
@@ -69,12 +134,89 @@ type PaginationInput struct {
 	Take int `json:"take"`
 }
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	AccountID   int     `json:"accountId"`
+// Counts the matching products priced from "from" up to, but not including, "to".
+// A missing bound is open.
+type PriceBucket struct {
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+	Count int      `json:"count"`
+}
+
+type PriceChange struct {
+	// Not set for the price the product was created with
+	OldPrice *float64 `json:"oldPrice,omitempty"`
+	NewPrice float64  `json:"newPrice"`
+	// The account that made the change, or scheduled it
+	ActorID int               `json:"actorId"`
+	Reason  PriceChangeReason `json:"reason"`
+	// Set for changes made by a price schedule
+	ScheduleID *int      `json:"scheduleId,omitempty"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+type PriceSchedule struct {
+	ID        int       `json:"id"`
+	ProductID string    `json:"productId"`
+	Price     float64   `json:"price"`
+	StartsAt  time.Time `json:"startsAt"`
+	// Set for sales, which put the regular price back when they end
+	EndsAt *time.Time          `json:"endsAt,omitempty"`
+	Status PriceScheduleStatus `json:"status"`
+	// The price a sale replaced, set once it started
+	RegularPrice *float64  `json:"regularPrice,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// A page of products following the Relay connection specification
+type ProductConnection struct {
+	Edges    []*ProductEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+	// The number of matching products, not only the returned page
+	TotalCount int `json:"totalCount"`
+}
+
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+}
+
+// A way a product varies, such as size, with the values it comes in
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOptionInput struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductSearchInput struct {
+	Query      *string      `json:"query,omitempty"`
+	CategoryID *string      `json:"categoryId,omitempty"`
+	MinPrice   *float64     `json:"minPrice,omitempty"`
+	MaxPrice   *float64     `json:"maxPrice,omitempty"`
+	SellerID   *int         `json:"sellerId,omitempty"`
+	Sort       *ProductSort `json:"sort,omitempty"`
+}
+
+type ProductSearchResult struct {
+	Products []*Product `json:"products"`
+	// The number of matching products, not only the returned page
+	Total        int              `json:"total"`
+	PriceBuckets []*PriceBucket   `json:"priceBuckets"`
+	Categories   []*CategoryFacet `json:"categories"`
+}
+
+type ProductSuggestion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ProductSuggestions struct {
+	Products []*ProductSuggestion `json:"products"`
+	// The prefix with its misspelled words corrected, set when no product matched
+	DidYouMean *string `json:"didYouMean,omitempty"`
 }
 
 type Query struct {
@@ -88,6 +230,45 @@ type RegisterInput struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Role     *Role  `json:"role,omitempty"`
+}
+
+type Review struct {
+	ID        int    `json:"id"`
+	ProductID string `json:"productId"`
+	AccountID int    `json:"accountId"`
+	// From 1 to 5 stars
+	Rating int          `json:"rating"`
+	Text   string       `json:"text"`
+	Status ReviewStatus `json:"status"`
+	// Why a moderator rejected the review
+	ModerationNote *string `json:"moderationNote,omitempty"`
+	// The answer of the seller of the product
+	Reply     *ReviewReply `json:"reply,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+type ReviewReply struct {
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Stock struct {
+	OnHand int `json:"onHand"`
+	// Held for orders that are not paid for yet
+	Reserved  int `json:"reserved"`
+	Available int `json:"available"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type UpdateAccountInput struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
 }
 
 type UpdateProductInput struct {
@@ -96,3 +277,428 @@ type UpdateProductInput struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 }
+
+type VariantInput struct {
+	Sku     string                `json:"sku"`
+	Options []*VariantOptionInput `json:"options"`
+	Price   float64               `json:"price"`
+}
+
+type VariantOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type VariantOptionInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type DataExportStatus string
+
+const (
+	DataExportStatusPending   DataExportStatus = "PENDING"
+	DataExportStatusRunning   DataExportStatus = "RUNNING"
+	DataExportStatusCompleted DataExportStatus = "COMPLETED"
+	DataExportStatusFailed    DataExportStatus = "FAILED"
+)
+
+var AllDataExportStatus = []DataExportStatus{
+	DataExportStatusPending,
+	DataExportStatusRunning,
+	DataExportStatusCompleted,
+	DataExportStatusFailed,
+}
+
+func (e DataExportStatus) IsValid() bool {
+	switch e {
+	case DataExportStatusPending, DataExportStatusRunning, DataExportStatusCompleted, DataExportStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e DataExportStatus) String() string {
+	return string(e)
+}
+
+func (e *DataExportStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DataExportStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DataExportStatus", str)
+	}
+	return nil
+}
+
+func (e DataExportStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Orders wait for their payment, then are fulfilled, shipped and delivered. They
+// can be cancelled until they are fulfilled and refunded once paid for.
+type OrderStatus string
+
+const (
+	OrderStatusPendingPayment OrderStatus = "PENDING_PAYMENT"
+	OrderStatusPaid           OrderStatus = "PAID"
+	OrderStatusFulfilled      OrderStatus = "FULFILLED"
+	OrderStatusShipped        OrderStatus = "SHIPPED"
+	OrderStatusDelivered      OrderStatus = "DELIVERED"
+	OrderStatusCancelled      OrderStatus = "CANCELLED"
+	OrderStatusRefunded       OrderStatus = "REFUNDED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPendingPayment,
+	OrderStatusPaid,
+	OrderStatusFulfilled,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPendingPayment, OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PriceChangeReason string
+
+const (
+	PriceChangeReasonCreated     PriceChangeReason = "CREATED"
+	PriceChangeReasonUpdated     PriceChangeReason = "UPDATED"
+	PriceChangeReasonImported    PriceChangeReason = "IMPORTED"
+	PriceChangeReasonScheduled   PriceChangeReason = "SCHEDULED"
+	PriceChangeReasonSaleStarted PriceChangeReason = "SALE_STARTED"
+	PriceChangeReasonSaleEnded   PriceChangeReason = "SALE_ENDED"
+)
+
+var AllPriceChangeReason = []PriceChangeReason{
+	PriceChangeReasonCreated,
+	PriceChangeReasonUpdated,
+	PriceChangeReasonImported,
+	PriceChangeReasonScheduled,
+	PriceChangeReasonSaleStarted,
+	PriceChangeReasonSaleEnded,
+}
+
+func (e PriceChangeReason) IsValid() bool {
+	switch e {
+	case PriceChangeReasonCreated, PriceChangeReasonUpdated, PriceChangeReasonImported, PriceChangeReasonScheduled, PriceChangeReasonSaleStarted, PriceChangeReasonSaleEnded:
+		return true
+	}
+	return false
+}
+
+func (e PriceChangeReason) String() string {
+	return string(e)
+}
+
+func (e *PriceChangeReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PriceChangeReason(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PriceChangeReason", str)
+	}
+	return nil
+}
+
+func (e PriceChangeReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PriceScheduleStatus string
+
+const (
+	PriceScheduleStatusScheduled PriceScheduleStatus = "SCHEDULED"
+	// A sale that started and has not ended
+	PriceScheduleStatusActive    PriceScheduleStatus = "ACTIVE"
+	PriceScheduleStatusCompleted PriceScheduleStatus = "COMPLETED"
+	PriceScheduleStatusCanceled  PriceScheduleStatus = "CANCELED"
+)
+
+var AllPriceScheduleStatus = []PriceScheduleStatus{
+	PriceScheduleStatusScheduled,
+	PriceScheduleStatusActive,
+	PriceScheduleStatusCompleted,
+	PriceScheduleStatusCanceled,
+}
+
+func (e PriceScheduleStatus) IsValid() bool {
+	switch e {
+	case PriceScheduleStatusScheduled, PriceScheduleStatusActive, PriceScheduleStatusCompleted, PriceScheduleStatusCanceled:
+		return true
+	}
+	return false
+}
+
+func (e PriceScheduleStatus) String() string {
+	return string(e)
+}
+
+func (e *PriceScheduleStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PriceScheduleStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PriceScheduleStatus", str)
+	}
+	return nil
+}
+
+func (e PriceScheduleStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSort string
+
+const (
+	ProductSortRelevance ProductSort = "RELEVANCE"
+	ProductSortPriceAsc  ProductSort = "PRICE_ASC"
+	ProductSortPriceDesc ProductSort = "PRICE_DESC"
+	ProductSortNewest    ProductSort = "NEWEST"
+)
+
+var AllProductSort = []ProductSort{
+	ProductSortRelevance,
+	ProductSortPriceAsc,
+	ProductSortPriceDesc,
+	ProductSortNewest,
+}
+
+func (e ProductSort) IsValid() bool {
+	switch e {
+	case ProductSortRelevance, ProductSortPriceAsc, ProductSortPriceDesc, ProductSortNewest:
+		return true
+	}
+	return false
+}
+
+func (e ProductSort) String() string {
+	return string(e)
+}
+
+func (e *ProductSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (e ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductStatus string
+
+const (
+	ProductStatusDraft     ProductStatus = "DRAFT"
+	ProductStatusPublished ProductStatus = "PUBLISHED"
+	ProductStatusArchived  ProductStatus = "ARCHIVED"
+)
+
+var AllProductStatus = []ProductStatus{
+	ProductStatusDraft,
+	ProductStatusPublished,
+	ProductStatusArchived,
+}
+
+func (e ProductStatus) IsValid() bool {
+	switch e {
+	case ProductStatusDraft, ProductStatusPublished, ProductStatusArchived:
+		return true
+	}
+	return false
+}
+
+func (e ProductStatus) String() string {
+	return string(e)
+}
+
+func (e *ProductStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductStatus", str)
+	}
+	return nil
+}
+
+func (e ProductStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPublished ReviewStatus = "PUBLISHED"
+	// A rejected review edited by its author, waiting for a moderator
+	ReviewStatusPending  ReviewStatus = "PENDING"
+	ReviewStatusRejected ReviewStatus = "REJECTED"
+)
+
+var AllReviewStatus = []ReviewStatus{
+	ReviewStatusPublished,
+	ReviewStatusPending,
+	ReviewStatusRejected,
+}
+
+func (e ReviewStatus) IsValid() bool {
+	switch e {
+	case ReviewStatusPublished, ReviewStatusPending, ReviewStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e ReviewStatus) String() string {
+	return string(e)
+}
+
+func (e *ReviewStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReviewStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReviewStatus", str)
+	}
+	return nil
+}
+
+func (e ReviewStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleCustomer Role = "CUSTOMER"
+	RoleSeller   Role = "SELLER"
+	RoleAdmin    Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleCustomer,
+	RoleSeller,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleCustomer, RoleSeller, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Scope string
+
+const (
+	ScopeProductsRead  Scope = "PRODUCTS_READ"
+	ScopeProductsWrite Scope = "PRODUCTS_WRITE"
+)
+
+var AllScope = []Scope{
+	ScopeProductsRead,
+	ScopeProductsWrite,
+}
+
+func (e Scope) IsValid() bool {
+	switch e {
+	case ScopeProductsRead, ScopeProductsWrite:
+		return true
+	}
+	return false
+}
+
+func (e Scope) String() string {
+	return string(e)
+}
+
+func (e *Scope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Scope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Scope", str)
+	}
+	return nil
+}
+
+func (e Scope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -4,12 +4,21 @@ import (
 	"context"
 	"errors"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
-
+	"github.com/99designs/gqlgen/graphql"
+	accountModels "github.com/rasadov/EcommerceAPI/account/models"
+	"github.com/rasadov/EcommerceAPI/graphql/export"
 	"github.com/rasadov/EcommerceAPI/order/models"
 	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
 )
 
 var (
@@ -24,52 +33,388 @@ func (resolver *mutationResolver) Register(ctx context.Context, in RegisterInput
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	token, err := resolver.server.accountClient.Register(ctx, in.Name, in.Email, in.Password)
+	role := auth.RoleCustomer
+	if in.Role != nil {
+		role = in.Role.toAuth()
+	}
+	tokens, err := resolver.server.accountClient.Register(ctx, in.Name, in.Email, in.Password, role)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	ginContext, ok := ctx.Value("GinContextKey").(*gin.Context)
-	if !ok {
-		return nil, errors.New("could not retrieve gin context")
+	return setAuthCookies(ctx, tokens)
+}
+
+func (resolver *mutationResolver) Login(ctx context.Context, in LoginInput) (*AuthResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ginContext, err := middleware.GinContextFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
-	ginContext.SetCookie("token", token, 3600, "/", "localhost", false, true)
 
-	return &AuthResponse{Token: token}, nil
+	result, err := resolver.server.accountClient.Login(ctx, in.Email, in.Password, ginContext.ClientIP())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if result.Tokens == nil {
+		return &AuthResponse{TwoFactorRequired: true, ChallengeToken: &result.ChallengeToken}, nil
+	}
+
+	return setAuthCookies(ctx, result.Tokens)
 }
 
-func (resolver *mutationResolver) Login(ctx context.Context, in LoginInput) (*AuthResponse, error) {
+func (resolver *mutationResolver) VerifyTwoFactor(ctx context.Context, challengeToken string, code string) (*AuthResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	token, err := resolver.server.accountClient.Login(ctx, in.Email, in.Password)
+	tokens, err := resolver.server.accountClient.VerifyTwoFactor(ctx, challengeToken, code)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	ginContext, ok := ctx.Value("GinContextKey").(*gin.Context)
-	if !ok {
-		return nil, errors.New("could not retrieve gin context")
+	return setAuthCookies(ctx, tokens)
+}
+
+// StartOidcLogin returns the provider page to send the user to. The provider
+// redirects back to the frontend, which passes the code and state to CompleteOidcLogin.
+func (resolver *mutationResolver) StartOidcLogin(ctx context.Context, provider string) (*RedirectResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	authURL, err := resolver.server.accountClient.StartOIDCLogin(ctx, provider)
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
-	ginContext.SetCookie("token", token, 3600, "/", "localhost", false, true)
+	return &RedirectResponse{URL: authURL}, nil
+}
+
+func (resolver *mutationResolver) CompleteOidcLogin(ctx context.Context, provider string, code string, state string) (*AuthResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	return &AuthResponse{Token: token}, nil
+	result, err := resolver.server.accountClient.CompleteOIDCLogin(ctx, provider, code, state)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if result.Tokens == nil {
+		return &AuthResponse{TwoFactorRequired: true, ChallengeToken: &result.ChallengeToken}, nil
+	}
+
+	return setAuthCookies(ctx, result.Tokens)
 }
 
-func (resolver *mutationResolver) CreateProduct(ctx context.Context, in CreateProductInput) (*Product, error) {
+func (resolver *mutationResolver) RefreshToken(ctx context.Context, token *string) (*AuthResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	log.Println("CreateProduct called with input:", in)
+	refreshToken, err := refreshTokenFromRequest(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := resolver.server.accountClient.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return setAuthCookies(ctx, tokens)
+}
+
+func (resolver *mutationResolver) Logout(ctx context.Context, token *string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	refreshToken, err := refreshTokenFromRequest(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resolver.server.accountClient.Logout(ctx, refreshToken)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	ginContext, err := middleware.GinContextFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ginContext.SetCookie(accessTokenCookie, "", -1, "/", "localhost", false, true)
+	ginContext.SetCookie(refreshTokenCookie, "", -1, "/", "localhost", false, true)
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := resolver.server.accountClient.RequestPasswordReset(ctx, email)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) ResetPassword(ctx context.Context, token string, password string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := resolver.server.accountClient.ResetPassword(ctx, token, password)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) SendVerificationEmail(ctx context.Context) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
 	accountId, err := auth.GetUserIdInt(ctx, true)
 	if err != nil {
 		return nil, err
 	}
-	log.Println("CreateProduct called with accountId:", accountId)
-	postProduct, err := resolver.server.productClient.PostProduct(ctx, in.Name, in.Description, in.Price, int64(accountId))
+
+	err = resolver.server.accountClient.SendVerificationEmail(ctx, uint64(accountId))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) VerifyEmail(ctx context.Context, token string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := resolver.server.accountClient.VerifyEmail(ctx, token)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) EnrollTwoFactor(ctx context.Context) (*TwoFactorEnrollment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	enrollment, err := resolver.server.accountClient.EnrollTwoFactor(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{Secret: enrollment.Secret, URI: enrollment.URI}, nil
+}
+
+func (resolver *mutationResolver) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := resolver.server.accountClient.ConfirmTwoFactor(ctx, code)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (resolver *mutationResolver) DisableTwoFactor(ctx context.Context, code string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	err := resolver.server.accountClient.DisableTwoFactor(ctx, code)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) UpdateAccount(ctx context.Context, in UpdateAccountInput) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	var name, email string
+	if in.Name != nil {
+		name = *in.Name
+	}
+	if in.Email != nil {
+		email = *in.Email
+	}
+	account, err := resolver.server.accountClient.UpdateAccount(ctx, name, email)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &Account{
+		ID:               account.ID,
+		Name:             account.Name,
+		Email:            account.Email,
+		EmailVerified:    account.EmailVerified,
+		Role:             roleFromAuth(account.Role),
+		TwoFactorEnabled: account.TwoFactorEnabled,
+	}, nil
+}
+
+// ChangePassword keeps the current session signed in when its refresh token is
+// passed or set as a cookie, every other session is signed out.
+func (resolver *mutationResolver) ChangePassword(ctx context.Context, currentPassword string, newPassword string, token *string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	refreshToken, _ := refreshTokenFromRequest(ctx, token)
+	err := resolver.server.accountClient.ChangePassword(ctx, currentPassword, newPassword, refreshToken)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) DeleteAccount(ctx context.Context, password string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	err := resolver.server.accountClient.DeleteAccount(ctx, password)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	ginContext, err := middleware.GinContextFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ginContext.SetCookie(accessTokenCookie, "", -1, "/", "localhost", false, true)
+	ginContext.SetCookie(refreshTokenCookie, "", -1, "/", "localhost", false, true)
+
+	success := true
+	return &success, nil
+}
+
+// RequestDataExport starts an export of everything the services store about an
+// account. Callers export their own account, admins can export any account.
+func (resolver *mutationResolver) RequestDataExport(ctx context.Context, accountID *int) (*DataExport, error) {
+	callerID, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	target := uint64(callerID)
+	if accountID != nil && uint64(*accountID) != target {
+		if err = middleware.RequireRole(ctx, auth.RoleAdmin); err != nil {
+			return nil, err
+		}
+		target = uint64(*accountID)
+	}
+
+	job, err := resolver.server.exports.Start(ctx, target, uint64(callerID))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return dataExportFromJob(job), nil
+}
+
+func (resolver *mutationResolver) CreateAPIKey(ctx context.Context, name string, scopes []Scope) (*CreatedAPIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	authScopes := make([]auth.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		authScopes = append(authScopes, scope.toAuth())
+	}
+	apiKey, key, err := resolver.server.accountClient.CreateAPIKey(ctx, name, authScopes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &CreatedAPIKey{Key: key, APIKey: apiKeyFromModel(apiKey)}, nil
+}
+
+func (resolver *mutationResolver) RevokeAPIKey(ctx context.Context, id int) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	err := resolver.server.accountClient.RevokeAPIKey(ctx, uint64(id))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) CreateProduct(ctx context.Context, in CreateProductInput) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	log.Println("CreateProduct called with input:", in)
+
+	status := productModels.StatusPublished
+	if in.Status != nil {
+		status = in.Status.toModel()
+	}
+	postProduct, err := resolver.server.productClient.PostProduct(ctx, in.Name, in.Description, in.Price, status)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -83,7 +428,8 @@ func (resolver *mutationResolver) CreateProduct(ctx context.Context, in CreatePr
 		Name:        postProduct.Name,
 		Description: postProduct.Description,
 		Price:       postProduct.Price,
-		AccountID:   accountId,
+		AccountID:   postProduct.AccountID,
+		Status:      productStatusFromModel(postProduct.Status),
 	}, nil
 }
 
@@ -91,43 +437,259 @@ func (resolver *mutationResolver) UpdateProduct(ctx context.Context, in UpdatePr
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	accountId, err := auth.GetUserIdInt(ctx, true)
+	updatedProduct, err := resolver.server.productClient.UpdateProduct(ctx, in.ID, in.Name, in.Description, in.Price)
 	if err != nil {
 		return nil, err
 	}
+	return productFromModel(updatedProduct), nil
+}
 
-	updatedProduct, err := resolver.server.productClient.UpdateProduct(ctx, in.ID, in.Name, in.Description, in.Price, int64(accountId))
+func (resolver *mutationResolver) DeleteProduct(ctx context.Context, id string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// The product is archived, its images are kept for the orders that show it
+	err := resolver.server.productClient.DeleteProduct(ctx, id)
 	if err != nil {
+		log.Println(err)
 		return nil, err
 	}
-	return &Product{
-		ID:          updatedProduct.ID,
-		Name:        updatedProduct.Name,
-		Description: updatedProduct.Description,
-		Price:       updatedProduct.Price,
-		AccountID:   accountId,
-	}, nil
+
+	success := true
+	return &success, nil
 }
 
-func (resolver *mutationResolver) DeleteProduct(ctx context.Context, id string) (*bool, error) {
+func (resolver *mutationResolver) SetProductStatus(ctx context.Context, productID string, status ProductStatus) (*Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	product, err := resolver.server.productClient.SetProductStatus(ctx, productID, status.toModel())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return productFromModel(product), nil
+}
+
+func (resolver *mutationResolver) SetProductCategories(ctx context.Context, productID string, categoryIds []string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	product, err := resolver.server.productClient.SetProductCategories(ctx, productID, categoryIds)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return productFromModel(product), nil
+}
+
+// SetProductVariants replaces the options of a product and the variants it is sold in.
+func (resolver *mutationResolver) SetProductVariants(ctx context.Context, productID string, options []*ProductOptionInput, variants []*VariantInput) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	productOptions := make([]productModels.ProductOption, 0, len(options))
+	for _, option := range options {
+		productOptions = append(productOptions, productModels.ProductOption{Name: option.Name, Values: option.Values})
+	}
+	productVariants := make([]productModels.Variant, 0, len(variants))
+	for _, variant := range variants {
+		productVariant := productModels.Variant{SKU: variant.Sku, Price: variant.Price}
+		for _, option := range variant.Options {
+			productVariant.Options = append(productVariant.Options, productModels.VariantOption{Name: option.Name, Value: option.Value})
+		}
+		productVariants = append(productVariants, productVariant)
+	}
+
+	product, err := resolver.server.productClient.SetProductVariants(ctx, productID, productOptions, productVariants)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return productFromModel(product), nil
+}
+
+// AddProductImage stores an uploaded image of a product with a thumbnail and
+// adds it to the product.
+func (resolver *mutationResolver) AddProductImage(ctx context.Context, productID string, file graphql.Upload) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
 	accountId, err := auth.GetUserIdInt(ctx, true)
 	if err != nil {
 		return nil, err
 	}
 
-	err = resolver.server.productClient.DeleteProduct(ctx, id, int64(accountId))
+	// Ownership is checked before storing anything, the product service checks it again
+	product, err := resolver.server.productClient.GetProduct(ctx, productID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+
+	image, err := resolver.server.media.PutProductImage(ctx, productID, file.File)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	product, err = resolver.server.productClient.AddProductImage(ctx, productID, *image)
+	if err != nil {
+		log.Println(err)
+		resolver.server.media.DeleteProductImage(ctx, *image)
+		return nil, err
+	}
+	return productFromModel(product), nil
+}
+
+// RemoveProductImage removes an image from a product and deletes its files.
+func (resolver *mutationResolver) RemoveProductImage(ctx context.Context, productID string, imageID string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// The image is looked up first, the product no longer lists it once removed
+	product, err := resolver.server.productClient.GetProduct(ctx, productID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	image := product.Image(imageID)
+
+	product, err = resolver.server.productClient.RemoveProductImage(ctx, productID, imageID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if image != nil {
+		resolver.server.media.DeleteProductImage(ctx, *image)
+	}
+	return productFromModel(product), nil
+}
+
+// SetStock sets the quantity on hand of a product, or of one of its variants,
+// which starts tracking its stock.
+func (resolver *mutationResolver) SetStock(ctx context.Context, productID string, sku *string, onHand int) (*Stock, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	variant := ""
+	if sku != nil {
+		variant = *sku
+	}
+	stock, err := resolver.server.productClient.SetStock(ctx, productID, variant, int64(onHand))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return stockFromModel(stock), nil
+}
+
+func (resolver *mutationResolver) SchedulePriceChange(ctx context.Context, productID string, price float64, startsAt time.Time, endsAt *time.Time) (*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	schedule, err := resolver.server.productClient.SchedulePriceChange(ctx, productID, price, startsAt, endsAt)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return priceScheduleFromModel(schedule), nil
+}
+
+func (resolver *mutationResolver) CancelPriceSchedule(ctx context.Context, id int) (*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	schedule, err := resolver.server.productClient.CancelPriceSchedule(ctx, uint64(id))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return priceScheduleFromModel(schedule), nil
+}
+
+func (resolver *mutationResolver) CreateCategory(ctx context.Context, name string, parentID *string) (*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	parent := ""
+	if parentID != nil {
+		parent = *parentID
+	}
+	category, err := resolver.server.productClient.CreateCategory(ctx, name, parent)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoryFromModel(category), nil
+}
+
+func (resolver *mutationResolver) RenameCategory(ctx context.Context, id string, name string) (*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	category, err := resolver.server.productClient.RenameCategory(ctx, id, name)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	return categoryFromModel(category), nil
+}
+
+// MoveCategory moves a category with its subtree under parentID, or to the root
+// when parentID is not set.
+func (resolver *mutationResolver) MoveCategory(ctx context.Context, id string, parentID *string) (*Category, error) {
+	// Moving reindexes every product in the subtree
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	parent := ""
+	if parentID != nil {
+		parent = *parentID
+	}
+	category, err := resolver.server.productClient.MoveCategory(ctx, id, parent)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoryFromModel(category), nil
+}
+
+func (resolver *mutationResolver) DeleteCategory(ctx context.Context, id string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := resolver.server.productClient.DeleteCategory(ctx, id); err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
 	success := true
 	return &success, nil
 }
 
+func (resolver *mutationResolver) SetAccountRole(ctx context.Context, accountID int, role Role) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	account, err := resolver.server.accountClient.SetAccountRole(ctx, uint64(accountID), role.toAuth())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &Account{
+		ID:               account.ID,
+		Name:             account.Name,
+		Email:            account.Email,
+		EmailVerified:    account.EmailVerified,
+		Role:             roleFromAuth(account.Role),
+		TwoFactorEnabled: account.TwoFactorEnabled,
+	}, nil
+}
+
 func (resolver *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -137,10 +699,14 @@ func (resolver *mutationResolver) CreateOrder(ctx context.Context, in OrderInput
 		if product.Quantity <= 0 {
 			return nil, ErrInvalidParameter
 		}
-		products = append(products, &models.OrderedProduct{
+		orderedProduct := &models.OrderedProduct{
 			ID:       product.ID,
 			Quantity: uint32(product.Quantity),
-		})
+		}
+		if product.Sku != nil {
+			orderedProduct.SKU = *product.Sku
+		}
+		products = append(products, orderedProduct)
 	}
 
 	accountId, err := auth.GetUserIdInt(ctx, true)
@@ -154,23 +720,23 @@ func (resolver *mutationResolver) CreateOrder(ctx context.Context, in OrderInput
 		return nil, err
 	}
 
-	var orderedProducts []*OrderedProduct
-	for _, orderedProduct := range postOrder.Products {
-		orderedProducts = append(orderedProducts, &OrderedProduct{
-			ID:          orderedProduct.ID,
-			Name:        orderedProduct.Name,
-			Description: orderedProduct.Description,
-			Price:       orderedProduct.Price,
-			Quantity:    int(orderedProduct.Quantity),
-		})
-	}
+	return orderFromModel(postOrder), nil
+}
 
-	return &Order{
-		ID:         int(postOrder.ID),
-		CreatedAt:  postOrder.CreatedAt,
-		TotalPrice: postOrder.TotalPrice,
-		Products:   orderedProducts,
-	}, nil
+func (resolver *mutationResolver) UpdateOrderStatus(ctx context.Context, id int, status OrderStatus, reason *string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var r string
+	if reason != nil {
+		r = *reason
+	}
+	order, err := resolver.server.orderClient.UpdateOrderStatus(ctx, uint64(id), string(status.toModel()), r)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return orderFromModel(order), nil
 }
 
 func (resolver *mutationResolver) CreateCustomerPortalSession(ctx context.Context, credentials *CustomerPortalSessionInput) (*RedirectResponse, error) {
@@ -198,3 +764,129 @@ func (resolver *mutationResolver) Checkout(ctx context.Context, details *Checkou
 	}
 	return &RedirectResponse{URL: UrlWithCheckoutSession}, nil
 }
+
+func apiKeyFromModel(key *accountModels.APIKey) *APIKey {
+	scopes := make([]Scope, 0)
+	for _, scope := range key.ScopeList() {
+		scopes = append(scopes, scopeFromAuth(scope))
+	}
+	return &APIKey{
+		ID:         int(key.ID),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+func dataExportFromJob(job *export.Job) *DataExport {
+	dataExport := &DataExport{
+		ID:          job.ID,
+		AccountID:   int(job.AccountID),
+		Status:      DataExportStatus(strings.ToUpper(string(job.Status))),
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	if job.Status == export.StatusCompleted {
+		downloadURL := "/exports/" + job.ID
+		dataExport.DownloadURL = &downloadURL
+	}
+	if job.Error != "" {
+		dataExport.Error = &job.Error
+	}
+	return dataExport
+}
+
+func (resolver *mutationResolver) PostReview(ctx context.Context, productID string, rating int, text string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	review, err := resolver.server.reviewClient.PostReview(ctx, productID, rating, text)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewFromModel(review), nil
+}
+
+func (resolver *mutationResolver) UpdateReview(ctx context.Context, id int, rating int, text string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	review, err := resolver.server.reviewClient.UpdateReview(ctx, uint64(id), rating, text)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewFromModel(review), nil
+}
+
+func (resolver *mutationResolver) DeleteReview(ctx context.Context, id int) (*bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := resolver.server.reviewClient.DeleteReview(ctx, uint64(id))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	success := true
+	return &success, nil
+}
+
+func (resolver *mutationResolver) ReplyToReview(ctx context.Context, id int, text string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	review, err := resolver.server.reviewClient.ReplyToReview(ctx, uint64(id), text)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewFromModel(review), nil
+}
+
+func (resolver *mutationResolver) ModerateReview(ctx context.Context, id int, status ReviewStatus, note *string) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	moderationNote := ""
+	if note != nil {
+		moderationNote = *note
+	}
+	review, err := resolver.server.reviewClient.ModerateReview(ctx, uint64(id), reviewStatusToModel[status], moderationNote)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewFromModel(review), nil
+}
+
+func setAuthCookies(ctx context.Context, tokens *accountModels.TokenPair) (*AuthResponse, error) {
+	ginContext, err := middleware.GinContextFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ginContext.SetCookie(accessTokenCookie, tokens.AccessToken, int(auth.AccessTokenDuration.Seconds()), "/", "localhost", false, true)
+	ginContext.SetCookie(refreshTokenCookie, tokens.RefreshToken, int(auth.RefreshTokenDuration.Seconds()), "/", "localhost", false, true)
+
+	return &AuthResponse{Token: &tokens.AccessToken, RefreshToken: &tokens.RefreshToken}, nil
+}
+
+// refreshTokenFromRequest prefers an explicitly passed token and falls back to the cookie.
+func refreshTokenFromRequest(ctx context.Context, token *string) (string, error) {
+	if token != nil && *token != "" {
+		return *token, nil
+	}
+	ginContext, err := middleware.GinContextFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	refreshToken, err := ginContext.Cookie(refreshTokenCookie)
+	if err != nil || refreshToken == "" {
+		return "", errors.New("refresh token not provided")
+	}
+	return refreshToken, nil
+}
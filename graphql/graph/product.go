@@ -0,0 +1,210 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+type productResolver struct {
+	server *Server
+}
+
+func (resolver *productResolver) Categories(ctx context.Context, obj *Product) ([]*Category, error) {
+	if len(obj.CategoryIDs) == 0 {
+		return []*Category{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	categoryList, err := resolver.server.productClient.GetCategories(ctx, "", obj.CategoryIDs)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoriesFromModels(categoryList), nil
+}
+
+func (resolver *productResolver) Stock(ctx context.Context, obj *Product) (*Stock, error) {
+	return resolver.server.stock(ctx, obj.ID, "")
+}
+
+func (resolver *productResolver) Reviews(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*Review, error) {
+	if obj.ReviewCount == 0 {
+		return []*Review{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+	reviews, err := resolver.server.reviewClient.ListReviews(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewsFromModels(reviews), nil
+}
+
+func (resolver *productResolver) PriceHistory(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*PriceChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+	changes, err := resolver.server.productClient.GetPriceHistory(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	res := make([]*PriceChange, 0, len(changes))
+	for _, change := range changes {
+		res = append(res, priceChangeFromModel(change))
+	}
+	return res, nil
+}
+
+type productImageResolver struct {
+	server *Server
+}
+
+func (resolver *productImageResolver) URL(ctx context.Context, obj *ProductImage) (string, error) {
+	return resolver.server.media.URL(obj.Key), nil
+}
+
+func (resolver *productImageResolver) ThumbnailURL(ctx context.Context, obj *ProductImage) (string, error) {
+	return resolver.server.media.URL(obj.ThumbnailKey), nil
+}
+
+type variantResolver struct {
+	server *Server
+}
+
+func (resolver *variantResolver) Stock(ctx context.Context, obj *Variant) (*Stock, error) {
+	return resolver.server.stock(ctx, obj.ProductID, obj.SKU)
+}
+
+// stock returns the stock of a product, or of its variant when sku is set, and
+// nil when it is not tracked.
+func (server *Server) stock(ctx context.Context, productID, sku string) (*Stock, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stockList, err := server.productClient.GetStock(ctx, []string{productID})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	for _, stock := range stockList {
+		if stock.SKU == sku {
+			return stockFromModel(&stock), nil
+		}
+	}
+	return nil, nil
+}
+
+func (status ProductStatus) toModel() productModels.ProductStatus {
+	return productModels.ProductStatus(strings.ToLower(string(status)))
+}
+
+func productStatusFromModel(status productModels.ProductStatus) ProductStatus {
+	if status == "" {
+		return ProductStatusPublished
+	}
+	return ProductStatus(strings.ToUpper(string(status)))
+}
+
+func productFromModel(product *productModels.Product) *Product {
+	res := &Product{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		AccountID:   product.AccountID,
+		Status:      productStatusFromModel(product.Status),
+		Options:     make([]*ProductOption, 0, len(product.Options)),
+		Variants:    make([]*Variant, 0, len(product.Variants)),
+		Images:      make([]*ProductImage, 0, len(product.Images)),
+		CategoryIDs: product.CategoryIDs,
+		ReviewCount: product.Rating.Count,
+	}
+	if product.Rating.Count > 0 {
+		res.AverageRating = &product.Rating.Average
+	}
+	for _, option := range product.Options {
+		res.Options = append(res.Options, &ProductOption{Name: option.Name, Values: option.Values})
+	}
+	for _, variant := range product.Variants {
+		v := &Variant{
+			SKU:       variant.SKU,
+			Options:   make([]*VariantOption, 0, len(variant.Options)),
+			Price:     variant.Price,
+			ProductID: product.ID,
+		}
+		for _, option := range variant.Options {
+			v.Options = append(v.Options, &VariantOption{Name: option.Name, Value: option.Value})
+		}
+		res.Variants = append(res.Variants, v)
+	}
+	for _, image := range product.Images {
+		res.Images = append(res.Images, &ProductImage{
+			ID:           image.ID,
+			ContentType:  image.ContentType,
+			Width:        image.Width,
+			Height:       image.Height,
+			Key:          image.Key,
+			ThumbnailKey: image.ThumbnailKey,
+		})
+	}
+	return res
+}
+
+func priceChangeFromModel(change *productModels.PriceChange) *PriceChange {
+	res := &PriceChange{
+		NewPrice:  change.NewPrice,
+		ActorID:   change.ActorID,
+		Reason:    PriceChangeReason(strings.ToUpper(string(change.Reason))),
+		ChangedAt: change.ChangedAt,
+	}
+	if change.OldPrice != 0 {
+		res.OldPrice = &change.OldPrice
+	}
+	if change.ScheduleID != nil {
+		scheduleID := int(*change.ScheduleID)
+		res.ScheduleID = &scheduleID
+	}
+	return res
+}
+
+func priceScheduleFromModel(schedule *productModels.PriceSchedule) *PriceSchedule {
+	res := &PriceSchedule{
+		ID:        int(schedule.ID),
+		ProductID: schedule.ProductID,
+		Price:     schedule.Price,
+		StartsAt:  schedule.StartsAt,
+		EndsAt:    schedule.EndsAt,
+		Status:    PriceScheduleStatus(strings.ToUpper(string(schedule.Status))),
+		CreatedAt: schedule.CreatedAt,
+	}
+	if schedule.RegularPrice != 0 {
+		res.RegularPrice = &schedule.RegularPrice
+	}
+	return res
+}
+
+func stockFromModel(stock *productModels.Stock) *Stock {
+	return &Stock{
+		OnHand:    stock.OnHand,
+		Reserved:  stock.Reserved,
+		Available: stock.Available(),
+	}
+}
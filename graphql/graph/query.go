@@ -3,10 +3,19 @@ package graph
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/rasadov/EcommerceAPI/graphql/export"
 	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+const (
+	// defaultConnectionSize and maxConnectionSize bound the products of a connection page
+	defaultConnectionSize = 20
+	maxConnectionSize     = 100
 )
 
 type queryResolver struct {
@@ -28,9 +37,12 @@ func (resolver *queryResolver) Accounts(
 			return nil, err
 		}
 		return []*Account{{
-			ID:    uint64(res.ID),
-			Name:  res.Name,
-			Email: res.Email,
+			ID:               uint64(res.ID),
+			Name:             res.Name,
+			Email:            res.Email,
+			EmailVerified:    res.EmailVerified,
+			Role:             roleFromAuth(res.Role),
+			TwoFactorEnabled: res.TwoFactorEnabled,
 		}}, nil
 	}
 
@@ -47,9 +59,12 @@ func (resolver *queryResolver) Accounts(
 	var accounts []*Account
 	for _, account := range accountList {
 		account := &Account{
-			ID:    uint64(account.ID),
-			Name:  account.Name,
-			Email: account.Email,
+			ID:               uint64(account.ID),
+			Name:             account.Name,
+			Email:            account.Email,
+			EmailVerified:    account.EmailVerified,
+			Role:             roleFromAuth(account.Role),
+			TwoFactorEnabled: account.TwoFactorEnabled,
 		}
 		accounts = append(accounts, account)
 	}
@@ -57,12 +72,74 @@ func (resolver *queryResolver) Accounts(
 	return accounts, nil
 }
 
+// Me returns the account of the caller.
+func (resolver *queryResolver) Me(ctx context.Context) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	callerID, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resolver.server.accountClient.GetAccount(ctx, uint64(callerID))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &Account{
+		ID:               res.ID,
+		Name:             res.Name,
+		Email:            res.Email,
+		EmailVerified:    res.EmailVerified,
+		Role:             roleFromAuth(res.Role),
+		TwoFactorEnabled: res.TwoFactorEnabled,
+	}, nil
+}
+
+// DataExport reports the progress of an export started by the caller.
+func (resolver *queryResolver) DataExport(ctx context.Context, id string) (*DataExport, error) {
+	callerID, err := auth.GetUserIdInt(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := resolver.server.exports.Get(id)
+	if err != nil || job.RequestedBy != uint64(callerID) {
+		return nil, export.ErrNotFound
+	}
+
+	return dataExportFromJob(job), nil
+}
+
+func (resolver *queryResolver) APIKeys(ctx context.Context) ([]*APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := auth.GetUserIdInt(ctx, true); err != nil {
+		return nil, err
+	}
+
+	keys, err := resolver.server.accountClient.ListAPIKeys(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	apiKeys := make([]*APIKey, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, apiKeyFromModel(key))
+	}
+	return apiKeys, nil
+}
+
 func (resolver *queryResolver) Product(
 	ctx context.Context,
 	pagination *PaginationInput,
 	query, id *string,
 	viewedProductsIds []*string,
 	byAccountId *bool,
+	categoryId *string,
 ) ([]*Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -74,12 +151,7 @@ func (resolver *queryResolver) Product(
 			log.Println(err)
 			return nil, err
 		}
-		return []*Product{{
-			ID:          res.ID,
-			Name:        res.Name,
-			Description: res.Description,
-			Price:       res.Price,
-		}}, nil
+		return []*Product{productFromModel(res)}, nil
 	}
 	skip, take := uint64(0), uint64(0)
 	if pagination != nil {
@@ -139,11 +211,14 @@ func (resolver *queryResolver) Product(
 		return products, nil
 	}
 
-	q := ""
+	q, category := "", ""
 	if query != nil {
 		q = *query
 	}
-	productList, err := resolver.server.productClient.GetProducts(ctx, skip, take, nil, q)
+	if categoryId != nil {
+		category = *categoryId
+	}
+	productList, err := resolver.server.productClient.GetProducts(ctx, skip, take, nil, q, category)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -151,19 +226,30 @@ func (resolver *queryResolver) Product(
 
 	var products []*Product
 	for _, product := range productList {
-		products = append(products,
-			&Product{
-				ID:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-			},
-		)
+		products = append(products, productFromModel(&product))
 	}
 
 	return products, nil
 }
 
+// Categories returns the categories with the given IDs, or else the children of
+// parentId, which are the root categories when it is not set.
+func (resolver *queryResolver) Categories(ctx context.Context, parentId *string, ids []string) ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	parent := ""
+	if parentId != nil {
+		parent = *parentId
+	}
+	categoryList, err := resolver.server.productClient.GetCategories(ctx, parent, ids)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoriesFromModels(categoryList), nil
+}
+
 func (pagination PaginationInput) bounds() (uint64, uint64) {
 	skipValue := uint64(0)
 	takeValue := uint64(100)
@@ -175,3 +261,202 @@ func (pagination PaginationInput) bounds() (uint64, uint64) {
 	}
 	return skipValue, takeValue
 }
+
+// SearchProducts returns a page of the matching products with the price and
+// category facets of all matches.
+func (resolver *queryResolver) SearchProducts(ctx context.Context, search *ProductSearchInput, pagination *PaginationInput) (*ProductSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	productSearch := productModels.ProductSearch{}
+	if search != nil {
+		productSearch = search.toModel()
+	}
+	if pagination != nil {
+		productSearch.Skip, productSearch.Take = pagination.bounds()
+	}
+	result, err := resolver.server.productClient.SearchProducts(ctx, productSearch)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &ProductSearchResult{
+		Products:     make([]*Product, 0, len(result.Products)),
+		Total:        int(result.Total),
+		PriceBuckets: make([]*PriceBucket, 0, len(result.PriceBuckets)),
+		Categories:   []*CategoryFacet{},
+	}
+	for _, product := range result.Products {
+		res.Products = append(res.Products, productFromModel(product))
+	}
+	for _, bucket := range result.PriceBuckets {
+		res.PriceBuckets = append(res.PriceBuckets, &PriceBucket{
+			From:  bucket.From,
+			To:    bucket.To,
+			Count: int(bucket.Count),
+		})
+	}
+	if len(result.Categories) == 0 {
+		return res, nil
+	}
+
+	// Resolve the counted categories at once, in the order of their counts
+	ids := make([]string, 0, len(result.Categories))
+	for _, count := range result.Categories {
+		ids = append(ids, count.CategoryID)
+	}
+	categoryList, err := resolver.server.productClient.GetCategories(ctx, "", ids)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	categories := make(map[string]*Category, len(categoryList))
+	for _, category := range categoriesFromModels(categoryList) {
+		categories[category.ID] = category
+	}
+	for _, count := range result.Categories {
+		if category, ok := categories[count.CategoryID]; ok {
+			res.Categories = append(res.Categories, &CategoryFacet{
+				Category: category,
+				Count:    int(count.Count),
+			})
+		}
+	}
+	return res, nil
+}
+
+// Products returns a page of the matching products as a connection. Each
+// product carries a cursor, and the next page is the one after the last cursor.
+func (resolver *queryResolver) Products(ctx context.Context, search *ProductSearchInput, first *int, after *string) (*ProductConnection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	productSearch := productModels.ProductSearch{}
+	if search != nil {
+		productSearch = search.toModel()
+	}
+	productSearch.Take = defaultConnectionSize
+	if first != nil {
+		if *first < 1 || *first > maxConnectionSize {
+			return nil, fmt.Errorf("first must be between 1 and %d", maxConnectionSize)
+		}
+		productSearch.Take = uint64(*first)
+	}
+	if after != nil {
+		productSearch.After = *after
+	}
+	result, err := resolver.server.productClient.SearchProducts(ctx, productSearch)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	connection := &ProductConnection{
+		Edges: make([]*ProductEdge, 0, len(result.Products)),
+		PageInfo: &PageInfo{
+			HasNextPage:     result.HasMore,
+			HasPreviousPage: result.HasPrevious,
+		},
+		TotalCount: int(result.Total),
+	}
+	for i, product := range result.Products {
+		connection.Edges = append(connection.Edges, &ProductEdge{
+			Cursor: result.Cursors[i],
+			Node:   productFromModel(product),
+		})
+	}
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.StartCursor = &connection.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+	return connection, nil
+}
+
+// ProductSuggestions completes a search box as the user types, so it gets a
+// short deadline: a late suggestion is of no use.
+func (resolver *queryResolver) ProductSuggestions(ctx context.Context, prefix string, limit *int) (*ProductSuggestions, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	size := 0
+	if limit != nil {
+		size = *limit
+	}
+	suggestions, err := resolver.server.productClient.SuggestProducts(ctx, prefix, size)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &ProductSuggestions{Products: make([]*ProductSuggestion, 0, len(suggestions.Products))}
+	for _, suggestion := range suggestions.Products {
+		res.Products = append(res.Products, &ProductSuggestion{
+			ID:   suggestion.ProductID,
+			Name: suggestion.Name,
+		})
+	}
+	if suggestions.DidYouMean != "" {
+		res.DidYouMean = &suggestions.DidYouMean
+	}
+	return res, nil
+}
+
+func (search ProductSearchInput) toModel() productModels.ProductSearch {
+	productSearch := productModels.ProductSearch{
+		MinPrice: search.MinPrice,
+		MaxPrice: search.MaxPrice,
+	}
+	if search.Query != nil {
+		productSearch.Query = *search.Query
+	}
+	if search.CategoryID != nil {
+		productSearch.CategoryID = *search.CategoryID
+	}
+	if search.SellerID != nil {
+		productSearch.AccountID = *search.SellerID
+	}
+	if search.Sort != nil {
+		switch *search.Sort {
+		case ProductSortPriceAsc:
+			productSearch.Sort = productModels.SortPriceAsc
+		case ProductSortPriceDesc:
+			productSearch.Sort = productModels.SortPriceDesc
+		case ProductSortNewest:
+			productSearch.Sort = productModels.SortNewest
+		}
+	}
+	return productSearch
+}
+
+func (resolver *queryResolver) ReviewsForModeration(ctx context.Context, status ReviewStatus, pagination *PaginationInput) ([]*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+	reviews, err := resolver.server.reviewClient.ListReviewsForModeration(ctx, reviewStatusToModel[status], skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return reviewsFromModels(reviews), nil
+}
+
+func (resolver *queryResolver) PriceSchedules(ctx context.Context, productID string) ([]*PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	schedules, err := resolver.server.productClient.ListPriceSchedules(ctx, productID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	res := make([]*PriceSchedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		res = append(res, priceScheduleFromModel(schedule))
+	}
+	return res, nil
+}
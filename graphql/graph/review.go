@@ -0,0 +1,46 @@
+package graph
+
+import (
+	reviewModels "github.com/rasadov/EcommerceAPI/review/models"
+)
+
+var (
+	reviewStatusToModel = map[ReviewStatus]reviewModels.Status{
+		ReviewStatusPublished: reviewModels.StatusPublished,
+		ReviewStatusPending:   reviewModels.StatusPending,
+		ReviewStatusRejected:  reviewModels.StatusRejected,
+	}
+	reviewStatusFromModel = map[reviewModels.Status]ReviewStatus{
+		reviewModels.StatusPublished: ReviewStatusPublished,
+		reviewModels.StatusPending:   ReviewStatusPending,
+		reviewModels.StatusRejected:  ReviewStatusRejected,
+	}
+)
+
+func reviewFromModel(review *reviewModels.Review) *Review {
+	res := &Review{
+		ID:        int(review.ID),
+		ProductID: review.ProductID,
+		AccountID: int(review.AccountID),
+		Rating:    review.Rating,
+		Text:      review.Text,
+		Status:    reviewStatusFromModel[review.Status],
+		CreatedAt: review.CreatedAt,
+		UpdatedAt: review.UpdatedAt,
+	}
+	if review.ModerationNote != "" {
+		res.ModerationNote = &review.ModerationNote
+	}
+	if review.Reply != "" && review.RepliedAt != nil {
+		res.Reply = &ReviewReply{Text: review.Reply, CreatedAt: *review.RepliedAt}
+	}
+	return res
+}
+
+func reviewsFromModels(reviews []*reviewModels.Review) []*Review {
+	res := make([]*Review, 0, len(reviews))
+	for _, review := range reviews {
+		res = append(res, reviewFromModel(review))
+	}
+	return res
+}
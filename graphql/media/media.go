@@ -0,0 +1,124 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+const (
+	// MaxImageSize is the largest image file accepted, in bytes.
+	MaxImageSize = 10 << 20
+	// maxImagePixels bounds the decoded size of an image, so a small file cannot
+	// expand into gigabytes of memory
+	maxImagePixels = 50_000_000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels.
+	ThumbnailSize = 320
+)
+
+var (
+	ErrImageTooLarge    = errors.New("image is larger than 10 MB or 50 megapixels")
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+)
+
+// Store puts product images and their thumbnails in blob storage.
+type Store struct {
+	storage storage.Storage
+}
+
+func NewStore(storage storage.Storage) *Store {
+	return &Store{storage: storage}
+}
+
+// URL returns where the image or thumbnail at key is served from.
+func (s *Store) URL(key string) string {
+	return s.storage.URL(key)
+}
+
+// PutProductImage stores an image of a product along with a thumbnail. The
+// image is kept as uploaded; GIF thumbnails are encoded as PNG.
+func (s *Store) PutProductImage(ctx context.Context, productID string, file io.Reader) (*productModels.ProductImage, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	thumbnail := &bytes.Buffer{}
+	thumbnailFormat := format
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(thumbnail, Thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: 85})
+	case "png", "gif":
+		thumbnailFormat = "png"
+		err = png.Encode(thumbnail, Thumbnail(img, ThumbnailSize))
+	default:
+		return nil, ErrUnsupportedImage
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := crypt.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	productImage := &productModels.ProductImage{
+		ID:           id,
+		Key:          fmt.Sprintf("products/%s/%s.%s", productID, id, extension(format)),
+		ThumbnailKey: fmt.Sprintf("products/%s/%s_thumb.%s", productID, id, extension(thumbnailFormat)),
+		ContentType:  "image/" + format,
+		Width:        config.Width,
+		Height:       config.Height,
+	}
+	if err = s.storage.Put(ctx, productImage.Key, productImage.ContentType, data); err != nil {
+		return nil, err
+	}
+	if err = s.storage.Put(ctx, productImage.ThumbnailKey, "image/"+thumbnailFormat, thumbnail.Bytes()); err != nil {
+		s.DeleteProductImage(ctx, *productImage)
+		return nil, err
+	}
+	return productImage, nil
+}
+
+// DeleteProductImage removes an image and its thumbnail from storage. Failures
+// are only logged, they leave unused files behind.
+func (s *Store) DeleteProductImage(ctx context.Context, productImage productModels.ProductImage) {
+	for _, key := range []string{productImage.Key, productImage.ThumbnailKey} {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Println("Failed to delete image", key, err)
+		}
+	}
+}
+
+func extension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
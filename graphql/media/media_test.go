@@ -0,0 +1,173 @@
+package media_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/graphql/media"
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStorage fails to put the blobs whose key contains fail, and records
+// the keys deleted.
+type failingStorage struct {
+	storage.Storage
+	fail    string
+	deleted []string
+}
+
+func (s *failingStorage) Put(ctx context.Context, key, contentType string, body []byte) error {
+	if strings.Contains(key, s.fail) {
+		return errors.New("storage unavailable")
+	}
+	return s.Storage.Put(ctx, key, contentType, body)
+}
+
+func (s *failingStorage) Delete(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return s.Storage.Delete(ctx, key)
+}
+
+func setupStore(t *testing.T) (*media.Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	local, err := storage.NewLocalStorage(dir, "http://localhost:8080/media")
+	require.NoError(t, err)
+	return media.NewStore(local), dir
+}
+
+func encodeImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestStore_PutProductImage(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		format, extension, thumbnailExtension string
+		thumbnailFormat                       string
+	}{
+		{"jpeg", "jpg", "jpg", "jpeg"},
+		{"png", "png", "png", "png"},
+		{"gif", "gif", "png", "png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			store, dir := setupStore(t)
+			data := encodeImage(t, tt.format, 800, 400)
+
+			productImage, err := store.PutProductImage(ctx, "product-1", bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, "products/product-1/"+productImage.ID+"."+tt.extension, productImage.Key)
+			assert.Equal(t, "products/product-1/"+productImage.ID+"_thumb."+tt.thumbnailExtension, productImage.ThumbnailKey)
+			assert.Equal(t, "image/"+tt.format, productImage.ContentType)
+			assert.Equal(t, 800, productImage.Width)
+			assert.Equal(t, 400, productImage.Height)
+			assert.Equal(t, "http://localhost:8080/media/"+productImage.Key, store.URL(productImage.Key))
+
+			// The image is kept as uploaded
+			stored, err := os.ReadFile(filepath.Join(dir, productImage.Key))
+			require.NoError(t, err)
+			assert.Equal(t, data, stored)
+
+			file, err := os.Open(filepath.Join(dir, productImage.ThumbnailKey))
+			require.NoError(t, err)
+			defer file.Close()
+			config, format, err := image.DecodeConfig(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.thumbnailFormat, format)
+			assert.Equal(t, media.ThumbnailSize, config.Width)
+			assert.Equal(t, media.ThumbnailSize/2, config.Height)
+		})
+	}
+}
+
+func TestStore_PutProductImage_Rejected(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not an image", func(t *testing.T) {
+		store, dir := setupStore(t)
+		_, err := store.PutProductImage(ctx, "product-1", strings.NewReader("<svg></svg>"))
+		assert.ErrorIs(t, err, media.ErrUnsupportedImage)
+		entries, _ := os.ReadDir(dir)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("truncated image", func(t *testing.T) {
+		store, _ := setupStore(t)
+		data := encodeImage(t, "png", 100, 100)
+		_, err := store.PutProductImage(ctx, "product-1", bytes.NewReader(data[:len(data)/2]))
+		assert.ErrorIs(t, err, media.ErrUnsupportedImage)
+	})
+
+	t.Run("file too large", func(t *testing.T) {
+		store, _ := setupStore(t)
+		data := append(encodeImage(t, "png", 10, 10), make([]byte, media.MaxImageSize)...)
+		_, err := store.PutProductImage(ctx, "product-1", bytes.NewReader(data))
+		assert.ErrorIs(t, err, media.ErrImageTooLarge)
+	})
+
+	t.Run("too many pixels", func(t *testing.T) {
+		store, _ := setupStore(t)
+		// A small GIF claiming a 10000x10000 pixels screen
+		data := encodeImage(t, "gif", 1, 1)
+		copy(data[6:10], []byte{0x10, 0x27, 0x10, 0x27})
+		_, err := store.PutProductImage(ctx, "product-1", bytes.NewReader(data))
+		assert.ErrorIs(t, err, media.ErrImageTooLarge)
+	})
+}
+
+func TestStore_PutProductImage_ThumbnailFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	local, err := storage.NewLocalStorage(dir, "http://localhost:8080/media")
+	require.NoError(t, err)
+	failing := &failingStorage{Storage: local, fail: "_thumb"}
+	store := media.NewStore(failing)
+
+	_, err = store.PutProductImage(ctx, "product-1", bytes.NewReader(encodeImage(t, "png", 400, 400)))
+	assert.EqualError(t, err, "storage unavailable")
+
+	// The image stored first is removed again
+	require.Len(t, failing.deleted, 2)
+	entries, err := os.ReadDir(filepath.Join(dir, "products", "product-1"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestStore_DeleteProductImage(t *testing.T) {
+	ctx := context.Background()
+	store, dir := setupStore(t)
+	productImage, err := store.PutProductImage(ctx, "product-1", bytes.NewReader(encodeImage(t, "png", 400, 400)))
+	require.NoError(t, err)
+
+	store.DeleteProductImage(ctx, *productImage)
+	for _, key := range []string{productImage.Key, productImage.ThumbnailKey} {
+		_, err := os.Stat(filepath.Join(dir, key))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,50 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Thumbnail scales img down to fit in a size by size square, keeping its aspect
+// ratio. Each pixel is the average of the pixels it covers. Images that already
+// fit are returned as they are.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if srcWidth <= size && srcHeight <= size {
+		return img
+	}
+	width, height := size, size
+	if srcWidth > srcHeight {
+		height = max(1, srcHeight*size/srcWidth)
+	} else {
+		width = max(1, srcWidth*size/srcHeight)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+	return dst
+}
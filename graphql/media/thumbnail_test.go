@@ -0,0 +1,68 @@
+package media_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/graphql/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail_Size(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		thumbnail     image.Point
+	}{
+		{"landscape", 1000, 500, image.Pt(320, 160)},
+		{"portrait", 500, 1000, image.Pt(160, 320)},
+		{"square", 640, 640, image.Pt(320, 320)},
+		{"thin strip", 10000, 10, image.Pt(320, 1)},
+		{"one side too long", 321, 100, image.Pt(320, 99)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			assert.Equal(t, tt.thumbnail, media.Thumbnail(img, 320).Bounds().Size())
+		})
+	}
+}
+
+func TestThumbnail_SmallImagesAreKept(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 320, 200))
+	assert.Same(t, img, media.Thumbnail(img, 320))
+}
+
+func TestThumbnail_AveragesPixels(t *testing.T) {
+	// Columns alternate between black and white, and the image does not start
+	// at the origin
+	img := image.NewRGBA(image.Rect(10, 10, 14, 12))
+	for y := 10; y < 12; y++ {
+		for x := 10; x < 14; x++ {
+			if x%2 == 1 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	thumbnail := media.Thumbnail(img, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), thumbnail.Bounds())
+	for x := 0; x < 2; x++ {
+		assert.Equal(t, color.RGBA{127, 127, 127, 255}, thumbnail.At(x, 0))
+	}
+}
+
+func TestThumbnail_KeepsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.NRGBA{255, 0, 0, 255})
+		img.Set(x, 1, color.NRGBA{255, 0, 0, 255})
+	}
+
+	thumbnail := media.Thumbnail(img, 2)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, thumbnail.At(0, 0))
+	assert.Equal(t, color.RGBA{0, 0, 0, 0}, thumbnail.At(1, 1))
+}
@@ -3,7 +3,6 @@ package client
 import (
 	"context"
 	"log"
-	"time"
 
 	"github.com/rasadov/EcommerceAPI/order/models"
 	"github.com/rasadov/EcommerceAPI/order/proto/pb"
@@ -43,6 +42,7 @@ func (client *Client) PostOrder(
 		protoProducts = append(protoProducts, &pb.OrderProduct{
 			Id:       p.ID,
 			Quantity: p.Quantity,
+			Sku:      p.SKU,
 		})
 	}
 
@@ -56,20 +56,7 @@ func (client *Client) PostOrder(
 	if err != nil {
 		return nil, err
 	}
-	// Create response order
-	newOrder := r.Order
-	newOrderCreatedAt := time.Time{}
-	err = newOrderCreatedAt.UnmarshalBinary(newOrder.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return &models.Order{
-		ID:         uint(r.Order.GetId()),
-		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
-		AccountID:  newOrder.AccountId,
-		Products:   products,
-	}, nil
+	return orderFromProto(r.Order)
 }
 
 func (client *Client) GetOrdersForAccount(ctx context.Context, accountID uint64) ([]models.Order, error) {
@@ -84,43 +71,82 @@ func (client *Client) GetOrdersForAccount(ctx context.Context, accountID uint64)
 	// Create response orders
 	var orders []models.Order
 	for _, orderProto := range r.Orders {
-		newOrder := models.Order{
-			ID:         uint(orderProto.Id),
-			TotalPrice: orderProto.TotalPrice,
-			AccountID:  orderProto.AccountId,
-		}
-		newOrder.CreatedAt = time.Time{}
-		err = newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
+		newOrder, err := orderFromProto(orderProto)
 		if err != nil {
 			return nil, err
 		}
-
-		var products []*models.OrderedProduct
-		for _, p := range orderProto.Products {
-			products = append(products, &models.OrderedProduct{
-				ID:          p.Id,
-				Quantity:    p.Quantity,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
-		}
-		newOrder.Products = products
-
-		orders = append(orders, newOrder)
+		orders = append(orders, *newOrder)
 	}
 	return orders, nil
 }
 
-func (client *Client) UpdateOrderStatus(ctx context.Context, orderId uint64, status string) error {
-	_, err := client.service.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{
+// UpdateOrderStatus moves an order to a status of its lifecycle, or to the one
+// a payment status leads to, and returns it with its status history.
+func (client *Client) UpdateOrderStatus(ctx context.Context, orderId uint64, status, reason string) (*models.Order, error) {
+	r, err := client.service.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{
 		OrderId: orderId,
 		Status:  status,
+		Reason:  reason,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return orderFromProto(r.Order)
+}
 
+// VerifyPurchase returns the paid order in which the account bought the product.
+// It fails with a NotFound status when there is none.
+func (client *Client) VerifyPurchase(ctx context.Context, accountID uint64, productID string) (*models.Order, error) {
+	r, err := client.service.VerifyPurchase(ctx, &pb.VerifyPurchaseRequest{
+		AccountId: accountID,
+		ProductId: productID,
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	order := &models.Order{ID: uint(r.OrderId), AccountID: accountID}
+	if err = order.CreatedAt.UnmarshalBinary(r.PurchasedAt); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
 
-	return nil
+// orderFromProto decodes an order. The order service prices the lines, variants
+// can cost more than the product.
+func orderFromProto(orderProto *pb.Order) (*models.Order, error) {
+	order := &models.Order{
+		ID:            uint(orderProto.Id),
+		TotalPrice:    orderProto.TotalPrice,
+		AccountID:     orderProto.AccountId,
+		Status:        models.OrderStatus(orderProto.Status),
+		Products:      make([]*models.OrderedProduct, 0, len(orderProto.Products)),
+		StatusHistory: make([]models.OrderStatusChange, 0, len(orderProto.StatusHistory)),
+	}
+	if err := order.CreatedAt.UnmarshalBinary(orderProto.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, p := range orderProto.Products {
+		order.Products = append(order.Products, &models.OrderedProduct{
+			ID:          p.Id,
+			Quantity:    p.Quantity,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Currency:    p.Currency,
+			SKU:         p.Sku,
+		})
+	}
+	for _, c := range orderProto.StatusHistory {
+		change := models.OrderStatusChange{
+			OrderID: order.ID,
+			From:    models.OrderStatus(c.From),
+			To:      models.OrderStatus(c.To),
+			Reason:  c.Reason,
+		}
+		if err := change.ChangedAt.UnmarshalBinary(c.ChangedAt); err != nil {
+			return nil, err
+		}
+		order.StatusHistory = append(order.StatusHistory, change)
+	}
+	return order, nil
 }
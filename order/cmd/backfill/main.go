@@ -0,0 +1,67 @@
+// Command backfill snapshots the product details and prices of the order lines
+// placed before orders recorded them.
+//
+//	backfill [flags]
+//
+// It is safe to run while the order service is up, and to run again: lines
+// that already have a snapshot are skipped.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/rasadov/EcommerceAPI/order/config"
+	"github.com/rasadov/EcommerceAPI/order/internal"
+	product "github.com/rasadov/EcommerceAPI/product/client"
+)
+
+// backfillTimeout bounds a whole run.
+const backfillTimeout = time.Hour
+
+func main() {
+	log.SetFlags(0)
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	databaseURL := flags.String("db", config.DatabaseUrl, "URL of the order database, DATABASE_URL by default")
+	productURL := flags.String("product", config.ProductUrl, "address of the product service, PRODUCT_SERVICE_URL by default")
+	currency := flags.String("currency", config.Currency, "currency of the catalog prices, CURRENCY or USD by default")
+	_ = flags.Parse(os.Args[1:])
+	if *databaseURL == "" || *productURL == "" {
+		log.Fatal("A database URL and a product service address are required, pass -db and -product")
+	}
+
+	db, err := gorm.Open(postgres.Open(*databaseURL), &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The columns of the snapshot are added if the service has not started since
+	repository, err := internal.NewPostgresRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer repository.Close()
+
+	productClient, err := product.NewClient(*productURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer productClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, backfillTimeout)
+	defer cancel()
+
+	result, err := internal.BackfillOrderLines(ctx, db, productClient, *currency)
+	if err != nil {
+		log.Fatalf("Backfilling order lines: %v", err)
+	}
+	log.Printf("Backfilled %d order lines, %d of deleted products were left as they are", result.Filled, result.Missing)
+}
@@ -0,0 +1,63 @@
+// Command migratestatus moves the orders placed before the order lifecycle to
+// one of its statuses and starts their status history.
+//
+//	migratestatus [flags]
+//
+// Orders without a status are pending payment, and orders with a status
+// reported by the payment service get the status it leads to. Orders with any
+// other status are reported and left as they are, unless -unknown names the
+// status to move them to. It is safe to run again.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/rasadov/EcommerceAPI/order/config"
+	"github.com/rasadov/EcommerceAPI/order/internal"
+	"github.com/rasadov/EcommerceAPI/order/models"
+)
+
+func main() {
+	log.SetFlags(0)
+	flags := flag.NewFlagSet("migratestatus", flag.ExitOnError)
+	databaseURL := flags.String("db", config.DatabaseUrl, "URL of the order database, DATABASE_URL by default")
+	unknown := flags.String("unknown", "", "status to move orders with an unknown status to, e.g. cancelled; they are only reported by default")
+	_ = flags.Parse(os.Args[1:])
+	if *databaseURL == "" {
+		log.Fatal("A database URL is required, pass -db")
+	}
+
+	db, err := gorm.Open(postgres.Open(*databaseURL), &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The status history table is added if the service has not started since
+	repository, err := internal.NewPostgresRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer repository.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := internal.MigrateOrderStatuses(ctx, db, models.OrderStatus(strings.ToLower(*unknown)))
+	if err != nil {
+		log.Fatalf("Migrating order statuses: %v", err)
+	}
+	log.Printf("Migrated %d orders, started the status history of %d", result.Migrated, result.Started)
+	for status, count := range result.Unknown {
+		log.Printf("Left %d orders with the unknown status %q, pass -unknown to move them", count, status)
+	}
+	if len(result.Unknown) > 0 {
+		os.Exit(1)
+	}
+}
@@ -39,6 +39,6 @@ func main() {
 	})
 	defer repository.Close()
 	log.Println("Listening on port 8080...")
-	service := internal.NewOrderService(repository, producer)
+	service := internal.NewOrderService(repository, producer, config.Currency)
 	log.Fatal(internal.ListenGRPC(service, config.AccountUrl, config.ProductUrl, 8080))
 }
@@ -3,10 +3,13 @@ package config
 import "os"
 
 var (
-	DatabaseUrl      string
-	AccountUrl       string
+	DatabaseUrl string
+	AccountUrl  string
+	// ProductUrl is the internal listener of the product service, which serves the stock reservations
 	ProductUrl       string
 	BootstrapServers string
+	// Currency is the ISO code of the catalog prices, recorded on order lines
+	Currency string
 )
 
 func init() {
@@ -14,4 +17,8 @@ func init() {
 	AccountUrl = os.Getenv("ACCOUNT_SERVICE_URL")
 	ProductUrl = os.Getenv("PRODUCT_SERVICE_URL")
 	BootstrapServers = os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
+	Currency = os.Getenv("CURRENCY")
+	if Currency == "" {
+		Currency = "USD"
+	}
 }
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rasadov/EcommerceAPI/order/models"
+	product "github.com/rasadov/EcommerceAPI/product/client"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+)
+
+const (
+	// backfillBatchSize is how many order lines are snapshotted at a time
+	backfillBatchSize = 500
+	// backfillHistoryPage is how many price changes of a product are fetched at
+	// a time, the most the product service lists at once
+	backfillHistoryPage = 100
+)
+
+// BackfillResult counts the order lines a backfill went through.
+type BackfillResult struct {
+	Filled int
+	// Missing lines are of products that were deleted, they are left as they are
+	Missing int
+}
+
+// legacyLine is an order line placed before snapshots, with the time of its order.
+type legacyLine struct {
+	ID        uint
+	ProductID string
+	SKU       string
+	OrderedAt time.Time
+}
+
+// BackfillOrderLines snapshots the order lines placed before orders recorded
+// what was bought. Their product is looked up as it is now, and the price is
+// taken from its full price history at the time of the order. Variants have no
+// price history, they get their current price. Lines that already have a
+// snapshot are skipped, so a backfill can be run again.
+func BackfillOrderLines(ctx context.Context, db *gorm.DB, productClient *product.Client, currency string) (*BackfillResult, error) {
+	result := &BackfillResult{}
+	histories := map[string][]*productModels.PriceChange{}
+	var lastID uint
+	for {
+		var lines []legacyLine
+		err := db.WithContext(ctx).
+			Table("order_products op").
+			Select("op.id, op.product_id, op.sku, o.created_at AS ordered_at").
+			Joins("JOIN orders o ON o.id = op.order_id").
+			Where("op.id > ? AND (op.currency IS NULL OR op.currency = '')", lastID).
+			Order("op.id").
+			Limit(backfillBatchSize).
+			Scan(&lines).Error
+		if err != nil {
+			return result, err
+		}
+		if len(lines) == 0 {
+			return result, nil
+		}
+		lastID = lines[len(lines)-1].ID
+
+		products, err := backfillProducts(ctx, productClient, lines)
+		if err != nil {
+			return result, err
+		}
+		for _, line := range lines {
+			p, ok := products[line.ProductID]
+			if !ok {
+				result.Missing++
+				continue
+			}
+			price := p.Price
+			if line.SKU != "" {
+				if variant := p.Variant(line.SKU); variant != nil {
+					price = variant.Price
+				}
+			} else {
+				history, ok := histories[p.ID]
+				if !ok {
+					history, err = priceHistory(ctx, productClient, p.ID)
+					if err != nil {
+						return result, err
+					}
+					histories[p.ID] = history
+				}
+				price = PriceAt(history, line.OrderedAt, price)
+			}
+
+			err = db.WithContext(ctx).
+				Model(&models.ProductsInfo{}).
+				Where("id = ?", line.ID).
+				Updates(map[string]interface{}{
+					"name":        p.Name,
+					"description": p.Description,
+					"price":       price,
+					"currency":    currency,
+				}).Error
+			if err != nil {
+				return result, err
+			}
+			result.Filled++
+		}
+	}
+}
+
+// backfillProducts looks up the products of the lines by ID.
+func backfillProducts(ctx context.Context, productClient *product.Client, lines []legacyLine) (map[string]productModels.Product, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, line := range lines {
+		if !seen[line.ProductID] {
+			seen[line.ProductID] = true
+			ids = append(ids, line.ProductID)
+		}
+	}
+	list, err := productClient.GetProducts(ctx, 0, 0, ids, "", "")
+	if err != nil {
+		return nil, err
+	}
+	products := make(map[string]productModels.Product, len(list))
+	for _, p := range list {
+		products[p.ID] = p
+	}
+	return products, nil
+}
+
+// priceHistory pages through all price changes of a product, newest first.
+func priceHistory(ctx context.Context, productClient *product.Client, productID string) ([]*productModels.PriceChange, error) {
+	var history []*productModels.PriceChange
+	for {
+		page, err := productClient.GetPriceHistory(ctx, productID, uint64(len(history)), backfillHistoryPage)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, page...)
+		if len(page) < backfillHistoryPage {
+			return history, nil
+		}
+	}
+}
+
+// PriceAt returns the price a product had at a time, from its price changes
+// newest first. Before the oldest change it had the price that change replaced,
+// and without changes current is returned.
+func PriceAt(history []*productModels.PriceChange, at time.Time, current float64) float64 {
+	for _, change := range history {
+		if !change.ChangedAt.After(at) {
+			return change.NewPrice
+		}
+	}
+	if len(history) > 0 && history[len(history)-1].OldPrice != 0 {
+		return history[len(history)-1].OldPrice
+	}
+	return current
+}
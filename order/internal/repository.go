@@ -2,17 +2,28 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	"github.com/rasadov/EcommerceAPI/order/models"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrStatusChanged is returned when the status of an order changed since it
+	// was read
+	ErrStatusChanged = errors.New("order status was changed")
+)
+
 type Repository interface {
 	Close()
 	PutOrder(ctx context.Context, order *models.Order) error
+	GetOrder(ctx context.Context, orderId uint64) (*models.Order, error)
 	GetOrdersForAccount(ctx context.Context, accountId uint64) ([]*models.Order, error)
-	UpdateOrderStatus(ctx context.Context, orderId uint64, status string) error
+	UpdateOrderStatus(ctx context.Context, orderId uint64, from models.OrderStatus, change models.OrderStatusChange) error
+	GetPaidOrderWithProduct(ctx context.Context, accountId uint64, productId string) (*models.Order, error)
 }
 
 type postgresRepository struct {
@@ -30,7 +41,7 @@ func NewPostgresRepository(db *gorm.DB) (Repository, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&models.Order{}, &models.ProductsInfo{})
+	err = db.AutoMigrate(&models.Order{}, &models.ProductsInfo{}, &models.OrderStatusChange{})
 	if err != nil {
 		return nil, err
 	}
@@ -49,20 +60,36 @@ func (repository *postgresRepository) Close() {
 	}
 }
 
+// PutOrder saves a new order with its lines and the first entry of its status
+// history.
 func (repository *postgresRepository) PutOrder(ctx context.Context, order *models.Order) error {
 	tx := repository.db.WithContext(ctx).Begin()
 
-	err := tx.WithContext(ctx).Create(&order).Error
+	err := tx.WithContext(ctx).Omit("StatusHistory").Create(&order).Error
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	for i := range order.StatusHistory {
+		order.StatusHistory[i].OrderID = order.ID
+	}
+	if len(order.StatusHistory) > 0 {
+		if err = tx.Create(&order.StatusHistory).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 
 	for _, product := range order.Products {
 		orderedProduct := models.ProductsInfo{
-			OrderID:   order.ID,
-			ProductID: product.ID,
-			Quantity:  int(product.Quantity),
+			OrderID:     order.ID,
+			ProductID:   product.ID,
+			SKU:         product.SKU,
+			Quantity:    int(product.Quantity),
+			Name:        product.Name,
+			Description: product.Description,
+			Price:       product.Price,
+			Currency:    product.Currency,
 		}
 		err = tx.Create(&orderedProduct).Error
 		if err != nil {
@@ -77,24 +104,90 @@ func (repository *postgresRepository) PutOrder(ctx context.Context, order *model
 	return nil
 }
 
+// GetOrder returns an order with its status history, or ErrOrderNotFound.
+func (repository *postgresRepository) GetOrder(ctx context.Context, orderId uint64) (*models.Order, error) {
+	var order models.Order
+	err := repository.db.WithContext(ctx).
+		Preload("StatusHistory", orderByID).
+		Preload("ProductsInfos", orderByID).
+		First(&order, orderId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	order.Products = orderedProducts(order.ProductsInfos)
+	return &order, nil
+}
+
+// GetOrdersForAccount returns the orders of the account with their status
+// history and their lines as they were ordered.
 func (repository *postgresRepository) GetOrdersForAccount(ctx context.Context, accountId uint64) ([]*models.Order, error) {
 	var orders []*models.Order
 	err := repository.db.WithContext(ctx).
-		Table("orders o").
-		Select("o.id, o.created_at, o.account_id, o.total_price::money::numeric::float8, op.product_id, op.quantity").
-		Joins("JOIN order_products op on o.id = op.order_id").
-		Where("o.account_id = ?", accountId).
-		Order("o.id").
-		Scan(&orders).Error
-
+		Preload("StatusHistory", orderByID).
+		Preload("ProductsInfos", orderByID).
+		Where("account_id = ?", accountId).
+		Order("id").
+		Find(&orders).Error
 	if err != nil {
 		return nil, err
 	}
+
+	for _, order := range orders {
+		order.Products = orderedProducts(order.ProductsInfos)
+	}
 	return orders, nil
 }
 
-func (repository *postgresRepository) UpdateOrderStatus(ctx context.Context, orderId uint64, status string) error {
-	return repository.db.WithContext(ctx).Table("orders o").
-		Where("id = ?", orderId).
-		Update("status", status).Error
+// UpdateOrderStatus moves an order to the status of the change and records it,
+// if the order still has the status from. Otherwise it returns ErrStatusChanged,
+// which keeps concurrent updates from skipping the transition checks.
+func (repository *postgresRepository) UpdateOrderStatus(ctx context.Context, orderId uint64, from models.OrderStatus, change models.OrderStatusChange) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", orderId, from).
+			Update("status", change.To)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrStatusChanged
+		}
+		change.OrderID = uint(orderId)
+		change.From = from
+		if change.ChangedAt.IsZero() {
+			change.ChangedAt = time.Now().UTC()
+		}
+		return tx.Create(&change).Error
+	})
+}
+
+// GetPaidOrderWithProduct returns the first order of the account that contains
+// the product and was paid for, and neither cancelled nor refunded since, or
+// gorm.ErrRecordNotFound.
+func (repository *postgresRepository) GetPaidOrderWithProduct(ctx context.Context, accountId uint64, productId string) (*models.Order, error) {
+	var order models.Order
+	err := repository.db.WithContext(ctx).
+		Where("account_id = ? AND status IN ?", accountId, models.PaidStatuses).
+		Where("EXISTS (SELECT 1 FROM order_products op WHERE op.order_id = orders.id AND op.product_id = ?)", productId).
+		Order("id").
+		First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+func orderedProducts(infos []models.ProductsInfo) []*models.OrderedProduct {
+	products := make([]*models.OrderedProduct, 0, len(infos))
+	for _, info := range infos {
+		products = append(products, info.OrderedProduct())
+	}
+	return products
 }
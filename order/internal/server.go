@@ -2,21 +2,31 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"slices"
+	"strings"
 
-	mapset "github.com/deckarep/golang-set/v2"
 	account "github.com/rasadov/EcommerceAPI/account/client"
 	"github.com/rasadov/EcommerceAPI/order/models"
 	"github.com/rasadov/EcommerceAPI/order/proto/pb"
 	product "github.com/rasadov/EcommerceAPI/product/client"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+var (
+	ErrVariantRequired    = errors.New("a variant has to be chosen for this product")
+	ErrUnknownVariant     = errors.New("product has no variant with this SKU")
+	ErrProductUnavailable = errors.New("product is not published")
+)
+
 type grpcServer struct {
 	pb.UnimplementedOrderServiceServer
 	service       Service
@@ -65,7 +75,7 @@ func (server *grpcServer) PostOrder(ctx context.Context, request *pb.PostOrderRe
 	for _, p := range request.Products {
 		productIDs = append(productIDs, p.Id)
 	}
-	orderedProducts, err := server.productClient.GetProducts(ctx, 0, 0, productIDs, "")
+	orderedProducts, err := server.productClient.GetProducts(ctx, 0, 0, productIDs, "", "")
 	if err != nil {
 		log.Println("Error getting ordered products", err)
 		return nil, err
@@ -74,52 +84,68 @@ func (server *grpcServer) PostOrder(ctx context.Context, request *pb.PostOrderRe
 	var products []*models.OrderedProduct
 	totalPrice := 0.0
 
-	for _, p := range orderedProducts {
+	for _, requestProduct := range request.Products {
+		if requestProduct.Quantity == 0 {
+			continue
+		}
+		i := slices.IndexFunc(orderedProducts, func(p productModels.Product) bool {
+			return p.ID == requestProduct.Id
+		})
+		if i == -1 {
+			continue
+		}
+		p := orderedProducts[i]
+		// Drafts and archived products are still found by ID but cannot be ordered
+		if !p.Published() {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v: %s", ErrProductUnavailable, p.ID)
+		}
 		productObj := &models.OrderedProduct{
 			ID:          p.ID,
 			Name:        p.Name,
 			Description: p.Description,
 			Price:       p.Price,
-			Quantity:    0,
+			Quantity:    requestProduct.Quantity,
 		}
-		for _, requestProduct := range request.Products {
-			if requestProduct.Id == p.ID {
-				productObj.Quantity = requestProduct.Quantity
-				break
+
+		// Products with variants are ordered by SKU, at the price of the variant
+		if len(p.Variants) > 0 || requestProduct.Sku != "" {
+			if requestProduct.Sku == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "%v: %s", ErrVariantRequired, p.ID)
 			}
+			variant := p.Variant(requestProduct.Sku)
+			if variant == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v: %s", ErrUnknownVariant, requestProduct.Sku)
+			}
+			productObj.SKU = variant.SKU
+			productObj.Price = variant.Price
 		}
 
-		if productObj.Quantity != 0 {
-			products = append(products, productObj)
-			totalPrice += productObj.Price * float64(productObj.Quantity)
-		}
+		products = append(products, productObj)
+		totalPrice += productObj.Price * float64(productObj.Quantity)
 	}
 
-	postOrder, err := server.service.PostOrder(ctx, request.AccountId, totalPrice, products)
+	// Hold the stock until the order is paid for, this fails if a product sold out
+	var items []productModels.ReservationItem
+	for _, p := range products {
+		items = append(items, productModels.ReservationItem{ProductID: p.ID, SKU: p.SKU, Quantity: int(p.Quantity)})
+	}
+	reservation, err := server.productClient.ReserveStock(ctx, items)
 	if err != nil {
-		log.Println("Error posting postOrder", err)
+		log.Println("Error reserving stock", err)
 		return nil, err
 	}
 
-	orderProto := &pb.Order{
-		Id:         uint64(postOrder.ID),
-		AccountId:  postOrder.AccountID,
-		TotalPrice: postOrder.TotalPrice,
-		Products:   []*pb.ProductInfo{},
-	}
-	orderProto.CreatedAt, _ = postOrder.CreatedAt.MarshalBinary()
-	for _, p := range postOrder.Products {
-		orderProto.Products = append(orderProto.Products, &pb.ProductInfo{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+	postOrder, err := server.service.PostOrder(ctx, request.AccountId, totalPrice, products, reservation.ID)
+	if err != nil {
+		log.Println("Error posting postOrder", err)
+		if releaseErr := server.productClient.ReleaseReservation(ctx, reservation.ID); releaseErr != nil {
+			log.Println("Error releasing reservation", releaseErr)
+		}
+		return nil, err
 	}
 
 	return &pb.PostOrderResponse{
-		Order: orderProto,
+		Order: orderToProto(postOrder),
 	}, nil
 }
 
@@ -130,68 +156,114 @@ func (server *grpcServer) GetOrdersForAccount(ctx context.Context, request *wrap
 		return nil, err
 	}
 
-	// Taking unique products. We use set to avoid repeating
-	productIDsSet := mapset.NewSet[string]()
-	for _, o := range accountOrders {
-		for _, p := range o.Products {
-			productIDsSet.Add(p.ID)
-		}
+	// The lines are returned as they were ordered, whatever the products are now
+	var orders []*pb.Order
+	for _, order := range accountOrders {
+		orders = append(orders, orderToProto(order))
 	}
+	return &pb.GetOrdersForAccountResponse{Orders: orders}, nil
+}
 
-	productIDs := productIDsSet.ToSlice()
-
-	products, err := server.productClient.GetProducts(ctx, 0, 0, productIDs, "")
+// UpdateOrderStatus moves an order along its lifecycle. The statuses reported
+// by the payment service are accepted as the status they lead to.
+func (server *grpcServer) UpdateOrderStatus(ctx context.Context, request *pb.UpdateOrderStatusRequest) (*pb.UpdateOrderStatusResponse, error) {
+	orderStatus, reason := models.OrderStatus(request.Status), request.Reason
+	if paymentStatus, ok := models.PaymentStatuses[request.Status]; ok {
+		orderStatus = paymentStatus
+		if reason == "" {
+			reason = "payment " + strings.ToLower(request.Status)
+		}
+	}
+	order, change, err := server.service.UpdateOrderStatus(ctx, request.OrderId, orderStatus, reason)
 	if err != nil {
-		log.Println("Error getting account products: ", err)
+		log.Println("Error updating order status", err)
+		switch {
+		case errors.Is(err, ErrOrderNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, ErrInvalidStatus):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrStatusChanged):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 		return nil, err
 	}
 
-	// Collecting orders
-
-	var orders []*pb.Order
-	for _, order := range accountOrders {
-		// Encode order
-		encodedOrder := &pb.Order{
-			AccountId:  order.AccountID,
-			Id:         uint64(order.ID),
-			TotalPrice: order.TotalPrice,
-			Products:   []*pb.ProductInfo{},
+	// Only the call that moved the order settles its stock, not the repeated
+	// notifications
+	if order.ReservationID != "" && change != nil {
+		if err = server.settleReservation(ctx, order.ReservationID, change); err != nil {
+			// The status is saved either way, an expired reservation cannot be committed
+			log.Println("Error settling reservation", err)
 		}
-		encodedOrder.CreatedAt, _ = order.CreatedAt.MarshalBinary()
-
-		// Decorate orders with products
-		for _, orderedProduct := range order.Products {
-			// Populate product fields
-			for _, prod := range products {
-				if prod.ID == orderedProduct.ID {
-					orderedProduct.Name = prod.Name
-					orderedProduct.Description = prod.Description
-					orderedProduct.Price = prod.Price
-					break
-				}
-			}
+	}
 
-			encodedOrder.Products = append(encodedOrder.Products, &pb.ProductInfo{
-				Id:          orderedProduct.ID,
-				Name:        orderedProduct.Name,
-				Description: orderedProduct.Description,
-				Price:       orderedProduct.Price,
-				Quantity:    orderedProduct.Quantity,
-			})
-		}
+	return &pb.UpdateOrderStatusResponse{Order: orderToProto(order)}, nil
+}
 
-		orders = append(orders, encodedOrder)
+// VerifyPurchase tells whether an account paid for an order containing the
+// product, answering NotFound when it did not.
+func (server *grpcServer) VerifyPurchase(ctx context.Context, request *pb.VerifyPurchaseRequest) (*pb.VerifyPurchaseResponse, error) {
+	order, err := server.service.VerifyPurchase(ctx, request.AccountId, request.ProductId)
+	if errors.Is(err, ErrNotPurchased) {
+		return nil, status.Error(codes.NotFound, err.Error())
 	}
-	return &pb.GetOrdersForAccountResponse{Orders: orders}, nil
+	if err != nil {
+		log.Println("Error verifying purchase", err)
+		return nil, err
+	}
+	res := &pb.VerifyPurchaseResponse{OrderId: uint64(order.ID)}
+	res.PurchasedAt, _ = order.CreatedAt.MarshalBinary()
+	return res, nil
 }
 
-func (server *grpcServer) UpdateOrderStatus(ctx context.Context, request *pb.UpdateOrderStatusRequest) (*emptypb.Empty, error) {
-	err := server.service.UpdateOrderStatus(ctx, request.OrderId, request.Status)
+// settleReservation commits the stock held for an order once the payment went
+// through, releases it when the order is cancelled before it was paid for, and
+// puts it back in stock when a paid order is cancelled or refunded.
+func (server *grpcServer) settleReservation(ctx context.Context, reservationID string, change *models.OrderStatusChange) error {
+	switch {
+	case change.From == models.StatusPendingPayment && change.To == models.StatusPaid:
+		return server.productClient.CommitReservation(ctx, reservationID)
+	case change.From == models.StatusPendingPayment && change.To == models.StatusCancelled:
+		return server.productClient.ReleaseReservation(ctx, reservationID)
+	case change.To == models.StatusCancelled, change.To == models.StatusRefunded:
+		return server.productClient.RestockReservation(ctx, reservationID)
+	}
+	return nil
+}
 
-	if err != nil {
-		log.Println("Error updating order status", err)
-		return nil, err
+func orderToProto(order *models.Order) *pb.Order {
+	res := &pb.Order{
+		Id:            uint64(order.ID),
+		AccountId:     order.AccountID,
+		TotalPrice:    order.TotalPrice,
+		Status:        string(order.Status),
+		Products:      make([]*pb.ProductInfo, 0, len(order.Products)),
+		StatusHistory: make([]*pb.OrderStatusChange, 0, len(order.StatusHistory)),
+	}
+	res.CreatedAt, _ = order.CreatedAt.MarshalBinary()
+	for _, p := range order.Products {
+		res.Products = append(res.Products, orderedProductToProto(p))
+	}
+	for _, change := range order.StatusHistory {
+		c := &pb.OrderStatusChange{
+			From:   string(change.From),
+			To:     string(change.To),
+			Reason: change.Reason,
+		}
+		c.ChangedAt, _ = change.ChangedAt.MarshalBinary()
+		res.StatusHistory = append(res.StatusHistory, c)
 	}
+	return res
+}
 
-	return &emptypb.Empty{}, nil
+func orderedProductToProto(p *models.OrderedProduct) *pb.ProductInfo {
+	return &pb.ProductInfo{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Quantity:    p.Quantity,
+		Sku:         p.SKU,
+		Currency:    p.Currency,
+	}
 }
@@ -2,39 +2,65 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/rasadov/EcommerceAPI/order/models"
 	"github.com/rasadov/EcommerceAPI/pkg/kafka"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotPurchased      = errors.New("account has no paid order with this product")
+	ErrInvalidStatus     = errors.New("unknown order status")
+	ErrInvalidTransition = errors.New("order cannot move to this status")
 )
 
 type Service interface {
-	PostOrder(ctx context.Context, accountID uint64, totalPrice float64, products []*models.OrderedProduct) (*models.Order, error)
+	PostOrder(ctx context.Context, accountID uint64, totalPrice float64, products []*models.OrderedProduct, reservationID string) (*models.Order, error)
+	GetOrder(ctx context.Context, orderID uint64) (*models.Order, error)
 	GetOrdersForAccount(ctx context.Context, accountID uint64) ([]*models.Order, error)
-	UpdateOrderStatus(ctx context.Context, orderId uint64, status string) error
+	UpdateOrderStatus(ctx context.Context, orderId uint64, status models.OrderStatus, reason string) (*models.Order, *models.OrderStatusChange, error)
+	VerifyPurchase(ctx context.Context, accountID uint64, productID string) (*models.Order, error)
 }
 
 type orderService struct {
 	repository Repository
 	producer   sarama.AsyncProducer
+	// currency is recorded on the lines of new orders
+	currency string
 }
 
-func NewOrderService(repository Repository, producer sarama.AsyncProducer) Service {
-	return &orderService{repository, producer}
+func NewOrderService(repository Repository, producer sarama.AsyncProducer, currency string) Service {
+	return &orderService{repository, producer, currency}
 }
 
 func (service orderService) Producer() sarama.AsyncProducer {
 	return service.producer
 }
 
-func (service orderService) PostOrder(ctx context.Context, accountID uint64, totalPrice float64, products []*models.OrderedProduct) (*models.Order, error) {
+// PostOrder saves the order with a snapshot of its products, which later reads
+// of the order return instead of the current products.
+func (service orderService) PostOrder(ctx context.Context, accountID uint64, totalPrice float64, products []*models.OrderedProduct, reservationID string) (*models.Order, error) {
+	for _, product := range products {
+		product.Currency = service.currency
+	}
+	now := time.Now().UTC()
 	order := models.Order{
-		AccountID:  accountID,
-		TotalPrice: totalPrice,
-		Products:   products,
-		CreatedAt:  time.Now().UTC(),
+		AccountID:     accountID,
+		TotalPrice:    totalPrice,
+		Products:      products,
+		CreatedAt:     now,
+		ReservationID: reservationID,
+		Status:        models.StatusPendingPayment,
+		StatusHistory: []models.OrderStatusChange{{
+			To:        models.StatusPendingPayment,
+			Reason:    "order placed",
+			ChangedAt: now,
+		}},
 	}
 	err := service.repository.PutOrder(ctx, &order)
 	if err != nil {
@@ -64,10 +90,54 @@ func (service orderService) PostOrder(ctx context.Context, accountID uint64, tot
 	return &order, nil
 }
 
+func (service orderService) GetOrder(ctx context.Context, orderID uint64) (*models.Order, error) {
+	return service.repository.GetOrder(ctx, orderID)
+}
+
 func (service orderService) GetOrdersForAccount(ctx context.Context, accountID uint64) ([]*models.Order, error) {
 	return service.repository.GetOrdersForAccount(ctx, accountID)
 }
 
-func (service orderService) UpdateOrderStatus(ctx context.Context, orderId uint64, status string) error {
-	return service.repository.UpdateOrderStatus(ctx, orderId, status)
+// UpdateOrderStatus moves an order to a status its current one leads to, and
+// records why. It returns the change it made, or no change when the order
+// already has the status, so payment notifications can be delivered twice.
+func (service orderService) UpdateOrderStatus(ctx context.Context, orderId uint64, status models.OrderStatus, reason string) (*models.Order, *models.OrderStatusChange, error) {
+	if !status.Valid() {
+		return nil, nil, ErrInvalidStatus
+	}
+	order, err := service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.Status == status {
+		return order, nil, nil
+	}
+	if !order.Status.CanTransitionTo(status) {
+		return nil, nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, order.Status, status)
+	}
+
+	change := models.OrderStatusChange{
+		From:      order.Status,
+		To:        status,
+		Reason:    reason,
+		ChangedAt: time.Now().UTC(),
+	}
+	if err = service.repository.UpdateOrderStatus(ctx, orderId, order.Status, change); err != nil {
+		return nil, nil, err
+	}
+	order, err = service.repository.GetOrder(ctx, orderId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, &change, nil
+}
+
+// VerifyPurchase returns the paid order in which the account bought the product,
+// or ErrNotPurchased.
+func (service orderService) VerifyPurchase(ctx context.Context, accountID uint64, productID string) (*models.Order, error) {
+	order, err := service.repository.GetPaidOrderWithProduct(ctx, accountID, productID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotPurchased
+	}
+	return order, err
 }
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/rasadov/EcommerceAPI/order/models"
+)
+
+// legacyStatusReason is the reason of the status history entries of orders
+// placed before it was kept.
+const legacyStatusReason = "status before history was kept"
+
+// StatusMigrationResult counts the orders a status migration went through.
+type StatusMigrationResult struct {
+	// Migrated orders were moved from a legacy status to a lifecycle status
+	Migrated int
+	// Started orders got the first entry of their status history
+	Started int
+	// Unknown counts, by status, the orders left as they are because their
+	// status is neither a lifecycle status nor one reported by payments
+	Unknown map[string]int
+}
+
+// statusCount is how many orders have a status.
+type statusCount struct {
+	Status string
+	Count  int
+}
+
+// MigrateOrderStatuses moves the orders placed before the lifecycle to a
+// lifecycle status and starts their status history. Orders without a status are
+// pending payment, and those with a status reported by the payment service get
+// the status it leads to. Other statuses are moved to unknown when it is set,
+// and reported otherwise. It can be run again, it only touches orders that
+// still need it.
+func MigrateOrderStatuses(ctx context.Context, db *gorm.DB, unknown models.OrderStatus) (*StatusMigrationResult, error) {
+	result := &StatusMigrationResult{Unknown: map[string]int{}}
+	if unknown != "" && !unknown.Valid() {
+		return result, ErrInvalidStatus
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var counts []statusCount
+		err := tx.Model(&models.Order{}).
+			Select("COALESCE(status, '') AS status, COUNT(*) AS count").
+			Group("COALESCE(status, '')").
+			Scan(&counts).Error
+		if err != nil {
+			return err
+		}
+		for _, count := range counts {
+			if models.OrderStatus(count.Status).Valid() {
+				continue
+			}
+			status, ok := legacyStatus(count.Status, unknown)
+			if !ok {
+				result.Unknown[count.Status] = count.Count
+				continue
+			}
+			res := tx.Model(&models.Order{}).
+				Where("COALESCE(status, '') = ?", count.Status).
+				Update("status", status)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Migrated += int(res.RowsAffected)
+		}
+
+		// Orders placed before the history start it with the status they have
+		res := tx.Exec(`INSERT INTO order_status_changes (order_id, to_status, reason, changed_at)
+			SELECT o.id, o.status, ?, o.created_at FROM orders o
+			WHERE o.status IN ?
+			AND NOT EXISTS (SELECT 1 FROM order_status_changes c WHERE c.order_id = o.id)`,
+			legacyStatusReason, models.OrderStatuses)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Started = int(res.RowsAffected)
+		return nil
+	})
+	return result, err
+}
+
+// legacyStatus returns the lifecycle status of an order that has a status from
+// before the lifecycle, or unknown when it is set.
+func legacyStatus(status string, unknown models.OrderStatus) (models.OrderStatus, bool) {
+	if status == "" {
+		return models.StatusPendingPayment, true
+	}
+	if paymentStatus, ok := models.PaymentStatuses[status]; ok {
+		return paymentStatus, true
+	}
+	return unknown, unknown != ""
+}
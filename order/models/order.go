@@ -2,14 +2,30 @@ package models
 
 import "time"
 
+// Statuses the payment service reports for the payment of an order
+const (
+	PaymentSucceeded = "Success"
+	PaymentFailed    = "Failed"
+)
+
+// PaymentStatuses map the statuses reported by the payment service to the
+// statuses they move an order to.
+var PaymentStatuses = map[string]OrderStatus{
+	PaymentSucceeded: StatusPaid,
+	PaymentFailed:    StatusCancelled,
+}
+
 type Order struct {
 	ID            uint `gorm:"primaryKey;autoIncrement"`
 	CreatedAt     time.Time
 	TotalPrice    float64
 	AccountID     uint64
-	Status        string
-	ProductsInfos []ProductsInfo    `gorm:"foreignKey:OrderID"`
-	Products      []*OrderedProduct `gorm:"-"`
+	Status        OrderStatus         `gorm:"type:varchar(20)"`
+	StatusHistory []OrderStatusChange `gorm:"foreignKey:OrderID"`
+	ProductsInfos []ProductsInfo      `gorm:"foreignKey:OrderID"`
+	Products      []*OrderedProduct   `gorm:"-"`
+	// ReservationID is the product service reservation holding stock for the order
+	ReservationID string
 }
 
 type OrderedProduct struct {
@@ -17,5 +33,8 @@ type OrderedProduct struct {
 	Name        string
 	Description string
 	Price       float64
+	Currency    string
 	Quantity    uint32
+	// SKU is the variant of the product that was ordered, if it has variants
+	SKU string
 }
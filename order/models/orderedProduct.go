@@ -1,12 +1,35 @@
 package models
 
+// ProductsInfo is a line of an order. The name, description and unit price are
+// a snapshot taken when the order was placed, so later changes to the product
+// do not change past orders.
 type ProductsInfo struct {
-	ID        uint `gorm:"primaryKey;autoIncrement"`
-	OrderID   uint
-	ProductID string
-	Quantity  int
+	ID          uint `gorm:"primaryKey;autoIncrement"`
+	OrderID     uint
+	ProductID   string
+	SKU         string
+	Quantity    int
+	Name        string
+	Description string
+	// Price is the unit price paid, the price of the variant when one was ordered
+	Price float64
+	// Currency is empty for lines placed before snapshots, until they are backfilled
+	Currency string `gorm:"type:varchar(3)"`
 }
 
 func (ProductsInfo) TableName() string {
 	return "order_products"
 }
+
+// OrderedProduct returns the line as it was ordered.
+func (info ProductsInfo) OrderedProduct() *OrderedProduct {
+	return &OrderedProduct{
+		ID:          info.ProductID,
+		Name:        info.Name,
+		Description: info.Description,
+		Price:       info.Price,
+		Currency:    info.Currency,
+		Quantity:    uint32(info.Quantity),
+		SKU:         info.SKU,
+	}
+}
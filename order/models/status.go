@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// OrderStatus is a step in the lifecycle of an order.
+type OrderStatus string
+
+const (
+	StatusPendingPayment OrderStatus = "pending_payment"
+	StatusPaid           OrderStatus = "paid"
+	StatusFulfilled      OrderStatus = "fulfilled"
+	StatusShipped        OrderStatus = "shipped"
+	StatusDelivered      OrderStatus = "delivered"
+	StatusCancelled      OrderStatus = "cancelled"
+	StatusRefunded       OrderStatus = "refunded"
+)
+
+// statusTransitions lists the statuses an order can move to from each status.
+// Cancelled and refunded orders are final.
+var statusTransitions = map[OrderStatus][]OrderStatus{
+	StatusPendingPayment: {StatusPaid, StatusCancelled},
+	StatusPaid:           {StatusFulfilled, StatusCancelled, StatusRefunded},
+	StatusFulfilled:      {StatusShipped, StatusRefunded},
+	StatusShipped:        {StatusDelivered, StatusRefunded},
+	StatusDelivered:      {StatusRefunded},
+	StatusCancelled:      {},
+	StatusRefunded:       {},
+}
+
+// OrderStatuses lists every status of the lifecycle.
+var OrderStatuses = []OrderStatus{
+	StatusPendingPayment, StatusPaid, StatusFulfilled, StatusShipped, StatusDelivered, StatusCancelled, StatusRefunded,
+}
+
+// PaidStatuses are the statuses of orders that were paid for and not given back.
+var PaidStatuses = []OrderStatus{StatusPaid, StatusFulfilled, StatusShipped, StatusDelivered}
+
+// Valid reports whether the status is part of the lifecycle.
+func (status OrderStatus) Valid() bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransitionTo reports whether an order can move from the status to next.
+func (status OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range statusTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChange records a move of an order from one status to another. The
+// first change of an order has no From.
+type OrderStatusChange struct {
+	ID        uint        `gorm:"primaryKey;autoIncrement"`
+	OrderID   uint        `gorm:"not null;index"`
+	From      OrderStatus `gorm:"column:from_status;type:varchar(20)"`
+	To        OrderStatus `gorm:"column:to_status;type:varchar(20);not null"`
+	Reason    string
+	ChangedAt time.Time
+}
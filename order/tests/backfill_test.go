@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/order/internal"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceAt(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 12, 0, 0, 0, time.UTC)
+	}
+	// The product was imported at 30 on the 1st, went up to 40 on the 10th and
+	// down to 35 on the 20th; it now costs 35
+	history := []*productModels.PriceChange{
+		{OldPrice: 40, NewPrice: 35, ChangedAt: day(20)},
+		{OldPrice: 30, NewPrice: 40, ChangedAt: day(10)},
+		{OldPrice: 25, NewPrice: 30, ChangedAt: day(1)},
+	}
+
+	tests := []struct {
+		name    string
+		history []*productModels.PriceChange
+		at      time.Time
+		price   float64
+	}{
+		{"before the oldest change", history, day(1).Add(-time.Hour), 25},
+		{"between changes", history, day(15), 40},
+		{"after the newest change", history, day(25), 35},
+		{"exactly at a change", history, day(10), 40},
+		{"exactly at the oldest change", history, day(1), 30},
+		{"exactly at the newest change", history, day(20), 35},
+		{"a moment before a change", history, day(20).Add(-time.Nanosecond), 40},
+		{"empty history", nil, day(15), 50},
+		// OldPrice is 0 for the price a product was created with, it had no
+		// earlier price to fall back to
+		{"before the creation price", []*productModels.PriceChange{
+			{OldPrice: 30, NewPrice: 40, ChangedAt: day(10)},
+			{OldPrice: 0, NewPrice: 30, ChangedAt: day(5)},
+		}, day(1), 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.price, internal.PriceAt(tt.history, tt.at, 50))
+		})
+	}
+}
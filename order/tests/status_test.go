@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/order/internal"
+	"github.com/rasadov/EcommerceAPI/order/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestOrderStatus_Valid(t *testing.T) {
+	for _, status := range models.OrderStatuses {
+		assert.True(t, status.Valid(), status)
+	}
+	for _, status := range []models.OrderStatus{"", "Success", "Failed", "PAID", "unknown"} {
+		assert.False(t, status.Valid(), status)
+	}
+}
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from models.OrderStatus
+		to   models.OrderStatus
+		want bool
+	}{
+		{models.StatusPendingPayment, models.StatusPaid, true},
+		{models.StatusPendingPayment, models.StatusCancelled, true},
+		{models.StatusPendingPayment, models.StatusRefunded, false},
+		{models.StatusPendingPayment, models.StatusShipped, false},
+		{models.StatusPaid, models.StatusFulfilled, true},
+		{models.StatusPaid, models.StatusCancelled, true},
+		{models.StatusPaid, models.StatusRefunded, true},
+		{models.StatusPaid, models.StatusPendingPayment, false},
+		{models.StatusFulfilled, models.StatusShipped, true},
+		{models.StatusFulfilled, models.StatusRefunded, true},
+		{models.StatusFulfilled, models.StatusCancelled, false},
+		{models.StatusShipped, models.StatusDelivered, true},
+		{models.StatusShipped, models.StatusRefunded, true},
+		{models.StatusShipped, models.StatusFulfilled, false},
+		{models.StatusDelivered, models.StatusRefunded, true},
+		{models.StatusDelivered, models.StatusCancelled, false},
+		{models.StatusPaid, models.StatusPaid, false},
+		{"", models.StatusPaid, false},
+		{"Success", models.StatusPaid, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to), "%q -> %q", tt.from, tt.to)
+	}
+
+	t.Run("cancelled and refunded are final", func(t *testing.T) {
+		for _, next := range models.OrderStatuses {
+			assert.False(t, models.StatusCancelled.CanTransitionTo(next), next)
+			assert.False(t, models.StatusRefunded.CanTransitionTo(next), next)
+		}
+	})
+
+	t.Run("payment statuses lead to allowed transitions", func(t *testing.T) {
+		for _, status := range models.PaymentStatuses {
+			assert.True(t, models.StatusPendingPayment.CanTransitionTo(status), status)
+		}
+	})
+}
+
+func setupStatusTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Order{}, &models.OrderStatusChange{}))
+	return db
+}
+
+func TestMigrateOrderStatuses(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("legacy statuses", func(t *testing.T) {
+		db := setupStatusTestDB(t)
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		orders := []models.Order{
+			{ID: 1, CreatedAt: createdAt},
+			{ID: 2, CreatedAt: createdAt, Status: models.PaymentSucceeded},
+			{ID: 3, CreatedAt: createdAt, Status: models.PaymentFailed},
+			{ID: 4, CreatedAt: createdAt, Status: models.StatusShipped},
+			{ID: 5, CreatedAt: createdAt, Status: "On hold"},
+			{ID: 6, CreatedAt: createdAt, Status: "On hold"},
+		}
+		require.NoError(t, db.Create(&orders).Error)
+
+		result, err := internal.MigrateOrderStatuses(ctx, db, "")
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Migrated)
+		assert.Equal(t, 4, result.Started)
+		assert.Equal(t, map[string]int{"On hold": 2}, result.Unknown)
+
+		want := map[uint]models.OrderStatus{
+			1: models.StatusPendingPayment,
+			2: models.StatusPaid,
+			3: models.StatusCancelled,
+			4: models.StatusShipped,
+			5: "On hold",
+			6: "On hold",
+		}
+		var stored []models.Order
+		require.NoError(t, db.Order("id").Find(&stored).Error)
+		for _, order := range stored {
+			assert.Equal(t, want[order.ID], order.Status, "order %d", order.ID)
+		}
+
+		var changes []models.OrderStatusChange
+		require.NoError(t, db.Order("order_id").Find(&changes).Error)
+		require.Len(t, changes, 4)
+		for _, change := range changes {
+			assert.Equal(t, want[change.OrderID], change.To)
+			assert.Empty(t, change.From)
+			assert.True(t, createdAt.Equal(change.ChangedAt))
+		}
+
+		t.Run("run again", func(t *testing.T) {
+			result, err := internal.MigrateOrderStatuses(ctx, db, models.StatusCancelled)
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.Migrated)
+			assert.Equal(t, 2, result.Started)
+			assert.Empty(t, result.Unknown)
+
+			var count int64
+			require.NoError(t, db.Model(&models.OrderStatusChange{}).Count(&count).Error)
+			assert.Equal(t, int64(6), count)
+
+			result, err = internal.MigrateOrderStatuses(ctx, db, "")
+			require.NoError(t, err)
+			assert.Zero(t, result.Migrated)
+			assert.Zero(t, result.Started)
+		})
+	})
+
+	t.Run("invalid unknown status", func(t *testing.T) {
+		db := setupStatusTestDB(t)
+		_, err := internal.MigrateOrderStatuses(ctx, db, "On hold")
+		assert.ErrorIs(t, err, internal.ErrInvalidStatus)
+	})
+}
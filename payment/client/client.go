@@ -4,9 +4,11 @@ import (
 	"context"
 	"log"
 
+	"github.com/rasadov/EcommerceAPI/payment/models"
 	"github.com/rasadov/EcommerceAPI/payment/proto/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type Client struct {
@@ -60,3 +62,38 @@ func (client *Client) CreateCheckoutSession(ctx context.Context, orderId, userId
 	}
 	return res.Value, nil
 }
+
+func (client *Client) GetCustomerData(ctx context.Context, userId uint64) (*models.Customer, error) {
+	res, err := client.service.GetCustomerData(ctx, &wrapperspb.UInt64Value{
+		Value: userId,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	customer := &models.Customer{
+		UserId:     userId,
+		CustomerId: res.CustomerId,
+	}
+	if err = customer.CreatedAt.UnmarshalBinary(res.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, t := range res.Transactions {
+		transaction := models.Transaction{
+			OrderId:    t.OrderId,
+			UserId:     userId,
+			CustomerId: res.CustomerId,
+			ProductId:  t.ProductId,
+			PaymentId:  t.PaymentId,
+			Amount:     t.Amount,
+			Currency:   t.Currency,
+			Status:     t.Status,
+		}
+		if err = transaction.CreatedAt.UnmarshalBinary(t.CreatedAt); err != nil {
+			return nil, err
+		}
+		customer.Transactions = append(customer.Transactions, transaction)
+	}
+	return customer, nil
+}
@@ -54,3 +54,37 @@ func (s *grpcServer) CreateCustomerPortalSession(ctx context.Context, request *p
 		Value: link,
 	}, nil
 }
+
+func (s *grpcServer) GetCustomerData(ctx context.Context, request *wrapperspb.UInt64Value) (*pb.CustomerDataResponse, error) {
+	customer, err := s.service.GetCustomerData(ctx, request.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, err := customer.CreatedAt.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var transactions []*pb.Transaction
+	for _, transaction := range customer.Transactions {
+		transactionCreatedAt, err := transaction.CreatedAt.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, &pb.Transaction{
+			OrderId:   transaction.OrderId,
+			ProductId: transaction.ProductId,
+			PaymentId: transaction.PaymentId,
+			Amount:    transaction.Amount,
+			Currency:  transaction.Currency,
+			Status:    transaction.Status,
+			CreatedAt: transactionCreatedAt,
+		})
+	}
+
+	return &pb.CustomerDataResponse{
+		CustomerId:   customer.CustomerId,
+		CreatedAt:    createdAt,
+		Transactions: transactions,
+	}, nil
+}
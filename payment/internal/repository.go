@@ -16,6 +16,7 @@ type Repository interface {
 	GetTransactionByProductID(ctx context.Context, productId string) (*models.Transaction, error)
 	RegisterTransaction(ctx context.Context, transaction *models.Transaction) error
 	UpdateTransaction(ctx context.Context, transaction *models.Transaction) error
+	ListTransactionsByUserID(ctx context.Context, userId uint64) ([]models.Transaction, error)
 }
 
 type postgresRepository struct {
@@ -98,3 +99,15 @@ func (repository *postgresRepository) RegisterTransaction(ctx context.Context, t
 func (repository *postgresRepository) UpdateTransaction(ctx context.Context, transaction *models.Transaction) error {
 	return repository.db.WithContext(ctx).Save(&transaction).Error
 }
+
+func (repository *postgresRepository) ListTransactionsByUserID(ctx context.Context, userId uint64) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := repository.db.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Order("created_at").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -25,6 +25,7 @@ type Service interface {
 		currency dodopayments.Currency,
 		customerId, productId string) error
 	HandlePaymentWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Transaction, error)
+	GetCustomerData(ctx context.Context, userId uint64) (*models.Customer, error)
 }
 
 type paymentService struct {
@@ -91,6 +92,24 @@ func (d *paymentService) RegisterTransaction(ctx context.Context,
 	return d.paymentRepository.RegisterTransaction(ctx, transaction)
 }
 
+// GetCustomerData returns the customer record of a user together with all of
+// their transactions. Users who never checked out get an empty customer.
+func (d *paymentService) GetCustomerData(ctx context.Context, userId uint64) (*models.Customer, error) {
+	customer, err := d.paymentRepository.GetCustomerByUserID(ctx, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		customer = &models.Customer{UserId: userId}
+	} else if err != nil {
+		return nil, err
+	}
+
+	transactions, err := d.paymentRepository.ListTransactionsByUserID(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	customer.Transactions = transactions
+	return customer, nil
+}
+
 func (d *paymentService) HandlePaymentWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Transaction, error) {
 	updatedTransaction, err := d.client.HandleWebhook(w, r)
 	if err != nil {
@@ -40,7 +40,7 @@ func (s *WebhookServer) HandlePaymentWebhook(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = s.orderClient.UpdateOrderStatus(ctx, transaction.OrderId, transaction.Status)
+	_, err = s.orderClient.UpdateOrderStatus(ctx, transaction.OrderId, transaction.Status, "")
 	if err != nil {
 		log.Println(err.Error())
 	}
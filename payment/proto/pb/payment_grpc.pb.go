@@ -22,6 +22,7 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	PaymentService_Checkout_FullMethodName                    = "/pb.PaymentService/Checkout"
 	PaymentService_CreateCustomerPortalSession_FullMethodName = "/pb.PaymentService/CreateCustomerPortalSession"
+	PaymentService_GetCustomerData_FullMethodName             = "/pb.PaymentService/GetCustomerData"
 )
 
 // PaymentServiceClient is the client API for PaymentService service.
@@ -30,6 +31,7 @@ const (
 type PaymentServiceClient interface {
 	Checkout(ctx context.Context, in *CheckoutRequest, opts ...grpc.CallOption) (*wrapperspb.StringValue, error)
 	CreateCustomerPortalSession(ctx context.Context, in *CustomerPortalRequest, opts ...grpc.CallOption) (*wrapperspb.StringValue, error)
+	GetCustomerData(ctx context.Context, in *wrapperspb.UInt64Value, opts ...grpc.CallOption) (*CustomerDataResponse, error)
 }
 
 type paymentServiceClient struct {
@@ -60,12 +62,23 @@ func (c *paymentServiceClient) CreateCustomerPortalSession(ctx context.Context,
 	return out, nil
 }
 
+func (c *paymentServiceClient) GetCustomerData(ctx context.Context, in *wrapperspb.UInt64Value, opts ...grpc.CallOption) (*CustomerDataResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CustomerDataResponse)
+	err := c.cc.Invoke(ctx, PaymentService_GetCustomerData_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PaymentServiceServer is the server API for PaymentService service.
 // All implementations must embed UnimplementedPaymentServiceServer
 // for forward compatibility.
 type PaymentServiceServer interface {
 	Checkout(context.Context, *CheckoutRequest) (*wrapperspb.StringValue, error)
 	CreateCustomerPortalSession(context.Context, *CustomerPortalRequest) (*wrapperspb.StringValue, error)
+	GetCustomerData(context.Context, *wrapperspb.UInt64Value) (*CustomerDataResponse, error)
 	mustEmbedUnimplementedPaymentServiceServer()
 }
 
@@ -82,6 +95,9 @@ func (UnimplementedPaymentServiceServer) Checkout(context.Context, *CheckoutRequ
 func (UnimplementedPaymentServiceServer) CreateCustomerPortalSession(context.Context, *CustomerPortalRequest) (*wrapperspb.StringValue, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateCustomerPortalSession not implemented")
 }
+func (UnimplementedPaymentServiceServer) GetCustomerData(context.Context, *wrapperspb.UInt64Value) (*CustomerDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCustomerData not implemented")
+}
 func (UnimplementedPaymentServiceServer) mustEmbedUnimplementedPaymentServiceServer() {}
 func (UnimplementedPaymentServiceServer) testEmbeddedByValue()                        {}
 
@@ -139,6 +155,24 @@ func _PaymentService_CreateCustomerPortalSession_Handler(srv interface{}, ctx co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PaymentService_GetCustomerData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.UInt64Value)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).GetCustomerData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_GetCustomerData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).GetCustomerData(ctx, req.(*wrapperspb.UInt64Value))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -154,6 +188,10 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateCustomerPortalSession",
 			Handler:    _PaymentService_CreateCustomerPortalSession_Handler,
 		},
+		{
+			MethodName: "GetCustomerData",
+			Handler:    _PaymentService_GetCustomerData_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "payment.proto",
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewJWK(kid, alg string, key crypto.PublicKey) (*JWK, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Alg: alg,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Alg: alg,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// JWKSFetcher loads the current key set from the account service, over HTTP or gRPC.
+type JWKSFetcher func(ctx context.Context) (*JWKS, error)
+
+// HTTPJWKSFetcher fetches a JWKS document from url.
+func HTTPJWKSFetcher(url string) JWKSFetcher {
+	return func(ctx context.Context) (*JWKS, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected JWKS status: %s", response.Status)
+		}
+		var jwks JWKS
+		if err = json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+			return nil, err
+		}
+		return &jwks, nil
+	}
+}
+
+// RemoteKeySet verifies tokens with public keys published by the account service.
+// Keys are cached and refetched when they get stale or when a token carries an
+// unknown kid, which is how rotated keys are picked up without a redeploy.
+type RemoteKeySet struct {
+	fetch JWKSFetcher
+	// CacheDuration is how long fetched keys are trusted before refetching.
+	CacheDuration time.Duration
+	// RefreshInterval is the minimum time between two fetches.
+	RefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewRemoteKeySet(fetch JWKSFetcher) *RemoteKeySet {
+	return &RemoteKeySet{
+		fetch:           fetch,
+		CacheDuration:   10 * time.Minute,
+		RefreshInterval: 30 * time.Second,
+		keys:            map[string]crypto.PublicKey{},
+	}
+}
+
+func (remote *RemoteKeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	remote.mu.RLock()
+	key, ok := remote.keys[kid]
+	age := time.Since(remote.fetchedAt)
+	sinceAttempt := time.Since(remote.attemptedAt)
+	remote.mu.RUnlock()
+
+	if ok && age < remote.CacheDuration {
+		return key, nil
+	}
+	// Unknown kids trigger a refetch, but we must not hammer the account
+	// service with a refetch for every forged token.
+	if sinceAttempt < remote.RefreshInterval {
+		if ok {
+			return key, nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	if err := remote.refresh(); err != nil {
+		log.Println("Failed to refresh JWKS:", err)
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	remote.mu.RLock()
+	defer remote.mu.RUnlock()
+	key, ok = remote.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (remote *RemoteKeySet) refresh() error {
+	remote.mu.Lock()
+	remote.attemptedAt = time.Now()
+	remote.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	jwks, err := remote.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping JWK %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	remote.keys = keys
+	remote.fetchedAt = time.Now()
+	return nil
+}
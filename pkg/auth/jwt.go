@@ -2,42 +2,65 @@ package auth
 
 import (
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rasadov/EcommerceAPI/account/config"
 )
 
+const (
+	// AccessTokenDuration is kept short because access tokens cannot be revoked.
+	AccessTokenDuration = 15 * time.Minute
+	// RefreshTokenDuration is the lifetime of a refresh token issued by the account service.
+	RefreshTokenDuration = 30 * 24 * time.Hour
+)
+
 type JWTCustomClaims struct {
 	UserID uint64 `json:"user_id"`
+	Role   Role   `json:"role"`
+	// Scopes is only set on tokens issued for an API key
+	Scopes []Scope `json:"scopes,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint64) (string, error) {
+// GenerateToken signs an access token with the active key of the key set.
+func (keySet *KeySet) GenerateToken(userID uint64, role Role) (string, error) {
+	return keySet.GenerateScopedToken(userID, role, nil)
+}
+
+// GenerateScopedToken signs an access token limited to scopes, for API keys.
+func (keySet *KeySet) GenerateScopedToken(userID uint64, role Role, scopes []Scope) (string, error) {
 	claims := &JWTCustomClaims{
 		UserID: userID,
+		Role:   role,
+		Scopes: scopes,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    config.Issuer,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenDuration)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.SecretKey))
+	key := keySet.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-func ValidateToken(encodedToken string) (*jwt.Token, error) {
+// ValidateToken verifies a token with the public key named by its kid header.
+// Only asymmetric algorithms are accepted, so no shared secret is needed.
+func ValidateToken(encodedToken string, keys KeyProvider) (*jwt.Token, error) {
 	token, err := jwt.ParseWithClaims(
 		encodedToken,
 		&JWTCustomClaims{},
 		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			kid, ok := t.Header["kid"].(string)
+			if !ok {
+				return nil, errors.New("token has no kid header")
 			}
-			return []byte(config.SecretKey), nil
+			return keys.PublicKey(kid)
 		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// KeyProvider resolves the public key used to verify a token by its kid header.
+type KeyProvider interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key and picks the matching algorithm.
+func NewSigningKey(id string, key crypto.Signer) (*SigningKey, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, PrivateKey: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// GenerateSigningKey creates a new Ed25519 key with a random kid.
+func GenerateSigningKey() (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id, err := crypt.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(id, private)
+}
+
+// KeySet holds every key that may have signed a live token. New tokens are signed
+// with the active key, the others are kept so tokens signed before a rotation stay valid.
+type KeySet struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(active *SigningKey, others ...*SigningKey) *KeySet {
+	keySet := &KeySet{keys: map[string]*SigningKey{}}
+	for _, key := range others {
+		keySet.keys[key.ID] = key
+	}
+	keySet.keys[active.ID] = active
+	keySet.active = active.ID
+	return keySet
+}
+
+// LoadKeySet reads every *.pem private key in dir, using the file name as kid.
+// activeID selects the signing key; when empty the last key by name is used, so
+// naming keys by date makes the newest one active.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+	for i, key := range keys {
+		if key.ID == activeID {
+			others := append(keys[:i:i], keys[i+1:]...)
+			return NewKeySet(key, others...), nil
+		}
+	}
+	return nil, fmt.Errorf("active signing key %q not found in %s", activeID, dir)
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	return NewSigningKey(strings.TrimSuffix(filepath.Base(path), ".pem"), signer)
+}
+
+func (keySet *KeySet) Active() *SigningKey {
+	keySet.mu.RLock()
+	defer keySet.mu.RUnlock()
+	return keySet.keys[keySet.active]
+}
+
+// Rotate makes key the active signing key while keeping the previous keys for verification.
+func (keySet *KeySet) Rotate(key *SigningKey) {
+	keySet.mu.Lock()
+	defer keySet.mu.Unlock()
+	keySet.keys[key.ID] = key
+	keySet.active = key.ID
+}
+
+// Retire removes a key once every token it signed has expired.
+func (keySet *KeySet) Retire(id string) error {
+	keySet.mu.Lock()
+	defer keySet.mu.Unlock()
+	if id == keySet.active {
+		return errors.New("cannot retire the active signing key")
+	}
+	delete(keySet.keys, id)
+	return nil
+}
+
+func (keySet *KeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	keySet.mu.RLock()
+	defer keySet.mu.RUnlock()
+	key, ok := keySet.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+func (keySet *KeySet) JWKS() *JWKS {
+	keySet.mu.RLock()
+	defer keySet.mu.RUnlock()
+
+	ids := make([]string, 0, len(keySet.keys))
+	for id := range keySet.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		key := keySet.keys[id]
+		jwk, err := NewJWK(key.ID, key.Method.Alg(), key.PrivateKey.Public())
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, *jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+)
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleSeller   Role = "seller"
+	RoleAdmin    Role = "admin"
+)
+
+// ParseRole validates a role name. An empty name is a customer, which is also
+// the role of tokens issued before roles existed.
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case "":
+		return RoleCustomer, nil
+	case RoleCustomer, RoleSeller, RoleAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+}
+
+// Satisfies reports whether role is one of required. Admins satisfy every role.
+func (role Role) Satisfies(required ...Role) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, r := range required {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+func GetRole(ctx context.Context) (Role, bool) {
+	role, ok := ctx.Value(contextkeys.RoleKey).(Role)
+	return role, ok
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+)
+
+// Scope limits what an API key can be used for. Sessions are not limited by scopes.
+type Scope string
+
+const (
+	ScopeProductsRead  Scope = "products:read"
+	ScopeProductsWrite Scope = "products:write"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from access tokens
+// sent in the same Authorization header.
+const APIKeyPrefix = "eak_"
+
+func ParseScope(name string) (Scope, error) {
+	switch scope := Scope(name); scope {
+	case ScopeProductsRead, ScopeProductsWrite:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q", name)
+	}
+}
+
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// GetScopes returns the scopes of a caller authenticated with an API key. ok is
+// false for callers authenticated with a session.
+func GetScopes(ctx context.Context) ([]Scope, bool) {
+	scopes, ok := ctx.Value(contextkeys.ScopesKey).([]Scope)
+	return scopes, ok
+}
+
+// HasScope reports whether the caller may act within scope. Sessions have every scope.
+func HasScope(ctx context.Context, scope Scope) bool {
+	scopes, ok := GetScopes(ctx)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -2,4 +2,18 @@ package contextkeys
 
 type ctxKeyUserID struct{}
 
+type ctxKeyRole struct{}
+
+type ctxKeyToken struct{}
+
+type ctxKeyScopes struct{}
+
 var UserIDKey = ctxKeyUserID{}
+
+var RoleKey = ctxKeyRole{}
+
+// TokenKey holds the raw access token so it can be forwarded to other services.
+var TokenKey = ctxKeyToken{}
+
+// ScopesKey holds the scopes of a caller authenticated with an API key.
+var ScopesKey = ctxKeyScopes{}
@@ -0,0 +1,109 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator app supports.
+const (
+	totpDigits = 6
+	totpModulo = 1000000 // 10^totpDigits
+	totpPeriod = 30 * time.Second
+	// totpSkew is the number of periods accepted before and after the current one,
+	// to tolerate clock drift between the server and the phone.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new base32 encoded 160-bit secret.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps import, usually from a QR code.
+func TOTPURI(issuer, accountName, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code for secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/int64(totpPeriod.Seconds()))), nil
+}
+
+// ValidateTOTP reports whether code is valid for secret at time t.
+func ValidateTOTP(secret, code string, t time.Time) bool {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+	counter := t.Unix() / int64(totpPeriod.Seconds())
+	valid := false
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		expected := hotp(key, uint64(counter+offset))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// hotp computes an HOTP value (RFC 4226).
+func hotp(key []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// RecoveryCode returns a random single-use code formatted for humans, e.g. "k3m9x-2hq7d".
+func RecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	code := make([]byte, 0, 11)
+	for i, b := range bytes {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, alphabet[int(b)%len(alphabet)])
+	}
+	return string(code), nil
+}
+
+// NormalizeRecoveryCode makes codes typed by users comparable with issued ones.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, " ", "")
+}
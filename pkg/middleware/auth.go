@@ -2,37 +2,109 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
 )
 
-func AuthorizeJWT() gin.HandlerFunc {
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient permissions")
+)
+
+// APIKeyResolver exchanges an API key for an access token of its account.
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (string, error)
+}
+
+// AuthorizeJWT authenticates the caller with the access token from the
+// Authorization header or the token cookie. API keys, sent as a bearer token or
+// in the X-API-Key header, are exchanged for an access token with apiKeys.
+func AuthorizeJWT(keys auth.KeyProvider, apiKeys APIKeyResolver) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authCookie, err := c.Cookie("token")
-		if err != nil || authCookie == "" {
+		if key := apiKeyFromRequest(c); key != "" {
+			if apiKeys == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API keys are not accepted"})
+				return
+			}
+			token, err := apiKeys.ResolveAPIKey(c.Request.Context(), key)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+				return
+			}
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		authToken, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			authToken, _ = c.Cookie("token")
+		}
+		if authToken == "" {
 			c.Set("userID", "")
 			c.Next()
 			return
 		}
 
-		token, err := auth.ValidateToken(authCookie)
+		ctx, err := authenticate(c.Request.Context(), authToken, keys)
 		if err != nil {
 			c.Set("userID", "")
 			c.Next()
 			return
 		}
 
-		if claims, ok := token.Claims.(*auth.JWTCustomClaims); ok && token.Valid {
-			c.Set("userID", claims.UserID)
-			ctxWithVal := context.WithValue(c.Request.Context(), contextkeys.UserIDKey, claims.UserID)
+		c.Set("userID", ctx.Value(contextkeys.UserIDKey))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
 
-			c.Request = c.Request.WithContext(ctxWithVal)
-		} else {
-			c.Set("userID", "")
-		}
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && auth.IsAPIKey(bearer) {
+		return bearer
+	}
+	return ""
+}
 
-		c.Next()
+// RequireRole checks that the caller authenticated by AuthorizeJWT or the gRPC
+// interceptor has one of roles. Without roles any authenticated caller is accepted.
+func RequireRole(ctx context.Context, roles ...auth.Role) error {
+	role, ok := auth.GetRole(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if len(roles) > 0 && !role.Satisfies(roles...) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// authenticate validates the token and stores the caller identity in the context.
+func authenticate(ctx context.Context, encodedToken string, keys auth.KeyProvider) (context.Context, error) {
+	token, err := auth.ValidateToken(encodedToken, keys)
+	if err != nil {
+		return ctx, err
+	}
+	claims, ok := token.Claims.(*auth.JWTCustomClaims)
+	if !ok {
+		return ctx, errors.New("invalid token claims")
+	}
+	role, err := auth.ParseRole(string(claims.Role))
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = context.WithValue(ctx, contextkeys.UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, contextkeys.RoleKey, role)
+	ctx = context.WithValue(ctx, contextkeys.TokenKey, encodedToken)
+	if len(claims.Scopes) > 0 {
+		ctx = context.WithValue(ctx, contextkeys.ScopesKey, claims.Scopes)
 	}
+	return ctx, nil
 }
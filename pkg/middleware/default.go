@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,3 +20,12 @@ func GinContextToContextMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// GinContextFromContext returns the gin.Context stored by GinContextToContextMiddleware.
+func GinContextFromContext(ctx context.Context) (*gin.Context, error) {
+	ginContext, ok := ctx.Value(ginContextKey).(*gin.Context)
+	if !ok {
+		return nil, errors.New("could not retrieve gin context")
+	}
+	return ginContext, nil
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authorizationHeader = "authorization"
+
+// MethodRoles maps full gRPC method names to the roles allowed to call them.
+// An empty list allows any authenticated caller, and methods that are not
+// listed can be called without a token.
+type MethodRoles map[string][]auth.Role
+
+// UnaryServerAuthInterceptor authenticates the bearer token sent in the request
+// metadata and enforces the roles required by methods.
+func UnaryServerAuthInterceptor(keys auth.KeyProvider, methods MethodRoles) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorizeMethod(ctx, info.FullMethod, keys, methods)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerAuthInterceptor is UnaryServerAuthInterceptor for streaming methods.
+func StreamServerAuthInterceptor(keys auth.KeyProvider, methods MethodRoles) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorizeMethod(stream.Context(), info.FullMethod, keys, methods)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{stream, ctx})
+	}
+}
+
+// authenticatedStream carries the context of the authenticated caller.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func authorizeMethod(ctx context.Context, method string, keys auth.KeyProvider, methods MethodRoles) (context.Context, error) {
+	if token := bearerToken(ctx); token != "" {
+		authenticated, err := authenticate(ctx, token, keys)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		ctx = authenticated
+	}
+
+	if roles, ok := methods[method]; ok {
+		err := RequireRole(ctx, roles...)
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+	return ctx, nil
+}
+
+// UnaryClientAuthInterceptor forwards the caller's access token to the called service.
+func UnaryClientAuthInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token, ok := ctx.Value(contextkeys.TokenKey).(string); ok && token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientAuthInterceptor is UnaryClientAuthInterceptor for streaming methods.
+func StreamClientAuthInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if token, ok := ctx.Value(contextkeys.TokenKey).(string); ok && token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func bearerToken(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, authorizationHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
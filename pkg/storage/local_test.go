@@ -0,0 +1,57 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "media")
+	store, err := storage.NewLocalStorage(dir, "http://localhost:8080/media/")
+	require.NoError(t, err)
+
+	t.Run("put writes the file", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "products/1/image.jpg", "image/jpeg", []byte("first")))
+		require.NoError(t, store.Put(ctx, "products/1/image.jpg", "image/jpeg", []byte("second")))
+
+		data, err := os.ReadFile(filepath.Join(dir, "products", "1", "image.jpg"))
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(data))
+		info, err := os.Stat(filepath.Join(dir, "products", "1", "image.jpg"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+		// No temporary file is left behind
+		entries, err := os.ReadDir(filepath.Join(dir, "products", "1"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("delete removes the file", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "products/2/image.png", "image/png", []byte("png")))
+		require.NoError(t, store.Delete(ctx, "products/2/image.png"))
+		_, err := os.Stat(filepath.Join(dir, "products", "2", "image.png"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		assert.NoError(t, store.Delete(ctx, "products/2/image.png"))
+	})
+
+	t.Run("keys cannot escape the directory", func(t *testing.T) {
+		assert.ErrorIs(t, store.Put(ctx, "../outside.jpg", "image/jpeg", []byte("x")), storage.ErrInvalidKey)
+		assert.ErrorIs(t, store.Put(ctx, "/etc/outside.jpg", "image/jpeg", []byte("x")), storage.ErrInvalidKey)
+		assert.ErrorIs(t, store.Delete(ctx, "products/../../outside.jpg"), storage.ErrInvalidKey)
+		_, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside.jpg"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		assert.Equal(t, "http://localhost:8080/media/products/1/image.jpg", store.URL("products/1/image.jpg"))
+	})
+}
@@ -0,0 +1,242 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeS3 keeps objects in memory, like a path style S3-compatible server, and
+// rejects requests that are not signed with the test credentials.
+type fakeS3 struct {
+	*httptest.Server
+	mu           sync.Mutex
+	objects      map[string]string
+	contentTypes map[string]string
+	// fail answers every request with this status when set
+	fail int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s3 := &fakeS3{objects: map[string]string{}, contentTypes: map[string]string{}}
+	s3.Server = httptest.NewServer(http.HandlerFunc(s3.serve))
+	t.Cleanup(s3.Close)
+	return s3
+}
+
+// object returns the body and content type of the object at path.
+func (s3 *fakeS3) object(path string) (body, contentType string, ok bool) {
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+	body, ok = s3.objects[path]
+	return body, s3.contentTypes[path], ok
+}
+
+func (s3 *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+
+	if s3.fail != 0 {
+		w.WriteHeader(s3.fail)
+		io.WriteString(w, "<Error><Code>SlowDown</Code></Error>\n")
+		return
+	}
+	if err := verifySignature(r, body); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, err.Error())
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s3.objects[r.URL.Path] = string(body)
+		s3.contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodDelete:
+		delete(s3.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature checks the Signature Version 4 of a request signed by the
+// test credentials in the test region.
+func verifySignature(r *http.Request, body []byte) error {
+	payloadHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payloadHash[:]) {
+		return fmt.Errorf("payload hash does not match the body")
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || time.Since(signedAt).Abs() > 15*time.Minute {
+		return fmt.Errorf("invalid request time %q", amzDate)
+	}
+
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + r.Header.Get("X-Amz-Content-Sha256") + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" +
+		r.Header.Get("X-Amz-Content-Sha256")
+	scope := amzDate[:8] + "/eu-west-1/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretAccessKey)
+	for _, data := range []string{amzDate[:8], "eu-west-1", "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		key = mac.Sum(nil)
+	}
+	expected := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		testAccessKeyID, scope, hex.EncodeToString(key))
+	if r.Header.Get("Authorization") != expected {
+		return fmt.Errorf("signature does not match: %s", r.Header.Get("Authorization"))
+	}
+	return nil
+}
+
+func setupS3Storage(t *testing.T, s3 *fakeS3) *storage.S3Storage {
+	t.Helper()
+	store, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        s3.URL,
+		Region:          "eu-west-1",
+		Bucket:          "media",
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+		PathStyle:       true,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("put and delete signed objects", func(t *testing.T) {
+		s3 := newFakeS3(t)
+		store := setupS3Storage(t, s3)
+
+		require.NoError(t, store.Put(ctx, "products/1/image.jpg", "image/jpeg", []byte("jpeg")))
+		body, contentType, ok := s3.object("/media/products/1/image.jpg")
+		require.True(t, ok)
+		assert.Equal(t, "jpeg", body)
+		assert.Equal(t, "image/jpeg", contentType)
+
+		require.NoError(t, store.Delete(ctx, "products/1/image.jpg"))
+		_, _, ok = s3.object("/media/products/1/image.jpg")
+		assert.False(t, ok)
+		assert.NoError(t, store.Delete(ctx, "products/1/image.jpg"))
+	})
+
+	t.Run("keys are escaped before signing", func(t *testing.T) {
+		s3 := newFakeS3(t)
+		store := setupS3Storage(t, s3)
+
+		require.NoError(t, store.Put(ctx, "products/1/my image+1 (é).jpg", "image/jpeg", nil))
+		_, _, ok := s3.object("/media/products/1/my image+1 (é).jpg")
+		assert.True(t, ok)
+	})
+
+	t.Run("wrong credentials are rejected", func(t *testing.T) {
+		s3 := newFakeS3(t)
+		store, err := storage.NewS3Storage(storage.S3Config{
+			Endpoint:        s3.URL,
+			Region:          "eu-west-1",
+			Bucket:          "media",
+			AccessKeyID:     testAccessKeyID,
+			SecretAccessKey: "wrong",
+			PathStyle:       true,
+		})
+		require.NoError(t, err)
+
+		err = store.Put(ctx, "products/1/image.jpg", "image/jpeg", []byte("jpeg"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "403 Forbidden")
+	})
+
+	t.Run("errors include the response", func(t *testing.T) {
+		s3 := newFakeS3(t)
+		s3.fail = http.StatusServiceUnavailable
+		store := setupS3Storage(t, s3)
+
+		err := store.Put(ctx, "products/1/image.jpg", "image/jpeg", []byte("jpeg"))
+		assert.EqualError(t, err, "s3 PUT /media/products/1/image.jpg: 503 Service Unavailable: <Error><Code>SlowDown</Code></Error>")
+		assert.Error(t, store.Delete(ctx, "products/1/image.jpg"))
+	})
+
+	t.Run("invalid keys are not sent", func(t *testing.T) {
+		s3 := newFakeS3(t)
+		s3.fail = http.StatusInternalServerError
+		store := setupS3Storage(t, s3)
+
+		assert.ErrorIs(t, store.Put(ctx, "../image.jpg", "image/jpeg", nil), storage.ErrInvalidKey)
+		assert.ErrorIs(t, store.Delete(ctx, "/image.jpg"), storage.ErrInvalidKey)
+	})
+}
+
+func TestS3Storage_URL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config storage.S3Config
+		url    string
+	}{
+		{"virtual host", storage.S3Config{Endpoint: "https://s3.eu-west-1.amazonaws.com"},
+			"https://media.s3.eu-west-1.amazonaws.com/products/1/my%20image.jpg"},
+		{"path style", storage.S3Config{Endpoint: "http://localhost:9000/", PathStyle: true},
+			"http://localhost:9000/media/products/1/my%20image.jpg"},
+		{"public URL", storage.S3Config{Endpoint: "http://localhost:9000", PathStyle: true, PublicURL: "https://cdn.example.com/"},
+			"https://cdn.example.com/products/1/my%20image.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Region = "eu-west-1"
+			tt.config.Bucket = "media"
+			store, err := storage.NewS3Storage(tt.config)
+			require.NoError(t, err)
+			assert.Equal(t, tt.url, store.URL("products/1/my image.jpg"))
+		})
+	}
+}
+
+func TestNewS3Storage(t *testing.T) {
+	tests := []struct {
+		name   string
+		config storage.S3Config
+		err    string
+	}{
+		{"no bucket", storage.S3Config{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1"},
+			"s3 storage needs an endpoint, a region and a bucket"},
+		{"no region", storage.S3Config{Endpoint: "https://s3.amazonaws.com", Bucket: "media"},
+			"s3 storage needs an endpoint, a region and a bucket"},
+		{"relative endpoint", storage.S3Config{Endpoint: "s3.amazonaws.com", Region: "us-east-1", Bucket: "media"},
+			`s3 endpoint "s3.amazonaws.com" is not an absolute URL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := storage.NewS3Storage(tt.config)
+			assert.True(t, strings.HasPrefix(err.Error(), tt.err), err.Error())
+		})
+	}
+}
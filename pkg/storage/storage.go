@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Storage keeps blobs, such as product images, under slash separated keys and
+// tells where they are served from. Bodies are held in memory, so it suits
+// files of a few megabytes.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body []byte) error
+	// Delete removes the blob at key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL of the blob at key.
+	URL(key string) string
+}
+
+// ValidKey reports whether key is a relative, clean path, so it cannot escape
+// the directory or bucket it is stored in.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
@@ -0,0 +1,32 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"products/1/image.jpg", true},
+		{"image.jpg", true},
+		{"products/1/my image+1.jpg", true},
+		{"", false},
+		{"/products/1/image.jpg", false},
+		{"products//image.jpg", false},
+		{"products/./image.jpg", false},
+		{"products/../image.jpg", false},
+		{"../image.jpg", false},
+		{"..", false},
+		{"products/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.valid, storage.ValidKey(tt.key))
+		})
+	}
+}
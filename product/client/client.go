@@ -2,8 +2,11 @@ package client
 
 import (
 	"context"
+	"io"
 	"log"
+	"time"
 
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
 	"github.com/rasadov/EcommerceAPI/product/models"
 	"github.com/rasadov/EcommerceAPI/product/proto/pb"
 	"google.golang.org/grpc"
@@ -11,13 +14,30 @@ import (
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+var (
+	productStatusToProto = map[models.ProductStatus]pb.ProductStatus{
+		models.StatusPublished: pb.ProductStatus_PUBLISHED,
+		models.StatusDraft:     pb.ProductStatus_DRAFT,
+		models.StatusArchived:  pb.ProductStatus_ARCHIVED,
+	}
+	productStatusFromProto = map[pb.ProductStatus]models.ProductStatus{
+		pb.ProductStatus_PUBLISHED: models.StatusPublished,
+		pb.ProductStatus_DRAFT:     models.StatusDraft,
+		pb.ProductStatus_ARCHIVED:  models.StatusArchived,
+	}
+)
+
 type Client struct {
 	conn    *grpc.ClientConn
 	service pb.ProductServiceClient
 }
 
 func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(middleware.UnaryClientAuthInterceptor()),
+		grpc.WithStreamInterceptor(middleware.StreamClientAuthInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -39,79 +59,574 @@ func (client *Client) GetProduct(ctx context.Context, id string) (*models.Produc
 	if err != nil {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-	}, nil
+	return productFromProto(res.Product), nil
 }
 
-func (client *Client) GetProducts(ctx context.Context, skip, take uint64, ids []string, query string) ([]models.Product, error) {
+func (client *Client) GetProducts(ctx context.Context, skip, take uint64, ids []string, query, categoryID string) ([]models.Product, error) {
 	res, err := client.service.GetProducts(ctx, &pb.GetProductsRequest{
-		Skip:  skip,
-		Take:  take,
-		Ids:   ids,
-		Query: query,
+		Skip:       skip,
+		Take:       take,
+		Ids:        ids,
+		Query:      query,
+		CategoryId: categoryID,
 	})
 	if err != nil {
 		return nil, err
 	}
 	var products []models.Product
 	for _, p := range res.Products {
-		products = append(products, models.Product{
-			ID:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			AccountID:   int(p.AccountId),
+		products = append(products, *productFromProto(p))
+	}
+	return products, nil
+}
+
+// SearchProducts returns a page of the products matching the search, with the
+// total number of matches and the price and category facets.
+func (client *Client) SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error) {
+	res, err := client.service.SearchProducts(ctx, &pb.GetProductsRequest{
+		Skip:       search.Skip,
+		Take:       search.Take,
+		Query:      search.Query,
+		CategoryId: search.CategoryID,
+		MinPrice:   search.MinPrice,
+		MaxPrice:   search.MaxPrice,
+		SellerId:   int64(search.AccountID),
+		Sort:       pb.ProductSort(search.Sort),
+		After:      search.After,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SearchResult{
+		Cursors:     res.Cursors,
+		HasMore:     res.HasMore,
+		HasPrevious: res.HasPrevious,
+		Total:       res.Total,
+	}
+	for _, p := range res.Products {
+		result.Products = append(result.Products, productFromProto(p))
+	}
+	for _, bucket := range res.PriceBuckets {
+		result.PriceBuckets = append(result.PriceBuckets, models.PriceBucket{
+			From:  bucket.From,
+			To:    bucket.To,
+			Count: bucket.Count,
+		})
+	}
+	for _, category := range res.Categories {
+		result.Categories = append(result.Categories, models.CategoryCount{
+			CategoryID: category.CategoryId,
+			Count:      category.Count,
 		})
 	}
+	return result, nil
+}
+
+// SuggestProducts returns products completing a search prefix, or a corrected
+// prefix when none matches.
+func (client *Client) SuggestProducts(ctx context.Context, prefix string, size int) (*models.Suggestions, error) {
+	res, err := client.service.SuggestProducts(ctx, &pb.SuggestProductsRequest{
+		Prefix: prefix,
+		Size:   uint32(size),
+	})
+	if err != nil {
+		return nil, err
+	}
+	suggestions := &models.Suggestions{DidYouMean: res.DidYouMean}
+	for _, suggestion := range res.Products {
+		suggestions.Products = append(suggestions.Products, models.ProductSuggestion{
+			ProductID: suggestion.ProductId,
+			Name:      suggestion.Name,
+		})
+	}
+	return suggestions, nil
+}
+
+func (client *Client) ListProductsByAccount(ctx context.Context, accountId int64, skip, take uint64) ([]models.Product, error) {
+	res, err := client.service.ListProductsByAccount(ctx, &pb.ListProductsByAccountRequest{
+		AccountId: accountId,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	for _, p := range res.Products {
+		products = append(products, *productFromProto(p))
+	}
 	return products, nil
 }
 
-func (client *Client) PostProduct(ctx context.Context, name, description string, price float64, accountId int64) (*models.Product, error) {
+// PostProduct creates a product of the caller, published unless status is draft.
+func (client *Client) PostProduct(ctx context.Context, name, description string, price float64, status models.ProductStatus) (*models.Product, error) {
 	res, err := client.service.PostProduct(ctx, &pb.CreateProductRequest{
 		Name:        name,
 		Description: description,
 		Price:       price,
-		AccountId:   accountId,
+		Status:      productStatusToProto[status],
 	})
 	if err != nil {
 		log.Println("Error creating product", err)
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-	}, nil
+	return productFromProto(res.Product), nil
 }
 
-func (client *Client) UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int64) (*models.Product, error) {
+// UpdateProduct changes the name, description and price of a product of the caller.
+func (client *Client) UpdateProduct(ctx context.Context, id, name, description string, price float64) (*models.Product, error) {
 	res, err := client.service.UpdateProduct(ctx, &pb.UpdateProductRequest{
 		Id:          id,
 		Name:        name,
 		Description: description,
 		Price:       price,
-		AccountId:   accountId,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          res.Product.Id,
-		Name:        res.Product.Name,
-		Description: res.Product.Description,
-		Price:       res.Product.Price,
-		AccountID:   int(res.Product.GetAccountId()),
-	}, nil
+	return productFromProto(res.Product), nil
+}
+
+// DeleteProduct archives a product of the caller.
+func (client *Client) DeleteProduct(ctx context.Context, productId string) error {
+	_, err := client.service.DeleteProduct(ctx, &pb.DeleteProductRequest{ProductId: productId})
+	return err
+}
+
+// SetProductStatus drafts, publishes or archives a product of the caller.
+func (client *Client) SetProductStatus(ctx context.Context, productId string, status models.ProductStatus) (*models.Product, error) {
+	res, err := client.service.SetProductStatus(ctx, &pb.SetProductStatusRequest{
+		ProductId: productId,
+		Status:    productStatusToProto[status],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(res.Product), nil
+}
+
+// SetProductCategories files a product of the caller under categoryIDs.
+func (client *Client) SetProductCategories(ctx context.Context, productId string, categoryIDs []string) (*models.Product, error) {
+	res, err := client.service.SetProductCategories(ctx, &pb.SetProductCategoriesRequest{
+		ProductId:   productId,
+		CategoryIds: categoryIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(res.Product), nil
+}
+
+func (client *Client) CreateCategory(ctx context.Context, name, parentID string) (*models.Category, error) {
+	res, err := client.service.CreateCategory(ctx, &pb.CreateCategoryRequest{
+		Name:     name,
+		ParentId: parentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categoryFromProto(res.Category), nil
+}
+
+func (client *Client) RenameCategory(ctx context.Context, id, name string) (*models.Category, error) {
+	res, err := client.service.RenameCategory(ctx, &pb.RenameCategoryRequest{
+		Id:   id,
+		Name: name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categoryFromProto(res.Category), nil
+}
+
+func (client *Client) MoveCategory(ctx context.Context, id, parentID string) (*models.Category, error) {
+	res, err := client.service.MoveCategory(ctx, &pb.MoveCategoryRequest{
+		Id:       id,
+		ParentId: parentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categoryFromProto(res.Category), nil
 }
 
-func (client *Client) DeleteProduct(ctx context.Context, productId string, accountId int64) error {
-	_, err := client.service.DeleteProduct(ctx, &pb.DeleteProductRequest{ProductId: productId, AccountId: accountId})
+func (client *Client) DeleteCategory(ctx context.Context, id string) error {
+	_, err := client.service.DeleteCategory(ctx, &wrapperspb.StringValue{
+		Value: id,
+	})
 	return err
 }
+
+// GetCategories returns the categories with ids, or when no ids are given the
+// children of parentID, which are the root categories for an empty parentID.
+func (client *Client) GetCategories(ctx context.Context, parentID string, ids []string) ([]models.Category, error) {
+	res, err := client.service.GetCategories(ctx, &pb.GetCategoriesRequest{
+		ParentId: parentID,
+		Ids:      ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]models.Category, 0, len(res.Categories))
+	for _, c := range res.Categories {
+		categories = append(categories, *categoryFromProto(c))
+	}
+	return categories, nil
+}
+
+func productFromProto(p *pb.Product) *models.Product {
+	product := &models.Product{
+		ID:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		AccountID:   int(p.GetAccountId()),
+		CategoryIDs: p.CategoryIds,
+		Status:      productStatusFromProto[p.Status],
+		Rating: models.Rating{
+			Average: p.RatingAverage,
+			Count:   int(p.RatingCount),
+		},
+	}
+	for _, option := range p.Options {
+		product.Options = append(product.Options, models.ProductOption{Name: option.Name, Values: option.Values})
+	}
+	for _, variant := range p.Variants {
+		v := models.Variant{SKU: variant.Sku, Price: variant.Price}
+		for _, option := range variant.Options {
+			v.Options = append(v.Options, models.VariantOption{Name: option.Name, Value: option.Value})
+		}
+		product.Variants = append(product.Variants, v)
+	}
+	for _, image := range p.Images {
+		product.Images = append(product.Images, models.ProductImage{
+			ID:           image.Id,
+			Key:          image.Key,
+			ThumbnailKey: image.ThumbnailKey,
+			ContentType:  image.ContentType,
+			Width:        int(image.Width),
+			Height:       int(image.Height),
+		})
+	}
+	return product
+}
+
+func categoryFromProto(c *pb.Category) *models.Category {
+	return &models.Category{
+		ID:       c.Id,
+		Name:     c.Name,
+		ParentID: c.ParentId,
+		Path:     c.Path,
+	}
+}
+
+// importChunkSize is how many bytes of an import file are sent per message
+const importChunkSize = 32 * 1024
+
+// ImportProducts streams an import file into the catalog of the caller.
+func (client *Client) ImportProducts(ctx context.Context, format models.BulkFormat, r io.Reader) (*models.ImportResult, error) {
+	stream, err := client.service.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, importChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.ImportProductsRequest{Format: pb.BulkFormat(format), Data: buf[:n]}); sendErr != nil {
+				// The reason the server stopped the stream is returned by CloseAndRecv
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ImportResult{
+		Created: int(res.Created),
+		Updated: int(res.Updated),
+		Failed:  int(res.Failed),
+	}
+	for _, rowErr := range res.Errors {
+		result.Errors = append(result.Errors, models.RowError{Line: int(rowErr.Line), Message: rowErr.Message})
+	}
+	return result, nil
+}
+
+// ExportProducts writes the catalog of the caller to w as it is streamed.
+func (client *Client) ExportProducts(ctx context.Context, format models.BulkFormat, w io.Writer) error {
+	stream, err := client.service.ExportProducts(ctx, &pb.ExportProductsRequest{Format: pb.BulkFormat(format)})
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// SetProductVariants replaces the options of a product and the variants it is sold in.
+func (client *Client) SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant) (*models.Product, error) {
+	req := &pb.SetProductVariantsRequest{ProductId: productId}
+	for _, option := range options {
+		req.Options = append(req.Options, &pb.ProductOption{Name: option.Name, Values: option.Values})
+	}
+	for _, variant := range variants {
+		v := &pb.Variant{Sku: variant.SKU, Price: variant.Price}
+		for _, option := range variant.Options {
+			v.Options = append(v.Options, &pb.VariantOption{Name: option.Name, Value: option.Value})
+		}
+		req.Variants = append(req.Variants, v)
+	}
+	res, err := client.service.SetProductVariants(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(res.Product), nil
+}
+
+// AddProductImage appends an image, already put in storage, to a product.
+func (client *Client) AddProductImage(ctx context.Context, productId string, image models.ProductImage) (*models.Product, error) {
+	res, err := client.service.AddProductImage(ctx, &pb.AddProductImageRequest{
+		ProductId: productId,
+		Image: &pb.ProductImage{
+			Id:           image.ID,
+			Key:          image.Key,
+			ThumbnailKey: image.ThumbnailKey,
+			ContentType:  image.ContentType,
+			Width:        int32(image.Width),
+			Height:       int32(image.Height),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(res.Product), nil
+}
+
+// RemoveProductImage removes an image from a product, leaving its files in storage.
+func (client *Client) RemoveProductImage(ctx context.Context, productId, imageId string) (*models.Product, error) {
+	res, err := client.service.RemoveProductImage(ctx, &pb.RemoveProductImageRequest{
+		ProductId: productId,
+		ImageId:   imageId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(res.Product), nil
+}
+
+// SetStock sets the quantity on hand of a product, or of one of its variants
+// when sku is set.
+func (client *Client) SetStock(ctx context.Context, productId, sku string, onHand int64) (*models.Stock, error) {
+	res, err := client.service.SetStock(ctx, &pb.SetStockRequest{
+		ProductId: productId,
+		Sku:       sku,
+		OnHand:    onHand,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stockFromProto(res.Stock), nil
+}
+
+// GetStock returns the stock of the tracked products among productIds.
+func (client *Client) GetStock(ctx context.Context, productIds []string) ([]models.Stock, error) {
+	res, err := client.service.GetStock(ctx, &pb.GetStockRequest{
+		ProductIds: productIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stock := make([]models.Stock, 0, len(res.Stocks))
+	for _, s := range res.Stocks {
+		stock = append(stock, *stockFromProto(s))
+	}
+	return stock, nil
+}
+
+// ReserveStock holds stock for an order and returns the reservation, which has
+// to be committed once the order is paid for or released if it is abandoned.
+func (client *Client) ReserveStock(ctx context.Context, items []models.ReservationItem) (*models.Reservation, error) {
+	req := &pb.ReserveStockRequest{}
+	for _, item := range items {
+		req.Items = append(req.Items, &pb.ReservationItem{
+			ProductId: item.ProductID,
+			Sku:       item.SKU,
+			Quantity:  uint32(item.Quantity),
+		})
+	}
+	res, err := client.service.ReserveStock(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	reservation := &models.Reservation{
+		ID:     res.Id,
+		Status: models.ReservationPending,
+		Items:  items,
+	}
+	if err = reservation.ExpiresAt.UnmarshalBinary(res.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (client *Client) CommitReservation(ctx context.Context, id string) error {
+	_, err := client.service.CommitReservation(ctx, &wrapperspb.StringValue{
+		Value: id,
+	})
+	return err
+}
+
+func (client *Client) ReleaseReservation(ctx context.Context, id string) error {
+	_, err := client.service.ReleaseReservation(ctx, &wrapperspb.StringValue{
+		Value: id,
+	})
+	return err
+}
+
+// RestockReservation puts the stock taken by a committed reservation back on
+// hand, when its order is cancelled or refunded.
+func (client *Client) RestockReservation(ctx context.Context, id string) error {
+	_, err := client.service.RestockReservation(ctx, &wrapperspb.StringValue{
+		Value: id,
+	})
+	return err
+}
+
+// SetProductRating records the rating of a product from its published reviews.
+func (client *Client) SetProductRating(ctx context.Context, productID string, rating models.Rating) error {
+	_, err := client.service.SetProductRating(ctx, &pb.SetProductRatingRequest{
+		ProductId: productID,
+		Average:   rating.Average,
+		Count:     int32(rating.Count),
+	})
+	return err
+}
+
+// GetPriceHistory lists the price changes of a product, newest first.
+func (client *Client) GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]*models.PriceChange, error) {
+	res, err := client.service.GetPriceHistory(ctx, &pb.GetPriceHistoryRequest{
+		ProductId: productId,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*models.PriceChange, 0, len(res.Changes))
+	for _, c := range res.Changes {
+		change := &models.PriceChange{
+			ProductID: c.ProductId,
+			OldPrice:  c.OldPrice,
+			NewPrice:  c.NewPrice,
+			ActorID:   int(c.ActorId),
+			Reason:    models.PriceChangeReason(c.Reason),
+		}
+		if c.ScheduleId != 0 {
+			scheduleID := c.ScheduleId
+			change.ScheduleID = &scheduleID
+		}
+		if err = change.ChangedAt.UnmarshalBinary(c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// SchedulePriceChange sets the price of a product of the caller at startsAt,
+// until endsAt for a sale.
+func (client *Client) SchedulePriceChange(ctx context.Context, productId string, price float64, startsAt time.Time, endsAt *time.Time) (*models.PriceSchedule, error) {
+	r := &pb.SchedulePriceChangeRequest{
+		ProductId: productId,
+		Price:     price,
+	}
+	var err error
+	if r.StartsAt, err = startsAt.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if endsAt != nil {
+		if r.EndsAt, err = endsAt.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	res, err := client.service.SchedulePriceChange(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return priceScheduleFromProto(res.Schedule)
+}
+
+func (client *Client) CancelPriceSchedule(ctx context.Context, id uint64) (*models.PriceSchedule, error) {
+	res, err := client.service.CancelPriceSchedule(ctx, &wrapperspb.UInt64Value{Value: id})
+	if err != nil {
+		return nil, err
+	}
+	return priceScheduleFromProto(res.Schedule)
+}
+
+func (client *Client) ListPriceSchedules(ctx context.Context, productId string) ([]*models.PriceSchedule, error) {
+	res, err := client.service.ListPriceSchedules(ctx, &wrapperspb.StringValue{Value: productId})
+	if err != nil {
+		return nil, err
+	}
+	schedules := make([]*models.PriceSchedule, 0, len(res.Schedules))
+	for _, s := range res.Schedules {
+		schedule, err := priceScheduleFromProto(s)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func priceScheduleFromProto(s *pb.PriceSchedule) (*models.PriceSchedule, error) {
+	schedule := &models.PriceSchedule{
+		ID:           s.Id,
+		ProductID:    s.ProductId,
+		Price:        s.Price,
+		Status:       models.PriceScheduleStatus(s.Status),
+		RegularPrice: s.RegularPrice,
+	}
+	if err := schedule.StartsAt.UnmarshalBinary(s.StartsAt); err != nil {
+		return nil, err
+	}
+	if len(s.EndsAt) > 0 {
+		endsAt := time.Time{}
+		if err := endsAt.UnmarshalBinary(s.EndsAt); err != nil {
+			return nil, err
+		}
+		schedule.EndsAt = &endsAt
+	}
+	if err := schedule.CreatedAt.UnmarshalBinary(s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func stockFromProto(s *pb.Stock) *models.Stock {
+	return &models.Stock{
+		ProductID: s.ProductId,
+		SKU:       s.Sku,
+		OnHand:    int(s.OnHand),
+		Reserved:  int(s.Reserved),
+	}
+}
@@ -0,0 +1,151 @@
+// Command catalog imports products into a seller's catalog from a CSV or JSONL
+// file, and exports the catalog to one.
+//
+//	catalog [flags] import products.csv
+//	catalog [flags] export products.jsonl
+//
+// The seller is the owner of the access token, passed with -token or the
+// ACCESS_TOKEN environment variable. A file named "-" is read from stdin or
+// written to stdout.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/rasadov/EcommerceAPI/pkg/contextkeys"
+	"github.com/rasadov/EcommerceAPI/product/client"
+	"github.com/rasadov/EcommerceAPI/product/models"
+)
+
+func main() {
+	log.SetFlags(0)
+	flags := flag.NewFlagSet("catalog", flag.ExitOnError)
+	addr := flags.String("addr", envOr("PRODUCT_SERVICE_URL", "localhost:8080"), "address of the product service")
+	token := flags.String("token", os.Getenv("ACCESS_TOKEN"), "access token of the seller")
+	formatName := flags.String("format", "", "csv or jsonl, guessed from the file extension by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: catalog [flags] import|export FILE")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command, path := flags.Arg(0), flags.Arg(1)
+	if *token == "" {
+		log.Fatal("An access token is required, pass -token or set ACCESS_TOKEN")
+	}
+	format, err := bulkFormat(*formatName, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	productClient, err := client.NewClient(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer productClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = context.WithValue(ctx, contextkeys.TokenKey, *token)
+
+	switch command {
+	case "import":
+		err = importProducts(ctx, productClient, format, path)
+	case "export":
+		err = exportProducts(ctx, productClient, format, path)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func importProducts(ctx context.Context, productClient *client.Client, format models.BulkFormat, path string) error {
+	var file io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		file = f
+	}
+
+	result, err := productClient.ImportProducts(ctx, format, file)
+	if err != nil {
+		return err
+	}
+	for _, rowErr := range result.Errors {
+		log.Printf("line %d: %s", rowErr.Line, rowErr.Message)
+	}
+	if hidden := result.Failed - len(result.Errors); hidden > 0 {
+		log.Printf("... and %d more rows with errors", hidden)
+	}
+	log.Printf("Created %d, updated %d, failed %d", result.Created, result.Updated, result.Failed)
+	if result.Failed > 0 {
+		return errors.New("some rows were not imported")
+	}
+	return nil
+}
+
+// exportProducts writes the export next to path and renames it once complete,
+// so a failed export does not leave a truncated file behind.
+func exportProducts(ctx context.Context, productClient *client.Client, format models.BulkFormat, path string) error {
+	if path == "-" {
+		return productClient.ExportProducts(ctx, format, os.Stdout)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".catalog-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = productClient.ExportProducts(ctx, format, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func bulkFormat(name, path string) (models.BulkFormat, error) {
+	if name == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			name = "jsonl"
+		default:
+			name = "csv"
+		}
+	}
+	switch strings.ToLower(name) {
+	case "csv":
+		return models.FormatCSV, nil
+	case "jsonl":
+		return models.FormatJSONL, nil
+	}
+	return 0, fmt.Errorf("unknown format %q, use csv or jsonl", name)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
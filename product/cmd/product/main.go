@@ -5,14 +5,19 @@ import (
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
 	"github.com/rasadov/EcommerceAPI/product/config"
 	"github.com/tinrab/retry"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 
 	"github.com/rasadov/EcommerceAPI/product/internal"
 )
 
 func main() {
 	var repository internal.Repository
+	var inventory internal.InventoryRepository
+	var prices internal.PriceRepository
 
 	producer, err := sarama.NewAsyncProducer([]string{config.BootstrapServers}, nil)
 	if err != nil {
@@ -33,7 +38,30 @@ func main() {
 		return
 	})
 	defer repository.Close()
-	log.Println("Listening on port 8080...")
-	service := internal.NewProductService(repository, producer)
-	log.Fatal(internal.ListenGRPC(service, 8080))
+
+	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
+		db, err := gorm.Open(postgres.Open(config.InventoryDatabaseURL), &gorm.Config{})
+		if err != nil {
+			log.Println(err)
+		}
+		inventory, err = internal.NewPostgresInventoryRepository(db)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		// Price history shares the inventory database
+		prices, err = internal.NewPostgresPriceRepository(db)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	})
+	defer inventory.Close()
+
+	log.Println("Listening on port 8080, internal port 8082...")
+	service := internal.NewProductService(repository, inventory, prices, producer)
+	go internal.ReleaseExpiredReservationsEvery(service, time.Minute)
+	go internal.ApplyPriceSchedulesEvery(service, time.Minute)
+	keys := auth.NewRemoteKeySet(auth.HTTPJWKSFetcher(config.JWKSURL))
+	log.Fatal(internal.ListenGRPC(service, keys, 8080, 8082))
 }
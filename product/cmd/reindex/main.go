@@ -0,0 +1,70 @@
+// Command reindex rebuilds the product service indices with their current
+// mappings and analyzers while the service keeps running.
+//
+//	reindex [flags] catalog|categories|all
+//
+// Each index is copied into a new version, catalog_v2 after catalog_v1, and
+// its alias is moved to the copy in one step. The old version is kept unless
+// -delete-old is passed, so the alias can be pointed back at it. An index from
+// before versioned indices, named like its alias, is kept as version 0, e.g.
+// catalog_v0; writes to it are blocked for the last copy before the swap.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/product/config"
+	"github.com/rasadov/EcommerceAPI/product/internal"
+)
+
+// reindexTimeout bounds a whole run.
+const reindexTimeout = 6 * time.Hour
+
+func main() {
+	log.SetFlags(0)
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	databaseURL := flags.String("url", config.DatabaseURL, "URL of Elasticsearch or OpenSearch, DATABASE_URL by default")
+	deleteOld := flags.Bool("delete-old", false, "delete the old index once the alias points at the new one")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: reindex [flags] catalog|categories|all")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *databaseURL == "" {
+		log.Fatal("A database URL is required, pass -url or set DATABASE_URL")
+	}
+
+	aliases := []string{flags.Arg(0)}
+	if aliases[0] == "all" {
+		aliases = []string{"categories", "catalog"}
+	} else if _, ok := internal.Indices[aliases[0]]; !ok {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, reindexTimeout)
+	defer cancel()
+
+	for _, alias := range aliases {
+		result, err := internal.Reindex(ctx, *databaseURL, alias, *deleteOld)
+		if err != nil {
+			log.Fatalf("Reindexing %s: %v", alias, err)
+		}
+		log.Printf("Reindexed %s from %s into %s, %d documents", alias, result.Old, result.New, result.Copied)
+		if result.Kept != "" {
+			log.Printf("The documents of %s are kept in %s", result.Old, result.Kept)
+		}
+	}
+}
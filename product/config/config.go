@@ -5,9 +5,15 @@ import "os"
 var (
 	DatabaseURL      string
 	BootstrapServers string
+	// JWKSURL is where the account service publishes the keys that sign access tokens
+	JWKSURL string
+	// InventoryDatabaseURL is the Postgres database keeping stock and reservations
+	InventoryDatabaseURL string
 )
 
 func init() {
 	DatabaseURL = os.Getenv("DATABASE_URL")
 	BootstrapServers = os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
+	JWKSURL = os.Getenv("JWKS_URL")
+	InventoryDatabaseURL = os.Getenv("INVENTORY_DATABASE_URL")
 }
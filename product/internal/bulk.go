@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	ErrInvalidHeader = errors.New("the CSV header needs name and price columns")
+)
+
+// csvColumns are the columns of exported CSV files. Imports need name and price,
+// the other columns are optional and can come in any order.
+var csvColumns = []string{"id", "name", "description", "price", "category_ids"}
+
+// csvListSeparator separates the category IDs in a CSV cell
+const csvListSeparator = ";"
+
+// maxJSONLine is the longest JSONL line read, in bytes.
+const maxJSONLine = 1 << 20
+
+// readImportRows calls fn with every row of an import file along with the error
+// that makes the row invalid, if any. It stops at the first error fn returns or
+// at one that makes the rest of the file unreadable.
+func readImportRows(r io.Reader, format models.BulkFormat, fn func(row models.ImportRow, rowErr error) error) error {
+	switch format {
+	case models.FormatCSV:
+		return readCSVRows(r, fn)
+	case models.FormatJSONL:
+		return readJSONLRows(r, fn)
+	}
+	return ErrUnknownFormat
+}
+
+func readCSVRows(r io.Reader, fn func(row models.ImportRow, rowErr error) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasName := columns["name"]
+	_, hasPrice := columns["price"]
+	if !hasName || !hasPrice {
+		return ErrInvalidHeader
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err = fn(models.ImportRow{Line: parseErr.StartLine}, parseErr.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		cell := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		row := models.ImportRow{
+			Line:        line,
+			ID:          cell("id"),
+			Name:        cell("name"),
+			Description: cell("description"),
+		}
+		if ids := cell("category_ids"); ids != "" {
+			for _, id := range strings.Split(ids, csvListSeparator) {
+				if id = strings.TrimSpace(id); id != "" {
+					row.CategoryIDs = append(row.CategoryIDs, id)
+				}
+			}
+		}
+		var rowErr error
+		row.Price, err = strconv.ParseFloat(cell("price"), 64)
+		if err != nil {
+			rowErr = fmt.Errorf("invalid price %q", cell("price"))
+		}
+		if err = fn(row, rowErr); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONLRows(r io.Reader, fn func(row models.ImportRow, rowErr error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLine)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		row := models.ImportRow{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		rowErr := decoder.Decode(&row)
+		row.Line = line
+		if err := fn(row, rowErr); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// validateImportRow checks the fields a product needs.
+func validateImportRow(row models.ImportRow) error {
+	if strings.TrimSpace(row.Name) == "" {
+		return errors.New("name must not be empty")
+	}
+	if row.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	for i, id := range row.CategoryIDs {
+		if slices.Contains(row.CategoryIDs[:i], id) {
+			return fmt.Errorf("category %s is listed twice", id)
+		}
+	}
+	return nil
+}
+
+// productWriter writes products as the rows of an export file.
+type productWriter interface {
+	Write(product *models.Product) error
+	Flush() error
+}
+
+func newProductWriter(w io.Writer, format models.BulkFormat) (productWriter, error) {
+	switch format {
+	case models.FormatCSV:
+		return &csvProductWriter{writer: csv.NewWriter(w)}, nil
+	case models.FormatJSONL:
+		return &jsonlProductWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvProductWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvProductWriter) Write(product *models.Product) error {
+	if !w.headerWritten {
+		if err := w.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	return w.writer.Write([]string{
+		product.ID,
+		product.Name,
+		product.Description,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		strings.Join(product.CategoryIDs, csvListSeparator),
+	})
+}
+
+// Flush writes the header of an empty export, so it can still be imported.
+func (w *csvProductWriter) Flush() error {
+	if !w.headerWritten {
+		if err := w.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonlProductWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlProductWriter) Write(product *models.Product) error {
+	return w.encoder.Encode(models.ImportRow{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		CategoryIDs: product.CategoryIDs,
+	})
+}
+
+func (w *jsonlProductWriter) Flush() error {
+	return nil
+}
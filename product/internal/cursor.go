@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is where a page of products ends: the sort values of its last product.
+// A search continues after it with search_after. The cursor records the order
+// it was made for, since its values mean nothing in another one.
+type cursor struct {
+	Sort  models.ProductSort `json:"s"`
+	After json.RawMessage    `json:"a"`
+}
+
+// productSorts orders the products for a search. Every order ends with the
+// product ID, so products are never tied and pages neither skip nor repeat
+// products. The ID is sorted on its indexed copy, newer clusters refuse to sort
+// on _id. Reversed orders look for the products before a cursor.
+func productSorts(sort models.ProductSort, reversed bool) []elastic.Sorter {
+	var sorts []elastic.Sorter
+	switch sort {
+	case models.SortPriceAsc:
+		sorts = append(sorts, elastic.NewFieldSort("price").Order(!reversed))
+	case models.SortPriceDesc:
+		sorts = append(sorts, elastic.NewFieldSort("price").Order(reversed))
+	case models.SortNewest:
+		// Products indexed before creation times were recorded come last
+		missing := "_last"
+		if reversed {
+			missing = "_first"
+		}
+		sorts = append(sorts, elastic.NewFieldSort("created_at").Order(reversed).Missing(missing))
+	default:
+		sorts = append(sorts, elastic.NewScoreSort().Order(reversed))
+	}
+	return append(sorts, elastic.NewFieldSort(catalogIndex.idField).Order(!reversed))
+}
+
+// encodeCursor makes the opaque cursor of a product from its sort values.
+func encodeCursor(sort models.ProductSort, values json.RawMessage) (string, error) {
+	data, err := json.Marshal(cursor{Sort: sort, After: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the sort values to search after, checking the cursor was
+// made for the same order.
+func decodeCursor(sort models.ProductSort, value string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := cursor{}
+	if err = json.Unmarshal(data, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	// Numbers are kept as they were sent, a long does not fit a float64
+	decoder := json.NewDecoder(bytes.NewReader(c.After))
+	decoder.UseNumber()
+	var values []interface{}
+	if err = decoder.Decode(&values); err != nil || len(values) != len(productSorts(sort, false)) {
+		return nil, ErrInvalidCursor
+	}
+	for _, v := range values {
+		switch v.(type) {
+		case json.Number, string:
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,442 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/olivere/elastic.v5"
+)
+
+// scrollKeepAlive is how long a scroll is kept between two pages
+const scrollKeepAlive = "1m"
+
+// esClient sends requests to Elasticsearch or OpenSearch. Elasticsearch 5 and 6
+// address documents by mapping type, later versions and OpenSearch have no
+// types; the client finds out which the cluster needs when it connects. Queries
+// are built with the elastic package, whose request builders only speak the
+// typed API.
+type esClient struct {
+	client *elastic.Client
+	// typed is set for clusters that need mapping types
+	typed bool
+}
+
+type esHit struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+	// Sort holds the sort values of the hit, to search after it
+	Sort json.RawMessage `json:"sort,omitempty"`
+}
+
+type esSearchResult struct {
+	Total        int64
+	Hits         []esHit
+	Aggregations elastic.Aggregations
+	Suggest      elastic.SearchSuggest
+	ScrollID     string
+}
+
+type esBulkAction struct {
+	// ID is empty for documents indexed under a generated ID
+	ID string
+	// Update applies Doc as a partial update instead of indexing it
+	Update bool
+	Doc    interface{}
+}
+
+type esBulkItem struct {
+	ID     string
+	Status int
+	Error  string
+}
+
+func newESClient(url string) (*esClient, error) {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.PerformRequest(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil {
+		client.Stop()
+		return nil, err
+	}
+	info := struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}{}
+	if err = json.Unmarshal(res.Body, &info); err != nil {
+		client.Stop()
+		return nil, err
+	}
+	major, _ := strconv.Atoi(strings.SplitN(info.Version.Number, ".", 2)[0])
+	typed := info.Version.Distribution != "opensearch" && major < 7
+	log.Printf("Connected to %s %s, mapping types: %t", distributionName(info.Version.Distribution), info.Version.Number, typed)
+	return &esClient{client: client, typed: typed}, nil
+}
+
+func distributionName(distribution string) string {
+	if distribution == "opensearch" {
+		return "OpenSearch"
+	}
+	return "Elasticsearch"
+}
+
+func (c *esClient) Stop() {
+	c.client.Stop()
+}
+
+// docPath is the path of a document, or of the documents of an index when id is empty.
+func (c *esClient) docPath(index, docType, id string) string {
+	path := "/" + url.PathEscape(index)
+	if c.typed {
+		path += "/" + docType
+	} else {
+		path += "/_doc"
+	}
+	if id != "" {
+		path += "/" + url.PathEscape(id)
+	}
+	return path
+}
+
+func (c *esClient) updatePath(index, docType, id string) string {
+	if c.typed {
+		return c.docPath(index, docType, id) + "/_update"
+	}
+	return "/" + url.PathEscape(index) + "/_update/" + url.PathEscape(id)
+}
+
+// mappingBody wraps a mapping in its type for clusters that need one.
+func (c *esClient) mappingBody(docType string, mapping map[string]interface{}) map[string]interface{} {
+	if c.typed {
+		return map[string]interface{}{docType: mapping}
+	}
+	return mapping
+}
+
+func refreshParams(refresh bool) url.Values {
+	if !refresh {
+		return nil
+	}
+	return url.Values{"refresh": {"wait_for"}}
+}
+
+// indexDoc saves a document and returns its ID, which is generated when id is empty.
+func (c *esClient) indexDoc(ctx context.Context, index, docType, id string, doc interface{}, refresh bool) (string, error) {
+	method := http.MethodPut
+	if id == "" {
+		method = http.MethodPost
+	}
+	res, err := c.client.PerformRequest(ctx, method, c.docPath(index, docType, id), refreshParams(refresh), doc)
+	if err != nil {
+		return "", err
+	}
+	created := struct {
+		ID string `json:"_id"`
+	}{}
+	if err = json.Unmarshal(res.Body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// getDoc decodes the source of a document into source, or returns ErrNotFound.
+func (c *esClient) getDoc(ctx context.Context, index, docType, id string, source interface{}) error {
+	res, err := c.client.PerformRequest(ctx, http.MethodGet, c.docPath(index, docType, id), nil, nil, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	doc := struct {
+		Found  bool            `json:"found"`
+		Source json.RawMessage `json:"_source"`
+	}{}
+	if err = json.Unmarshal(res.Body, &doc); err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound || !doc.Found {
+		return ErrNotFound
+	}
+	return json.Unmarshal(doc.Source, source)
+}
+
+// multiGet returns the documents found among ids.
+func (c *esClient) multiGet(ctx context.Context, index, docType string, ids []string) ([]esHit, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	path := "/" + url.PathEscape(index) + "/_mget"
+	if c.typed {
+		path = c.docPath(index, docType, "") + "/_mget"
+	}
+	res, err := c.client.PerformRequest(ctx, http.MethodPost, path, nil, map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	docs := struct {
+		Docs []struct {
+			esHit
+			Found bool `json:"found"`
+		} `json:"docs"`
+	}{}
+	if err = json.Unmarshal(res.Body, &docs); err != nil {
+		return nil, err
+	}
+	var hits []esHit
+	for _, doc := range docs.Docs {
+		if doc.Found {
+			hits = append(hits, doc.esHit)
+		}
+	}
+	return hits, nil
+}
+
+// updateDoc applies a partial update, or returns ErrNotFound.
+func (c *esClient) updateDoc(ctx context.Context, index, docType, id string, doc interface{}) error {
+	_, err := c.client.PerformRequest(ctx, http.MethodPost, c.updatePath(index, docType, id), nil, map[string]interface{}{"doc": doc})
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// deleteDoc deletes a document, or returns ErrNotFound.
+func (c *esClient) deleteDoc(ctx context.Context, index, docType, id string, refresh bool) error {
+	_, err := c.client.PerformRequest(ctx, http.MethodDelete, c.docPath(index, docType, id), refreshParams(refresh), nil)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// search runs a search built with elastic.SearchSource. Totals are counted
+// exactly, newer versions otherwise stop counting at 10,000.
+func (c *esClient) search(ctx context.Context, index string, source *elastic.SearchSource, params url.Values) (*esSearchResult, error) {
+	body, err := source.Source()
+	if err != nil {
+		return nil, err
+	}
+	if !c.typed {
+		if params == nil {
+			params = url.Values{}
+		}
+		params.Set("track_total_hits", "true")
+	}
+	res, err := c.client.PerformRequest(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_search", params, body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSearchResult(res.Body)
+}
+
+// scroll calls fn with every document matching query, stopping at the first
+// error.
+func (c *esClient) scroll(ctx context.Context, index string, query elastic.Query, size int, fn func(esHit) error) error {
+	result, err := c.search(ctx, index, elastic.NewSearchSource().Query(query).Size(size).Sort("_doc", true), url.Values{"scroll": {scrollKeepAlive}})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if result.ScrollID == "" {
+			return
+		}
+		_, err := c.client.PerformRequest(context.Background(), http.MethodDelete, "/_search/scroll", nil,
+			map[string]interface{}{"scroll_id": []string{result.ScrollID}})
+		if err != nil {
+			log.Println("Failed to clear scroll:", err)
+		}
+	}()
+
+	for len(result.Hits) > 0 {
+		for _, hit := range result.Hits {
+			if err = fn(hit); err != nil {
+				return err
+			}
+		}
+		res, err := c.client.PerformRequest(ctx, http.MethodPost, "/_search/scroll", nil, map[string]interface{}{
+			"scroll":    scrollKeepAlive,
+			"scroll_id": result.ScrollID,
+		})
+		if err != nil {
+			return err
+		}
+		if result, err = decodeSearchResult(res.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeSearchResult(body []byte) (*esSearchResult, error) {
+	res := struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			// Total is a number up to Elasticsearch 6 and an object after
+			Total json.RawMessage `json:"total"`
+			Hits  []esHit         `json:"hits"`
+		} `json:"hits"`
+		Aggregations elastic.Aggregations  `json:"aggregations"`
+		Suggest      elastic.SearchSuggest `json:"suggest"`
+	}{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	result := &esSearchResult{
+		Hits:         res.Hits.Hits,
+		Aggregations: res.Aggregations,
+		Suggest:      res.Suggest,
+		ScrollID:     res.ScrollID,
+	}
+	if len(res.Hits.Total) > 0 && json.Unmarshal(res.Hits.Total, &result.Total) != nil {
+		total := struct {
+			Value int64 `json:"value"`
+		}{}
+		if err := json.Unmarshal(res.Hits.Total, &total); err != nil {
+			return nil, err
+		}
+		result.Total = total.Value
+	}
+	return result, nil
+}
+
+// bulk sends the actions in one request and returns their results in order.
+func (c *esClient) bulk(ctx context.Context, index, docType string, actions []esBulkAction, refresh bool) ([]esBulkItem, error) {
+	if len(actions) == 0 {
+		return nil, nil
+	}
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, action := range actions {
+		meta := map[string]interface{}{"_index": index}
+		if c.typed {
+			meta["_type"] = docType
+		}
+		if action.ID != "" {
+			meta["_id"] = action.ID
+		}
+		var err error
+		if action.Update {
+			err = encoder.Encode(map[string]interface{}{"update": meta})
+			if err == nil {
+				err = encoder.Encode(map[string]interface{}{"doc": action.Doc})
+			}
+		} else {
+			err = encoder.Encode(map[string]interface{}{"index": meta})
+			if err == nil {
+				err = encoder.Encode(action.Doc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := c.client.PerformRequestWithContentType(ctx, http.MethodPost, "/_bulk", refreshParams(refresh), body.String(), "application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+	response := struct {
+		Items []map[string]struct {
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  *struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}{}
+	if err = json.Unmarshal(res.Body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Items) != len(actions) {
+		return nil, fmt.Errorf("bulk request returned %d results for %d actions", len(response.Items), len(actions))
+	}
+
+	items := make([]esBulkItem, len(actions))
+	for i, item := range response.Items {
+		for _, result := range item {
+			items[i] = esBulkItem{ID: result.ID, Status: result.Status}
+			if result.Error != nil {
+				items[i].Error = result.Error.Reason
+			}
+		}
+	}
+	return items, nil
+}
+
+// indexExists reports whether name is an index or an alias.
+func (c *esClient) indexExists(ctx context.Context, name string) (bool, error) {
+	res, err := c.client.PerformRequest(ctx, http.MethodHead, "/"+url.PathEscape(name), nil, nil, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+// aliasIndices returns the indices behind an alias, none when name is not an alias.
+func (c *esClient) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	res, err := c.client.PerformRequest(ctx, http.MethodGet, "/_alias/"+url.PathEscape(alias), nil, nil, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	indices := map[string]json.RawMessage{}
+	if err = json.Unmarshal(res.Body, &indices); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// waitForTask polls a background task until it completes and returns its response.
+func (c *esClient) waitForTask(ctx context.Context, taskID string, progress func(status json.RawMessage)) (json.RawMessage, error) {
+	for {
+		res, err := c.client.PerformRequest(ctx, http.MethodGet, "/_tasks/"+url.PathEscape(taskID), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		task := struct {
+			Completed bool `json:"completed"`
+			Task      struct {
+				Status json.RawMessage `json:"status"`
+			} `json:"task"`
+			Response json.RawMessage `json:"response"`
+			Error    json.RawMessage `json:"error"`
+		}{}
+		if err = json.Unmarshal(res.Body, &task); err != nil {
+			return nil, err
+		}
+		if task.Completed {
+			if len(task.Error) > 0 {
+				return nil, fmt.Errorf("task %s failed: %s", taskID, task.Error)
+			}
+			return task.Response, nil
+		}
+		if progress != nil {
+			progress(task.Task.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/olivere/elastic.v5"
+)
+
+// indexDefinition describes an index the service reads and writes through an
+// alias. The index behind the alias is versioned, NAME_vN, so a new version can
+// be built with a changed mapping and swapped in by Reindex.
+type indexDefinition struct {
+	alias string
+	// docType is the mapping type on clusters that still have types
+	docType string
+	// idField is a keyword field repeating the document ID, filled in on the
+	// documents indexed before it existed
+	idField  string
+	settings map[string]interface{}
+	mapping  map[string]interface{}
+}
+
+// textAnalysis defines the analyzers of the product texts. product_text
+// lowercases words, strips their accents and reduces them to their stem, so
+// "Cameras" matches "camera". product_words keeps the words whole for spelling
+// suggestions, and autocomplete indexes the beginnings of words for type-ahead.
+var textAnalysis = map[string]interface{}{
+	"filter": map[string]interface{}{
+		"english_stemmer": map[string]interface{}{
+			"type":     "stemmer",
+			"language": "light_english",
+		},
+		"word_prefixes": map[string]interface{}{
+			"type":     "edge_ngram",
+			"min_gram": 1,
+			"max_gram": 20,
+		},
+	},
+	"analyzer": map[string]interface{}{
+		"product_text": map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    []string{"lowercase", "asciifolding", "english_stemmer"},
+		},
+		"product_words": map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    []string{"lowercase", "asciifolding"},
+		},
+		"autocomplete": map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    []string{"lowercase", "asciifolding", "word_prefixes"},
+		},
+	},
+}
+
+var catalogIndex = indexDefinition{
+	alias:   "catalog",
+	docType: "product",
+	idField: "product_id",
+	settings: map[string]interface{}{
+		"analysis": textAnalysis,
+	},
+	mapping: map[string]interface{}{
+		// Fields that are not mapped are kept in the source but not indexed
+		"dynamic": false,
+		"properties": map[string]interface{}{
+			"product_id": map[string]interface{}{"type": "keyword"},
+			"name": map[string]interface{}{
+				"type":     "text",
+				"analyzer": "product_text",
+				"fields": map[string]interface{}{
+					"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+					"words":   map[string]interface{}{"type": "text", "analyzer": "product_words"},
+					// The typed text is matched whole against the indexed prefixes
+					"autocomplete": map[string]interface{}{
+						"type":            "text",
+						"analyzer":        "autocomplete",
+						"search_analyzer": "product_words",
+					},
+				},
+			},
+			"description":    map[string]interface{}{"type": "text", "analyzer": "product_text"},
+			"price":          map[string]interface{}{"type": "double"},
+			"account_id":     map[string]interface{}{"type": "long"},
+			"created_at":     map[string]interface{}{"type": "date"},
+			"status":         map[string]interface{}{"type": "keyword"},
+			"category_ids":   map[string]interface{}{"type": "keyword"},
+			"category_paths": map[string]interface{}{"type": "keyword"},
+			"options": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"name":   map[string]interface{}{"type": "keyword"},
+					"values": map[string]interface{}{"type": "keyword"},
+				},
+			},
+			"variants": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"sku":   map[string]interface{}{"type": "keyword"},
+					"price": map[string]interface{}{"type": "double"},
+					"options": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"name":  map[string]interface{}{"type": "keyword"},
+							"value": map[string]interface{}{"type": "keyword"},
+						},
+					},
+				},
+			},
+			"rating": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"average": map[string]interface{}{"type": "float"},
+					"count":   map[string]interface{}{"type": "integer"},
+				},
+			},
+			"images": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"id":            map[string]interface{}{"type": "keyword"},
+					"key":           map[string]interface{}{"type": "keyword", "index": false},
+					"thumbnail_key": map[string]interface{}{"type": "keyword", "index": false},
+					"content_type":  map[string]interface{}{"type": "keyword", "index": false},
+					"width":         map[string]interface{}{"type": "integer", "index": false},
+					"height":        map[string]interface{}{"type": "integer", "index": false},
+				},
+			},
+		},
+	},
+}
+
+var categoriesIndex = indexDefinition{
+	alias:   "categories",
+	docType: "category",
+	mapping: map[string]interface{}{
+		"dynamic": false,
+		"properties": map[string]interface{}{
+			"name":      map[string]interface{}{"type": "keyword"},
+			"parent_id": map[string]interface{}{"type": "keyword"},
+			"path":      map[string]interface{}{"type": "keyword"},
+		},
+	},
+}
+
+// Indices lists the indices the product service keeps, by alias.
+var Indices = map[string]indexDefinition{
+	catalogIndex.alias:    catalogIndex,
+	categoriesIndex.alias: categoriesIndex,
+}
+
+// ensureIndex creates the first version of an index behind its alias. An
+// existing index gets the fields added to the mapping since it was built;
+// changes to existing fields need a reindex.
+func (c *esClient) ensureIndex(ctx context.Context, def indexDefinition) error {
+	indices, err := c.aliasIndices(ctx, def.alias)
+	if err != nil {
+		return err
+	}
+	if len(indices) == 0 {
+		exists, err := c.indexExists(ctx, def.alias)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			name := versionedIndexName(def.alias, 1)
+			if err = c.createIndex(ctx, name, def); err != nil {
+				return err
+			}
+			return c.swapAlias(ctx, def.alias, "", name)
+		}
+		log.Printf("Index %s predates versioned indices, run the reindex command to move it behind an alias", def.alias)
+	}
+
+	_, err = c.client.PerformRequest(ctx, http.MethodPut, c.mappingPath(def.alias, def.docType), nil, c.mappingBody(def.docType, def.mapping))
+	if err != nil {
+		log.Printf("Failed to update the mapping of %s, run the reindex command to apply it: %v", def.alias, err)
+		return nil
+	}
+	if def.idField != "" {
+		if err = c.fillIDField(ctx, def); err != nil {
+			log.Printf("Failed to fill %s in %s: %v", def.idField, def.alias, err)
+		}
+	}
+	return nil
+}
+
+// fillIDField starts a background task copying the ID of the documents that
+// do not have the ID field yet into it.
+func (c *esClient) fillIDField(ctx context.Context, def indexDefinition) error {
+	missing, err := elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery(def.idField)).Source()
+	if err != nil {
+		return err
+	}
+	res, err := c.client.PerformRequest(ctx, http.MethodPost, "/"+url.PathEscape(def.alias)+"/_update_by_query",
+		url.Values{"conflicts": {"proceed"}, "wait_for_completion": {"false"}},
+		map[string]interface{}{
+			"query": missing,
+			"script": map[string]interface{}{
+				"source": "ctx._source[params.field] = ctx._id",
+				"lang":   "painless",
+				"params": map[string]interface{}{"field": def.idField},
+			},
+		})
+	if err != nil {
+		return err
+	}
+	started := struct {
+		Task string `json:"task"`
+	}{}
+	if err = json.Unmarshal(res.Body, &started); err != nil {
+		return err
+	}
+	log.Printf("Filling %s in %s, task %s", def.idField, def.alias, started.Task)
+	return nil
+}
+
+func (c *esClient) mappingPath(index, docType string) string {
+	if c.typed {
+		return "/" + url.PathEscape(index) + "/_mapping/" + docType
+	}
+	return "/" + url.PathEscape(index) + "/_mapping"
+}
+
+func (c *esClient) createIndex(ctx context.Context, name string, def indexDefinition) error {
+	body := map[string]interface{}{
+		"mappings": c.mappingBody(def.docType, def.mapping),
+	}
+	if def.settings != nil {
+		body["settings"] = def.settings
+	}
+	_, err := c.client.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(name), nil, body)
+	return err
+}
+
+// swapAlias points alias at index instead of old in one atomic change, so
+// readers and writers never see the alias missing. An empty old only adds the
+// alias. An old index named like the alias, from before versioned indices, is
+// deleted, as the alias cannot be added next to it.
+func (c *esClient) swapAlias(ctx context.Context, alias, old, index string) error {
+	var actions []map[string]interface{}
+	switch old {
+	case "":
+	case alias:
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": old}})
+	default:
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": old, "alias": alias}})
+	}
+	actions = append(actions, map[string]interface{}{"add": map[string]interface{}{"index": index, "alias": alias}})
+	_, err := c.client.PerformRequest(ctx, http.MethodPost, "/_aliases", nil, map[string]interface{}{"actions": actions})
+	return err
+}
+
+func versionedIndexName(alias string, version int) string {
+	return fmt.Sprintf("%s_v%d", alias, version)
+}
+
+// nextIndexVersion returns the version after the last one built for alias.
+func (c *esClient) nextIndexVersion(ctx context.Context, alias string) (int, error) {
+	res, err := c.client.PerformRequest(ctx, http.MethodGet, "/_cat/indices/"+url.PathEscape(alias)+"_v*", url.Values{"format": {"json"}, "h": {"index"}}, nil, http.StatusNotFound)
+	if err != nil {
+		return 0, err
+	}
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	if res.StatusCode == http.StatusOK {
+		if err = json.Unmarshal(res.Body, &indices); err != nil {
+			return 0, err
+		}
+	}
+	last := 0
+	for _, index := range indices {
+		version, err := strconv.Atoi(strings.TrimPrefix(index.Index, alias+"_v"))
+		if err == nil && version > last {
+			last = version
+		}
+	}
+	return last + 1, nil
+}
+
+// ReindexResult tells what Reindex did.
+type ReindexResult struct {
+	Old    string
+	New    string
+	Copied int64
+	// Kept is where the documents of an old index named like the alias were
+	// kept, empty when they were deleted
+	Kept string
+}
+
+// Reindex builds a new version of the index behind alias with the current
+// mapping, copies the documents into it and points the alias at it, without
+// stopping the service. Documents written while the copy runs are copied again
+// after the swap; documents deleted meanwhile stay in the new index. The old
+// index is kept unless deleteOld is set, so the swap can be undone.
+//
+// An old index named like the alias, from before versioned indices, has to be
+// deleted by the swap. Writes to it are blocked for the last copy instead, and
+// unless deleteOld is set its documents are kept in version 0 of the index.
+func Reindex(ctx context.Context, databaseURL, alias string, deleteOld bool) (*ReindexResult, error) {
+	def, ok := Indices[alias]
+	if !ok {
+		return nil, fmt.Errorf("unknown index %q", alias)
+	}
+	client, err := newESClient(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Stop()
+
+	old := alias
+	indices, err := client.aliasIndices(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	switch len(indices) {
+	case 0:
+		exists, err := client.indexExists(ctx, alias)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("index %s does not exist", alias)
+		}
+	case 1:
+		old = indices[0]
+	default:
+		slices.Sort(indices)
+		return nil, fmt.Errorf("alias %s points at several indices: %s", alias, strings.Join(indices, ", "))
+	}
+
+	version, err := client.nextIndexVersion(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReindexResult{Old: old, New: versionedIndexName(alias, version)}
+	if err = client.createIndex(ctx, result.New, def); err != nil {
+		return nil, err
+	}
+	log.Printf("Created %s, copying %s", result.New, old)
+
+	if result.Copied, err = client.copyIndex(ctx, old, result.New); err != nil {
+		return nil, err
+	}
+	if old == alias {
+		if !deleteOld {
+			result.Kept = versionedIndexName(alias, 0)
+		}
+		if err = client.replaceLegacyIndex(ctx, alias, result.New, result.Kept); err != nil {
+			return nil, err
+		}
+		log.Printf("Alias %s points at %s", alias, result.New)
+		return result, nil
+	}
+
+	if err = client.swapAlias(ctx, alias, old, result.New); err != nil {
+		return nil, err
+	}
+	log.Printf("Alias %s points at %s", alias, result.New)
+	caughtUp, err := client.copyIndex(ctx, old, result.New)
+	if err != nil {
+		return nil, fmt.Errorf("alias was swapped, but copying the latest changes failed: %w", err)
+	}
+	log.Printf("Copied %d documents changed during the reindex", caughtUp)
+	if deleteOld {
+		if _, err = client.client.PerformRequest(ctx, http.MethodDelete, "/"+url.PathEscape(old), nil, nil); err != nil {
+			return nil, err
+		}
+		log.Printf("Deleted %s", old)
+	}
+	return result, nil
+}
+
+// replaceLegacyIndex puts the alias in place of the index named like it, which
+// index already has a copy of. The documents are copied into keep first, when it
+// is set. Writes to the old index are then blocked while the changes made since
+// the copies are brought over, so none is lost when the swap deletes it.
+func (c *esClient) replaceLegacyIndex(ctx context.Context, alias, index, keep string) error {
+	if keep != "" {
+		if err := c.copyIndexDefinition(ctx, alias, keep); err != nil {
+			return err
+		}
+		if _, err := c.copyIndex(ctx, alias, keep); err != nil {
+			return err
+		}
+		log.Printf("Kept the documents of %s in %s", alias, keep)
+	}
+
+	if err := c.blockWrites(ctx, alias, true); err != nil {
+		return err
+	}
+	log.Printf("Blocked writes to %s to copy the latest changes", alias)
+	err := func() error {
+		for _, dest := range []string{index, keep} {
+			if dest == "" {
+				continue
+			}
+			caughtUp, err := c.copyIndex(ctx, alias, dest)
+			if err != nil {
+				return err
+			}
+			log.Printf("Copied %d documents changed during the reindex into %s", caughtUp, dest)
+		}
+		return c.swapAlias(ctx, alias, alias, index)
+	}()
+	if err != nil {
+		if unblockErr := c.blockWrites(ctx, alias, false); unblockErr != nil {
+			log.Printf("Failed to unblock writes to %s: %v", alias, unblockErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *esClient) blockWrites(ctx context.Context, index string, block bool) error {
+	_, err := c.client.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(index)+"/_settings", nil, map[string]interface{}{
+		"index.blocks.write": block,
+	})
+	return err
+}
+
+// copyIndexDefinition creates dest with the mappings and analysis settings of
+// source, unless it already exists from an earlier run.
+func (c *esClient) copyIndexDefinition(ctx context.Context, source, dest string) error {
+	exists, err := c.indexExists(ctx, dest)
+	if err != nil || exists {
+		return err
+	}
+	res, err := c.client.PerformRequest(ctx, http.MethodGet, "/"+url.PathEscape(source), nil, nil)
+	if err != nil {
+		return err
+	}
+	indices := map[string]struct {
+		Mappings json.RawMessage `json:"mappings"`
+		Settings struct {
+			Index struct {
+				Analysis json.RawMessage `json:"analysis"`
+			} `json:"index"`
+		} `json:"settings"`
+	}{}
+	if err = json.Unmarshal(res.Body, &indices); err != nil {
+		return err
+	}
+	definition, ok := indices[source]
+	if !ok {
+		return fmt.Errorf("index %s does not exist", source)
+	}
+	body := map[string]interface{}{"mappings": definition.Mappings}
+	if len(definition.Settings.Index.Analysis) > 0 {
+		body["settings"] = map[string]interface{}{"analysis": definition.Settings.Index.Analysis}
+	}
+	_, err = c.client.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(dest), nil, body)
+	return err
+}
+
+// copyIndex copies the documents of source into dest with a background reindex
+// task. Versions are kept, so a document is only copied over an older version
+// of itself and a second copy only brings the documents changed since the first.
+func (c *esClient) copyIndex(ctx context.Context, source, dest string) (int64, error) {
+	if _, err := c.client.PerformRequest(ctx, http.MethodPost, "/"+url.PathEscape(source)+"/_refresh", nil, nil); err != nil {
+		return 0, err
+	}
+	res, err := c.client.PerformRequest(ctx, http.MethodPost, "/_reindex", url.Values{"wait_for_completion": {"false"}}, map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    map[string]interface{}{"index": source},
+		"dest":      map[string]interface{}{"index": dest, "version_type": "external"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	started := struct {
+		Task string `json:"task"`
+	}{}
+	if err = json.Unmarshal(res.Body, &started); err != nil {
+		return 0, err
+	}
+
+	type reindexStatus struct {
+		Total   int64 `json:"total"`
+		Created int64 `json:"created"`
+		Updated int64 `json:"updated"`
+	}
+	response, err := c.waitForTask(ctx, started.Task, func(raw json.RawMessage) {
+		status := reindexStatus{}
+		if json.Unmarshal(raw, &status) == nil && status.Total > 0 {
+			log.Printf("Copied %d of %d documents", status.Created+status.Updated, status.Total)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	done := struct {
+		reindexStatus
+		Failures []json.RawMessage `json:"failures"`
+	}{}
+	if err = json.Unmarshal(response, &done); err != nil {
+		return 0, err
+	}
+	if len(done.Failures) > 0 {
+		return 0, fmt.Errorf("%d documents could not be copied, the first failure: %s", len(done.Failures), done.Failures[0])
+	}
+	return done.Created + done.Updated, nil
+}
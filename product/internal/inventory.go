@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+)
+
+var (
+	ErrInsufficientStock    = errors.New("not enough stock")
+	ErrStockBelowReserved   = errors.New("stock cannot be set below the reserved quantity")
+	ErrInvalidStockQuantity = errors.New("stock quantity must not be negative")
+	ErrInvalidReservation   = errors.New("a reservation needs products with positive quantities")
+	ErrReservationNotFound  = errors.New("reservation not found")
+	ErrReservationReleased  = errors.New("reservation was released")
+	ErrReservationCommitted = errors.New("reservation was committed")
+	ErrReservationRestocked = errors.New("reservation was restocked")
+	ErrReservationPending   = errors.New("reservation was not committed")
+)
+
+// InventoryRepository keeps the stock of products and the reservations holding
+// it. Every change locks the stock rows it touches, so concurrent reservations
+// cannot oversell a product.
+type InventoryRepository interface {
+	Close()
+	SetStock(ctx context.Context, productID, sku string, onHand int) (*models.Stock, error)
+	GetStock(ctx context.Context, productIDs []string) ([]*models.Stock, error)
+	DeleteStock(ctx context.Context, productID string) error
+	DeleteVariantStock(ctx context.Context, productID string, skus []string) error
+	ReserveStock(ctx context.Context, reservation *models.Reservation) error
+	CommitReservation(ctx context.Context, id string) error
+	ReleaseReservation(ctx context.Context, id string) error
+	RestockReservation(ctx context.Context, id string) error
+	ListExpiredReservations(ctx context.Context, now time.Time) ([]string, error)
+}
+
+type postgresInventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresInventoryRepository(db *gorm.DB) (InventoryRepository, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlDB.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Stock{}, &models.Reservation{}, &models.ReservationItem{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresInventoryRepository{db}, nil
+}
+
+func (repository *postgresInventoryRepository) Close() {
+	sqlDB, err := repository.db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+		if err != nil {
+			log.Println("Error closing inventory repository")
+			log.Println(err)
+		}
+	}
+}
+
+// SetStock sets the quantity on hand of a product or variant, which starts
+// tracking its stock.
+func (repository *postgresInventoryRepository) SetStock(ctx context.Context, productID, sku string, onHand int) (*models.Stock, error) {
+	stock := &models.Stock{}
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Stock{ProductID: productID, SKU: sku}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(stock, "product_id = ? AND sku = ?", productID, sku).Error
+		if err != nil {
+			return err
+		}
+		if onHand < stock.Reserved {
+			return ErrStockBelowReserved
+		}
+		stock.OnHand = onHand
+		return saveStock(tx, stock)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// GetStock returns the stock of the tracked products among productIDs and of
+// their variants.
+func (repository *postgresInventoryRepository) GetStock(ctx context.Context, productIDs []string) ([]*models.Stock, error) {
+	var stock []*models.Stock
+	err := repository.db.WithContext(ctx).
+		Where("product_id IN ?", productIDs).
+		Find(&stock).Error
+	return stock, err
+}
+
+// DeleteStock stops tracking the stock of a product and its variants.
+func (repository *postgresInventoryRepository) DeleteStock(ctx context.Context, productID string) error {
+	return repository.db.WithContext(ctx).
+		Where("product_id = ?", productID).
+		Delete(&models.Stock{}).Error
+}
+
+func (repository *postgresInventoryRepository) DeleteVariantStock(ctx context.Context, productID string, skus []string) error {
+	if len(skus) == 0 {
+		return nil
+	}
+	return repository.db.WithContext(ctx).
+		Where("product_id = ? AND sku IN ?", productID, skus).
+		Delete(&models.Stock{}).Error
+}
+
+// ReserveStock saves the reservation and holds its quantities, or holds nothing
+// when one of the tracked products does not have enough stock available.
+func (repository *postgresInventoryRepository) ReserveStock(ctx context.Context, reservation *models.Reservation) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stock, err := lockStock(tx, reservation.Items)
+		if err != nil {
+			return err
+		}
+		for i, item := range reservation.Items {
+			productStock, ok := stock[stockKey{item.ProductID, item.SKU}]
+			if !ok {
+				continue
+			}
+			reservation.Items[i].Held = true
+			if productStock.Available() < item.Quantity {
+				if item.SKU != "" {
+					return fmt.Errorf("%w for variant %s of product %s: %d available", ErrInsufficientStock, item.SKU, item.ProductID, productStock.Available())
+				}
+				return fmt.Errorf("%w for product %s: %d available", ErrInsufficientStock, item.ProductID, productStock.Available())
+			}
+			productStock.Reserved += item.Quantity
+		}
+		for _, productStock := range stock {
+			if err = saveStock(tx, productStock); err != nil {
+				return err
+			}
+		}
+		return tx.Create(reservation).Error
+	})
+}
+
+// CommitReservation takes the reserved quantities out of stock. Committing a
+// reservation again has no effect.
+func (repository *postgresInventoryRepository) CommitReservation(ctx context.Context, id string) error {
+	return repository.settleReservation(ctx, id, models.ReservationPending, models.ReservationCommitted)
+}
+
+// ReleaseReservation returns the reserved quantities to the available stock.
+// Releasing a reservation again has no effect.
+func (repository *postgresInventoryRepository) ReleaseReservation(ctx context.Context, id string) error {
+	return repository.settleReservation(ctx, id, models.ReservationPending, models.ReservationReleased)
+}
+
+// RestockReservation puts the quantities taken out of stock by a committed
+// reservation back on hand. Restocking a reservation again has no effect.
+func (repository *postgresInventoryRepository) RestockReservation(ctx context.Context, id string) error {
+	return repository.settleReservation(ctx, id, models.ReservationCommitted, models.ReservationRestocked)
+}
+
+// ListExpiredReservations returns the IDs of the pending reservations that
+// expired before now.
+func (repository *postgresInventoryRepository) ListExpiredReservations(ctx context.Context, now time.Time) ([]string, error) {
+	var ids []string
+	err := repository.db.WithContext(ctx).
+		Model(&models.Reservation{}).
+		Where("status = ? AND expires_at < ?", models.ReservationPending, now).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// settleReservation moves a reservation from the status from to status and
+// updates the stock it holds or took accordingly.
+func (repository *postgresInventoryRepository) settleReservation(ctx context.Context, id string, from, status models.ReservationStatus) error {
+	return repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		reservation := &models.Reservation{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items").
+			First(reservation, "id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if reservation.Status == status {
+			return nil
+		}
+		if reservation.Status != from {
+			return reservationStatusError(reservation.Status)
+		}
+
+		stock, err := lockStock(tx, reservation.Items)
+		if err != nil {
+			return err
+		}
+		for _, item := range reservation.Items {
+			productStock, ok := stock[stockKey{item.ProductID, item.SKU}]
+			if !ok || !item.Held {
+				continue
+			}
+			switch status {
+			case models.ReservationCommitted:
+				productStock.Reserved -= item.Quantity
+				productStock.OnHand -= item.Quantity
+			case models.ReservationReleased:
+				productStock.Reserved -= item.Quantity
+			case models.ReservationRestocked:
+				productStock.OnHand += item.Quantity
+			}
+		}
+		for _, productStock := range stock {
+			if err = saveStock(tx, productStock); err != nil {
+				return err
+			}
+		}
+		return tx.Model(reservation).Update("status", status).Error
+	})
+}
+
+// reservationStatusError tells why a reservation with the status cannot be settled.
+func reservationStatusError(status models.ReservationStatus) error {
+	switch status {
+	case models.ReservationCommitted:
+		return ErrReservationCommitted
+	case models.ReservationReleased:
+		return ErrReservationReleased
+	case models.ReservationRestocked:
+		return ErrReservationRestocked
+	default:
+		return ErrReservationPending
+	}
+}
+
+// saveStock writes the quantities of a locked stock row. Save would insert the
+// stock of a product without variants, as its empty SKU is a zero primary key.
+func saveStock(tx *gorm.DB, stock *models.Stock) error {
+	stock.UpdatedAt = time.Now().UTC()
+	return tx.Model(&models.Stock{}).
+		Where("product_id = ? AND sku = ?", stock.ProductID, stock.SKU).
+		Updates(map[string]interface{}{
+			"on_hand":    stock.OnHand,
+			"reserved":   stock.Reserved,
+			"updated_at": stock.UpdatedAt,
+		}).Error
+}
+
+// stockKey identifies the stock of a product, or of a variant when sku is set.
+type stockKey struct {
+	productID string
+	sku       string
+}
+
+// lockStock locks the stock rows of the tracked products and variants among
+// items. Rows are locked in key order so concurrent reservations cannot deadlock.
+func lockStock(tx *gorm.DB, items []models.ReservationItem) (map[stockKey]*models.Stock, error) {
+	keys := make([][]interface{}, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, []interface{}{item.ProductID, item.SKU})
+	}
+
+	var rows []*models.Stock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("(product_id, sku) IN ?", keys).
+		Order("product_id, sku").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	stock := make(map[stockKey]*models.Stock, len(rows))
+	for _, row := range rows {
+		stock[stockKey{row.ProductID, row.SKU}] = row
+	}
+	return stock, nil
+}
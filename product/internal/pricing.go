@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("price schedule not found")
+	// ErrScheduleChanged is returned when a schedule was applied or canceled
+	// since it was read
+	ErrScheduleChanged = errors.New("price schedule was changed")
+)
+
+// PriceRepository keeps the price history of products and their scheduled
+// price changes. It shares the inventory database, which owns the connection.
+type PriceRepository interface {
+	AddPriceChanges(ctx context.Context, changes ...*models.PriceChange) error
+	ListPriceChanges(ctx context.Context, productID string, skip, take uint64) ([]*models.PriceChange, error)
+	CreatePriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error
+	GetPriceSchedule(ctx context.Context, id uint64) (*models.PriceSchedule, error)
+	ListPriceSchedules(ctx context.Context, productID string) ([]*models.PriceSchedule, error)
+	HasOverlappingSale(ctx context.Context, productID string, startsAt, endsAt time.Time) (bool, error)
+	ListDuePriceSchedules(ctx context.Context, now time.Time) ([]*models.PriceSchedule, error)
+	SetPriceScheduleStatus(ctx context.Context, schedule *models.PriceSchedule, from models.PriceScheduleStatus) error
+}
+
+type postgresPriceRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresPriceRepository(db *gorm.DB) (PriceRepository, error) {
+	err := db.AutoMigrate(&models.PriceChange{}, &models.PriceSchedule{})
+	if err != nil {
+		return nil, err
+	}
+	return &postgresPriceRepository{db}, nil
+}
+
+func (repository *postgresPriceRepository) AddPriceChanges(ctx context.Context, changes ...*models.PriceChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return repository.db.WithContext(ctx).Create(changes).Error
+}
+
+// ListPriceChanges returns the price changes of a product, newest first.
+func (repository *postgresPriceRepository) ListPriceChanges(ctx context.Context, productID string, skip, take uint64) ([]*models.PriceChange, error) {
+	var changes []*models.PriceChange
+	err := repository.db.WithContext(ctx).
+		Where("product_id = ?", productID).
+		Order("changed_at DESC, id DESC").
+		Offset(int(skip)).
+		Limit(int(take)).
+		Find(&changes).Error
+	return changes, err
+}
+
+func (repository *postgresPriceRepository) CreatePriceSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	return repository.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (repository *postgresPriceRepository) GetPriceSchedule(ctx context.Context, id uint64) (*models.PriceSchedule, error) {
+	schedule := &models.PriceSchedule{}
+	err := repository.db.WithContext(ctx).First(schedule, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// ListPriceSchedules returns the schedules of a product, the latest starting first.
+func (repository *postgresPriceRepository) ListPriceSchedules(ctx context.Context, productID string) ([]*models.PriceSchedule, error) {
+	var schedules []*models.PriceSchedule
+	err := repository.db.WithContext(ctx).
+		Where("product_id = ?", productID).
+		Order("starts_at DESC, id DESC").
+		Find(&schedules).Error
+	return schedules, err
+}
+
+// HasOverlappingSale reports whether a sale of the product that is scheduled or
+// running overlaps the time from startsAt to endsAt.
+func (repository *postgresPriceRepository) HasOverlappingSale(ctx context.Context, productID string, startsAt, endsAt time.Time) (bool, error) {
+	var count int64
+	err := repository.db.WithContext(ctx).
+		Model(&models.PriceSchedule{}).
+		Where("product_id = ? AND status IN ? AND ends_at IS NOT NULL", productID,
+			[]models.PriceScheduleStatus{models.ScheduleScheduled, models.ScheduleActive}).
+		Where("starts_at < ? AND ends_at > ?", endsAt, startsAt).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListDuePriceSchedules returns the schedules to start and the sales to end at
+// now, in the order they are due.
+func (repository *postgresPriceRepository) ListDuePriceSchedules(ctx context.Context, now time.Time) ([]*models.PriceSchedule, error) {
+	var schedules []*models.PriceSchedule
+	err := repository.db.WithContext(ctx).
+		Where("(status = ? AND starts_at <= ?) OR (status = ? AND ends_at <= ?)",
+			models.ScheduleScheduled, now, models.ScheduleActive, now).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "CASE WHEN status = ? THEN ends_at ELSE starts_at END, id",
+			Vars: []interface{}{models.ScheduleActive},
+		}}).
+		Find(&schedules).Error
+	return schedules, err
+}
+
+// SetPriceScheduleStatus saves the status and regular price of a schedule if
+// its status is still from, which keeps replicas from applying it twice.
+func (repository *postgresPriceRepository) SetPriceScheduleStatus(ctx context.Context, schedule *models.PriceSchedule, from models.PriceScheduleStatus) error {
+	res := repository.db.WithContext(ctx).
+		Model(&models.PriceSchedule{}).
+		Where("id = ? AND status = ?", schedule.ID, from).
+		Updates(map[string]interface{}{
+			"status":        schedule.Status,
+			"regular_price": schedule.RegularPrice,
+			"updated_at":    time.Now().UTC(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrScheduleChanged
+	}
+	return nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"unicode/utf16"
 
 	"gopkg.in/olivere/elastic.v5"
 
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
 	"github.com/rasadov/EcommerceAPI/product/models"
 )
 
@@ -19,25 +23,58 @@ type Repository interface {
 	Close()
 	PutProduct(ctx context.Context, p *models.Product) error
 	GetProductById(ctx context.Context, id string) (*models.Product, error)
-	ListProducts(ctx context.Context, skip, take uint64) ([]*models.Product, error)
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error)
-	SearchProducts(ctx context.Context, query string, skip, take uint64) ([]*models.Product, error)
+	SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error)
+	SuggestProducts(ctx context.Context, text string, size int) (*models.Suggestions, error)
+	ListProductsByAccount(ctx context.Context, accountID, viewerID int, skip, take uint64) ([]*models.Product, error)
+	ScrollProductsByAccount(ctx context.Context, accountID int, fn func(*models.Product) error) error
+	BulkPutProducts(ctx context.Context, products []*models.Product, categoryPaths map[string]string) ([]error, error)
 	UpdateProduct(ctx context.Context, updatedProduct *models.Product) error
-	DeleteProduct(ctx context.Context, productId string) error
+	SetProductPrice(ctx context.Context, productId string, price float64) error
+	SetProductStatus(ctx context.Context, productId string, status models.ProductStatus) error
+	SetProductCategories(ctx context.Context, productId string, categoryIDs, categoryPaths []string) error
+	SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant) error
+	SetProductImages(ctx context.Context, productId string, images []models.ProductImage) error
+	SetProductRating(ctx context.Context, productId string, rating models.Rating) error
+	ListProductsInCategories(ctx context.Context, categoryIDs []string) ([]*models.Product, error)
+	SaveCategories(ctx context.Context, categories ...*models.Category) error
+	GetCategory(ctx context.Context, id string) (*models.Category, error)
+	ListCategories(ctx context.Context, parentID string) ([]*models.Category, error)
+	ListCategoriesWithIDs(ctx context.Context, ids []string) ([]*models.Category, error)
+	ListCategorySubtree(ctx context.Context, id string) ([]*models.Category, error)
+	DeleteCategory(ctx context.Context, id string) error
 }
 
+const (
+	// maxCategories is the most categories a listing returns, Elasticsearch's
+	// default result window
+	maxCategories = 10000
+	// scrollSize is how many products are fetched per scroll request
+	scrollSize = 500
+	// maxCategoryFacets is the most categories counted in a search
+	maxCategoryFacets = 50
+)
+
+// priceFacetBounds split the price facet of a search into buckets.
+var priceFacetBounds = []float64{10, 25, 50, 100, 250, 500, 1000}
+
 type elasticRepository struct {
-	client *elastic.Client
+	client *esClient
 }
 
+// NewElasticRepository connects to Elasticsearch or OpenSearch and creates the
+// indices that are missing.
 func NewElasticRepository(url string) (Repository, error) {
-	client, err := elastic.NewClient(
-		elastic.SetURL(url),
-		elastic.SetSniff(false),
-	)
+	client, err := newESClient(url)
 	if err != nil {
 		return nil, err
 	}
+	for _, def := range []indexDefinition{catalogIndex, categoriesIndex} {
+		if err = client.ensureIndex(context.Background(), def); err != nil {
+			client.Stop()
+			return nil, err
+		}
+	}
 	return &elasticRepository{client}, nil
 }
 
@@ -46,148 +83,601 @@ func (r *elasticRepository) Close() {
 }
 
 func (r *elasticRepository) PutProduct(ctx context.Context, p *models.Product) error {
-	res, err := r.client.Index().
-		Index("catalog").
-		Type("product").
-		BodyJson(models.ProductDocument{
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		}).
-		Do(ctx)
+	id, err := newProductID()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.indexDoc(ctx, catalogIndex.alias, catalogIndex.docType, id, models.ProductDocument{
+		ProductID:   id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		AccountID:   p.AccountID,
+		CreatedAt:   &p.CreatedAt,
+		Status:      p.Status,
+	}, false)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	p.ID = res.Id
+	p.ID = id
 	return nil
 }
 
 func (r *elasticRepository) GetProductById(ctx context.Context, id string) (*models.Product, error) {
-	res, _ := r.client.Get().
-		Index("catalog").
-		Type("product").
-		Id(id).
-		Do(ctx)
-	if !res.Found {
-		return nil, ErrNotFound
-	}
 	product := models.ProductDocument{}
-	if err := json.Unmarshal(*res.Source, &product); err != nil {
+	err := r.client.getDoc(ctx, catalogIndex.alias, catalogIndex.docType, id, &product)
+	if err == ErrNotFound {
 		return nil, err
 	}
-	return &models.Product{
-		ID:          id,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-	}, nil
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return productFromDocument(id, product), nil
 }
 
-func (r *elasticRepository) ListProducts(ctx context.Context, skip, take uint64) ([]*models.Product, error) {
-	res, err := r.client.Search().
-		Index("catalog").
-		Type("product").
-		Query(elastic.MatchAllQuery{}).
-		From(int(skip)).
-		Size(int(take)).
-		Do(ctx)
+func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error) {
+	hits, err := r.client.multiGet(ctx, catalogIndex.alias, catalogIndex.docType, ids)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	var products []*models.Product
-	for _, hit := range res.Hits.Hits {
+	return productsFromHits(hits)
+}
+
+// SearchProducts returns a page of the products matching the search, with the
+// price and category facets of all matches. Each facet ignores its own filter,
+// so it keeps counting the alternatives to the current selection. A page after
+// a cursor is found with search_after, which reaches past the result window
+// and is not shifted by products added to or removed from earlier pages.
+func (r *elasticRepository) SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error) {
+	query := elastic.NewBoolQuery()
+	if search.Query != "" {
+		query = query.Must(elastic.NewMultiMatchQuery(search.Query, "name", "description"))
+	}
+	if search.AccountID != 0 {
+		query = query.Filter(elastic.NewTermQuery("account_id", search.AccountID))
+	}
+	query = query.Filter(visibleProducts(search.ViewerID))
+
+	// Price and category filters are applied after the aggregations
+	var priceFilter, categoryFilterQuery elastic.Query = elastic.NewMatchAllQuery(), elastic.NewMatchAllQuery()
+	if search.MinPrice != nil || search.MaxPrice != nil {
+		priceRange := elastic.NewRangeQuery("price")
+		if search.MinPrice != nil {
+			priceRange = priceRange.Gte(*search.MinPrice)
+		}
+		if search.MaxPrice != nil {
+			priceRange = priceRange.Lte(*search.MaxPrice)
+		}
+		priceFilter = priceRange
+	}
+	if search.CategoryPath != "" {
+		categoryFilterQuery = categoryFilter(search.CategoryPath)
+	}
+
+	prices := elastic.NewRangeAggregation().Field("price").AddUnboundedFrom(priceFacetBounds[0])
+	for i := 1; i < len(priceFacetBounds); i++ {
+		prices = prices.AddRange(priceFacetBounds[i-1], priceFacetBounds[i])
+	}
+	prices = prices.AddUnboundedTo(priceFacetBounds[len(priceFacetBounds)-1])
+
+	source := elastic.NewSearchSource().
+		Query(query).
+		PostFilter(elastic.NewBoolQuery().Filter(priceFilter, categoryFilterQuery)).
+		Aggregation("price_facet", elastic.NewFilterAggregation().
+			Filter(categoryFilterQuery).
+			SubAggregation("prices", prices)).
+		Aggregation("category_facet", elastic.NewFilterAggregation().
+			Filter(priceFilter).
+			SubAggregation("categories", elastic.NewTermsAggregation().
+				Field("category_ids").
+				Size(maxCategoryFacets))).
+		SortBy(productSorts(search.Sort, false)...).
+		// One more product tells whether another page follows
+		Size(int(search.Take) + 1)
+	var after []interface{}
+	if search.After != "" {
+		var err error
+		if after, err = decodeCursor(search.Sort, search.After); err != nil {
+			return nil, err
+		}
+		source = source.SearchAfter(after...)
+	} else {
+		source = source.From(int(search.Skip))
+	}
+	res, err := r.client.search(ctx, catalogIndex.alias, source, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	hasPrevious := search.Skip > 0 && res.Total > 0
+	if after != nil {
+		// The products before the cursor are the first ones in the reversed order
+		before := elastic.NewSearchSource().
+			// Scored like the search, so the cursor's score compares
+			Query(elastic.NewBoolQuery().Must(query).Filter(priceFilter, categoryFilterQuery)).
+			SortBy(productSorts(search.Sort, true)...).
+			SearchAfter(after...).
+			FetchSource(false).
+			Size(1)
+		previous, err := r.client.search(ctx, catalogIndex.alias, before, nil)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		hasPrevious = len(previous.Hits) > 0
+	}
+
+	hits := res.Hits
+	if len(hits) > int(search.Take) {
+		hits = hits[:search.Take]
+	}
+	products, err := productsFromHits(hits)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SearchResult{
+		Products:    products,
+		Cursors:     make([]string, 0, len(hits)),
+		HasMore:     len(res.Hits) > len(hits),
+		HasPrevious: hasPrevious,
+		Total:       res.Total,
+	}
+	for _, hit := range hits {
+		c, err := encodeCursor(search.Sort, hit.Sort)
+		if err != nil {
+			return nil, err
+		}
+		result.Cursors = append(result.Cursors, c)
+	}
+	if facet, ok := res.Aggregations.Filter("price_facet"); ok {
+		if buckets, ok := facet.Range("prices"); ok {
+			for _, bucket := range buckets.Buckets {
+				if bucket.DocCount == 0 {
+					continue
+				}
+				result.PriceBuckets = append(result.PriceBuckets, models.PriceBucket{
+					From:  bucket.From,
+					To:    bucket.To,
+					Count: bucket.DocCount,
+				})
+			}
+		}
+	}
+	if facet, ok := res.Aggregations.Filter("category_facet"); ok {
+		if buckets, ok := facet.Terms("categories"); ok {
+			for _, bucket := range buckets.Buckets {
+				id, _ := bucket.Key.(string)
+				result.Categories = append(result.Categories, models.CategoryCount{
+					CategoryID: id,
+					Count:      bucket.DocCount,
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+// SuggestProducts returns the products whose name has words starting with the
+// words of text, for type-ahead. When none does, the misspelled words of text
+// are corrected with the most similar words of the product names.
+func (r *elasticRepository) SuggestProducts(ctx context.Context, text string, size int) (*models.Suggestions, error) {
+	source := elastic.NewSearchSource().
+		Query(elastic.NewBoolQuery().
+			Must(elastic.NewMatchQuery("name.autocomplete", text).Operator("and")).
+			Filter(visibleProducts(0))).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("name")).
+		Suggester(elastic.NewTermSuggester("did_you_mean").
+			Text(text).
+			Field("name.words").
+			SuggestMode("missing").
+			Size(1)).
+		Size(size)
+	res, err := r.client.search(ctx, catalogIndex.alias, source, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	suggestions := &models.Suggestions{}
+	for _, hit := range res.Hits {
 		product := models.ProductDocument{}
-		if err = json.Unmarshal(*hit.Source, &product); err == nil {
-			products = append(products, &models.Product{
-				ID:          hit.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-			})
+		if err = json.Unmarshal(hit.Source, &product); err != nil {
+			return nil, err
 		}
+		suggestions.Products = append(suggestions.Products, models.ProductSuggestion{
+			ProductID: hit.ID,
+			Name:      product.Name,
+		})
 	}
-	return products, err
+	if len(suggestions.Products) == 0 {
+		suggestions.DidYouMean = correctedText(text, res.Suggest["did_you_mean"])
+	}
+	return suggestions, nil
 }
 
-func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error) {
-	var items []*elastic.MultiGetItem
-	for _, id := range ids {
-		items = append(items, elastic.NewMultiGetItem().
-			Index("catalog").
-			Type("product").
-			Id(id))
+// correctedText replaces the words of text that have a suggestion, and returns
+// an empty string when none has. Suggestions locate words in UTF-16 code units.
+func correctedText(text string, words []elastic.SearchSuggestion) string {
+	units := utf16.Encode([]rune(text))
+	var corrected []uint16
+	end := 0
+	for _, word := range words {
+		if len(word.Options) == 0 || word.Offset < end || word.Offset+word.Length > len(units) {
+			continue
+		}
+		corrected = append(corrected, units[end:word.Offset]...)
+		corrected = append(corrected, utf16.Encode([]rune(word.Options[0].Text))...)
+		end = word.Offset + word.Length
 	}
-	res, err := r.client.MultiGet().
-		Add(items...).
-		Do(ctx)
+	if corrected == nil {
+		return ""
+	}
+	corrected = append(corrected, units[end:]...)
+	return string(utf16.Decode(corrected))
+}
+
+// ListProductsByAccount returns the catalog of a seller, with its drafts when
+// the seller is the viewer.
+func (r *elasticRepository) ListProductsByAccount(ctx context.Context, accountID, viewerID int, skip, take uint64) ([]*models.Product, error) {
+	source := elastic.NewSearchSource().
+		Query(elastic.NewBoolQuery().Filter(
+			elastic.NewTermQuery("account_id", accountID),
+			visibleProducts(viewerID),
+		)).
+		From(int(skip)).
+		Size(int(take))
+	res, err := r.client.search(ctx, catalogIndex.alias, source, nil)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	return productsFromHits(res.Hits)
+}
+
+func (r *elasticRepository) UpdateProduct(ctx context.Context, updatedProduct *models.Product) error {
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, updatedProduct.ID, models.ProductDocument{
+		Name:        updatedProduct.Name,
+		Description: updatedProduct.Description,
+		Price:       updatedProduct.Price,
+		AccountID:   updatedProduct.AccountID,
+	})
+}
+
+// SetProductPrice changes only the price of a product.
+func (r *elasticRepository) SetProductPrice(ctx context.Context, productId string, price float64) error {
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"price": price,
+	})
+}
+
+func (r *elasticRepository) SetProductStatus(ctx context.Context, productId string, status models.ProductStatus) error {
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"status": status,
+	})
+}
+
+// SetProductCategories replaces the categories of a product.
+func (r *elasticRepository) SetProductCategories(ctx context.Context, productId string, categoryIDs, categoryPaths []string) error {
+	// Empty lists have to be sent as [] to clear the fields
+	if categoryIDs == nil {
+		categoryIDs = []string{}
+	}
+	if categoryPaths == nil {
+		categoryPaths = []string{}
+	}
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"category_ids":   categoryIDs,
+		"category_paths": categoryPaths,
+	})
+}
+
+// SetProductVariants replaces the options and variants of a product.
+func (r *elasticRepository) SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant) error {
+	// Empty lists have to be sent as [] to clear the fields
+	if options == nil {
+		options = []models.ProductOption{}
+	}
+	if variants == nil {
+		variants = []models.Variant{}
+	}
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"options":  options,
+		"variants": variants,
+	})
+}
+
+// SetProductImages replaces the images of a product.
+func (r *elasticRepository) SetProductImages(ctx context.Context, productId string, images []models.ProductImage) error {
+	// An empty list has to be sent as [] to clear the field
+	if images == nil {
+		images = []models.ProductImage{}
+	}
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"images": images,
+	})
+}
+
+// SetProductRating replaces the rating of a product.
+func (r *elasticRepository) SetProductRating(ctx context.Context, productId string, rating models.Rating) error {
+	return r.client.updateDoc(ctx, catalogIndex.alias, catalogIndex.docType, productId, map[string]interface{}{
+		"rating": rating,
+	})
+}
 
+// ListProductsInCategories returns every product assigned to one of the categories.
+func (r *elasticRepository) ListProductsInCategories(ctx context.Context, categoryIDs []string) ([]*models.Product, error) {
+	values := make([]interface{}, 0, len(categoryIDs))
+	for _, id := range categoryIDs {
+		values = append(values, id)
+	}
 	var products []*models.Product
-	for _, doc := range res.Docs {
+	err := r.scrollProducts(ctx, elastic.NewTermsQuery("category_ids", values...), func(product *models.Product) error {
+		products = append(products, product)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ScrollProductsByAccount calls fn with every product of a seller that is not
+// archived, stopping at the first error.
+func (r *elasticRepository) ScrollProductsByAccount(ctx context.Context, accountID int, fn func(*models.Product) error) error {
+	return r.scrollProducts(ctx, elastic.NewBoolQuery().
+		Filter(elastic.NewTermQuery("account_id", accountID)).
+		MustNot(elastic.NewTermQuery("status", models.StatusArchived)), fn)
+}
+
+func (r *elasticRepository) scrollProducts(ctx context.Context, query elastic.Query, fn func(*models.Product) error) error {
+	err := r.client.scroll(ctx, catalogIndex.alias, query, scrollSize, func(hit esHit) error {
 		product := models.ProductDocument{}
-		if err = json.Unmarshal(*doc.Source, &product); err == nil {
-			products = append(products, &models.Product{
-				ID:          doc.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
+		if err := json.Unmarshal(hit.Source, &product); err != nil {
+			return err
+		}
+		return fn(productFromDocument(hit.ID, product))
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// newProductID generates the ID of a new product, which is also indexed in the
+// product_id field.
+func newProductID() (string, error) {
+	// As long as the IDs Elasticsearch generates
+	return crypt.RandomToken(15)
+}
+
+// BulkPutProducts indexes the products without an ID, setting their ID, and
+// updates the others, in one request. Categories are looked up in categoryPaths
+// by ID. It returns the error of each product, nil for those that were saved.
+func (r *elasticRepository) BulkPutProducts(ctx context.Context, products []*models.Product, categoryPaths map[string]string) ([]error, error) {
+	if len(products) == 0 {
+		return nil, nil
+	}
+	actions := make([]esBulkAction, 0, len(products))
+	for _, p := range products {
+		paths := make([]string, 0, len(p.CategoryIDs))
+		for _, id := range p.CategoryIDs {
+			paths = append(paths, categoryPaths[id])
+		}
+		if p.ID == "" {
+			id, err := newProductID()
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, esBulkAction{
+				ID: id,
+				Doc: models.ProductDocument{
+					ProductID:     id,
+					Name:          p.Name,
+					Description:   p.Description,
+					Price:         p.Price,
+					AccountID:     p.AccountID,
+					CategoryIDs:   p.CategoryIDs,
+					CategoryPaths: paths,
+					CreatedAt:     &p.CreatedAt,
+					Status:        p.Status,
+				},
 			})
+			continue
+		}
+		categoryIDs := p.CategoryIDs
+		if categoryIDs == nil {
+			categoryIDs = []string{}
+		}
+		actions = append(actions, esBulkAction{
+			ID:     p.ID,
+			Update: true,
+			Doc: map[string]interface{}{
+				"name":           p.Name,
+				"description":    p.Description,
+				"price":          p.Price,
+				"category_ids":   categoryIDs,
+				"category_paths": paths,
+			},
+		})
+	}
+	items, err := r.client.bulk(ctx, catalogIndex.alias, catalogIndex.docType, actions, false)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	errs := make([]error, len(products))
+	for i, item := range items {
+		switch {
+		case item.Status == http.StatusNotFound:
+			errs[i] = ErrNotFound
+		case item.Error != "":
+			errs[i] = errors.New(item.Error)
+		case products[i].ID == "":
+			products[i].ID = item.ID
 		}
 	}
-	return products, err
+	return errs, nil
 }
 
-func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip, take uint64) ([]*models.Product, error) {
-	res, err := r.client.Search().
-		Index("catalog").
-		Type("product").
-		Query(elastic.NewMultiMatchQuery(query, "name", "description")).
-		From(int(skip)).
-		Size(int(take)).
-		Do(ctx)
+// SaveCategories indexes the categories under their IDs. The index is refreshed
+// before returning, so the tree is consistent for the next change.
+func (r *elasticRepository) SaveCategories(ctx context.Context, categories ...*models.Category) error {
+	actions := make([]esBulkAction, 0, len(categories))
+	for _, category := range categories {
+		actions = append(actions, esBulkAction{
+			ID: category.ID,
+			Doc: models.CategoryDocument{
+				Name:     category.Name,
+				ParentID: category.ParentID,
+				Path:     category.Path,
+			},
+		})
+	}
+	items, err := r.client.bulk(ctx, categoriesIndex.alias, categoriesIndex.docType, actions, true)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, item := range items {
+		if item.Error != "" {
+			return fmt.Errorf("failed to save category %s: %s", item.ID, item.Error)
+		}
+	}
+	return nil
+}
+
+func (r *elasticRepository) GetCategory(ctx context.Context, id string) (*models.Category, error) {
+	category := models.CategoryDocument{}
+	err := r.client.getDoc(ctx, categoriesIndex.alias, categoriesIndex.docType, id, &category)
+	if err == ErrNotFound {
+		return nil, err
+	}
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	return categoryFromDocument(id, category), nil
+}
+
+// ListCategories returns the children of a category sorted by name, or the root
+// categories when parentID is empty.
+func (r *elasticRepository) ListCategories(ctx context.Context, parentID string) ([]*models.Category, error) {
+	return r.searchCategories(ctx, elastic.NewTermQuery("parent_id", parentID))
+}
+
+func (r *elasticRepository) ListCategoriesWithIDs(ctx context.Context, ids []string) ([]*models.Category, error) {
+	hits, err := r.client.multiGet(ctx, categoriesIndex.alias, categoriesIndex.docType, ids)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoriesFromHits(hits)
+}
+
+// ListCategorySubtree returns a category and all of its descendants.
+func (r *elasticRepository) ListCategorySubtree(ctx context.Context, id string) ([]*models.Category, error) {
+	return r.searchCategories(ctx, elastic.NewTermQuery("path", id))
+}
+
+func (r *elasticRepository) DeleteCategory(ctx context.Context, id string) error {
+	return r.client.deleteDoc(ctx, categoriesIndex.alias, categoriesIndex.docType, id, true)
+}
+
+func (r *elasticRepository) searchCategories(ctx context.Context, query elastic.Query) ([]*models.Category, error) {
+	source := elastic.NewSearchSource().
+		Query(query).
+		Sort("name", true).
+		Size(maxCategories)
+	res, err := r.client.search(ctx, categoriesIndex.alias, source, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return categoriesFromHits(res.Hits)
+}
+
+// categoryFilter matches the products in the category at path or in one of its
+// subcategories.
+func categoryFilter(path string) elastic.Query {
+	return elastic.NewBoolQuery().
+		Should(
+			elastic.NewTermQuery("category_paths", path),
+			elastic.NewPrefixQuery("category_paths", path+"/"),
+		).
+		MinimumNumberShouldMatch(1)
+}
+
+// visibleProducts matches the published products, and all products of the
+// viewer when set. Products without a status predate it and are published.
+func visibleProducts(viewerID int) elastic.Query {
+	published := elastic.NewBoolQuery().
+		MustNot(elastic.NewTermsQuery("status", models.StatusDraft, models.StatusArchived))
+	if viewerID == 0 {
+		return published
+	}
+	return elastic.NewBoolQuery().
+		Should(published, elastic.NewTermQuery("account_id", viewerID)).
+		MinimumNumberShouldMatch(1)
+}
+
+func productFromDocument(id string, document models.ProductDocument) *models.Product {
+	product := &models.Product{
+		ID:          id,
+		Name:        document.Name,
+		Description: document.Description,
+		Price:       document.Price,
+		AccountID:   document.AccountID,
+		CategoryIDs: document.CategoryIDs,
+		Options:     document.Options,
+		Variants:    document.Variants,
+		Images:      document.Images,
+		Status:      document.Status,
+	}
+	if product.Status == "" {
+		product.Status = models.StatusPublished
+	}
+	if document.Rating != nil {
+		product.Rating = *document.Rating
+	}
+	if document.CreatedAt != nil {
+		product.CreatedAt = *document.CreatedAt
+	}
+	return product
+}
+
+func productsFromHits(hits []esHit) ([]*models.Product, error) {
 	var products []*models.Product
-	for _, hit := range res.Hits.Hits {
+	for _, hit := range hits {
 		product := models.ProductDocument{}
-		if err = json.Unmarshal(*hit.Source, &product); err == nil {
-			products = append(products, &models.Product{
-				ID:          hit.Id,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-			})
+		if err := json.Unmarshal(hit.Source, &product); err != nil {
+			return nil, err
 		}
+		products = append(products, productFromDocument(hit.ID, product))
 	}
-	return products, err
+	return products, nil
 }
 
-func (r *elasticRepository) UpdateProduct(ctx context.Context, updatedProduct *models.Product) error {
-	_, err := r.client.Update().
-		Index("catalog").
-		Type("product").
-		Id(updatedProduct.ID).
-		Doc(models.ProductDocument{
-			Name:        updatedProduct.Name,
-			Description: updatedProduct.Description,
-			Price:       updatedProduct.Price,
-		}).
-		Do(ctx)
-	return err
+func categoriesFromHits(hits []esHit) ([]*models.Category, error) {
+	var categories []*models.Category
+	for _, hit := range hits {
+		category := models.CategoryDocument{}
+		if err := json.Unmarshal(hit.Source, &category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, categoryFromDocument(hit.ID, category))
+	}
+	return categories, nil
 }
 
-func (r *elasticRepository) DeleteProduct(ctx context.Context, productId string) error {
-	_, err := r.client.Delete().
-		Index("catalog").
-		Type("product").
-		Id(productId).
-		Do(ctx)
-	return err
+func categoryFromDocument(id string, document models.CategoryDocument) *models.Category {
+	return &models.Category{
+		ID:       id,
+		Name:     document.Name,
+		ParentID: document.ParentID,
+		Path:     document.Path,
+	}
 }
@@ -1,31 +1,107 @@
 package internal
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
 	"github.com/rasadov/EcommerceAPI/product/models"
 	"github.com/rasadov/EcommerceAPI/product/proto/pb"
 )
 
+// methodRoles lists the RPCs restricted to some roles, every other RPC is public.
+var methodRoles = middleware.MethodRoles{
+	pb.ProductService_PostProduct_FullMethodName:          {auth.RoleSeller},
+	pb.ProductService_UpdateProduct_FullMethodName:        {auth.RoleSeller},
+	pb.ProductService_DeleteProduct_FullMethodName:        {auth.RoleSeller},
+	pb.ProductService_SetProductStatus_FullMethodName:     {auth.RoleSeller},
+	pb.ProductService_ImportProducts_FullMethodName:       {auth.RoleSeller},
+	pb.ProductService_ExportProducts_FullMethodName:       {auth.RoleSeller},
+	pb.ProductService_SetProductCategories_FullMethodName: {auth.RoleSeller},
+	pb.ProductService_SetProductVariants_FullMethodName:   {auth.RoleSeller},
+	pb.ProductService_AddProductImage_FullMethodName:      {auth.RoleSeller},
+	pb.ProductService_RemoveProductImage_FullMethodName:   {auth.RoleSeller},
+	pb.ProductService_SetStock_FullMethodName:             {auth.RoleSeller},
+	pb.ProductService_SchedulePriceChange_FullMethodName:  {auth.RoleSeller},
+	pb.ProductService_CancelPriceSchedule_FullMethodName:  {auth.RoleSeller},
+	pb.ProductService_ListPriceSchedules_FullMethodName:   {auth.RoleSeller},
+	// The category tree is shared by all sellers
+	pb.ProductService_CreateCategory_FullMethodName: {auth.RoleAdmin},
+	pb.ProductService_RenameCategory_FullMethodName: {auth.RoleAdmin},
+	pb.ProductService_MoveCategory_FullMethodName:   {auth.RoleAdmin},
+	pb.ProductService_DeleteCategory_FullMethodName: {auth.RoleAdmin},
+}
+
+// internalMethods are called by the other services rather than by users. The
+// public listener refuses them, they are only served on the internal one.
+var internalMethods = map[string]bool{
+	// The review service keeps the rating of a product up to date
+	pb.ProductService_SetProductRating_FullMethodName: true,
+	// The order service holds stock while an order is paid for
+	pb.ProductService_ReserveStock_FullMethodName:       true,
+	pb.ProductService_CommitReservation_FullMethodName:  true,
+	pb.ProductService_ReleaseReservation_FullMethodName: true,
+	pb.ProductService_RestockReservation_FullMethodName: true,
+}
+
+var (
+	productStatusToProto = map[models.ProductStatus]pb.ProductStatus{
+		models.StatusPublished: pb.ProductStatus_PUBLISHED,
+		models.StatusDraft:     pb.ProductStatus_DRAFT,
+		models.StatusArchived:  pb.ProductStatus_ARCHIVED,
+	}
+	productStatusFromProto = map[pb.ProductStatus]models.ProductStatus{
+		pb.ProductStatus_PUBLISHED: models.StatusPublished,
+		pb.ProductStatus_DRAFT:     models.StatusDraft,
+		pb.ProductStatus_ARCHIVED:  models.StatusArchived,
+	}
+)
+
 type grpcServer struct {
 	pb.UnimplementedProductServiceServer
 	service Service
 }
 
-func ListenGRPC(s Service, port int) error {
+// ListenGRPC serves the public API on port and the whole API, including the
+// internal methods, on internalPort, which must not be reachable from outside.
+func ListenGRPC(s Service, keys auth.KeyProvider, port, internalPort int) error {
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- serveGRPC(s, keys, port, false)
+	}()
+	go func() {
+		errCh <- serveGRPC(s, keys, internalPort, true)
+	}()
+	return <-errCh
+}
+
+func serveGRPC(s Service, keys auth.KeyProvider, port int, internal bool) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	serv := grpc.NewServer()
+	unary := []grpc.UnaryServerInterceptor{middleware.UnaryServerAuthInterceptor(keys, methodRoles)}
+	if !internal {
+		unary = append([]grpc.UnaryServerInterceptor{refuseInternalMethods}, unary...)
+	}
+	serv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.StreamInterceptor(middleware.StreamServerAuthInterceptor(keys, methodRoles)),
+	)
 
 	pb.RegisterProductServiceServer(serv, &grpcServer{
 		UnimplementedProductServiceServer: pb.UnimplementedProductServiceServer{},
@@ -34,78 +110,692 @@ func ListenGRPC(s Service, port int) error {
 	return serv.Serve(lis)
 }
 
+// refuseInternalMethods keeps the internal methods off the public listener.
+func refuseInternalMethods(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if internalMethods[info.FullMethod] {
+		return nil, status.Error(codes.PermissionDenied, "method is only served on the internal listener")
+	}
+	return handler(ctx, req)
+}
+
 func (s *grpcServer) GetProduct(ctx context.Context, r *wrapperspb.StringValue) (*pb.ProductResponse, error) {
 	p, err := s.service.GetProduct(ctx, r.Value)
 	if err != nil {
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.ProductsResponse, error) {
 	var res []*models.Product
-	var err error
-	if r.Query != "" {
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
-	} else if len(r.Ids) != 0 {
+	if len(r.Ids) != 0 {
+		var err error
 		res, err = s.service.GetProductsWithIDs(ctx, r.Ids)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
+		result, err := s.service.SearchProducts(ctx, productSearchFromProto(ctx, r))
+		if err != nil {
+			return nil, serviceError(err)
+		}
+		res = result.Products
 	}
+	var products []*pb.Product
+	for _, p := range res {
+		products = append(products, productToProto(p))
+
+	}
+	return &pb.ProductsResponse{Products: products}, nil
+}
+
+// SearchProducts is GetProducts with the total number of matches and the facets.
+func (s *grpcServer) SearchProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.SearchProductsResponse, error) {
+	result, err := s.service.SearchProducts(ctx, productSearchFromProto(ctx, r))
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	res := &pb.SearchProductsResponse{
+		Total:       result.Total,
+		Cursors:     result.Cursors,
+		HasMore:     result.HasMore,
+		HasPrevious: result.HasPrevious,
+	}
+	for _, p := range result.Products {
+		res.Products = append(res.Products, productToProto(p))
+	}
+	for _, bucket := range result.PriceBuckets {
+		res.PriceBuckets = append(res.PriceBuckets, &pb.PriceBucket{
+			From:  bucket.From,
+			To:    bucket.To,
+			Count: bucket.Count,
+		})
+	}
+	for _, category := range result.Categories {
+		res.Categories = append(res.Categories, &pb.CategoryCount{
+			CategoryId: category.CategoryID,
+			Count:      category.Count,
+		})
+	}
+	return res, nil
+}
+
+// SuggestProducts completes a search being typed in a search box.
+func (s *grpcServer) SuggestProducts(ctx context.Context, r *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	suggestions, err := s.service.SuggestProducts(ctx, r.Prefix, int(r.Size))
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	res := &pb.SuggestProductsResponse{DidYouMean: suggestions.DidYouMean}
+	for _, suggestion := range suggestions.Products {
+		res.Products = append(res.Products, &pb.ProductSuggestion{
+			ProductId: suggestion.ProductID,
+			Name:      suggestion.Name,
+		})
+	}
+	return res, nil
+}
+
+func (s *grpcServer) ListProductsByAccount(ctx context.Context, r *pb.ListProductsByAccountRequest) (*pb.ProductsResponse, error) {
+	res, err := s.service.ListProductsByAccount(ctx, int(r.GetAccountId()), viewerID(ctx), r.Skip, r.Take)
 	if err != nil {
 		return nil, err
 	}
 	var products []*pb.Product
 	for _, p := range res {
-		products = append(products, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
-
+		products = append(products, productToProto(p))
 	}
 	return &pb.ProductsResponse{Products: products}, nil
 }
 
-func (s *grpcServer) PostProduct(ctx context.Context, r *pb.CreateProductRequest) (*pb.ProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.GetName(), r.GetDescription(), r.Price, int(r.GetAccountId()))
+// ImportProducts reads the chunks of an import file as they arrive, so the file
+// is never held in memory.
+func (s *grpcServer) ImportProducts(stream pb.ProductService_ImportProductsServer) error {
+	accountId, err := callerID(stream.Context())
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "import file is empty")
+	}
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		data := first.GetData()
+		for {
+			if _, err := writer.Write(data); err != nil {
+				return
+			}
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				writer.Close()
+				return
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			data = chunk.GetData()
+		}
+	}()
+	result, err := s.service.ImportProducts(stream.Context(), accountId, models.BulkFormat(first.GetFormat()), reader)
+	// Unblocks the goroutine when the import stopped before the end of the file
+	reader.Close()
+	if err != nil {
+		log.Println(err)
+		return serviceError(err)
+	}
+
+	res := &pb.ImportProductsResponse{
+		Created: int64(result.Created),
+		Updated: int64(result.Updated),
+		Failed:  int64(result.Failed),
+	}
+	for _, rowErr := range result.Errors {
+		res.Errors = append(res.Errors, &pb.RowError{Line: int64(rowErr.Line), Message: rowErr.Message})
+	}
+	return stream.SendAndClose(res)
+}
+
+// exportChunkSize is how many bytes of an export file are sent per message
+const exportChunkSize = 32 * 1024
+
+func (s *grpcServer) ExportProducts(r *pb.ExportProductsRequest, stream pb.ProductService_ExportProductsServer) error {
+	accountId, err := callerID(stream.Context())
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriterSize(chunkWriter{stream}, exportChunkSize)
+	err = s.service.ExportProducts(stream.Context(), accountId, models.BulkFormat(r.GetFormat()), writer)
+	if err == nil {
+		err = writer.Flush()
+	}
 	if err != nil {
 		log.Println(err)
+		return serviceError(err)
+	}
+	return nil
+}
+
+// chunkWriter sends what is written to it as chunks of an export.
+type chunkWriter struct {
+	stream pb.ProductService_ExportProductsServer
+}
+
+func (w chunkWriter) Write(data []byte) (int, error) {
+	if err := w.stream.Send(&pb.ExportProductsChunk{Data: data}); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// PostProduct creates a product owned by the caller.
+func (s *grpcServer) PostProduct(ctx context.Context, r *pb.CreateProductRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	p, err := s.service.PostProduct(ctx, r.GetName(), r.GetDescription(), r.Price, productStatusFromProto[r.GetStatus()], accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
+// UpdateProduct changes a product of the caller.
 func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.ProductResponse, error) {
-	p, err := s.service.UpdateProduct(ctx, r.GetId(), r.GetName(), r.GetDescription(), r.Price, int(r.GetAccountId()))
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.service.UpdateProduct(ctx, r.GetId(), r.GetName(), r.GetDescription(), r.Price, accountId)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return &pb.ProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
 }
 
+// DeleteProduct archives a product of the caller.
 func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductRequest) (*emptypb.Empty, error) {
-	err := s.service.DeleteProduct(ctx, r.GetProductId(), int(r.GetAccountId()))
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.service.DeleteProduct(ctx, r.GetProductId(), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// SetProductStatus drafts, publishes or archives a product of the caller.
+func (s *grpcServer) SetProductStatus(ctx context.Context, r *pb.SetProductStatusRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	productStatus, ok := productStatusFromProto[r.GetStatus()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidStatus.Error())
+	}
+	p, err := s.service.SetProductStatus(ctx, r.GetProductId(), productStatus, accountId)
 	if err != nil {
 		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) SetProductCategories(ctx context.Context, r *pb.SetProductCategoriesRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
 		return nil, err
 	}
+	p, err := s.service.SetProductCategories(ctx, r.GetProductId(), r.GetCategoryIds(), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) CreateCategory(ctx context.Context, r *pb.CreateCategoryRequest) (*pb.CategoryResponse, error) {
+	c, err := s.service.CreateCategory(ctx, r.GetName(), r.GetParentId())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return &pb.CategoryResponse{Category: categoryToProto(c)}, nil
+}
+
+func (s *grpcServer) RenameCategory(ctx context.Context, r *pb.RenameCategoryRequest) (*pb.CategoryResponse, error) {
+	c, err := s.service.RenameCategory(ctx, r.GetId(), r.GetName())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return &pb.CategoryResponse{Category: categoryToProto(c)}, nil
+}
+
+func (s *grpcServer) MoveCategory(ctx context.Context, r *pb.MoveCategoryRequest) (*pb.CategoryResponse, error) {
+	c, err := s.service.MoveCategory(ctx, r.GetId(), r.GetParentId())
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.CategoryResponse{Category: categoryToProto(c)}, nil
+}
+
+func (s *grpcServer) DeleteCategory(ctx context.Context, r *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := s.service.DeleteCategory(ctx, r.Value); err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
 	return &emptypb.Empty{}, nil
 }
+
+func (s *grpcServer) GetCategories(ctx context.Context, r *pb.GetCategoriesRequest) (*pb.CategoriesResponse, error) {
+	var res []*models.Category
+	var err error
+	if len(r.Ids) != 0 {
+		res, err = s.service.GetCategoriesWithIDs(ctx, r.Ids)
+	} else {
+		res, err = s.service.GetCategories(ctx, r.ParentId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]*pb.Category, 0, len(res))
+	for _, c := range res {
+		categories = append(categories, categoryToProto(c))
+	}
+	return &pb.CategoriesResponse{Categories: categories}, nil
+}
+
+func (s *grpcServer) SetProductVariants(ctx context.Context, r *pb.SetProductVariantsRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.service.SetProductVariants(ctx, r.GetProductId(), optionsFromProto(r.GetOptions()), variantsFromProto(r.GetVariants()), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) AddProductImage(ctx context.Context, r *pb.AddProductImageRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.service.AddProductImage(ctx, r.GetProductId(), imageFromProto(r.GetImage()), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) RemoveProductImage(ctx context.Context, r *pb.RemoveProductImageRequest) (*pb.ProductResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.service.RemoveProductImage(ctx, r.GetProductId(), r.GetImageId(), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) SetStock(ctx context.Context, r *pb.SetStockRequest) (*pb.StockResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := s.service.SetStock(ctx, r.GetProductId(), r.GetSku(), int(r.GetOnHand()), accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.StockResponse{Stock: stockToProto(stock)}, nil
+}
+
+func (s *grpcServer) GetStock(ctx context.Context, r *pb.GetStockRequest) (*pb.StocksResponse, error) {
+	res, err := s.service.GetStock(ctx, r.GetProductIds())
+	if err != nil {
+		return nil, err
+	}
+	stocks := make([]*pb.Stock, 0, len(res))
+	for _, stock := range res {
+		stocks = append(stocks, stockToProto(stock))
+	}
+	return &pb.StocksResponse{Stocks: stocks}, nil
+}
+
+// SetProductRating is called by the review service when the published reviews
+// of a product change.
+func (s *grpcServer) SetProductRating(ctx context.Context, r *pb.SetProductRatingRequest) (*emptypb.Empty, error) {
+	err := s.service.SetProductRating(ctx, r.ProductId, models.Rating{
+		Average: r.Average,
+		Count:   int(r.Count),
+	})
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) GetPriceHistory(ctx context.Context, r *pb.GetPriceHistoryRequest) (*pb.PriceHistoryResponse, error) {
+	changes, err := s.service.GetPriceHistory(ctx, r.GetProductId(), r.GetSkip(), r.GetTake())
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	res := &pb.PriceHistoryResponse{Changes: make([]*pb.PriceChange, 0, len(changes))}
+	for _, change := range changes {
+		res.Changes = append(res.Changes, priceChangeToProto(change))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) SchedulePriceChange(ctx context.Context, r *pb.SchedulePriceChangeRequest) (*pb.PriceScheduleResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var startsAt time.Time
+	var endsAt *time.Time
+	if err = startsAt.UnmarshalBinary(r.GetStartsAt()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidSchedule.Error())
+	}
+	if len(r.GetEndsAt()) > 0 {
+		endsAt = &time.Time{}
+		if err = endsAt.UnmarshalBinary(r.GetEndsAt()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, ErrInvalidSchedule.Error())
+		}
+	}
+	schedule, err := s.service.SchedulePriceChange(ctx, r.GetProductId(), r.GetPrice(), startsAt, endsAt, accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.PriceScheduleResponse{Schedule: priceScheduleToProto(schedule)}, nil
+}
+
+func (s *grpcServer) CancelPriceSchedule(ctx context.Context, r *wrapperspb.UInt64Value) (*pb.PriceScheduleResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.service.CancelPriceSchedule(ctx, r.Value, accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.PriceScheduleResponse{Schedule: priceScheduleToProto(schedule)}, nil
+}
+
+func (s *grpcServer) ListPriceSchedules(ctx context.Context, r *wrapperspb.StringValue) (*pb.PriceSchedulesResponse, error) {
+	accountId, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := s.service.ListPriceSchedules(ctx, r.Value, accountId)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	res := &pb.PriceSchedulesResponse{Schedules: make([]*pb.PriceSchedule, 0, len(schedules))}
+	for _, schedule := range schedules {
+		res.Schedules = append(res.Schedules, priceScheduleToProto(schedule))
+	}
+	return res, nil
+}
+
+// ReserveStock, CommitReservation and ReleaseReservation are called by the order
+// service while an order is placed and paid for, RestockReservation when a paid
+// order is cancelled or refunded.
+func (s *grpcServer) ReserveStock(ctx context.Context, r *pb.ReserveStockRequest) (*pb.ReservationResponse, error) {
+	items := make([]models.ReservationItem, 0, len(r.GetItems()))
+	for _, item := range r.GetItems() {
+		items = append(items, models.ReservationItem{
+			ProductID: item.GetProductId(),
+			SKU:       item.GetSku(),
+			Quantity:  int(item.GetQuantity()),
+		})
+	}
+	reservation, err := s.service.ReserveStock(ctx, items)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	res := &pb.ReservationResponse{Id: reservation.ID}
+	res.ExpiresAt, _ = reservation.ExpiresAt.MarshalBinary()
+	return res, nil
+}
+
+func (s *grpcServer) CommitReservation(ctx context.Context, r *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := s.service.CommitReservation(ctx, r.Value); err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) ReleaseReservation(ctx context.Context, r *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := s.service.ReleaseReservation(ctx, r.Value); err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) RestockReservation(ctx context.Context, r *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := s.service.RestockReservation(ctx, r.Value); err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func productToProto(p *models.Product) *pb.Product {
+	return &pb.Product{
+		Id:            p.ID,
+		Name:          p.Name,
+		Description:   p.Description,
+		Price:         p.Price,
+		AccountId:     int64(p.AccountID),
+		CategoryIds:   p.CategoryIDs,
+		Options:       optionsToProto(p.Options),
+		Variants:      variantsToProto(p.Variants),
+		Images:        imagesToProto(p.Images),
+		RatingAverage: p.Rating.Average,
+		RatingCount:   int32(p.Rating.Count),
+		Status:        productStatusToProto[p.Status],
+	}
+}
+
+func optionsToProto(options []models.ProductOption) []*pb.ProductOption {
+	res := make([]*pb.ProductOption, 0, len(options))
+	for _, option := range options {
+		res = append(res, &pb.ProductOption{Name: option.Name, Values: option.Values})
+	}
+	return res
+}
+
+func variantsToProto(variants []models.Variant) []*pb.Variant {
+	res := make([]*pb.Variant, 0, len(variants))
+	for _, variant := range variants {
+		v := &pb.Variant{Sku: variant.SKU, Price: variant.Price}
+		for _, option := range variant.Options {
+			v.Options = append(v.Options, &pb.VariantOption{Name: option.Name, Value: option.Value})
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func optionsFromProto(options []*pb.ProductOption) []models.ProductOption {
+	res := make([]models.ProductOption, 0, len(options))
+	for _, option := range options {
+		res = append(res, models.ProductOption{Name: option.GetName(), Values: option.GetValues()})
+	}
+	return res
+}
+
+func variantsFromProto(variants []*pb.Variant) []models.Variant {
+	res := make([]models.Variant, 0, len(variants))
+	for _, variant := range variants {
+		v := models.Variant{SKU: variant.GetSku(), Price: variant.GetPrice()}
+		for _, option := range variant.GetOptions() {
+			v.Options = append(v.Options, models.VariantOption{Name: option.GetName(), Value: option.GetValue()})
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func imagesToProto(images []models.ProductImage) []*pb.ProductImage {
+	res := make([]*pb.ProductImage, 0, len(images))
+	for _, image := range images {
+		res = append(res, &pb.ProductImage{
+			Id:           image.ID,
+			Key:          image.Key,
+			ThumbnailKey: image.ThumbnailKey,
+			ContentType:  image.ContentType,
+			Width:        int32(image.Width),
+			Height:       int32(image.Height),
+		})
+	}
+	return res
+}
+
+func imageFromProto(image *pb.ProductImage) models.ProductImage {
+	return models.ProductImage{
+		ID:           image.GetId(),
+		Key:          image.GetKey(),
+		ThumbnailKey: image.GetThumbnailKey(),
+		ContentType:  image.GetContentType(),
+		Width:        int(image.GetWidth()),
+		Height:       int(image.GetHeight()),
+	}
+}
+
+func categoryToProto(c *models.Category) *pb.Category {
+	return &pb.Category{
+		Id:       c.ID,
+		Name:     c.Name,
+		ParentId: c.ParentID,
+		Path:     c.Path,
+	}
+}
+
+func stockToProto(stock *models.Stock) *pb.Stock {
+	return &pb.Stock{
+		ProductId: stock.ProductID,
+		Sku:       stock.SKU,
+		OnHand:    int64(stock.OnHand),
+		Reserved:  int64(stock.Reserved),
+		Available: int64(stock.Available()),
+	}
+}
+
+func productSearchFromProto(ctx context.Context, r *pb.GetProductsRequest) models.ProductSearch {
+	return models.ProductSearch{
+		Query:      r.Query,
+		CategoryID: r.CategoryId,
+		MinPrice:   r.MinPrice,
+		MaxPrice:   r.MaxPrice,
+		AccountID:  int(r.SellerId),
+		ViewerID:   viewerID(ctx),
+		Sort:       models.ProductSort(r.Sort),
+		After:      r.After,
+		Skip:       r.Skip,
+		Take:       r.Take,
+	}
+}
+
+func priceChangeToProto(change *models.PriceChange) *pb.PriceChange {
+	res := &pb.PriceChange{
+		ProductId: change.ProductID,
+		OldPrice:  change.OldPrice,
+		NewPrice:  change.NewPrice,
+		ActorId:   int64(change.ActorID),
+		Reason:    string(change.Reason),
+	}
+	if change.ScheduleID != nil {
+		res.ScheduleId = *change.ScheduleID
+	}
+	res.ChangedAt, _ = change.ChangedAt.MarshalBinary()
+	return res
+}
+
+func priceScheduleToProto(schedule *models.PriceSchedule) *pb.PriceSchedule {
+	res := &pb.PriceSchedule{
+		Id:           schedule.ID,
+		ProductId:    schedule.ProductID,
+		Price:        schedule.Price,
+		Status:       string(schedule.Status),
+		RegularPrice: schedule.RegularPrice,
+	}
+	res.StartsAt, _ = schedule.StartsAt.MarshalBinary()
+	if schedule.EndsAt != nil {
+		res.EndsAt, _ = schedule.EndsAt.MarshalBinary()
+	}
+	res.CreatedAt, _ = schedule.CreatedAt.MarshalBinary()
+	return res
+}
+
+// callerID returns the account authenticated by the interceptor.
+func callerID(ctx context.Context) (int, error) {
+	accountId, err := auth.GetUserIdInt(ctx, false)
+	if err != nil {
+		return 0, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return accountId, nil
+}
+
+// viewerID returns the account of the caller when it sent a token, or 0.
+func viewerID(ctx context.Context) int {
+	accountId, err := auth.GetUserIdInt(ctx, false)
+	if err != nil {
+		return 0
+	}
+	return accountId
+}
+
+// serviceError maps the failures of the category, search, variant, image, bulk,
+// inventory, pricing and lifecycle methods to status codes.
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrReservationNotFound), errors.Is(err, ErrImageNotFound),
+		errors.Is(err, ErrScheduleNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrCategoryNameRequired), errors.Is(err, ErrInvalidPriceRange),
+		errors.Is(err, ErrInvalidStockQuantity), errors.Is(err, ErrInvalidReservation),
+		errors.Is(err, ErrInvalidOption), errors.Is(err, ErrInvalidVariant), errors.Is(err, ErrDuplicateVariant),
+		errors.Is(err, ErrVariantRequired), errors.Is(err, ErrUnknownVariant), errors.Is(err, ErrInvalidImage),
+		errors.Is(err, ErrUnknownFormat), errors.Is(err, ErrInvalidHeader),
+		errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrPageTooDeep), errors.Is(err, ErrInvalidRating),
+		errors.Is(err, ErrInvalidPrice), errors.Is(err, ErrInvalidSchedule), errors.Is(err, ErrInvalidStatus):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCategoryExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrCategoryCycle), errors.Is(err, ErrCategoryHasChildren),
+		errors.Is(err, ErrInsufficientStock), errors.Is(err, ErrStockBelowReserved), errors.Is(err, ErrTooManyImages),
+		errors.Is(err, ErrReservationCommitted), errors.Is(err, ErrReservationReleased),
+		errors.Is(err, ErrReservationRestocked), errors.Is(err, ErrReservationPending),
+		errors.Is(err, ErrSaleOverlap), errors.Is(err, ErrScheduleFinished), errors.Is(err, ErrInvalidTransition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
@@ -3,67 +3,157 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/IBM/sarama"
 
+	"github.com/rasadov/EcommerceAPI/pkg/crypt"
 	"github.com/rasadov/EcommerceAPI/pkg/kafka"
 	"github.com/rasadov/EcommerceAPI/product/models"
 )
 
+var (
+	ErrCategoryNameRequired = errors.New("category name must not be empty")
+	ErrCategoryExists       = errors.New("a category with this name already exists here")
+	ErrCategoryCycle        = errors.New("a category cannot be moved into itself or its subcategories")
+	ErrCategoryHasChildren  = errors.New("category has subcategories")
+	ErrInvalidPriceRange    = errors.New("minimum price is greater than the maximum price")
+	ErrPageTooDeep          = errors.New("pages past the first 10,000 products are only reached with a cursor")
+	ErrInvalidOption        = errors.New("options need a unique name and unique values")
+	ErrInvalidVariant       = errors.New("variants need a unique SKU, a positive price and one value of each option")
+	ErrDuplicateVariant     = errors.New("two variants have the same options")
+	ErrVariantRequired      = errors.New("product has variants, choose one by SKU")
+	ErrUnknownVariant       = errors.New("product has no variant with this SKU")
+	ErrInvalidImage         = errors.New("an image needs an ID and storage keys")
+	ErrTooManyImages        = errors.New("product has the most images allowed")
+	ErrImageNotFound        = errors.New("product has no image with this ID")
+	ErrInvalidRating        = errors.New("a rating averages 1 to 5 stars over a positive count, or is empty")
+	ErrInvalidPrice         = errors.New("price must be positive")
+	ErrInvalidSchedule      = errors.New("a price change starts in the future, and a sale ends after it starts")
+	ErrSaleOverlap          = errors.New("product has another sale at that time")
+	ErrScheduleFinished     = errors.New("price schedule already completed or canceled")
+	ErrInvalidStatus        = errors.New("unknown product status")
+	ErrInvalidTransition    = errors.New("product status cannot change this way")
+)
+
 type Service interface {
-	PostProduct(ctx context.Context, name, description string, price float64, accountId int) (*models.Product, error)
+	PostProduct(ctx context.Context, name, description string, price float64, status models.ProductStatus, accountId int) (*models.Product, error)
 	GetProduct(ctx context.Context, id string) (*models.Product, error)
-	GetProducts(ctx context.Context, skip, take uint64) ([]*models.Product, error)
 	GetProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error)
-	SearchProducts(ctx context.Context, query string, skip, take uint64) ([]*models.Product, error)
+	SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error)
+	SuggestProducts(ctx context.Context, prefix string, size int) (*models.Suggestions, error)
+	ListProductsByAccount(ctx context.Context, accountId, viewerId int, skip, take uint64) ([]*models.Product, error)
+	ImportProducts(ctx context.Context, accountId int, format models.BulkFormat, r io.Reader) (*models.ImportResult, error)
+	ExportProducts(ctx context.Context, accountId int, format models.BulkFormat, w io.Writer) error
 	UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int) (*models.Product, error)
 	DeleteProduct(ctx context.Context, productId string, accountId int) error
+	SetProductStatus(ctx context.Context, productId string, status models.ProductStatus, accountId int) (*models.Product, error)
+	SetProductCategories(ctx context.Context, productId string, categoryIDs []string, accountId int) (*models.Product, error)
+	CreateCategory(ctx context.Context, name, parentID string) (*models.Category, error)
+	RenameCategory(ctx context.Context, id, name string) (*models.Category, error)
+	MoveCategory(ctx context.Context, id, parentID string) (*models.Category, error)
+	DeleteCategory(ctx context.Context, id string) error
+	GetCategories(ctx context.Context, parentID string) ([]*models.Category, error)
+	GetCategoriesWithIDs(ctx context.Context, ids []string) ([]*models.Category, error)
+	SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant, accountId int) (*models.Product, error)
+	AddProductImage(ctx context.Context, productId string, image models.ProductImage, accountId int) (*models.Product, error)
+	RemoveProductImage(ctx context.Context, productId, imageId string, accountId int) (*models.Product, error)
+	SetProductRating(ctx context.Context, productId string, rating models.Rating) error
+	GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]*models.PriceChange, error)
+	SchedulePriceChange(ctx context.Context, productId string, price float64, startsAt time.Time, endsAt *time.Time, accountId int) (*models.PriceSchedule, error)
+	CancelPriceSchedule(ctx context.Context, id uint64, accountId int) (*models.PriceSchedule, error)
+	ListPriceSchedules(ctx context.Context, productId string, accountId int) ([]*models.PriceSchedule, error)
+	ApplyPriceSchedules(ctx context.Context) (int, error)
+	SetStock(ctx context.Context, productId, sku string, onHand, accountId int) (*models.Stock, error)
+	GetStock(ctx context.Context, productIds []string) ([]*models.Stock, error)
+	ReserveStock(ctx context.Context, items []models.ReservationItem) (*models.Reservation, error)
+	CommitReservation(ctx context.Context, id string) error
+	ReleaseReservation(ctx context.Context, id string) error
+	RestockReservation(ctx context.Context, id string) error
+	ReleaseExpiredReservations(ctx context.Context) (int, error)
 	Producer() sarama.AsyncProducer
 }
 
+// statusTransitions lists the statuses a product can move to from each status.
+// Archived products go back to drafts, to be checked before they are published.
+var statusTransitions = map[models.ProductStatus][]models.ProductStatus{
+	models.StatusDraft:     {models.StatusPublished, models.StatusArchived},
+	models.StatusPublished: {models.StatusDraft, models.StatusArchived},
+	models.StatusArchived:  {models.StatusDraft},
+}
+
+const (
+	// reservationDuration is how long stock is held for an order that is not paid for
+	reservationDuration = 30 * time.Minute
+	// maxProductImages is the most images a product can have
+	maxProductImages = 10
+	// importBatchSize is how many rows of an import are saved per bulk request
+	importBatchSize = 500
+	// defaultSuggestions and maxSuggestions bound the products suggested while typing
+	defaultSuggestions = 8
+	maxSuggestions     = 20
+	// maxResultWindow is how deep Elasticsearch pages with skip and take
+	maxResultWindow = 10000
+	// maxSuggestionPrefix is the longest text, in characters, suggestions are looked up for
+	maxSuggestionPrefix = 100
+	// maxPriceHistory is the most price changes listed at once
+	maxPriceHistory = 100
+)
+
 type productService struct {
-	repo     Repository
-	producer sarama.AsyncProducer
+	repo      Repository
+	inventory InventoryRepository
+	prices    PriceRepository
+	producer  sarama.AsyncProducer
 }
 
-func NewProductService(repository Repository, producer sarama.AsyncProducer) Service {
-	return &productService{repository, producer}
+func NewProductService(repository Repository, inventory InventoryRepository, prices PriceRepository, producer sarama.AsyncProducer) Service {
+	return &productService{repository, inventory, prices, producer}
 }
 
 func (service productService) Producer() sarama.AsyncProducer {
 	return service.producer
 }
 
-func (service productService) PostProduct(ctx context.Context, name, description string, price float64, accountId int) (*models.Product, error) {
+// PostProduct creates a product of the seller, published unless status is draft.
+func (service productService) PostProduct(ctx context.Context, name, description string, price float64, status models.ProductStatus, accountId int) (*models.Product, error) {
+	switch status {
+	case "":
+		status = models.StatusPublished
+	case models.StatusDraft, models.StatusPublished:
+	default:
+		return nil, ErrInvalidStatus
+	}
 	product := models.Product{
 		Name:        name,
 		Description: description,
 		Price:       price,
 		AccountID:   accountId,
+		CreatedAt:   time.Now().UTC(),
+		Status:      status,
 	}
 
 	err := service.repo.PutProduct(ctx, &product)
 	if err != nil {
 		return nil, err
 	}
+	service.recordPriceChanges(ctx, &models.PriceChange{
+		ProductID: product.ID,
+		NewPrice:  product.Price,
+		ActorID:   accountId,
+		Reason:    models.PriceCreated,
+		ChangedAt: product.CreatedAt,
+	})
 
-	go func() {
-		err = kafka.SendMessageToRecommender(service, models.Event{
-			Type: "product_created",
-			Data: models.EventData{
-				ID:          &product.ID,
-				Name:        &product.Name,
-				Description: &product.Description,
-				Price:       &product.Price,
-				AccountID:   &product.AccountID,
-			},
-		}, "product_events")
-		if err != nil {
-			log.Println("Failed to send event to recommendation service:", err)
-		}
-	}()
-
+	// Drafts are not recommended until they are published
+	if product.Published() {
+		service.sendProductEvent("product_created", &product)
+	}
 	return &product, nil
 }
 
@@ -89,18 +179,227 @@ func (service productService) GetProduct(ctx context.Context, id string) (*model
 	return product, nil
 }
 
-func (service productService) GetProducts(ctx context.Context, skip, take uint64) ([]*models.Product, error) {
-	return service.repo.ListProducts(ctx, skip, take)
-}
-
 func (service productService) GetProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error) {
 	return service.repo.ListProductsWithIDs(ctx, ids)
 }
 
-func (service productService) SearchProducts(ctx context.Context, query string, skip, take uint64) ([]*models.Product, error) {
-	return service.repo.SearchProducts(ctx, query, skip, take)
+// SearchProducts lists the products matching the search with its facets. Without
+// a query the products are listed by ID, unless sorted otherwise. Pages are
+// taken with skip and take, or after the cursor of a product.
+func (service productService) SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error) {
+	if search.MinPrice != nil && search.MaxPrice != nil && *search.MinPrice > *search.MaxPrice {
+		return nil, ErrInvalidPriceRange
+	}
+	categoryPath, err := service.categoryPath(ctx, search.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	search.CategoryPath = categoryPath
+	if search.Take > 100 || (search.Skip == 0 && search.Take == 0) {
+		search.Take = 100
+	}
+	if search.After == "" && search.Skip+search.Take > maxResultWindow {
+		return nil, ErrPageTooDeep
+	}
+	return service.repo.SearchProducts(ctx, search)
+}
+
+// SuggestProducts returns products to complete a search being typed, or a
+// corrected search when the prefix matches none.
+func (service productService) SuggestProducts(ctx context.Context, prefix string, size int) (*models.Suggestions, error) {
+	prefix = strings.TrimSpace(prefix)
+	if runes := []rune(prefix); len(runes) > maxSuggestionPrefix {
+		prefix = string(runes[:maxSuggestionPrefix])
+	}
+	if prefix == "" {
+		return &models.Suggestions{}, nil
+	}
+	if size <= 0 {
+		size = defaultSuggestions
+	}
+	size = min(size, maxSuggestions)
+	return service.repo.SuggestProducts(ctx, prefix, size)
+}
+
+// ListProductsByAccount returns the published products of a seller, and its
+// drafts when the seller is the viewer.
+func (service productService) ListProductsByAccount(ctx context.Context, accountId, viewerId int, skip, take uint64) ([]*models.Product, error) {
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+	return service.repo.ListProductsByAccount(ctx, accountId, viewerId, skip, take)
+}
+
+// ImportProducts creates the products of a seller read from an import file, and
+// updates those the rows have an ID for. Invalid rows are reported and skipped,
+// the valid ones are saved in batches.
+func (service productService) ImportProducts(ctx context.Context, accountId int, format models.BulkFormat, r io.Reader) (*models.ImportResult, error) {
+	result := &models.ImportResult{}
+	batch := make([]models.ImportRow, 0, importBatchSize)
+	err := readImportRows(r, format, func(row models.ImportRow, rowErr error) error {
+		if rowErr == nil {
+			rowErr = validateImportRow(row)
+		}
+		if rowErr != nil {
+			result.AddError(row.Line, rowErr)
+			return nil
+		}
+		batch = append(batch, row)
+		if len(batch) < importBatchSize {
+			return nil
+		}
+		err := service.importBatch(ctx, accountId, batch, result)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil {
+		err = service.importBatch(ctx, accountId, batch, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (service productService) importBatch(ctx context.Context, accountId int, rows []models.ImportRow, result *models.ImportResult) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// Rows can only update products of the seller, other products are reported
+	// as missing so their IDs cannot be probed
+	var productIDs, categoryIDs []string
+	for _, row := range rows {
+		if row.ID != "" {
+			productIDs = append(productIDs, row.ID)
+		}
+		for _, id := range row.CategoryIDs {
+			if !slices.Contains(categoryIDs, id) {
+				categoryIDs = append(categoryIDs, id)
+			}
+		}
+	}
+	owned := make(map[string]bool, len(productIDs))
+	prices := make(map[string]float64, len(productIDs))
+	if len(productIDs) > 0 {
+		existing, err := service.repo.ListProductsWithIDs(ctx, productIDs)
+		if err != nil {
+			return err
+		}
+		for _, product := range existing {
+			owned[product.ID] = product.AccountID == accountId
+			prices[product.ID] = product.Price
+		}
+	}
+	categoryPaths := make(map[string]string, len(categoryIDs))
+	if len(categoryIDs) > 0 {
+		categories, err := service.repo.ListCategoriesWithIDs(ctx, categoryIDs)
+		if err != nil {
+			return err
+		}
+		for _, category := range categories {
+			categoryPaths[category.ID] = strings.Join(category.Path, "/")
+		}
+	}
+
+	now := time.Now().UTC()
+	products := make([]*models.Product, 0, len(rows))
+	lines := make([]int, 0, len(rows))
+	for _, row := range rows {
+		if row.ID != "" && !owned[row.ID] {
+			result.AddError(row.Line, ErrNotFound)
+			continue
+		}
+		if i := slices.IndexFunc(row.CategoryIDs, func(id string) bool { return categoryPaths[id] == "" }); i >= 0 {
+			result.AddError(row.Line, fmt.Errorf("category %s not found", row.CategoryIDs[i]))
+			continue
+		}
+		products = append(products, &models.Product{
+			ID:          row.ID,
+			Name:        row.Name,
+			Description: row.Description,
+			Price:       row.Price,
+			AccountID:   accountId,
+			CategoryIDs: row.CategoryIDs,
+			CreatedAt:   now,
+			Status:      models.StatusPublished,
+		})
+		lines = append(lines, row.Line)
+	}
+
+	// IDs are only set on the created products once they are saved
+	updated := make([]bool, len(products))
+	for i, product := range products {
+		updated[i] = product.ID != ""
+	}
+	errs, err := service.repo.BulkPutProducts(ctx, products, categoryPaths)
+	if err != nil {
+		return err
+	}
+
+	var events []models.Event
+	var priceChanges []*models.PriceChange
+	for i, product := range products {
+		if errs[i] != nil {
+			result.AddError(lines[i], errs[i])
+			continue
+		}
+		eventType := "product_created"
+		if updated[i] {
+			eventType = "product_updated"
+			result.Updated++
+		} else {
+			result.Created++
+		}
+		if !updated[i] || prices[product.ID] != product.Price {
+			priceChanges = append(priceChanges, &models.PriceChange{
+				ProductID: product.ID,
+				OldPrice:  prices[product.ID],
+				NewPrice:  product.Price,
+				ActorID:   accountId,
+				Reason:    models.PriceImported,
+				ChangedAt: now,
+			})
+		}
+		events = append(events, models.Event{
+			Type: eventType,
+			Data: models.EventData{
+				ID:          &product.ID,
+				Name:        &product.Name,
+				Description: &product.Description,
+				Price:       &product.Price,
+				AccountID:   &product.AccountID,
+			},
+		})
+	}
+
+	service.recordPriceChanges(ctx, priceChanges...)
+
+	go func() {
+		for _, event := range events {
+			if err := kafka.SendMessageToRecommender(service, event, "product_events"); err != nil {
+				log.Println("Failed to send event to recommendation service:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// ExportProducts writes the catalog of a seller to w in a format ImportProducts reads.
+func (service productService) ExportProducts(ctx context.Context, accountId int, format models.BulkFormat, w io.Writer) error {
+	writer, err := newProductWriter(w, format)
+	if err != nil {
+		return err
+	}
+	err = service.repo.ScrollProductsByAccount(ctx, accountId, writer.Write)
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
 }
 
+// UpdateProduct changes the name, description and price of a product of the
+// seller and returns it as stored. The recommender only hears of published products.
 func (service productService) UpdateProduct(ctx context.Context, id, name, description string, price float64, accountId int) (*models.Product, error) {
 	product, err := service.repo.GetProductById(ctx, id)
 	if err != nil {
@@ -121,45 +420,796 @@ func (service productService) UpdateProduct(ctx context.Context, id, name, descr
 	if err != nil {
 		return nil, err
 	}
+	if price != product.Price {
+		service.recordPriceChanges(ctx, &models.PriceChange{
+			ProductID: id,
+			OldPrice:  product.Price,
+			NewPrice:  price,
+			ActorID:   accountId,
+			Reason:    models.PriceUpdated,
+			ChangedAt: time.Now().UTC(),
+		})
+	}
 
-	go func() {
-		err = kafka.SendMessageToRecommender(service, models.Event{
-			Type: "product_updated",
-			Data: models.EventData{
-				ID:          &updatedProduct.ID,
-				Name:        &updatedProduct.Name,
-				Description: &updatedProduct.Description,
-				Price:       &updatedProduct.Price,
-				AccountID:   &updatedProduct.AccountID,
-			},
-		}, "product_events")
+	stored, err := service.repo.GetProductById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Published() {
+		service.sendProductEvent("product_updated", stored)
+	}
+	return stored, nil
+}
+
+// DeleteProduct archives a product. Archived products are no longer listed or
+// ordered, but past orders still find them by ID.
+func (service productService) DeleteProduct(ctx context.Context, productId string, accountId int) error {
+	_, err := service.SetProductStatus(ctx, productId, models.StatusArchived, accountId)
+	return err
+}
+
+// SetProductStatus moves a product of the seller through its lifecycle. Setting
+// the status a product already has changes nothing.
+func (service productService) SetProductStatus(ctx context.Context, productId string, status models.ProductStatus, accountId int) (*models.Product, error) {
+	if _, ok := statusTransitions[status]; !ok {
+		return nil, ErrInvalidStatus
+	}
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	if product.Status == status {
+		return product, nil
+	}
+	if !slices.Contains(statusTransitions[product.Status], status) {
+		return nil, ErrInvalidTransition
+	}
+
+	wasPublished := product.Published()
+	if err = service.repo.SetProductStatus(ctx, productId, status); err != nil {
+		return nil, err
+	}
+	product.Status = status
+
+	// The recommender only knows published products
+	switch {
+	case wasPublished && !product.Published():
+		service.sendProductEvent("product_deleted", product)
+	case !wasPublished && product.Published():
+		service.sendProductEvent("product_created", product)
+	}
+	return product, nil
+}
+
+// SetProductCategories replaces the categories of a product with categoryIDs.
+func (service productService) SetProductCategories(ctx context.Context, productId string, categoryIDs []string, accountId int) (*models.Product, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+
+	var ids []string
+	for _, id := range categoryIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	categories, err := service.repo.ListCategoriesWithIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) != len(ids) {
+		return nil, ErrNotFound
+	}
+	paths := make([]string, 0, len(categories))
+	for _, category := range categories {
+		paths = append(paths, strings.Join(category.Path, "/"))
+	}
+	if err = service.repo.SetProductCategories(ctx, product.ID, ids, paths); err != nil {
+		return nil, err
+	}
+	product.CategoryIDs = ids
+	return product, nil
+}
+
+// CreateCategory adds a category under parentID, or a root category when
+// parentID is empty. Names are unique among siblings.
+func (service productService) CreateCategory(ctx context.Context, name, parentID string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrCategoryNameRequired
+	}
+	var parentPath []string
+	if parentID != "" {
+		parent, err := service.repo.GetCategory(ctx, parentID)
 		if err != nil {
-			log.Println("Failed to send event to recommendation service:", err)
+			return nil, err
 		}
-	}()
+		parentPath = parent.Path
+	}
+	if err := service.checkCategoryName(ctx, parentID, name, ""); err != nil {
+		return nil, err
+	}
 
-	return updatedProduct, nil
+	id, err := crypt.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	category := &models.Category{
+		ID:       id,
+		Name:     name,
+		ParentID: parentID,
+		Path:     append(slices.Clone(parentPath), id),
+	}
+	if err = service.repo.SaveCategories(ctx, category); err != nil {
+		return nil, err
+	}
+	return category, nil
 }
-func (service productService) DeleteProduct(ctx context.Context, productId string, accountId int) error {
-	product, err := service.repo.GetProductById(ctx, productId)
+
+// RenameCategory changes the name of a category. Products reference categories
+// by ID, so they are not affected.
+func (service productService) RenameCategory(ctx context.Context, id, name string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrCategoryNameRequired
+	}
+	category, err := service.repo.GetCategory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.checkCategoryName(ctx, category.ParentID, name, category.ID); err != nil {
+		return nil, err
+	}
+	category.Name = name
+	if err = service.repo.SaveCategories(ctx, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// MoveCategory moves a category and its subcategories under parentID, or to the
+// root when parentID is empty, and updates the paths indexed with their products.
+func (service productService) MoveCategory(ctx context.Context, id, parentID string) (*models.Category, error) {
+	category, err := service.repo.GetCategory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var parentPath []string
+	if parentID != "" {
+		parent, err := service.repo.GetCategory(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(parent.Path, category.ID) {
+			return nil, ErrCategoryCycle
+		}
+		parentPath = parent.Path
+	}
+	if err = service.checkCategoryName(ctx, parentID, category.Name, category.ID); err != nil {
+		return nil, err
+	}
+
+	subtree, err := service.repo.ListCategorySubtree(ctx, category.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Every path in the subtree continues from the moved category at the same depth
+	depth := len(category.Path) - 1
+	ids := make([]string, 0, len(subtree))
+	for _, descendant := range subtree {
+		descendant.Path = append(slices.Clone(parentPath), descendant.Path[depth:]...)
+		if descendant.ID == category.ID {
+			descendant.ParentID = parentID
+			category = descendant
+		}
+		ids = append(ids, descendant.ID)
+	}
+	if err = service.repo.SaveCategories(ctx, subtree...); err != nil {
+		return nil, err
+	}
+	if err = service.refreshProductCategories(ctx, ids); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// DeleteCategory deletes a category without subcategories and removes it from
+// its products.
+func (service productService) DeleteCategory(ctx context.Context, id string) error {
+	children, err := service.repo.ListCategories(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return ErrCategoryHasChildren
+	}
+	if err = service.repo.DeleteCategory(ctx, id); err != nil {
+		return err
+	}
+	return service.refreshProductCategories(ctx, []string{id})
+}
+
+// GetCategories returns the children of a category, or the root categories when
+// parentID is empty.
+func (service productService) GetCategories(ctx context.Context, parentID string) ([]*models.Category, error) {
+	return service.repo.ListCategories(ctx, parentID)
+}
+
+func (service productService) GetCategoriesWithIDs(ctx context.Context, ids []string) ([]*models.Category, error) {
+	return service.repo.ListCategoriesWithIDs(ctx, ids)
+}
+
+// categoryPath returns the indexed path of a category, or an empty path when no
+// category is given.
+func (service productService) categoryPath(ctx context.Context, categoryID string) (string, error) {
+	if categoryID == "" {
+		return "", nil
+	}
+	category, err := service.repo.GetCategory(ctx, categoryID)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(category.Path, "/"), nil
+}
+
+// checkCategoryName rejects a name already used by another child of parentID.
+func (service productService) checkCategoryName(ctx context.Context, parentID, name, id string) error {
+	siblings, err := service.repo.ListCategories(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	for _, sibling := range siblings {
+		if sibling.ID != id && strings.EqualFold(sibling.Name, name) {
+			return ErrCategoryExists
+		}
+	}
+	return nil
+}
+
+// refreshProductCategories indexes the current paths of the products in the
+// categories, after the categories were moved or deleted. Deleted categories
+// are dropped from the products.
+func (service productService) refreshProductCategories(ctx context.Context, categoryIDs []string) error {
+	products, err := service.repo.ListProductsInCategories(ctx, categoryIDs)
 	if err != nil {
 		return err
 	}
+	var ids []string
+	for _, product := range products {
+		for _, id := range product.CategoryIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	categories, err := service.repo.ListCategoriesWithIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	paths := make(map[string]string, len(categories))
+	for _, category := range categories {
+		paths[category.ID] = strings.Join(category.Path, "/")
+	}
+
+	for _, product := range products {
+		var productIDs, productPaths []string
+		for _, id := range product.CategoryIDs {
+			if path, ok := paths[id]; ok {
+				productIDs = append(productIDs, id)
+				productPaths = append(productPaths, path)
+			}
+		}
+		if err = service.repo.SetProductCategories(ctx, product.ID, productIDs, productPaths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetProductVariants replaces the options of a product and the variants it is
+// sold in. The stock of variants that are removed is no longer tracked.
+func (service productService) SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant, accountId int) (*models.Product, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
 	if product.AccountID != accountId {
-		return errors.New("unauthorized")
+		return nil, errors.New("unauthorized")
+	}
+	if err = validateVariants(options, variants); err != nil {
+		return nil, err
 	}
 
-	go func() {
-		err = kafka.SendMessageToRecommender(service, models.Event{
-			Type: "product_deleted",
-			Data: models.EventData{
-				ID: &product.ID,
-			},
-		}, "product_events")
+	if err = service.repo.SetProductVariants(ctx, productId, options, variants); err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, variant := range product.Variants {
+		if !slices.ContainsFunc(variants, func(other models.Variant) bool { return other.SKU == variant.SKU }) {
+			removed = append(removed, variant.SKU)
+		}
+	}
+	if err = service.inventory.DeleteVariantStock(ctx, productId, removed); err != nil {
+		log.Println("Failed to delete stock of removed variants", productId, err)
+	}
+
+	product.Options = options
+	product.Variants = variants
+	return product, nil
+}
+
+// validateVariants checks that every variant has a unique SKU and exactly one
+// of the values of each option, and that no two variants are the same.
+func validateVariants(options []models.ProductOption, variants []models.Variant) error {
+	values := make(map[string][]string, len(options))
+	for _, option := range options {
+		if option.Name == "" || len(option.Values) == 0 {
+			return ErrInvalidOption
+		}
+		if _, ok := values[option.Name]; ok {
+			return ErrInvalidOption
+		}
+		for i, value := range option.Values {
+			if value == "" || slices.Contains(option.Values[:i], value) {
+				return ErrInvalidOption
+			}
+		}
+		values[option.Name] = option.Values
+	}
+	if len(options) == 0 && len(variants) > 0 {
+		return ErrInvalidVariant
+	}
+
+	skus := make(map[string]bool, len(variants))
+	combinations := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if variant.SKU == "" || skus[variant.SKU] || variant.Price <= 0 || len(variant.Options) != len(options) {
+			return ErrInvalidVariant
+		}
+		skus[variant.SKU] = true
+
+		chosen := make(map[string]string, len(variant.Options))
+		for _, option := range variant.Options {
+			if _, ok := chosen[option.Name]; ok || !slices.Contains(values[option.Name], option.Value) {
+				return ErrInvalidVariant
+			}
+			chosen[option.Name] = option.Value
+		}
+		// Options are listed in product order so equal variants get the same key
+		key := make([]string, 0, len(options))
+		for _, option := range options {
+			key = append(key, chosen[option.Name])
+		}
+		combination := strings.Join(key, "\x00")
+		if combinations[combination] {
+			return ErrDuplicateVariant
+		}
+		combinations[combination] = true
+	}
+	return nil
+}
+
+// AddProductImage appends an image, already stored by the caller, to the images
+// of a product.
+func (service productService) AddProductImage(ctx context.Context, productId string, image models.ProductImage, accountId int) (*models.Product, error) {
+	if image.ID == "" || image.Key == "" || image.ThumbnailKey == "" {
+		return nil, ErrInvalidImage
+	}
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	if len(product.Images) >= maxProductImages {
+		return nil, ErrTooManyImages
+	}
+	if product.Image(image.ID) != nil {
+		return nil, ErrInvalidImage
+	}
+
+	images := append(product.Images, image)
+	if err = service.repo.SetProductImages(ctx, productId, images); err != nil {
+		return nil, err
+	}
+	product.Images = images
+	return product, nil
+}
+
+// RemoveProductImage removes an image from a product. Deleting the stored files
+// is left to the caller.
+func (service productService) RemoveProductImage(ctx context.Context, productId, imageId string, accountId int) (*models.Product, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	if product.Image(imageId) == nil {
+		return nil, ErrImageNotFound
+	}
+
+	images := slices.DeleteFunc(product.Images, func(image models.ProductImage) bool { return image.ID == imageId })
+	if err = service.repo.SetProductImages(ctx, productId, images); err != nil {
+		return nil, err
+	}
+	product.Images = images
+	return product, nil
+}
+
+// SetStock sets the quantity of a product the seller has on hand, or of one of
+// its variants when sku is set. Stock is tracked from the first time it is set.
+func (service productService) SetStock(ctx context.Context, productId, sku string, onHand, accountId int) (*models.Stock, error) {
+	if onHand < 0 {
+		return nil, ErrInvalidStockQuantity
+	}
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	if sku == "" && len(product.Variants) > 0 {
+		return nil, ErrVariantRequired
+	}
+	if sku != "" && product.Variant(sku) == nil {
+		return nil, ErrUnknownVariant
+	}
+	return service.inventory.SetStock(ctx, productId, sku, onHand)
+}
+
+func (service productService) GetStock(ctx context.Context, productIds []string) ([]*models.Stock, error) {
+	if len(productIds) == 0 {
+		return nil, nil
+	}
+	return service.inventory.GetStock(ctx, productIds)
+}
+
+// ReserveStock holds the quantities of items for reservationDuration. Either
+// every tracked product has enough stock and all of it is held, or nothing is.
+func (service productService) ReserveStock(ctx context.Context, items []models.ReservationItem) (*models.Reservation, error) {
+	var merged []models.ReservationItem
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidReservation
+		}
+		i := slices.IndexFunc(merged, func(other models.ReservationItem) bool {
+			return other.ProductID == item.ProductID && other.SKU == item.SKU
+		})
+		if i == -1 {
+			merged = append(merged, models.ReservationItem{ProductID: item.ProductID, SKU: item.SKU, Quantity: item.Quantity})
+		} else {
+			merged[i].Quantity += item.Quantity
+		}
+	}
+	if len(merged) == 0 {
+		return nil, ErrInvalidReservation
+	}
+
+	id, err := crypt.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	reservation := &models.Reservation{
+		ID:        id,
+		Status:    models.ReservationPending,
+		ExpiresAt: now.Add(reservationDuration),
+		CreatedAt: now,
+		Items:     merged,
+	}
+	if err = service.inventory.ReserveStock(ctx, reservation); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (service productService) CommitReservation(ctx context.Context, id string) error {
+	return service.inventory.CommitReservation(ctx, id)
+}
+
+func (service productService) ReleaseReservation(ctx context.Context, id string) error {
+	return service.inventory.ReleaseReservation(ctx, id)
+}
+
+func (service productService) RestockReservation(ctx context.Context, id string) error {
+	return service.inventory.RestockReservation(ctx, id)
+}
+
+// ReleaseExpiredReservations releases the pending reservations of abandoned
+// orders and returns how many were released.
+func (service productService) ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	ids, err := service.inventory.ListExpiredReservations(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	released := 0
+	for _, id := range ids {
+		// The order may have been paid for since it was listed
+		err = service.inventory.ReleaseReservation(ctx, id)
+		if errors.Is(err, ErrReservationCommitted) {
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// ReleaseExpiredReservationsEvery runs ReleaseExpiredReservations at every
+// interval. It never returns.
+func ReleaseExpiredReservationsEvery(service Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		released, err := service.ReleaseExpiredReservations(ctx)
+		cancel()
 		if err != nil {
+			log.Println("Failed to release expired reservations:", err)
+		}
+		if released > 0 {
+			log.Println("Released expired reservations:", released)
+		}
+	}
+}
+
+// SetProductRating records the rating the review service computed for a product.
+func (service productService) SetProductRating(ctx context.Context, productId string, rating models.Rating) error {
+	empty := rating.Count == 0 && rating.Average == 0
+	if !empty && (rating.Count <= 0 || rating.Average < 1 || rating.Average > 5) {
+		return ErrInvalidRating
+	}
+	return service.repo.SetProductRating(ctx, productId, rating)
+}
+
+// GetPriceHistory lists the price changes of a product, newest first.
+func (service productService) GetPriceHistory(ctx context.Context, productId string, skip, take uint64) ([]*models.PriceChange, error) {
+	if take == 0 || take > maxPriceHistory {
+		take = maxPriceHistory
+	}
+	return service.prices.ListPriceChanges(ctx, productId, skip, take)
+}
+
+// SchedulePriceChange sets the price of a product at startsAt. With endsAt it
+// is a sale, and the price the product has when the sale starts is put back
+// when it ends. Sales of a product cannot overlap.
+func (service productService) SchedulePriceChange(ctx context.Context, productId string, price float64, startsAt time.Time, endsAt *time.Time, accountId int) (*models.PriceSchedule, error) {
+	if price <= 0 {
+		return nil, ErrInvalidPrice
+	}
+	now := time.Now().UTC()
+	if !startsAt.After(now) || (endsAt != nil && !endsAt.After(startsAt)) {
+		return nil, ErrInvalidSchedule
+	}
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+
+	schedule := &models.PriceSchedule{
+		ProductID: productId,
+		AccountID: accountId,
+		Price:     price,
+		StartsAt:  startsAt.UTC(),
+		Status:    models.ScheduleScheduled,
+	}
+	if endsAt != nil {
+		end := endsAt.UTC()
+		schedule.EndsAt = &end
+		overlaps, err := service.prices.HasOverlappingSale(ctx, productId, schedule.StartsAt, end)
+		if err != nil {
+			return nil, err
+		}
+		if overlaps {
+			return nil, ErrSaleOverlap
+		}
+	}
+	if err = service.prices.CreatePriceSchedule(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// CancelPriceSchedule cancels a price change that has not started. Canceling a
+// running sale ends it now.
+func (service productService) CancelPriceSchedule(ctx context.Context, id uint64, accountId int) (*models.PriceSchedule, error) {
+	schedule, err := service.prices.GetPriceSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+
+	switch schedule.Status {
+	case models.ScheduleScheduled:
+		schedule.Status = models.ScheduleCanceled
+		err = service.prices.SetPriceScheduleStatus(ctx, schedule, models.ScheduleScheduled)
+	case models.ScheduleActive:
+		err = service.endSale(ctx, schedule, models.ScheduleCanceled)
+	default:
+		return nil, ErrScheduleFinished
+	}
+	if errors.Is(err, ErrScheduleChanged) {
+		return nil, ErrScheduleFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// ListPriceSchedules returns the price schedules of a product of the seller.
+func (service productService) ListPriceSchedules(ctx context.Context, productId string, accountId int) ([]*models.PriceSchedule, error) {
+	product, err := service.repo.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+	if product.AccountID != accountId {
+		return nil, errors.New("unauthorized")
+	}
+	return service.prices.ListPriceSchedules(ctx, productId)
+}
+
+// ApplyPriceSchedules starts the price changes and ends the sales that are due,
+// and returns how many were applied.
+func (service productService) ApplyPriceSchedules(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	schedules, err := service.prices.ListDuePriceSchedules(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, schedule := range schedules {
+		if schedule.Status == models.ScheduleActive {
+			err = service.endSale(ctx, schedule, models.ScheduleCompleted)
+		} else {
+			err = service.startPriceSchedule(ctx, schedule, now)
+		}
+		// Another replica or the seller got to it first
+		if errors.Is(err, ErrScheduleChanged) {
+			continue
+		}
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// ApplyPriceSchedulesEvery runs ApplyPriceSchedules at every interval. It never
+// returns.
+func ApplyPriceSchedulesEvery(service Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		applied, err := service.ApplyPriceSchedules(ctx)
+		cancel()
+		if err != nil {
+			log.Println("Failed to apply price schedules:", err)
+		}
+		if applied > 0 {
+			log.Println("Applied price schedules:", applied)
+		}
+	}
+}
+
+// startPriceSchedule sets the price of a schedule that is due. Schedules of
+// deleted products are canceled, and sales that ended before they could start
+// are completed without changing the price.
+func (service productService) startPriceSchedule(ctx context.Context, schedule *models.PriceSchedule, now time.Time) error {
+	product, err := service.repo.GetProductById(ctx, schedule.ProductID)
+	if errors.Is(err, ErrNotFound) {
+		schedule.Status = models.ScheduleCanceled
+		return service.prices.SetPriceScheduleStatus(ctx, schedule, models.ScheduleScheduled)
+	}
+	if err != nil {
+		return err
+	}
+	if schedule.IsSale() && !schedule.EndsAt.After(now) {
+		schedule.Status = models.ScheduleCompleted
+		return service.prices.SetPriceScheduleStatus(ctx, schedule, models.ScheduleScheduled)
+	}
+
+	reason := models.PriceScheduled
+	schedule.Status = models.ScheduleCompleted
+	if schedule.IsSale() {
+		reason = models.PriceSaleStarted
+		schedule.Status = models.ScheduleActive
+		schedule.RegularPrice = product.Price
+	}
+	if err = service.prices.SetPriceScheduleStatus(ctx, schedule, models.ScheduleScheduled); err != nil {
+		return err
+	}
+	if err = service.setScheduledPrice(ctx, product, schedule, schedule.Price, reason); err != nil {
+		// The schedule is tried again on the next run
+		applied := schedule.Status
+		schedule.Status = models.ScheduleScheduled
+		if resetErr := service.prices.SetPriceScheduleStatus(ctx, schedule, applied); resetErr != nil {
+			log.Println("Failed to reset price schedule", schedule.ID, resetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// endSale puts back the regular price of a running sale. A price the seller
+// changed during the sale is kept.
+func (service productService) endSale(ctx context.Context, schedule *models.PriceSchedule, status models.PriceScheduleStatus) error {
+	product, err := service.repo.GetProductById(ctx, schedule.ProductID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	schedule.Status = status
+	if err = service.prices.SetPriceScheduleStatus(ctx, schedule, models.ScheduleActive); err != nil {
+		return err
+	}
+	if product == nil || product.Price != schedule.Price {
+		return nil
+	}
+	return service.setScheduledPrice(ctx, product, schedule, schedule.RegularPrice, models.PriceSaleEnded)
+}
+
+// setScheduledPrice sets the price of a product for a schedule, records the
+// change and publishes the updated product.
+func (service productService) setScheduledPrice(ctx context.Context, product *models.Product, schedule *models.PriceSchedule, price float64, reason models.PriceChangeReason) error {
+	if err := service.repo.SetProductPrice(ctx, product.ID, price); err != nil {
+		return err
+	}
+	service.recordPriceChanges(ctx, &models.PriceChange{
+		ProductID:  product.ID,
+		OldPrice:   product.Price,
+		NewPrice:   price,
+		ActorID:    schedule.AccountID,
+		Reason:     reason,
+		ScheduleID: &schedule.ID,
+		ChangedAt:  time.Now().UTC(),
+	})
+	product.Price = price
+
+	if product.Published() {
+		service.sendProductEvent("product_updated", product)
+	}
+	return nil
+}
+
+// recordPriceChanges adds changes to the price history. The prices are already
+// changed, so a failure is only logged.
+func (service productService) recordPriceChanges(ctx context.Context, changes ...*models.PriceChange) {
+	if err := service.prices.AddPriceChanges(ctx, changes...); err != nil {
+		log.Println("Failed to record price changes:", err)
+	}
+}
+
+// sendProductEvent publishes a change of a product to the recommender.
+func (service productService) sendProductEvent(eventType string, product *models.Product) {
+	event := models.Event{
+		Type: eventType,
+		Data: models.EventData{
+			ID:          &product.ID,
+			Name:        &product.Name,
+			Description: &product.Description,
+			Price:       &product.Price,
+			AccountID:   &product.AccountID,
+		},
+	}
+	go func() {
+		if err := kafka.SendMessageToRecommender(service, event, "product_events"); err != nil {
 			log.Println("Failed to send event to recommendation service:", err)
 		}
 	}()
-
-	return service.repo.DeleteProduct(ctx, productId)
 }
@@ -0,0 +1,45 @@
+package models
+
+type BulkFormat int
+
+// maxImportErrors is the most row errors an import reports
+const maxImportErrors = 1000
+
+const (
+	FormatCSV BulkFormat = iota
+	FormatJSONL
+)
+
+// ImportRow is a product read from an import file. Rows with an ID update the
+// product, the others create one. Exports write products as rows, so an export
+// can be edited and imported back.
+type ImportRow struct {
+	// Line is where the row starts in the file
+	Line        int      `json:"-"`
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price"`
+	CategoryIDs []string `json:"category_ids,omitempty"`
+}
+
+type RowError struct {
+	Line    int
+	Message string
+}
+
+type ImportResult struct {
+	Created int
+	Updated int
+	// Failed counts every row that was not imported, Errors only the first ones
+	Failed int
+	Errors []RowError
+}
+
+// AddError reports a row that was not imported.
+func (result *ImportResult) AddError(line int, err error) {
+	result.Failed++
+	if len(result.Errors) < maxImportErrors {
+		result.Errors = append(result.Errors, RowError{Line: line, Message: err.Error()})
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+// Category is a node of the category tree. Path holds the IDs of its ancestors
+// from the root, followed by its own ID.
+type Category struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	ParentID string   `json:"parentID"`
+	Path     []string `json:"path"`
+}
+
+type CategoryDocument struct {
+	Name     string   `json:"name"`
+	ParentID string   `json:"parent_id"`
+	Path     []string `json:"path"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// ProductImage is a picture of a product kept in blob storage, along with a
+// smaller copy for listings. Keys are resolved into URLs by the storage.
+type ProductImage struct {
+	ID           string `json:"id"`
+	Key          string `json:"key"`
+	ThumbnailKey string `json:"thumbnail_key"`
+	ContentType  string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// Image returns the image of the product with the ID, or nil if there is none.
+func (p *Product) Image(id string) *ProductImage {
+	for i := range p.Images {
+		if p.Images[i].ID == id {
+			return &p.Images[i]
+		}
+	}
+	return nil
+}
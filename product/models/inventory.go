@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Stock is the inventory of a product, or of one of its variants when SKU is
+// set. Products without stock are not tracked and can always be ordered.
+type Stock struct {
+	ProductID string `gorm:"primaryKey"`
+	SKU       string `gorm:"primaryKey"`
+	OnHand    int
+	// Reserved is the part of OnHand held by pending reservations
+	Reserved  int
+	UpdatedAt time.Time
+}
+
+func (Stock) TableName() string {
+	return "stock"
+}
+
+// Available is the quantity that can still be reserved.
+func (stock Stock) Available() int {
+	return stock.OnHand - stock.Reserved
+}
+
+type ReservationStatus string
+
+const (
+	ReservationPending   ReservationStatus = "pending"
+	ReservationCommitted ReservationStatus = "committed"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationRestocked ReservationStatus = "restocked"
+)
+
+// Reservation holds stock for an order until it is paid for, which commits it,
+// or abandoned, which releases it. Pending reservations are released once they
+// expire. A committed reservation is restocked when its order is cancelled or
+// refunded.
+type Reservation struct {
+	ID        string            `gorm:"primaryKey"`
+	Status    ReservationStatus `gorm:"type:varchar(20);index"`
+	ExpiresAt time.Time         `gorm:"index"`
+	CreatedAt time.Time
+	Items     []ReservationItem `gorm:"foreignKey:ReservationID"`
+}
+
+type ReservationItem struct {
+	ID            uint64 `gorm:"primaryKey;autoIncrement"`
+	ReservationID string `gorm:"index"`
+	ProductID     string
+	SKU           string
+	Quantity      int
+	// Held is false for products whose stock was not tracked when reserved
+	Held bool
+}
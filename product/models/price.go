@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// PriceChangeReason tells what changed the price of a product.
+type PriceChangeReason string
+
+const (
+	PriceCreated   PriceChangeReason = "created"
+	PriceUpdated   PriceChangeReason = "updated"
+	PriceImported  PriceChangeReason = "imported"
+	PriceScheduled PriceChangeReason = "scheduled"
+	// PriceSaleStarted and PriceSaleEnded are the changes made by a sale, which
+	// sets a price for a while and then puts the previous one back
+	PriceSaleStarted PriceChangeReason = "sale_started"
+	PriceSaleEnded   PriceChangeReason = "sale_ended"
+)
+
+// PriceChange records a change of the price of a product. Variants have prices
+// of their own, which are not recorded.
+type PriceChange struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	ProductID string `gorm:"not null;index:idx_price_changes_product"`
+	// OldPrice is 0 for the price a product was created with
+	OldPrice float64
+	NewPrice float64
+	// ActorID is the account that made the change, or that scheduled it
+	ActorID int
+	Reason  PriceChangeReason `gorm:"type:varchar(20)"`
+	// ScheduleID is set for changes made by a price schedule
+	ScheduleID *uint64
+	ChangedAt  time.Time `gorm:"index:idx_price_changes_product"`
+}
+
+type PriceScheduleStatus string
+
+const (
+	ScheduleScheduled PriceScheduleStatus = "scheduled"
+	// ScheduleActive is a sale whose price is set, until it ends
+	ScheduleActive    PriceScheduleStatus = "active"
+	ScheduleCompleted PriceScheduleStatus = "completed"
+	ScheduleCanceled  PriceScheduleStatus = "canceled"
+)
+
+// PriceSchedule sets the price of a product at StartsAt. With EndsAt it is a
+// sale, and the price the product had before is put back at EndsAt.
+type PriceSchedule struct {
+	ID        uint64  `gorm:"primaryKey;autoIncrement"`
+	ProductID string  `gorm:"not null;index"`
+	AccountID int     `gorm:"not null"`
+	Price     float64 `gorm:"not null"`
+	StartsAt  time.Time
+	EndsAt    *time.Time
+	Status    PriceScheduleStatus `gorm:"type:varchar(20);index"`
+	// RegularPrice is the price a sale replaced, set when it starts
+	RegularPrice float64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// IsSale reports whether the schedule puts the previous price back when it ends.
+func (schedule PriceSchedule) IsSale() bool {
+	return schedule.EndsAt != nil
+}
@@ -1,15 +1,58 @@
 package models
 
+import "time"
+
+// ProductStatus is the lifecycle state of a product. Only published products
+// are listed to shoppers and can be ordered. Archived products replace deleted
+// ones, they are still found by ID so past orders can show them.
+type ProductStatus string
+
+const (
+	StatusDraft     ProductStatus = "draft"
+	StatusPublished ProductStatus = "published"
+	StatusArchived  ProductStatus = "archived"
+)
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	AccountID   int     `json:"accountID"`
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       float64         `json:"price"`
+	AccountID   int             `json:"accountID"`
+	CategoryIDs []string        `json:"categoryIDs"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Options     []ProductOption `json:"options"`
+	// Variants are ordered by SKU instead of the product when there are any
+	Variants []Variant      `json:"variants"`
+	Images   []ProductImage `json:"images"`
+	Rating   Rating         `json:"rating"`
+	Status   ProductStatus  `json:"status"`
+}
+
+// Published reports whether the product is listed and can be ordered.
+func (p Product) Published() bool {
+	return p.Status == StatusPublished
 }
 
 type ProductDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	// ProductID repeats the document ID in an indexed field, which searches sort
+	// by last. Sorting on _id itself is not allowed by newer clusters.
+	ProductID   string   `json:"product_id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price"`
+	AccountID   int      `json:"account_id"`
+	CategoryIDs []string `json:"category_ids,omitempty"`
+	// CategoryPaths are the paths of the categories joined with "/", so a
+	// category filter can match the products of its subcategories by prefix
+	CategoryPaths []string `json:"category_paths,omitempty"`
+	// CreatedAt is only set when the product is indexed, partial updates leave it out
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+	Options   []ProductOption `json:"options,omitempty"`
+	Variants  []Variant       `json:"variants,omitempty"`
+	Images    []ProductImage  `json:"images,omitempty"`
+	// Rating is kept up to date by the review service
+	Rating *Rating `json:"rating,omitempty"`
+	// Status is missing on products indexed before it was recorded, which are published
+	Status ProductStatus `json:"status,omitempty"`
 }
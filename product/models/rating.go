@@ -0,0 +1,8 @@
+package models
+
+// Rating sums up the published reviews of a product.
+type Rating struct {
+	// Average is the mean of the stars, from 1 to 5, or 0 without reviews
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
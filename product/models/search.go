@@ -0,0 +1,73 @@
+package models
+
+type ProductSort int
+
+const (
+	SortRelevance ProductSort = iota
+	SortPriceAsc
+	SortPriceDesc
+	SortNewest
+)
+
+// ProductSearch filters and orders a product listing. Zero values leave the
+// listing unfiltered.
+type ProductSearch struct {
+	Query string
+	// CategoryID limits the products to a category and its subcategories. The
+	// service resolves it into CategoryPath for the repository.
+	CategoryID   string
+	CategoryPath string
+	MinPrice     *float64
+	MaxPrice     *float64
+	AccountID    int
+	// ViewerID is the account searching. Its own drafts are listed along with
+	// the published products of everyone.
+	ViewerID int
+	Sort     ProductSort
+	// After is the cursor of a product from a previous page of the same search,
+	// the page starts after it and Skip is ignored
+	After string
+	Skip  uint64
+	Take  uint64
+}
+
+type SearchResult struct {
+	Products []*Product
+	// Cursors holds the cursor of each product, to continue the search after it
+	Cursors []string
+	// HasMore is set when more products follow the page
+	HasMore bool
+	// HasPrevious is set when matching products come before the page
+	HasPrevious bool
+	// Total is the number of products matching the search, not only the returned page
+	Total        int64
+	PriceBuckets []PriceBucket
+	Categories   []CategoryCount
+}
+
+// PriceBucket counts the matching products priced from From up to, but not
+// including, To. A nil bound is open.
+type PriceBucket struct {
+	From  *float64
+	To    *float64
+	Count int64
+}
+
+// CategoryCount counts the matching products assigned to a category.
+type CategoryCount struct {
+	CategoryID string
+	Count      int64
+}
+
+// ProductSuggestion is a product offered while a search is typed.
+type ProductSuggestion struct {
+	ProductID string
+	Name      string
+}
+
+type Suggestions struct {
+	Products []ProductSuggestion
+	// DidYouMean is the text with its misspelled words corrected, empty when
+	// nothing was corrected
+	DidYouMean string
+}
@@ -0,0 +1,31 @@
+package models
+
+// ProductOption is a way a product varies, such as size, with the values it
+// comes in.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Variant is a version of a product that can be ordered, with one value of each
+// of the product's options and its own price and stock.
+type Variant struct {
+	SKU     string          `json:"sku"`
+	Options []VariantOption `json:"options"`
+	Price   float64         `json:"price"`
+}
+
+type VariantOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Variant returns the variant of the product with the SKU, or nil if there is none.
+func (p *Product) Variant(sku string) *Variant {
+	for i := range p.Variants {
+		if p.Variants[i].SKU == sku {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// expectBulkPut saves the products of every bulk request, giving the created
+// ones an ID, and collects them. Products named in failing are rejected.
+func expectBulkPut(s *testService, failing ...string) *[]*models.Product {
+	var saved []*models.Product
+	save := func(products []*models.Product) []error {
+		errs := make([]error, len(products))
+		for i, product := range products {
+			if slices.Contains(failing, product.Name) {
+				errs[i] = errors.New("document rejected")
+				continue
+			}
+			if product.ID == "" {
+				product.ID = fmt.Sprintf("new-%d", len(saved)+1)
+			}
+			saved = append(saved, product)
+		}
+		return errs
+	}
+	s.repo.On("BulkPutProducts", mock.Anything, mock.Anything, mock.Anything).Return(save, nil)
+	return &saved
+}
+
+func TestProductService_ImportProducts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("CSV", func(t *testing.T) {
+		s := setupTestService(t)
+		saved := expectBulkPut(s)
+		s.repo.On("ListCategoriesWithIDs", mock.Anything, []string{"lighting", "desk"}).
+			Return([]*models.Category{
+				{ID: "lighting", Path: []string{"home", "lighting"}},
+				{ID: "desk", Path: []string{"office", "desk"}},
+			}, nil)
+
+		file := "Price,Name,Description,category_ids\n" +
+			"40,Lamp,A desk lamp,lighting; desk\n" +
+			"abc,Chair,,\n" +
+			"10, ,No name,\n" +
+			"-1,Table,,\n" +
+			"5,Pen,\"A pen, blue\",\n" +
+			"8,Shelf,,desk;desk\n" +
+			"9,\"Broken,\n"
+		result, err := s.ImportProducts(ctx, 7, models.FormatCSV, strings.NewReader(file))
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, result.Created)
+		assert.Zero(t, result.Updated)
+		assert.Equal(t, 5, result.Failed)
+		assert.Equal(t, []models.RowError{
+			{Line: 3, Message: `invalid price "abc"`},
+			{Line: 4, Message: "name must not be empty"},
+			{Line: 5, Message: "price must not be negative"},
+			{Line: 7, Message: "category desk is listed twice"},
+			{Line: 8, Message: `extraneous or missing " in quoted-field`},
+		}, result.Errors)
+
+		require.Len(t, *saved, 2)
+		lamp := (*saved)[0]
+		assert.Equal(t, "Lamp", lamp.Name)
+		assert.Equal(t, "A desk lamp", lamp.Description)
+		assert.Equal(t, 40.0, lamp.Price)
+		assert.Equal(t, 7, lamp.AccountID)
+		assert.Equal(t, []string{"lighting", "desk"}, lamp.CategoryIDs)
+		assert.Equal(t, models.StatusPublished, lamp.Status)
+		assert.Equal(t, "A pen, blue", (*saved)[1].Description)
+		s.repo.AssertCalled(t, "BulkPutProducts", mock.Anything, mock.Anything,
+			map[string]string{"lighting": "home/lighting", "desk": "office/desk"})
+
+		history, err := s.GetPriceHistory(ctx, "new-1", 0, 10)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, models.PriceImported, history[0].Reason)
+
+		for range 2 {
+			assert.Equal(t, "product_created", s.events.next(t, "product_events").Type)
+		}
+	})
+
+	t.Run("CSV header needs name and price", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.ImportProducts(ctx, 7, models.FormatCSV, strings.NewReader("id,name,description\n1,Lamp,\n"))
+		assert.ErrorIs(t, err, internal.ErrInvalidHeader)
+
+		result, err := s.ImportProducts(ctx, 7, models.FormatCSV, strings.NewReader(""))
+		require.NoError(t, err)
+		assert.Zero(t, result.Created)
+		s.repo.AssertNotCalled(t, "BulkPutProducts", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("JSONL", func(t *testing.T) {
+		s := setupTestService(t)
+		saved := expectBulkPut(s, "Rejected")
+
+		file := `{"name":"Lamp","description":"A desk lamp","price":40}` + "\n" +
+			"\n" +
+			`{"name":"Chair","price":"12"}` + "\n" +
+			`{"name":"Table","price":30,"colour":"red"}` + "\n" +
+			`not json` + "\n" +
+			`{"name":"","price":5}` + "\n" +
+			`{"name":"Rejected","price":5}` + "\n"
+		result, err := s.ImportProducts(ctx, 7, models.FormatJSONL, strings.NewReader(file))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, result.Created)
+		assert.Equal(t, 5, result.Failed)
+		lines := make([]int, 0, len(result.Errors))
+		for _, rowErr := range result.Errors {
+			lines = append(lines, rowErr.Line)
+		}
+		assert.Equal(t, []int{3, 4, 5, 6, 7}, lines)
+		assert.Contains(t, result.Errors[1].Message, `unknown field "colour"`)
+		assert.Equal(t, "name must not be empty", result.Errors[3].Message)
+		assert.Equal(t, "document rejected", result.Errors[4].Message)
+		require.Len(t, *saved, 1)
+		assert.Equal(t, "Lamp", (*saved)[0].Name)
+	})
+
+	t.Run("updates only products of the seller", func(t *testing.T) {
+		s := setupTestService(t)
+		saved := expectBulkPut(s)
+		own := createSampleProduct(models.StatusPublished)
+		other := createSampleProduct(models.StatusPublished)
+		other.ID = "product-2"
+		other.AccountID = 8
+		s.repo.On("ListProductsWithIDs", mock.Anything, []string{"product-1", "product-2", "missing"}).
+			Return([]*models.Product{own, other}, nil)
+
+		file := `{"id":"product-1","name":"Lamp","price":45}` + "\n" +
+			`{"id":"product-2","name":"Chair","price":10}` + "\n" +
+			`{"id":"missing","name":"Table","price":10}` + "\n" +
+			`{"name":"Pen","price":2,"category_ids":["unknown"]}` + "\n"
+		s.repo.On("ListCategoriesWithIDs", mock.Anything, []string{"unknown"}).Return([]*models.Category{}, nil)
+		result, err := s.ImportProducts(ctx, 7, models.FormatJSONL, strings.NewReader(file))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, result.Updated)
+		assert.Zero(t, result.Created)
+		assert.Equal(t, []models.RowError{
+			{Line: 2, Message: internal.ErrNotFound.Error()},
+			{Line: 3, Message: internal.ErrNotFound.Error()},
+			{Line: 4, Message: "category unknown not found"},
+		}, result.Errors)
+		require.Len(t, *saved, 1)
+		assert.Equal(t, "product-1", (*saved)[0].ID)
+
+		change := latestPriceChange(t, s, "product-1")
+		assert.Equal(t, 40.0, change.OldPrice)
+		assert.Equal(t, 45.0, change.NewPrice)
+		assert.Equal(t, "product_updated", s.events.next(t, "product_events").Type)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.ImportProducts(ctx, 7, models.BulkFormat(9), strings.NewReader(""))
+		assert.ErrorIs(t, err, internal.ErrUnknownFormat)
+	})
+}
+
+func TestProductService_ExportProducts(t *testing.T) {
+	ctx := context.Background()
+	lamp := createSampleProduct(models.StatusPublished)
+	lamp.Description = "A desk lamp, brass"
+	lamp.CategoryIDs = []string{"lighting", "desk"}
+	pen := &models.Product{ID: "product-2", Name: "Pen", Price: 2.5, AccountID: 7}
+
+	expectScroll := func(s *testService, products ...*models.Product) {
+		s.repo.On("ScrollProductsByAccount", mock.Anything, 7, mock.Anything).
+			Run(func(args mock.Arguments) {
+				fn := args.Get(2).(func(*models.Product) error)
+				for _, product := range products {
+					require.NoError(t, fn(product))
+				}
+			}).
+			Return(nil)
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		s := setupTestService(t)
+		expectScroll(s, lamp, pen)
+		var out bytes.Buffer
+		require.NoError(t, s.ExportProducts(ctx, 7, models.FormatCSV, &out))
+		assert.Equal(t, "id,name,description,price,category_ids\n"+
+			"product-1,Lamp,\"A desk lamp, brass\",40,lighting;desk\n"+
+			"product-2,Pen,,2.5,\n", out.String())
+	})
+
+	t.Run("empty CSV has a header", func(t *testing.T) {
+		s := setupTestService(t)
+		expectScroll(s)
+		var out bytes.Buffer
+		require.NoError(t, s.ExportProducts(ctx, 7, models.FormatCSV, &out))
+		assert.Equal(t, "id,name,description,price,category_ids\n", out.String())
+	})
+
+	t.Run("JSONL", func(t *testing.T) {
+		s := setupTestService(t)
+		expectScroll(s, lamp, pen)
+		var out bytes.Buffer
+		require.NoError(t, s.ExportProducts(ctx, 7, models.FormatJSONL, &out))
+		assert.Equal(t, `{"id":"product-1","name":"Lamp","description":"A desk lamp, brass","price":40,"category_ids":["lighting","desk"]}`+"\n"+
+			`{"id":"product-2","name":"Pen","description":"","price":2.5}`+"\n", out.String())
+	})
+
+	for _, format := range []models.BulkFormat{models.FormatCSV, models.FormatJSONL} {
+		t.Run(fmt.Sprintf("imports back as format %d", format), func(t *testing.T) {
+			s := setupTestService(t)
+			expectScroll(s, lamp, pen)
+			var out bytes.Buffer
+			require.NoError(t, s.ExportProducts(ctx, 7, format, &out))
+
+			s.repo.On("ListProductsWithIDs", mock.Anything, []string{"product-1", "product-2"}).
+				Return([]*models.Product{lamp, pen}, nil)
+			s.repo.On("ListCategoriesWithIDs", mock.Anything, []string{"lighting", "desk"}).
+				Return([]*models.Category{{ID: "lighting", Path: []string{"lighting"}}, {ID: "desk", Path: []string{"desk"}}}, nil)
+			saved := expectBulkPut(s)
+			result, err := s.ImportProducts(ctx, 7, format, &out)
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.Updated)
+			assert.Empty(t, result.Errors)
+			require.Len(t, *saved, 2)
+			assert.Equal(t, lamp.Description, (*saved)[0].Description)
+			assert.Equal(t, lamp.CategoryIDs, (*saved)[0].CategoryIDs)
+			assert.Equal(t, pen.Price, (*saved)[1].Price)
+		})
+	}
+}
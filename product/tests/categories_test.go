@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// categoryTree returns home > lighting > lamps and office as fresh copies, so
+// that the service can change them.
+func categoryTree() map[string]*models.Category {
+	return map[string]*models.Category{
+		"home":     {ID: "home", Name: "Home", Path: []string{"home"}},
+		"lighting": {ID: "lighting", Name: "Lighting", ParentID: "home", Path: []string{"home", "lighting"}},
+		"lamps":    {ID: "lamps", Name: "Lamps", ParentID: "lighting", Path: []string{"home", "lighting", "lamps"}},
+		"office":   {ID: "office", Name: "Office", Path: []string{"office"}},
+	}
+}
+
+func TestProductService_CreateCategory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("under a parent", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetCategory", ctx, "lighting").Return(tree["lighting"], nil)
+		s.repo.On("ListCategories", ctx, "lighting").Return([]*models.Category{tree["lamps"]}, nil)
+		s.repo.On("SaveCategories", ctx, mock.Anything).Return(nil)
+
+		category, err := s.CreateCategory(ctx, "  Desk lamps ", "lighting")
+		require.NoError(t, err)
+		assert.NotEmpty(t, category.ID)
+		assert.Equal(t, "Desk lamps", category.Name)
+		assert.Equal(t, "lighting", category.ParentID)
+		assert.Equal(t, []string{"home", "lighting", category.ID}, category.Path)
+		assert.Equal(t, []string{"home", "lighting"}, tree["lighting"].Path)
+		s.repo.AssertCalled(t, "SaveCategories", ctx, []*models.Category{category})
+	})
+
+	t.Run("at the root", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("ListCategories", ctx, "").Return([]*models.Category{}, nil)
+		s.repo.On("SaveCategories", ctx, mock.Anything).Return(nil)
+
+		category, err := s.CreateCategory(ctx, "Garden", "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{category.ID}, category.Path)
+		s.repo.AssertNotCalled(t, "GetCategory", mock.Anything, mock.Anything)
+	})
+
+	t.Run("name is required", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.CreateCategory(ctx, " ", "")
+		assert.ErrorIs(t, err, internal.ErrCategoryNameRequired)
+	})
+
+	t.Run("name is unique among siblings", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetCategory", ctx, "lighting").Return(tree["lighting"], nil)
+		s.repo.On("ListCategories", ctx, "lighting").Return([]*models.Category{tree["lamps"]}, nil)
+
+		_, err := s.CreateCategory(ctx, "LAMPS", "lighting")
+		assert.ErrorIs(t, err, internal.ErrCategoryExists)
+		s.repo.AssertNotCalled(t, "SaveCategories", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown parent", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetCategory", ctx, "missing").Return(nil, internal.ErrNotFound)
+		_, err := s.CreateCategory(ctx, "Lamps", "missing")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
+}
+
+func TestProductService_RenameCategory(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestService(t)
+	tree := categoryTree()
+	s.repo.On("GetCategory", ctx, "home").Return(tree["home"], nil)
+	s.repo.On("ListCategories", ctx, "").Return([]*models.Category{tree["home"], tree["office"]}, nil)
+	s.repo.On("SaveCategories", ctx, mock.Anything).Return(nil)
+
+	// A category may change the case of its own name
+	category, err := s.RenameCategory(ctx, "home", "HOME")
+	require.NoError(t, err)
+	assert.Equal(t, "HOME", category.Name)
+	assert.Equal(t, []string{"home"}, category.Path)
+
+	_, err = s.RenameCategory(ctx, "home", "office")
+	assert.ErrorIs(t, err, internal.ErrCategoryExists)
+	_, err = s.RenameCategory(ctx, "home", "")
+	assert.ErrorIs(t, err, internal.ErrCategoryNameRequired)
+	s.repo.AssertNumberOfCalls(t, "SaveCategories", 1)
+	s.repo.AssertNotCalled(t, "ListProductsInCategories", mock.Anything, mock.Anything)
+}
+
+func TestProductService_MoveCategory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rewrites the paths of the subtree and its products", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetCategory", ctx, "lighting").Return(tree["lighting"], nil)
+		s.repo.On("GetCategory", ctx, "office").Return(tree["office"], nil)
+		s.repo.On("ListCategories", ctx, "office").Return([]*models.Category{}, nil)
+		s.repo.On("ListCategorySubtree", ctx, "lighting").Return([]*models.Category{tree["lighting"], tree["lamps"]}, nil)
+		s.repo.On("SaveCategories", ctx, mock.Anything).Return(nil)
+
+		lamp := &models.Product{ID: "lamp", CategoryIDs: []string{"lamps", "office"}}
+		bulb := &models.Product{ID: "bulb", CategoryIDs: []string{"lighting"}}
+		s.repo.On("ListProductsInCategories", ctx, []string{"lighting", "lamps"}).Return([]*models.Product{lamp, bulb}, nil)
+		s.repo.On("ListCategoriesWithIDs", ctx, []string{"lamps", "office", "lighting"}).
+			Return([]*models.Category{tree["lamps"], tree["office"], tree["lighting"]}, nil)
+		s.repo.On("SetProductCategories", ctx, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		category, err := s.MoveCategory(ctx, "lighting", "office")
+		require.NoError(t, err)
+		assert.Equal(t, "office", category.ParentID)
+		assert.Equal(t, []string{"office", "lighting"}, category.Path)
+		assert.Equal(t, "lighting", tree["lamps"].ParentID)
+		assert.Equal(t, []string{"office", "lighting", "lamps"}, tree["lamps"].Path)
+		s.repo.AssertCalled(t, "SaveCategories", ctx, []*models.Category{tree["lighting"], tree["lamps"]})
+
+		s.repo.AssertCalled(t, "SetProductCategories", ctx, "lamp",
+			[]string{"lamps", "office"}, []string{"office/lighting/lamps", "office"})
+		s.repo.AssertCalled(t, "SetProductCategories", ctx, "bulb",
+			[]string{"lighting"}, []string{"office/lighting"})
+	})
+
+	t.Run("to the root", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetCategory", ctx, "lamps").Return(tree["lamps"], nil)
+		s.repo.On("ListCategories", ctx, "").Return([]*models.Category{tree["home"], tree["office"]}, nil)
+		s.repo.On("ListCategorySubtree", ctx, "lamps").Return([]*models.Category{tree["lamps"]}, nil)
+		s.repo.On("SaveCategories", ctx, mock.Anything).Return(nil)
+		s.repo.On("ListProductsInCategories", ctx, []string{"lamps"}).Return([]*models.Product{}, nil)
+		s.repo.On("ListCategoriesWithIDs", ctx, []string(nil)).Return([]*models.Category{}, nil)
+
+		category, err := s.MoveCategory(ctx, "lamps", "")
+		require.NoError(t, err)
+		assert.Empty(t, category.ParentID)
+		assert.Equal(t, []string{"lamps"}, category.Path)
+	})
+
+	cycles := []struct {
+		name, parentID string
+	}{
+		{"into itself", "home"},
+		{"into a subcategory", "lighting"},
+		{"into a nested subcategory", "lamps"},
+	}
+	for _, tt := range cycles {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupTestService(t)
+			tree := categoryTree()
+			s.repo.On("GetCategory", ctx, "home").Return(tree["home"], nil)
+			s.repo.On("GetCategory", ctx, tt.parentID).Return(tree[tt.parentID], nil)
+
+			_, err := s.MoveCategory(ctx, "home", tt.parentID)
+			assert.ErrorIs(t, err, internal.ErrCategoryCycle)
+			s.repo.AssertNotCalled(t, "SaveCategories", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("name is unique under the new parent", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetCategory", ctx, "lamps").Return(tree["lamps"], nil)
+		s.repo.On("GetCategory", ctx, "office").Return(tree["office"], nil)
+		s.repo.On("ListCategories", ctx, "office").Return([]*models.Category{{ID: "desk-lamps", Name: "lamps"}}, nil)
+
+		_, err := s.MoveCategory(ctx, "lamps", "office")
+		assert.ErrorIs(t, err, internal.ErrCategoryExists)
+		s.repo.AssertNotCalled(t, "SaveCategories", mock.Anything, mock.Anything)
+	})
+}
+
+func TestProductService_DeleteCategory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("with subcategories", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("ListCategories", ctx, "lighting").Return([]*models.Category{tree["lamps"]}, nil)
+
+		assert.ErrorIs(t, s.DeleteCategory(ctx, "lighting"), internal.ErrCategoryHasChildren)
+		s.repo.AssertNotCalled(t, "DeleteCategory", mock.Anything, mock.Anything)
+	})
+
+	t.Run("removes the category from its products", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("ListCategories", ctx, "lamps").Return([]*models.Category{}, nil)
+		s.repo.On("DeleteCategory", ctx, "lamps").Return(nil)
+		lamp := &models.Product{ID: "lamp", CategoryIDs: []string{"lamps", "office"}}
+		s.repo.On("ListProductsInCategories", ctx, []string{"lamps"}).Return([]*models.Product{lamp}, nil)
+		// The deleted category is no longer found
+		s.repo.On("ListCategoriesWithIDs", ctx, []string{"lamps", "office"}).Return([]*models.Category{tree["office"]}, nil)
+		s.repo.On("SetProductCategories", ctx, "lamp", []string{"office"}, []string{"office"}).Return(nil)
+
+		require.NoError(t, s.DeleteCategory(ctx, "lamps"))
+		s.repo.AssertExpectations(t)
+	})
+}
+
+func TestProductService_SetProductCategories(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("indexes the category paths", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+		s.repo.On("ListCategoriesWithIDs", ctx, []string{"lamps", "office"}).
+			Return([]*models.Category{tree["lamps"], tree["office"]}, nil)
+		s.repo.On("SetProductCategories", ctx, "product-1", []string{"lamps", "office"},
+			[]string{"home/lighting/lamps", "office"}).Return(nil)
+
+		product, err := s.SetProductCategories(ctx, "product-1", []string{"lamps", "office", "lamps"}, 7)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"lamps", "office"}, product.CategoryIDs)
+		s.repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown category", func(t *testing.T) {
+		s := setupTestService(t)
+		tree := categoryTree()
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+		s.repo.On("ListCategoriesWithIDs", ctx, []string{"lamps", "missing"}).
+			Return([]*models.Category{tree["lamps"]}, nil)
+
+		_, err := s.SetProductCategories(ctx, "product-1", []string{"lamps", "missing"}, 7)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		s.repo.AssertNotCalled(t, "SetProductCategories", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("clearing the categories", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+		s.repo.On("ListCategoriesWithIDs", ctx, []string(nil)).Return([]*models.Category{}, nil)
+		s.repo.On("SetProductCategories", ctx, "product-1", []string(nil), []string{}).Return(nil)
+
+		product, err := s.SetProductCategories(ctx, "product-1", nil, 7)
+		require.NoError(t, err)
+		assert.Empty(t, product.CategoryIDs)
+	})
+}
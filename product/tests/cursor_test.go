@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchResultWithSort is a search result of one product with its sort values.
+func searchResultWithSort(sort string) string {
+	return `{"hits":{"total":{"value":5},"hits":[{"_id":"a","_source":{"name":"Lamp"},"sort":` + sort + `}]}}`
+}
+
+func rawCursor(json string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(json))
+}
+
+func TestElasticRepository_SearchProducts_Cursor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		sort   models.ProductSort
+		values string
+		before string
+	}{
+		{"relevance", models.SortRelevance, `[1.5,"a"]`, `[{"_score":{"order":"asc"}},{"product_id":{"order":"desc"}}]`},
+		{"price ascending", models.SortPriceAsc, `[40,"a"]`, `[{"price":{"order":"desc"}},{"product_id":{"order":"desc"}}]`},
+		{"price descending", models.SortPriceDesc, `[40,"a"]`, `[{"price":{"order":"asc"}},{"product_id":{"order":"desc"}}]`},
+		// Dates are longs, which must not lose digits on the way
+		{"newest", models.SortNewest, `[1735689600123456789,"a"]`, `[{"created_at":{"missing":"_first","order":"asc"}},{"product_id":{"order":"desc"}}]`},
+		{"newest without date", models.SortNewest, `[-9223372036854775808,"a"]`, `[{"created_at":{"missing":"_first","order":"asc"}},{"product_id":{"order":"desc"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newFakeElasticsearch(t, "8.13.0")
+			repo := setupElasticRepository(t, es)
+			es.respond("POST", "/catalog/_search", searchResultWithSort(tt.values))
+
+			first, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: tt.sort, Take: 1})
+			require.NoError(t, err)
+			require.Len(t, first.Cursors, 1)
+			assert.False(t, first.HasPrevious)
+
+			es.reset()
+			// The page after the cursor, then the product before it
+			es.respond("POST", "/catalog/_search", emptySearchResult, searchResultWithSort(tt.values))
+			next, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: tt.sort, Take: 1, After: first.Cursors[0], Skip: 30})
+			require.NoError(t, err)
+			assert.True(t, next.HasPrevious)
+
+			requests := es.received("POST", "/catalog/_search")
+			require.Len(t, requests, 2)
+			assert.Contains(t, requests[0].Body, `"search_after":`+tt.values)
+			page := requests[0].decode(t)
+			assert.NotContains(t, page, "from")
+
+			assert.Contains(t, requests[1].Body, `"search_after":`+tt.values)
+			before := requests[1].decode(t)
+			assertJSON(t, tt.before, before["sort"])
+			assert.Equal(t, 1.0, before["size"])
+			assert.Equal(t, false, before["_source"])
+			// Filters are part of the query, which scores like the page
+			assertJSON(t, `{"bool":{
+				"must":`+mustJSON(t, page["query"])+`,
+				"filter":[{"match_all":{}},{"match_all":{}}]}}`, before["query"])
+		})
+	}
+
+	t.Run("first product has nothing before it", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", searchResultWithSort(`[40,"a"]`), emptySearchResult)
+
+		first, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: models.SortPriceAsc, Take: 1})
+		require.NoError(t, err)
+		next, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: models.SortPriceAsc, Take: 1, After: first.Cursors[0]})
+		require.NoError(t, err)
+		assert.False(t, next.HasPrevious)
+	})
+
+	t.Run("offset pages", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", searchResultWithSort(`[40,"a"]`))
+
+		result, err := repo.SearchProducts(ctx, models.ProductSearch{Skip: 10, Take: 1})
+		require.NoError(t, err)
+		assert.True(t, result.HasPrevious)
+		assert.Len(t, es.received("POST", "/catalog/_search"), 1)
+	})
+}
+
+// mustJSON encodes a decoded part of a request body back to JSON.
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestElasticRepository_SearchProducts_InvalidCursor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		sort   models.ProductSort
+		cursor string
+	}{
+		{"not base64", models.SortPriceAsc, "not a cursor!"},
+		{"padded base64", models.SortPriceAsc, base64.URLEncoding.EncodeToString([]byte(`{"s":1,"a":[40,"a"]}`))},
+		{"not JSON", models.SortPriceAsc, rawCursor(`price 40`)},
+		{"not an object", models.SortPriceAsc, rawCursor(`[40,"a"]`)},
+		{"other sort", models.SortPriceDesc, rawCursor(`{"s":1,"a":[40,"a"]}`)},
+		{"no sort", models.SortPriceAsc, rawCursor(`{"a":[40,"a"]}`)},
+		{"no values", models.SortPriceAsc, rawCursor(`{"s":1}`)},
+		{"values not a list", models.SortPriceAsc, rawCursor(`{"s":1,"a":{"price":40}}`)},
+		{"empty values", models.SortPriceAsc, rawCursor(`{"s":1,"a":[]}`)},
+		{"too few values", models.SortPriceAsc, rawCursor(`{"s":1,"a":[40]}`)},
+		{"too many values", models.SortPriceAsc, rawCursor(`{"s":1,"a":[40,"a","b"]}`)},
+		{"null value", models.SortPriceAsc, rawCursor(`{"s":1,"a":[null,"a"]}`)},
+		{"boolean value", models.SortPriceAsc, rawCursor(`{"s":1,"a":[true,"a"]}`)},
+		{"object value", models.SortPriceAsc, rawCursor(`{"s":1,"a":[40,{"id":"a"}]}`)},
+		{"list value", models.SortPriceAsc, rawCursor(`{"s":1,"a":[40,["a"]]}`)},
+	}
+	es := newFakeElasticsearch(t, "8.13.0")
+	repo := setupElasticRepository(t, es)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: tt.sort, Take: 10, After: tt.cursor})
+			assert.ErrorIs(t, err, internal.ErrInvalidCursor)
+		})
+	}
+	assert.Empty(t, es.received("POST", "/catalog/_search"), "invalid cursors are not searched")
+
+	t.Run("valid", func(t *testing.T) {
+		es.respond("POST", "/catalog/_search", emptySearchResult)
+		_, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: models.SortPriceAsc, Take: 10, After: rawCursor(`{"s":1,"a":[40,"a"]}`)})
+		assert.NoError(t, err)
+	})
+}
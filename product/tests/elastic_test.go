@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/stretchr/testify/require"
+)
+
+// esRequest is a request received by the fake Elasticsearch.
+type esRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// decode unmarshals the JSON body of the request.
+func (r esRequest) decode(t *testing.T) map[string]interface{} {
+	t.Helper()
+	body := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(r.Body), &body), r.Body)
+	return body
+}
+
+type esResponse struct {
+	Status int
+	Body   string
+}
+
+// fakeElasticsearch answers the requests of the repository with canned
+// responses and records them. Every index is served behind its alias as
+// ALIAS_v1 unless aliases says otherwise.
+type fakeElasticsearch struct {
+	*httptest.Server
+	version      string
+	distribution string
+
+	mu        sync.Mutex
+	requests  []esRequest
+	responses map[string][]esResponse
+	aliases   map[string]string
+	indices   map[string]bool
+}
+
+func newFakeElasticsearch(t *testing.T, version string) *fakeElasticsearch {
+	es := &fakeElasticsearch{
+		version:   version,
+		responses: map[string][]esResponse{},
+		aliases:   map[string]string{},
+		indices:   map[string]bool{},
+	}
+	es.Server = httptest.NewServer(http.HandlerFunc(es.serve))
+	t.Cleanup(es.Close)
+	return es
+}
+
+// respond queues responses to the requests with the method and path, which are
+// answered in order. The last one keeps answering.
+func (es *fakeElasticsearch) respond(method, path string, bodies ...string) {
+	for _, body := range bodies {
+		es.respondStatus(method, path, http.StatusOK, body)
+	}
+}
+
+// respondStatus queues a response with a status other than OK.
+func (es *fakeElasticsearch) respondStatus(method, path string, status int, body string) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.responses[method+" "+path] = append(es.responses[method+" "+path], esResponse{status, body})
+}
+
+// received returns the requests with the method and path, in order.
+func (es *fakeElasticsearch) received(method, path string) []esRequest {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	var requests []esRequest
+	for _, r := range es.requests {
+		if r.Method == method && r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// reset forgets the requests received and the responses queued so far.
+func (es *fakeElasticsearch) reset() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.requests = nil
+	es.responses = map[string][]esResponse{}
+}
+
+func (es *fakeElasticsearch) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.requests = append(es.requests, esRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: string(body)})
+
+	w.Header().Set("Content-Type", "application/json")
+	key := r.Method + " " + r.URL.Path
+	if queued := es.responses[key]; len(queued) > 0 {
+		response := queued[0]
+		if len(queued) > 1 {
+			es.responses[key] = queued[1:]
+		}
+		w.WriteHeader(response.Status)
+		io.WriteString(w, response.Body)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		info := map[string]interface{}{"version": map[string]string{"number": es.version, "distribution": es.distribution}}
+		json.NewEncoder(w).Encode(info)
+	case strings.HasPrefix(r.URL.Path, "/_alias/"):
+		alias := strings.TrimPrefix(r.URL.Path, "/_alias/")
+		index, ok := es.aliases[alias]
+		if !ok {
+			index = alias + "_v1"
+		}
+		if index == "" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{index: map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}}})
+	case strings.HasPrefix(r.URL.Path, "/_cat/"):
+		io.WriteString(w, `[]`)
+	case r.Method == http.MethodHead:
+		if !es.indices[strings.TrimPrefix(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	default:
+		io.WriteString(w, `{}`)
+	}
+}
+
+// setupElasticRepository connects a repository to the fake Elasticsearch.
+func setupElasticRepository(t *testing.T, es *fakeElasticsearch) internal.Repository {
+	repo, err := internal.NewElasticRepository(es.URL)
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+	es.reset()
+	return repo
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// calls lists the requests received by the fake Elasticsearch as "METHOD
+// path", leaving out the ones checking the cluster.
+func (es *fakeElasticsearch) calls() []string {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	var calls []string
+	for _, r := range es.requests {
+		if r.Path != "/" {
+			calls = append(calls, r.Method+" "+r.Path)
+		}
+	}
+	return calls
+}
+
+// respondCopies answers the reindex tasks started by copies, in order, with the
+// number of documents each copied.
+func (es *fakeElasticsearch) respondCopies(copied ...string) {
+	for i, count := range copied {
+		task := "node:" + strconv.Itoa(i+1)
+		es.respond(http.MethodPost, "/_reindex", `{"task":"`+task+`"}`)
+		es.respond(http.MethodGet, "/_tasks/"+task, `{"completed":true,"response":{"created":`+count+`,"updated":0,"failures":[]}}`)
+	}
+}
+
+func TestNewElasticRepository_Indices(t *testing.T) {
+	t.Run("new cluster", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.aliases["catalog"] = ""
+		es.aliases["categories"] = ""
+
+		repo, err := internal.NewElasticRepository(es.URL)
+		require.NoError(t, err)
+		defer repo.Close()
+
+		assert.Equal(t, []string{
+			"GET /_alias/catalog",
+			"HEAD /catalog",
+			"PUT /catalog_v1",
+			"POST /_aliases",
+			"GET /_alias/categories",
+			"HEAD /categories",
+			"PUT /categories_v1",
+			"POST /_aliases",
+		}, es.calls())
+
+		created := es.received(http.MethodPut, "/catalog_v1")[0].decode(t)
+		assert.Equal(t, false, created["mappings"].(map[string]interface{})["dynamic"])
+		assertJSON(t, `{"type":"keyword"}`, created["mappings"].(map[string]interface{})["properties"].(map[string]interface{})["product_id"])
+		assert.Contains(t, created["settings"].(map[string]interface{})["analysis"].(map[string]interface{})["analyzer"], "product_text")
+		assertJSON(t, `{"actions":[{"add":{"alias":"catalog","index":"catalog_v1"}}]}`, es.received(http.MethodPost, "/_aliases")[0].decode(t))
+	})
+
+	t.Run("mapping types on Elasticsearch 6", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "6.8.0")
+		es.aliases["categories"] = ""
+
+		repo, err := internal.NewElasticRepository(es.URL)
+		require.NoError(t, err)
+		defer repo.Close()
+
+		created := es.received(http.MethodPut, "/categories_v1")[0].decode(t)
+		assert.Contains(t, created["mappings"], "category")
+		mappings := es.received(http.MethodPut, "/catalog/_mapping/product")
+		require.Len(t, mappings, 1)
+		assert.Contains(t, mappings[0].decode(t), "product")
+	})
+
+	t.Run("existing index gets new fields and fills the ID field", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+
+		repo, err := internal.NewElasticRepository(es.URL)
+		require.NoError(t, err)
+		defer repo.Close()
+
+		assert.Empty(t, es.received(http.MethodPut, "/catalog_v1"))
+		mapping := es.received(http.MethodPut, "/catalog/_mapping")[0].decode(t)
+		assert.Contains(t, mapping["properties"], "product_id")
+
+		fill := es.received(http.MethodPost, "/catalog/_update_by_query")[0]
+		assert.Equal(t, "conflicts=proceed&wait_for_completion=false", fill.Query)
+		body := fill.decode(t)
+		assertJSON(t, `{"bool":{"must_not":{"exists":{"field":"product_id"}}}}`, body["query"])
+		assertJSON(t, `{"lang":"painless","params":{"field":"product_id"},"source":"ctx._source[params.field] = ctx._id"}`, body["script"])
+	})
+
+	t.Run("a rejected mapping is left for a reindex", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.respondStatus(http.MethodPut, "/catalog/_mapping", http.StatusBadRequest, `{"error":{"type":"illegal_argument_exception"}}`)
+
+		repo, err := internal.NewElasticRepository(es.URL)
+		require.NoError(t, err)
+		defer repo.Close()
+		assert.Empty(t, es.received(http.MethodPost, "/catalog/_update_by_query"))
+	})
+}
+
+func TestReindex(t *testing.T) {
+	ctx := context.Background()
+
+	for _, deleteOld := range []bool{false, true} {
+		name := "keeps the old index"
+		if deleteOld {
+			name = "deletes the old index"
+		}
+		t.Run("versioned index "+name, func(t *testing.T) {
+			es := newFakeElasticsearch(t, "8.13.0")
+			es.aliases["catalog"] = "catalog_v2"
+			es.respond(http.MethodGet, "/_cat/indices/catalog_v*", `[{"index":"catalog_v1"},{"index":"catalog_v2"}]`)
+			es.respondCopies("5", "1")
+
+			result, err := internal.Reindex(ctx, es.URL, "catalog", deleteOld)
+			require.NoError(t, err)
+			assert.Equal(t, &internal.ReindexResult{Old: "catalog_v2", New: "catalog_v3", Copied: 5}, result)
+
+			expected := []string{
+				"GET /_alias/catalog",
+				"GET /_cat/indices/catalog_v*",
+				"PUT /catalog_v3",
+				"POST /catalog_v2/_refresh",
+				"POST /_reindex",
+				"GET /_tasks/node:1",
+				"POST /_aliases",
+				// Writes made to the old index during the copy
+				"POST /catalog_v2/_refresh",
+				"POST /_reindex",
+				"GET /_tasks/node:2",
+			}
+			if deleteOld {
+				expected = append(expected, "DELETE /catalog_v2")
+			}
+			assert.Equal(t, expected, es.calls())
+
+			copies := es.received(http.MethodPost, "/_reindex")
+			for _, copy := range copies {
+				assert.Equal(t, "wait_for_completion=false", copy.Query)
+				assertJSON(t, `{"conflicts":"proceed","source":{"index":"catalog_v2"},"dest":{"index":"catalog_v3","version_type":"external"}}`, copy.decode(t))
+			}
+			assertJSON(t, `{"actions":[
+				{"remove":{"alias":"catalog","index":"catalog_v2"}},
+				{"add":{"alias":"catalog","index":"catalog_v3"}}]}`, es.received(http.MethodPost, "/_aliases")[0].decode(t))
+		})
+	}
+
+	t.Run("legacy index is kept in version 0", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.aliases["catalog"] = ""
+		es.indices["catalog"] = true
+		es.respondStatus(http.MethodGet, "/_cat/indices/catalog_v*", http.StatusNotFound, `{}`)
+		es.respond(http.MethodGet, "/catalog", `{"catalog":{
+			"mappings":{"properties":{"name":{"type":"text"}}},
+			"settings":{"index":{"number_of_shards":"5","analysis":{"analyzer":{"product_text":{"type":"custom"}}}}}}}`)
+		es.respondCopies("5", "5", "1", "1")
+
+		result, err := internal.Reindex(ctx, es.URL, "catalog", false)
+		require.NoError(t, err)
+		assert.Equal(t, &internal.ReindexResult{Old: "catalog", New: "catalog_v1", Copied: 5, Kept: "catalog_v0"}, result)
+
+		assert.Equal(t, []string{
+			"GET /_alias/catalog",
+			"HEAD /catalog",
+			"GET /_cat/indices/catalog_v*",
+			"PUT /catalog_v1",
+			"POST /catalog/_refresh",
+			"POST /_reindex",
+			"GET /_tasks/node:1",
+			"HEAD /catalog_v0",
+			"GET /catalog",
+			"PUT /catalog_v0",
+			"POST /catalog/_refresh",
+			"POST /_reindex",
+			"GET /_tasks/node:2",
+			"PUT /catalog/_settings",
+			"POST /catalog/_refresh",
+			"POST /_reindex",
+			"GET /_tasks/node:3",
+			"POST /catalog/_refresh",
+			"POST /_reindex",
+			"GET /_tasks/node:4",
+			"POST /_aliases",
+		}, es.calls())
+
+		// Version 0 is the old index as it was, with its own mapping
+		assertJSON(t, `{"mappings":{"properties":{"name":{"type":"text"}}},
+			"settings":{"analysis":{"analyzer":{"product_text":{"type":"custom"}}}}}`,
+			es.received(http.MethodPut, "/catalog_v0")[0].decode(t))
+		dests := []string{}
+		for _, copy := range es.received(http.MethodPost, "/_reindex") {
+			dests = append(dests, copy.decode(t)["dest"].(map[string]interface{})["index"].(string))
+		}
+		assert.Equal(t, []string{"catalog_v1", "catalog_v0", "catalog_v1", "catalog_v0"}, dests)
+		assertJSON(t, `{"index.blocks.write":true}`, es.received(http.MethodPut, "/catalog/_settings")[0].decode(t))
+		assertJSON(t, `{"actions":[
+			{"remove_index":{"index":"catalog"}},
+			{"add":{"alias":"catalog","index":"catalog_v1"}}]}`, es.received(http.MethodPost, "/_aliases")[0].decode(t))
+	})
+
+	t.Run("legacy index is deleted", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.aliases["catalog"] = ""
+		es.indices["catalog"] = true
+		es.respondCopies("5", "1")
+
+		result, err := internal.Reindex(ctx, es.URL, "catalog", true)
+		require.NoError(t, err)
+		assert.Empty(t, result.Kept)
+		assert.Empty(t, es.received(http.MethodPut, "/catalog_v0"))
+		assert.Len(t, es.received(http.MethodPost, "/_reindex"), 2)
+		assert.Len(t, es.received(http.MethodPut, "/catalog/_settings"), 1)
+	})
+
+	t.Run("writes are unblocked when the swap fails", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.aliases["catalog"] = ""
+		es.indices["catalog"] = true
+		es.respondCopies("5", "1")
+		es.respondStatus(http.MethodPost, "/_aliases", http.StatusInternalServerError, `{"error":{"type":"exception"}}`)
+
+		_, err := internal.Reindex(ctx, es.URL, "catalog", true)
+		assert.Error(t, err)
+		blocks := es.received(http.MethodPut, "/catalog/_settings")
+		require.Len(t, blocks, 2)
+		assertJSON(t, `{"index.blocks.write":true}`, blocks[0].decode(t))
+		assertJSON(t, `{"index.blocks.write":false}`, blocks[1].decode(t))
+	})
+
+	t.Run("failed copies stop the reindex", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		es.respond(http.MethodPost, "/_reindex", `{"task":"node:1"}`)
+		es.respond(http.MethodGet, "/_tasks/node:1", `{"completed":true,"response":{"created":4,"failures":[{"id":"a","cause":{"type":"mapper_parsing_exception"}}]}}`)
+
+		_, err := internal.Reindex(ctx, es.URL, "catalog", false)
+		assert.ErrorContains(t, err, "1 documents could not be copied")
+		assert.Empty(t, es.received(http.MethodPost, "/_aliases"))
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		_, err := internal.Reindex(ctx, es.URL, "orders", false)
+		assert.ErrorContains(t, err, `unknown index "orders"`)
+
+		es.aliases["catalog"] = ""
+		_, err = internal.Reindex(ctx, es.URL, "catalog", false)
+		assert.ErrorContains(t, err, "index catalog does not exist")
+
+		es.respond(http.MethodGet, "/_alias/categories", `{"categories_v1":{},"categories_v2":{}}`)
+		_, err = internal.Reindex(ctx, es.URL, "categories", false)
+		assert.ErrorContains(t, err, "alias categories points at several indices: categories_v1, categories_v2")
+	})
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertStock checks the quantities of the stock of a product or variant.
+func assertStock(t *testing.T, s *testService, productID, sku string, onHand, reserved int) {
+	t.Helper()
+	stock, err := s.GetStock(context.Background(), []string{productID})
+	require.NoError(t, err)
+	for _, productStock := range stock {
+		if productStock.SKU == sku {
+			assert.Equal(t, onHand, productStock.OnHand, "on hand")
+			assert.Equal(t, reserved, productStock.Reserved, "reserved")
+			return
+		}
+	}
+	t.Fatalf("no stock for %s %s", productID, sku)
+}
+
+// expireReservation moves the expiry of a reservation into the past.
+func expireReservation(t *testing.T, s *testService, id string) {
+	t.Helper()
+	err := s.db.Model(&models.Reservation{}).
+		Where("id = ?", id).
+		Update("expires_at", time.Now().UTC().Add(-time.Minute)).Error
+	require.NoError(t, err)
+}
+
+func TestProductService_ReserveStock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds tracked stock", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.inventory.SetStock(ctx, "lamp", "", 5)
+		require.NoError(t, err)
+
+		reservation, err := s.ReserveStock(ctx, []models.ReservationItem{
+			{ProductID: "lamp", Quantity: 2},
+			{ProductID: "untracked", Quantity: 9},
+			{ProductID: "lamp", Quantity: 1},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.ReservationPending, reservation.Status)
+		assert.WithinDuration(t, time.Now().Add(30*time.Minute), reservation.ExpiresAt, time.Minute)
+		require.Len(t, reservation.Items, 2)
+		assert.Equal(t, 3, reservation.Items[0].Quantity)
+		assert.True(t, reservation.Items[0].Held)
+		assert.False(t, reservation.Items[1].Held)
+		assertStock(t, s, "lamp", "", 5, 3)
+	})
+
+	t.Run("holds nothing without enough stock", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.inventory.SetStock(ctx, "lamp", "", 5)
+		require.NoError(t, err)
+		_, err = s.inventory.SetStock(ctx, "shirt", "M", 1)
+		require.NoError(t, err)
+
+		_, err = s.ReserveStock(ctx, []models.ReservationItem{
+			{ProductID: "lamp", Quantity: 2},
+			{ProductID: "shirt", SKU: "M", Quantity: 2},
+		})
+		assert.ErrorIs(t, err, internal.ErrInsufficientStock)
+		assertStock(t, s, "lamp", "", 5, 0)
+		assertStock(t, s, "shirt", "M", 1, 0)
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.ReserveStock(ctx, nil)
+		assert.ErrorIs(t, err, internal.ErrInvalidReservation)
+		_, err = s.ReserveStock(ctx, []models.ReservationItem{{ProductID: "lamp", Quantity: 0}})
+		assert.ErrorIs(t, err, internal.ErrInvalidReservation)
+	})
+
+	t.Run("stock cannot go below what is reserved", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.inventory.SetStock(ctx, "lamp", "", 5)
+		require.NoError(t, err)
+		_, err = s.ReserveStock(ctx, []models.ReservationItem{{ProductID: "lamp", Quantity: 3}})
+		require.NoError(t, err)
+
+		_, err = s.inventory.SetStock(ctx, "lamp", "", 2)
+		assert.ErrorIs(t, err, internal.ErrStockBelowReserved)
+	})
+}
+
+func TestProductService_SettleReservation(t *testing.T) {
+	ctx := context.Background()
+
+	reserve := func(t *testing.T) (*testService, string) {
+		s := setupTestService(t)
+		_, err := s.inventory.SetStock(ctx, "lamp", "", 5)
+		require.NoError(t, err)
+		reservation, err := s.ReserveStock(ctx, []models.ReservationItem{{ProductID: "lamp", Quantity: 2}})
+		require.NoError(t, err)
+		return s, reservation.ID
+	}
+
+	t.Run("commit takes stock", func(t *testing.T) {
+		s, id := reserve(t)
+		require.NoError(t, s.CommitReservation(ctx, id))
+		assertStock(t, s, "lamp", "", 3, 0)
+
+		require.NoError(t, s.CommitReservation(ctx, id))
+		assertStock(t, s, "lamp", "", 3, 0)
+		assert.ErrorIs(t, s.ReleaseReservation(ctx, id), internal.ErrReservationCommitted)
+	})
+
+	t.Run("release returns stock", func(t *testing.T) {
+		s, id := reserve(t)
+		require.NoError(t, s.ReleaseReservation(ctx, id))
+		assertStock(t, s, "lamp", "", 5, 0)
+
+		require.NoError(t, s.ReleaseReservation(ctx, id))
+		assert.ErrorIs(t, s.CommitReservation(ctx, id), internal.ErrReservationReleased)
+		assert.ErrorIs(t, s.RestockReservation(ctx, id), internal.ErrReservationReleased)
+	})
+
+	t.Run("restock puts committed stock back", func(t *testing.T) {
+		s, id := reserve(t)
+		assert.ErrorIs(t, s.RestockReservation(ctx, id), internal.ErrReservationPending)
+
+		require.NoError(t, s.CommitReservation(ctx, id))
+		require.NoError(t, s.RestockReservation(ctx, id))
+		assertStock(t, s, "lamp", "", 5, 0)
+
+		require.NoError(t, s.RestockReservation(ctx, id))
+		assertStock(t, s, "lamp", "", 5, 0)
+		assert.ErrorIs(t, s.CommitReservation(ctx, id), internal.ErrReservationRestocked)
+	})
+
+	t.Run("unknown reservation", func(t *testing.T) {
+		s := setupTestService(t)
+		assert.ErrorIs(t, s.CommitReservation(ctx, "missing"), internal.ErrReservationNotFound)
+	})
+}
+
+func TestProductService_ReleaseExpiredReservations(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestService(t)
+	_, err := s.inventory.SetStock(ctx, "lamp", "", 10)
+	require.NoError(t, err)
+
+	var ids []string
+	for range 4 {
+		reservation, err := s.ReserveStock(ctx, []models.ReservationItem{{ProductID: "lamp", Quantity: 2}})
+		require.NoError(t, err)
+		ids = append(ids, reservation.ID)
+	}
+	expired, paid, current, released := ids[0], ids[1], ids[2], ids[3]
+	require.NoError(t, s.CommitReservation(ctx, paid))
+	require.NoError(t, s.ReleaseReservation(ctx, released))
+	for _, id := range []string{expired, paid, released} {
+		expireReservation(t, s, id)
+	}
+	assertStock(t, s, "lamp", "", 8, 4)
+
+	count, err := s.ReleaseExpiredReservations(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assertStock(t, s, "lamp", "", 8, 2)
+
+	// The reservation that has not expired still holds its stock
+	assert.NoError(t, s.CommitReservation(ctx, current))
+	assert.ErrorIs(t, s.CommitReservation(ctx, expired), internal.ErrReservationReleased)
+
+	count, err = s.ReleaseExpiredReservations(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticRepository_PutProduct(t *testing.T) {
+	ctx := context.Background()
+	es := newFakeElasticsearch(t, "8.13.0")
+	repo := setupElasticRepository(t, es)
+
+	product := &models.Product{
+		Name:      "Lamp",
+		Price:     40,
+		AccountID: 7,
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:    models.StatusDraft,
+	}
+	require.NoError(t, repo.PutProduct(ctx, product))
+	require.NotEmpty(t, product.ID)
+
+	requests := es.received(http.MethodPut, "/catalog/_doc/"+product.ID)
+	require.Len(t, requests, 1)
+	body := requests[0].decode(t)
+	assert.Equal(t, product.ID, body["product_id"])
+	assert.Equal(t, 7.0, body["account_id"])
+	assert.Equal(t, "draft", body["status"])
+	assert.Equal(t, "2025-01-01T00:00:00Z", body["created_at"])
+}
+
+func TestElasticRepository_ListProductsByAccount(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		viewerID int
+		visible  string
+	}{
+		{"shopper sees published products", 0,
+			`{"bool":{"must_not":{"terms":{"status":["draft","archived"]}}}}`},
+		{"seller sees its drafts", 7,
+			`{"bool":{"minimum_should_match":"1","should":[
+				{"bool":{"must_not":{"terms":{"status":["draft","archived"]}}}},
+				{"term":{"account_id":7}}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newFakeElasticsearch(t, "8.13.0")
+			repo := setupElasticRepository(t, es)
+			es.respond(http.MethodPost, "/catalog/_search", `{"hits":{"total":{"value":1},"hits":[
+				{"_id":"a","_source":{"name":"Lamp","price":40,"account_id":7}}]}}`)
+
+			products, err := repo.ListProductsByAccount(ctx, 7, tt.viewerID, 20, 10)
+			require.NoError(t, err)
+			require.Len(t, products, 1)
+			assert.Equal(t, 7, products[0].AccountID)
+			// Products indexed before the lifecycle are published
+			assert.Equal(t, models.StatusPublished, products[0].Status)
+
+			body := es.received(http.MethodPost, "/catalog/_search")[0].decode(t)
+			assertJSON(t, `{"bool":{"filter":[{"term":{"account_id":7}},`+tt.visible+`]}}`, body["query"])
+			assert.Equal(t, 20.0, body["from"])
+			assert.Equal(t, 10.0, body["size"])
+		})
+	}
+}
+
+func TestProductService_Ownership(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("seller catalogs are paged", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("ListProductsByAccount", ctx, 7, 0, uint64(0), uint64(100)).Return([]*models.Product{}, nil).Once()
+		s.repo.On("ListProductsByAccount", ctx, 7, 7, uint64(30), uint64(100)).Return([]*models.Product{}, nil).Once()
+		s.repo.On("ListProductsByAccount", ctx, 7, 7, uint64(30), uint64(10)).Return([]*models.Product{}, nil).Once()
+
+		_, err := s.ListProductsByAccount(ctx, 7, 0, 0, 0)
+		require.NoError(t, err)
+		_, err = s.ListProductsByAccount(ctx, 7, 7, 30, 1000)
+		require.NoError(t, err)
+		_, err = s.ListProductsByAccount(ctx, 7, 7, 30, 10)
+		require.NoError(t, err)
+		s.repo.AssertExpectations(t)
+	})
+
+	t.Run("products are created for the seller", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("PutProduct", ctx, mock.MatchedBy(func(p *models.Product) bool {
+			return p.AccountID == 7
+		})).Return(nil).Once()
+
+		product, err := s.PostProduct(ctx, "Lamp", "", 40, "", 7)
+		require.NoError(t, err)
+		assert.Equal(t, 7, product.AccountID)
+		event := s.events.next(t, "product_events")
+		assert.Equal(t, 7, *event.Data.AccountID)
+	})
+
+	changes := []struct {
+		name   string
+		change func(s *testService) error
+		method string
+	}{
+		{"update", func(s *testService) error {
+			_, err := s.UpdateProduct(ctx, "product-1", "Chair", "", 10, 8)
+			return err
+		}, "UpdateProduct"},
+		{"delete", func(s *testService) error {
+			return s.DeleteProduct(ctx, "product-1", 8)
+		}, "SetProductStatus"},
+		{"categories", func(s *testService) error {
+			_, err := s.SetProductCategories(ctx, "product-1", []string{"lighting"}, 8)
+			return err
+		}, "SetProductCategories"},
+		{"images", func(s *testService) error {
+			_, err := s.AddProductImage(ctx, "product-1", models.ProductImage{ID: "i", Key: "k", ThumbnailKey: "t"}, 8)
+			return err
+		}, "SetProductImages"},
+		{"stock", func(s *testService) error {
+			_, err := s.SetStock(ctx, "product-1", "", 5, 8)
+			return err
+		}, ""},
+		{"price schedules", func(s *testService) error {
+			_, err := s.SchedulePriceChange(ctx, "product-1", 30, time.Now().Add(time.Hour), nil, 8)
+			return err
+		}, ""},
+	}
+	for _, tt := range changes {
+		t.Run("other sellers cannot change "+tt.name, func(t *testing.T) {
+			s := setupTestService(t)
+			s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+
+			assert.EqualError(t, tt.change(s), "unauthorized")
+			if tt.method != "" {
+				s.repo.AssertNotCalled(t, tt.method)
+			}
+			stock, err := s.GetStock(ctx, []string{"product-1"})
+			require.NoError(t, err)
+			assert.Empty(t, stock)
+			schedules, err := s.prices.ListPriceSchedules(ctx, "product-1")
+			require.NoError(t, err)
+			assert.Empty(t, schedules)
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPricedProduct makes the repository serve a product whose price follows
+// the prices the service sets.
+func setupPricedProduct(s *testService, status models.ProductStatus) *models.Product {
+	product := createSampleProduct(status)
+	s.repo.On("GetProductById", mock.Anything, product.ID).Return(product, nil)
+	s.repo.On("SetProductPrice", mock.Anything, product.ID, mock.AnythingOfType("float64")).
+		Run(func(args mock.Arguments) { product.Price = args.Get(2).(float64) }).
+		Return(nil)
+	return product
+}
+
+// moveSchedule sets the times of a schedule, which the service only accepts
+// in the future.
+func moveSchedule(t *testing.T, s *testService, id uint64, startsAt time.Time, endsAt *time.Time) {
+	t.Helper()
+	err := s.db.Model(&models.PriceSchedule{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"starts_at": startsAt.UTC(), "ends_at": endsAt}).Error
+	require.NoError(t, err)
+}
+
+func getSchedule(t *testing.T, s *testService, id uint64) *models.PriceSchedule {
+	t.Helper()
+	schedule, err := s.prices.GetPriceSchedule(context.Background(), id)
+	require.NoError(t, err)
+	return schedule
+}
+
+func latestPriceChange(t *testing.T, s *testService, productID string) *models.PriceChange {
+	t.Helper()
+	history, err := s.GetPriceHistory(context.Background(), productID, 0, 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	return history[0]
+}
+
+func at(t time.Time) *time.Time {
+	return &t
+}
+
+func TestProductService_SchedulePriceChange(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	t.Run("validation", func(t *testing.T) {
+		s := setupTestService(t)
+		setupPricedProduct(s, models.StatusPublished)
+
+		_, err := s.SchedulePriceChange(ctx, "product-1", 0, now.Add(time.Hour), nil, 7)
+		assert.ErrorIs(t, err, internal.ErrInvalidPrice)
+		_, err = s.SchedulePriceChange(ctx, "product-1", 30, now.Add(-time.Hour), nil, 7)
+		assert.ErrorIs(t, err, internal.ErrInvalidSchedule)
+		_, err = s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), at(now.Add(time.Hour)), 7)
+		assert.ErrorIs(t, err, internal.ErrInvalidSchedule)
+		_, err = s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), nil, 8)
+		assert.Error(t, err)
+	})
+
+	t.Run("sales cannot overlap", func(t *testing.T) {
+		s := setupTestService(t)
+		setupPricedProduct(s, models.StatusPublished)
+		sale, err := s.SchedulePriceChange(ctx, "product-1", 30, now.Add(2*time.Hour), at(now.Add(4*time.Hour)), 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.ScheduleScheduled, sale.Status)
+
+		tests := []struct {
+			name     string
+			startsAt time.Time
+			endsAt   *time.Time
+			err      error
+		}{
+			{"starts during", now.Add(3 * time.Hour), at(now.Add(5 * time.Hour)), internal.ErrSaleOverlap},
+			{"ends during", now.Add(time.Hour), at(now.Add(3 * time.Hour)), internal.ErrSaleOverlap},
+			{"inside", now.Add(150 * time.Minute), at(now.Add(210 * time.Minute)), internal.ErrSaleOverlap},
+			{"around", now.Add(time.Hour), at(now.Add(5 * time.Hour)), internal.ErrSaleOverlap},
+			{"ends when it starts", now.Add(time.Hour), at(now.Add(2 * time.Hour)), nil},
+			{"starts when it ends", now.Add(4 * time.Hour), at(now.Add(5 * time.Hour)), nil},
+			{"price change during", now.Add(3 * time.Hour), nil, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				schedule, err := s.SchedulePriceChange(ctx, "product-1", 25, tt.startsAt, tt.endsAt, 7)
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+					return
+				}
+				require.NoError(t, err)
+				// Leave room for the next case
+				_, err = s.CancelPriceSchedule(ctx, schedule.ID, 7)
+				require.NoError(t, err)
+			})
+		}
+
+		t.Run("canceled sales do not count", func(t *testing.T) {
+			_, err := s.CancelPriceSchedule(ctx, sale.ID, 7)
+			require.NoError(t, err)
+			_, err = s.SchedulePriceChange(ctx, "product-1", 25, now.Add(3*time.Hour), at(now.Add(5*time.Hour)), 7)
+			assert.NoError(t, err)
+		})
+	})
+}
+
+func TestProductService_ApplyPriceSchedules(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	t.Run("price change", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusPublished)
+		schedule, err := s.SchedulePriceChange(ctx, "product-1", 35, now.Add(time.Hour), nil, 7)
+		require.NoError(t, err)
+
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+		assert.Equal(t, 40.0, product.Price)
+
+		moveSchedule(t, s, schedule.ID, now.Add(-time.Minute), nil)
+		applied, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 35.0, product.Price)
+		assert.Equal(t, models.ScheduleCompleted, getSchedule(t, s, schedule.ID).Status)
+
+		change := latestPriceChange(t, s, "product-1")
+		assert.Equal(t, models.PriceScheduled, change.Reason)
+		assert.Equal(t, 40.0, change.OldPrice)
+		assert.Equal(t, 35.0, change.NewPrice)
+		assert.Equal(t, 7, change.ActorID)
+		assert.Equal(t, schedule.ID, *change.ScheduleID)
+
+		event := s.events.next(t, "product_events")
+		assert.Equal(t, "product_updated", event.Type)
+		assert.Equal(t, 35.0, *event.Data.Price)
+
+		applied, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("sale starts and reverts", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusPublished)
+		sale, err := s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), at(now.Add(2*time.Hour)), 7)
+		require.NoError(t, err)
+
+		moveSchedule(t, s, sale.ID, now.Add(-time.Minute), at(now.Add(time.Hour)))
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 30.0, product.Price)
+		running := getSchedule(t, s, sale.ID)
+		assert.Equal(t, models.ScheduleActive, running.Status)
+		assert.Equal(t, 40.0, running.RegularPrice)
+		assert.Equal(t, models.PriceSaleStarted, latestPriceChange(t, s, "product-1").Reason)
+		event := s.events.next(t, "product_events")
+		assert.Equal(t, "product_updated", event.Type)
+		assert.Equal(t, 30.0, *event.Data.Price)
+
+		moveSchedule(t, s, sale.ID, now.Add(-time.Minute), at(now.Add(-time.Second)))
+		applied, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 40.0, product.Price)
+		assert.Equal(t, models.ScheduleCompleted, getSchedule(t, s, sale.ID).Status)
+		change := latestPriceChange(t, s, "product-1")
+		assert.Equal(t, models.PriceSaleEnded, change.Reason)
+		assert.Equal(t, 30.0, change.OldPrice)
+		assert.Equal(t, 40.0, change.NewPrice)
+		event = s.events.next(t, "product_events")
+		assert.Equal(t, "product_updated", event.Type)
+		assert.Equal(t, 40.0, *event.Data.Price)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("sale keeps a price the seller changed", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusPublished)
+		sale, err := s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), at(now.Add(2*time.Hour)), 7)
+		require.NoError(t, err)
+		moveSchedule(t, s, sale.ID, now.Add(-time.Minute), at(now.Add(time.Hour)))
+		_, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		s.events.next(t, "product_events")
+
+		product.Price = 28
+		moveSchedule(t, s, sale.ID, now.Add(-time.Minute), at(now.Add(-time.Second)))
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 28.0, product.Price)
+		assert.Equal(t, models.ScheduleCompleted, getSchedule(t, s, sale.ID).Status)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("sale that ended before it started", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusPublished)
+		sale, err := s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), at(now.Add(2*time.Hour)), 7)
+		require.NoError(t, err)
+
+		moveSchedule(t, s, sale.ID, now.Add(-2*time.Hour), at(now.Add(-time.Hour)))
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 40.0, product.Price)
+		assert.Equal(t, models.ScheduleCompleted, getSchedule(t, s, sale.ID).Status)
+		s.repo.AssertNotCalled(t, "SetProductPrice", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("drafts change price silently", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusDraft)
+		schedule, err := s.SchedulePriceChange(ctx, "product-1", 35, now.Add(time.Hour), nil, 7)
+		require.NoError(t, err)
+
+		moveSchedule(t, s, schedule.ID, now.Add(-time.Minute), nil)
+		_, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 35.0, product.Price)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("schedules of deleted products are canceled", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", mock.Anything, "product-1").Return(createSampleProduct(models.StatusPublished), nil).Once()
+		schedule, err := s.SchedulePriceChange(ctx, "product-1", 35, now.Add(time.Hour), nil, 7)
+		require.NoError(t, err)
+		s.repo.On("GetProductById", mock.Anything, "product-1").Return(nil, internal.ErrNotFound)
+
+		moveSchedule(t, s, schedule.ID, now.Add(-time.Minute), nil)
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, models.ScheduleCanceled, getSchedule(t, s, schedule.ID).Status)
+	})
+}
+
+func TestProductService_CancelPriceSchedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	t.Run("scheduled", func(t *testing.T) {
+		s := setupTestService(t)
+		setupPricedProduct(s, models.StatusPublished)
+		schedule, err := s.SchedulePriceChange(ctx, "product-1", 35, now.Add(time.Hour), nil, 7)
+		require.NoError(t, err)
+
+		_, err = s.CancelPriceSchedule(ctx, schedule.ID, 8)
+		assert.Error(t, err)
+		canceled, err := s.CancelPriceSchedule(ctx, schedule.ID, 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.ScheduleCanceled, canceled.Status)
+		_, err = s.CancelPriceSchedule(ctx, schedule.ID, 7)
+		assert.ErrorIs(t, err, internal.ErrScheduleFinished)
+
+		moveSchedule(t, s, schedule.ID, now.Add(-time.Minute), nil)
+		applied, err := s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+	})
+
+	t.Run("running sale ends now", func(t *testing.T) {
+		s := setupTestService(t)
+		product := setupPricedProduct(s, models.StatusPublished)
+		sale, err := s.SchedulePriceChange(ctx, "product-1", 30, now.Add(time.Hour), at(now.Add(2*time.Hour)), 7)
+		require.NoError(t, err)
+		moveSchedule(t, s, sale.ID, now.Add(-time.Minute), at(now.Add(time.Hour)))
+		_, err = s.ApplyPriceSchedules(ctx)
+		require.NoError(t, err)
+		s.events.next(t, "product_events")
+
+		canceled, err := s.CancelPriceSchedule(ctx, sale.ID, 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.ScheduleCanceled, canceled.Status)
+		assert.Equal(t, 40.0, product.Price)
+		assert.Equal(t, models.PriceSaleEnded, latestPriceChange(t, s, "product-1").Reason)
+		assert.Equal(t, "product_updated", s.events.next(t, "product_events").Type)
+	})
+
+	t.Run("unknown schedule", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.CancelPriceSchedule(ctx, 42, 7)
+		assert.ErrorIs(t, err, internal.ErrScheduleNotFound)
+	})
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// assertJSON checks a part of a decoded request body against JSON.
+func assertJSON(t *testing.T, expected string, actual interface{}) {
+	t.Helper()
+	data, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(data))
+}
+
+const emptySearchResult = `{"hits":{"total":{"value":0},"hits":[]}}`
+
+func TestElasticRepository_SearchProducts_Query(t *testing.T) {
+	ctx := context.Background()
+	minPrice, maxPrice := 10.0, 50.0
+
+	t.Run("filters and facets", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", emptySearchResult)
+
+		_, err := repo.SearchProducts(ctx, models.ProductSearch{
+			Query:        "lamp",
+			AccountID:    3,
+			ViewerID:     7,
+			MinPrice:     &minPrice,
+			MaxPrice:     &maxPrice,
+			CategoryPath: "home/lighting",
+			Skip:         20,
+			Take:         10,
+		})
+		require.NoError(t, err)
+
+		requests := es.received("POST", "/catalog/_search")
+		require.Len(t, requests, 1)
+		assert.Equal(t, "track_total_hits=true", requests[0].Query)
+		body := requests[0].decode(t)
+
+		priceFilter := `{"range":{"price":{"from":10,"include_lower":true,"include_upper":true,"to":50}}}`
+		categoryFilter := `{"bool":{"minimum_should_match":"1","should":[
+			{"term":{"category_paths":"home/lighting"}},
+			{"prefix":{"category_paths":"home/lighting/"}}]}}`
+
+		// The seller's own drafts are listed to it along with published products
+		assertJSON(t, `{"bool":{
+			"must":{"multi_match":{"fields":["name","description"],"query":"lamp"}},
+			"filter":[
+				{"term":{"account_id":3}},
+				{"bool":{"minimum_should_match":"1","should":[
+					{"bool":{"must_not":{"terms":{"status":["draft","archived"]}}}},
+					{"term":{"account_id":7}}]}}]}}`, body["query"])
+		// Price and category filters apply to the hits, and to the facet of the other one only
+		assertJSON(t, `{"bool":{"filter":[`+priceFilter+`,`+categoryFilter+`]}}`, body["post_filter"])
+		assertJSON(t, `{
+			"price_facet":{
+				"filter":`+categoryFilter+`,
+				"aggregations":{"prices":{"range":{"field":"price","ranges":[
+					{"to":10},{"from":10,"to":25},{"from":25,"to":50},{"from":50,"to":100},
+					{"from":100,"to":250},{"from":250,"to":500},{"from":500,"to":1000},{"from":1000}]}}}},
+			"category_facet":{
+				"filter":`+priceFilter+`,
+				"aggregations":{"categories":{"terms":{"field":"category_ids","size":50}}}}}`, body["aggregations"])
+		assertJSON(t, `[{"_score":{"order":"desc"}},{"product_id":{"order":"asc"}}]`, body["sort"])
+		assert.Equal(t, 20.0, body["from"])
+		assert.Equal(t, 11.0, body["size"])
+	})
+
+	t.Run("without filters", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", emptySearchResult)
+
+		_, err := repo.SearchProducts(ctx, models.ProductSearch{Take: 10})
+		require.NoError(t, err)
+
+		body := es.received("POST", "/catalog/_search")[0].decode(t)
+		assertJSON(t, `{"bool":{"filter":{"bool":{"must_not":{"terms":{"status":["draft","archived"]}}}}}}`, body["query"])
+		assertJSON(t, `{"bool":{"filter":[{"match_all":{}},{"match_all":{}}]}}`, body["post_filter"])
+	})
+
+	sorts := []struct {
+		name     string
+		sort     models.ProductSort
+		expected string
+	}{
+		{"relevance", models.SortRelevance, `[{"_score":{"order":"desc"}},{"product_id":{"order":"asc"}}]`},
+		{"price ascending", models.SortPriceAsc, `[{"price":{"order":"asc"}},{"product_id":{"order":"asc"}}]`},
+		{"price descending", models.SortPriceDesc, `[{"price":{"order":"desc"}},{"product_id":{"order":"asc"}}]`},
+		{"newest", models.SortNewest, `[{"created_at":{"missing":"_last","order":"desc"}},{"product_id":{"order":"asc"}}]`},
+	}
+	for _, tt := range sorts {
+		t.Run("sort by "+tt.name, func(t *testing.T) {
+			es := newFakeElasticsearch(t, "8.13.0")
+			repo := setupElasticRepository(t, es)
+			es.respond("POST", "/catalog/_search", emptySearchResult)
+
+			_, err := repo.SearchProducts(ctx, models.ProductSearch{Sort: tt.sort, Take: 10})
+			require.NoError(t, err)
+			assertJSON(t, tt.expected, es.received("POST", "/catalog/_search")[0].decode(t)["sort"])
+		})
+	}
+
+	t.Run("Elasticsearch 6 counts totals without being asked", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "6.8.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", `{"hits":{"total":3,"hits":[]}}`)
+
+		result, err := repo.SearchProducts(ctx, models.ProductSearch{Take: 10})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), result.Total)
+		assert.Empty(t, es.received("POST", "/catalog/_search")[0].Query)
+	})
+}
+
+func TestElasticRepository_SearchProducts_Result(t *testing.T) {
+	ctx := context.Background()
+	es := newFakeElasticsearch(t, "8.13.0")
+	repo := setupElasticRepository(t, es)
+	es.respond("POST", "/catalog/_search", `{
+		"hits":{"total":{"value":42,"relation":"eq"},"hits":[
+			{"_id":"a","_source":{"name":"Lamp","price":40,"account_id":3,"category_ids":["lighting"]},"sort":[1.5,"a"]},
+			{"_id":"b","_source":{"name":"Chair","price":20,"account_id":3,"status":"published"},"sort":[1.2,"b"]},
+			{"_id":"c","_source":{"name":"Desk","price":90,"account_id":3},"sort":[1.1,"c"]}]},
+		"aggregations":{
+			"price_facet":{"doc_count":42,"prices":{"buckets":[
+				{"key":"*-10.0","to":10,"doc_count":0},
+				{"key":"10.0-25.0","from":10,"to":25,"doc_count":12},
+				{"key":"1000.0-*","from":1000,"doc_count":2}]}},
+			"category_facet":{"doc_count":42,"categories":{"buckets":[
+				{"key":"lighting","doc_count":30},
+				{"key":"desk","doc_count":5}]}}}}`)
+
+	result, err := repo.SearchProducts(ctx, models.ProductSearch{Take: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(42), result.Total)
+	assert.True(t, result.HasMore)
+	assert.False(t, result.HasPrevious)
+	require.Len(t, result.Products, 2)
+	assert.Equal(t, "a", result.Products[0].ID)
+	assert.Equal(t, "Lamp", result.Products[0].Name)
+	assert.Equal(t, []string{"lighting"}, result.Products[0].CategoryIDs)
+	assert.Equal(t, "b", result.Products[1].ID)
+	assert.Len(t, result.Cursors, 2)
+
+	ten, twentyFive, thousand := 10.0, 25.0, 1000.0
+	assert.Equal(t, []models.PriceBucket{
+		{From: &ten, To: &twentyFive, Count: 12},
+		{From: &thousand, Count: 2},
+	}, result.PriceBuckets)
+	assert.Equal(t, []models.CategoryCount{
+		{CategoryID: "lighting", Count: 30},
+		{CategoryID: "desk", Count: 5},
+	}, result.Categories)
+}
+
+func TestProductService_SearchProducts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("category is searched by path", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetCategory", ctx, "lamps").Return(&models.Category{ID: "lamps", Path: []string{"home", "lighting", "lamps"}}, nil)
+		s.repo.On("SearchProducts", ctx, models.ProductSearch{CategoryID: "lamps", CategoryPath: "home/lighting/lamps", Take: 100}).
+			Return(&models.SearchResult{}, nil).Once()
+
+		_, err := s.SearchProducts(ctx, models.ProductSearch{CategoryID: "lamps"})
+		require.NoError(t, err)
+		s.repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown category", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetCategory", ctx, "missing").Return(nil, internal.ErrNotFound)
+		_, err := s.SearchProducts(ctx, models.ProductSearch{CategoryID: "missing"})
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
+
+	t.Run("page size is capped", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("SearchProducts", ctx, models.ProductSearch{Skip: 10, Take: 100}).Return(&models.SearchResult{}, nil).Once()
+		_, err := s.SearchProducts(ctx, models.ProductSearch{Skip: 10, Take: 500})
+		require.NoError(t, err)
+		s.repo.AssertExpectations(t)
+	})
+
+	t.Run("invalid price range", func(t *testing.T) {
+		s := setupTestService(t)
+		minPrice, maxPrice := 50.0, 10.0
+		_, err := s.SearchProducts(ctx, models.ProductSearch{MinPrice: &minPrice, MaxPrice: &maxPrice})
+		assert.ErrorIs(t, err, internal.ErrInvalidPriceRange)
+	})
+
+	t.Run("deep pages need a cursor", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.SearchProducts(ctx, models.ProductSearch{Skip: 9950, Take: 100})
+		assert.ErrorIs(t, err, internal.ErrPageTooDeep)
+
+		s.repo.On("SearchProducts", ctx, mock.Anything).Return(&models.SearchResult{}, nil).Once()
+		_, err = s.SearchProducts(ctx, models.ProductSearch{Skip: 9950, Take: 100, After: "cursor"})
+		assert.NoError(t, err)
+	})
+}
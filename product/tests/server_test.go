@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/rasadov/EcommerceAPI/product/proto/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// freePort returns a TCP port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// setupTestServer serves the service on its public listener and returns a
+// client of it, along with the keys its tokens are signed with.
+func setupTestServer(t *testing.T, s *testService) (pb.ProductServiceClient, *auth.KeySet) {
+	t.Helper()
+	key, err := auth.GenerateSigningKey()
+	require.NoError(t, err)
+	keys := auth.NewKeySet(key)
+
+	port := freePort(t)
+	go internal.ListenGRPC(s, keys, port, freePort(t))
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewProductServiceClient(conn), keys
+}
+
+// asAccount sends the token of a seller with the calls made with ctx.
+func asAccount(t *testing.T, keys *auth.KeySet, accountID uint64) context.Context {
+	t.Helper()
+	token, err := keys.GenerateToken(accountID, auth.RoleSeller)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestProductServer_CallerOwnsProducts(t *testing.T) {
+	s := setupTestService(t)
+	client, keys := setupTestServer(t, s)
+	s.repo.On("GetProductById", mock.Anything, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+	// Seller 8 claims to be seller 7, who owns product-1
+	forged := asAccount(t, keys, 8)
+
+	t.Run("products are created for the caller", func(t *testing.T) {
+		s.repo.On("PutProduct", mock.Anything, mock.Anything).Return(nil).Once()
+
+		res, err := client.PostProduct(forged, &pb.CreateProductRequest{Name: "Lamp", Price: 40, AccountId: 7})
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), res.Product.AccountId)
+		s.repo.AssertCalled(t, "PutProduct", mock.Anything, mock.MatchedBy(func(p *models.Product) bool {
+			return p.AccountID == 8
+		}))
+	})
+
+	t.Run("another seller's account id does not update", func(t *testing.T) {
+		_, err := client.UpdateProduct(forged, &pb.UpdateProductRequest{Id: "product-1", Name: "Chair", Price: 1, AccountId: 7})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unauthorized")
+		s.repo.AssertNotCalled(t, "UpdateProduct", mock.Anything, mock.Anything)
+	})
+
+	t.Run("another seller's account id does not delete", func(t *testing.T) {
+		_, err := client.DeleteProduct(forged, &pb.DeleteProductRequest{ProductId: "product-1", AccountId: 7})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unauthorized")
+		s.repo.AssertNotCalled(t, "SetProductStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("the owner deletes", func(t *testing.T) {
+		s.repo.On("SetProductStatus", mock.Anything, "product-1", models.StatusArchived).Return(nil).Once()
+
+		// The account id sent along is ignored, the token names the owner
+		_, err := client.DeleteProduct(asAccount(t, keys, 7), &pb.DeleteProductRequest{ProductId: "product-1", AccountId: 8})
+		require.NoError(t, err)
+		s.repo.AssertCalled(t, "SetProductStatus", mock.Anything, "product-1", models.StatusArchived)
+	})
+
+	t.Run("without a token", func(t *testing.T) {
+		_, err := client.DeleteProduct(context.Background(), &pb.DeleteProductRequest{ProductId: "product-1", AccountId: 7})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
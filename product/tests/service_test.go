@@ -0,0 +1,384 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) Close() {}
+
+func (m *MockRepository) PutProduct(ctx context.Context, p *models.Product) error {
+	args := m.Called(ctx, p)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetProductById(ctx context.Context, id string) (*models.Product, error) {
+	args := m.Called(ctx, id)
+	product, _ := args.Get(0).(*models.Product)
+	if product != nil {
+		// The service changes the product it gets, as it would a decoded document
+		copied := *product
+		product = &copied
+	}
+	return product, args.Error(1)
+}
+
+func (m *MockRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]*models.Product, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).([]*models.Product), args.Error(1)
+}
+
+func (m *MockRepository) SearchProducts(ctx context.Context, search models.ProductSearch) (*models.SearchResult, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).(*models.SearchResult), args.Error(1)
+}
+
+func (m *MockRepository) SuggestProducts(ctx context.Context, text string, size int) (*models.Suggestions, error) {
+	args := m.Called(ctx, text, size)
+	return args.Get(0).(*models.Suggestions), args.Error(1)
+}
+
+func (m *MockRepository) ListProductsByAccount(ctx context.Context, accountID, viewerID int, skip, take uint64) ([]*models.Product, error) {
+	args := m.Called(ctx, accountID, viewerID, skip, take)
+	return args.Get(0).([]*models.Product), args.Error(1)
+}
+
+func (m *MockRepository) ScrollProductsByAccount(ctx context.Context, accountID int, fn func(*models.Product) error) error {
+	args := m.Called(ctx, accountID, fn)
+	return args.Error(0)
+}
+
+func (m *MockRepository) BulkPutProducts(ctx context.Context, products []*models.Product, categoryPaths map[string]string) ([]error, error) {
+	args := m.Called(ctx, products, categoryPaths)
+	if save, ok := args.Get(0).(func([]*models.Product) []error); ok {
+		return save(products), args.Error(1)
+	}
+	errs, _ := args.Get(0).([]error)
+	return errs, args.Error(1)
+}
+
+func (m *MockRepository) UpdateProduct(ctx context.Context, updatedProduct *models.Product) error {
+	args := m.Called(ctx, updatedProduct)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductPrice(ctx context.Context, productId string, price float64) error {
+	args := m.Called(ctx, productId, price)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductStatus(ctx context.Context, productId string, status models.ProductStatus) error {
+	args := m.Called(ctx, productId, status)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductCategories(ctx context.Context, productId string, categoryIDs, categoryPaths []string) error {
+	args := m.Called(ctx, productId, categoryIDs, categoryPaths)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductVariants(ctx context.Context, productId string, options []models.ProductOption, variants []models.Variant) error {
+	args := m.Called(ctx, productId, options, variants)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductImages(ctx context.Context, productId string, images []models.ProductImage) error {
+	args := m.Called(ctx, productId, images)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetProductRating(ctx context.Context, productId string, rating models.Rating) error {
+	args := m.Called(ctx, productId, rating)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListProductsInCategories(ctx context.Context, categoryIDs []string) ([]*models.Product, error) {
+	args := m.Called(ctx, categoryIDs)
+	return args.Get(0).([]*models.Product), args.Error(1)
+}
+
+func (m *MockRepository) SaveCategories(ctx context.Context, categories ...*models.Category) error {
+	args := m.Called(ctx, categories)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetCategory(ctx context.Context, id string) (*models.Category, error) {
+	args := m.Called(ctx, id)
+	category, _ := args.Get(0).(*models.Category)
+	return category, args.Error(1)
+}
+
+func (m *MockRepository) ListCategories(ctx context.Context, parentID string) ([]*models.Category, error) {
+	args := m.Called(ctx, parentID)
+	return args.Get(0).([]*models.Category), args.Error(1)
+}
+
+func (m *MockRepository) ListCategoriesWithIDs(ctx context.Context, ids []string) ([]*models.Category, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).([]*models.Category), args.Error(1)
+}
+
+func (m *MockRepository) ListCategorySubtree(ctx context.Context, id string) ([]*models.Category, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]*models.Category), args.Error(1)
+}
+
+func (m *MockRepository) DeleteCategory(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// eventRecorder is a Kafka producer that keeps the messages sent to it.
+type eventRecorder struct {
+	sarama.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{input: make(chan *sarama.ProducerMessage, 100)}
+}
+
+func (r *eventRecorder) Input() chan<- *sarama.ProducerMessage {
+	return r.input
+}
+
+// next waits for the next event sent to the topic.
+func (r *eventRecorder) next(t *testing.T, topic string) models.Event {
+	t.Helper()
+	for {
+		select {
+		case msg := <-r.input:
+			if msg.Topic != topic {
+				continue
+			}
+			value, err := msg.Value.Encode()
+			require.NoError(t, err)
+			var event models.Event
+			require.NoError(t, json.Unmarshal(value, &event))
+			return event
+		case <-time.After(time.Second):
+			t.Fatalf("no event sent to %s", topic)
+			return models.Event{}
+		}
+	}
+}
+
+// assertNoEvent checks that nothing is sent to the topic for a moment.
+func (r *eventRecorder) assertNoEvent(t *testing.T, topic string) {
+	t.Helper()
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case msg := <-r.input:
+			assert.NotEqual(t, topic, msg.Topic, "unexpected event")
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// setupTestDB opens a SQLite database in a temporary file, which every
+// connection of the pool shares.
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "product.db")), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+type testService struct {
+	internal.Service
+	repo      *MockRepository
+	inventory internal.InventoryRepository
+	prices    internal.PriceRepository
+	db        *gorm.DB
+	events    *eventRecorder
+}
+
+func setupTestService(t *testing.T) *testService {
+	db := setupTestDB(t)
+	inventory, err := internal.NewPostgresInventoryRepository(db)
+	require.NoError(t, err)
+	prices, err := internal.NewPostgresPriceRepository(db)
+	require.NoError(t, err)
+	repo := &MockRepository{}
+	events := newEventRecorder()
+	return &testService{
+		Service:   internal.NewProductService(repo, inventory, prices, events),
+		repo:      repo,
+		inventory: inventory,
+		prices:    prices,
+		db:        db,
+		events:    events,
+	}
+}
+
+func createSampleProduct(status models.ProductStatus) *models.Product {
+	return &models.Product{
+		ID:          "product-1",
+		Name:        "Lamp",
+		Description: "A desk lamp",
+		Price:       40,
+		AccountID:   7,
+		CreatedAt:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:      status,
+	}
+}
+
+func TestProductService_SetProductStatus(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		from   models.ProductStatus
+		to     models.ProductStatus
+		err    error
+		events []string
+	}{
+		{models.StatusDraft, models.StatusPublished, nil, []string{"product_created"}},
+		{models.StatusDraft, models.StatusArchived, nil, nil},
+		{models.StatusPublished, models.StatusDraft, nil, []string{"product_deleted"}},
+		{models.StatusPublished, models.StatusArchived, nil, []string{"product_deleted"}},
+		{models.StatusArchived, models.StatusDraft, nil, nil},
+		{models.StatusArchived, models.StatusPublished, internal.ErrInvalidTransition, nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			s := setupTestService(t)
+			s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(tt.from), nil)
+			if tt.err == nil {
+				s.repo.On("SetProductStatus", ctx, "product-1", tt.to).Return(nil).Once()
+			}
+
+			product, err := s.SetProductStatus(ctx, "product-1", tt.to, 7)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				s.repo.AssertNotCalled(t, "SetProductStatus", mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.to, product.Status)
+			}
+			for _, eventType := range tt.events {
+				event := s.events.next(t, "product_events")
+				assert.Equal(t, eventType, event.Type)
+				assert.Equal(t, "product-1", *event.Data.ID)
+			}
+			s.events.assertNoEvent(t, "product_events")
+			s.repo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("same status changes nothing", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+
+		product, err := s.SetProductStatus(ctx, "product-1", models.StatusPublished, 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPublished, product.Status)
+		s.repo.AssertNotCalled(t, "SetProductStatus", mock.Anything, mock.Anything, mock.Anything)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.SetProductStatus(ctx, "product-1", "deleted", 7)
+		assert.ErrorIs(t, err, internal.ErrInvalidStatus)
+		s.repo.AssertNotCalled(t, "GetProductById", mock.Anything, mock.Anything)
+	})
+
+	t.Run("other seller", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusDraft), nil)
+		_, err := s.SetProductStatus(ctx, "product-1", models.StatusPublished, 8)
+		assert.Error(t, err)
+		s.repo.AssertNotCalled(t, "SetProductStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("delete archives", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+		s.repo.On("SetProductStatus", ctx, "product-1", models.StatusArchived).Return(nil).Once()
+
+		require.NoError(t, s.DeleteProduct(ctx, "product-1", 7))
+		assert.Equal(t, "product_deleted", s.events.next(t, "product_events").Type)
+		s.repo.AssertExpectations(t)
+	})
+}
+
+func TestProductService_PostProduct(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("published by default", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("PutProduct", ctx, mock.AnythingOfType("*models.Product")).Return(nil).Once()
+
+		product, err := s.PostProduct(ctx, "Lamp", "A desk lamp", 40, "", 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPublished, product.Status)
+		assert.Equal(t, "product_created", s.events.next(t, "product_events").Type)
+	})
+
+	t.Run("drafts are not announced", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("PutProduct", ctx, mock.AnythingOfType("*models.Product")).Return(nil).Once()
+
+		product, err := s.PostProduct(ctx, "Lamp", "A desk lamp", 40, models.StatusDraft, 7)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusDraft, product.Status)
+		s.events.assertNoEvent(t, "product_events")
+	})
+
+	t.Run("cannot start archived", func(t *testing.T) {
+		s := setupTestService(t)
+		_, err := s.PostProduct(ctx, "Lamp", "A desk lamp", 40, models.StatusArchived, 7)
+		assert.ErrorIs(t, err, internal.ErrInvalidStatus)
+		s.repo.AssertNotCalled(t, "PutProduct", mock.Anything, mock.Anything)
+	})
+}
+
+func TestProductService_UpdateProduct(t *testing.T) {
+	ctx := context.Background()
+
+	for _, status := range []models.ProductStatus{models.StatusDraft, models.StatusPublished} {
+		t.Run(string(status), func(t *testing.T) {
+			s := setupTestService(t)
+			stored := createSampleProduct(status)
+			stored.Name = "Desk lamp"
+			stored.CategoryIDs = []string{"lighting"}
+			s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(status), nil).Once()
+			s.repo.On("UpdateProduct", ctx, mock.AnythingOfType("*models.Product")).Return(nil).Once()
+			s.repo.On("GetProductById", ctx, "product-1").Return(stored, nil).Once()
+
+			product, err := s.UpdateProduct(ctx, "product-1", "Desk lamp", "A desk lamp", 40, 7)
+			require.NoError(t, err)
+			assert.Equal(t, stored, product)
+			if status == models.StatusPublished {
+				event := s.events.next(t, "product_events")
+				assert.Equal(t, "product_updated", event.Type)
+				assert.Equal(t, "Desk lamp", *event.Data.Name)
+			}
+			s.events.assertNoEvent(t, "product_events")
+			s.repo.AssertExpectations(t)
+		})
+	}
+}
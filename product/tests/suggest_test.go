@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticRepository_SuggestProducts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("completes product names", func(t *testing.T) {
+		es := newFakeElasticsearch(t, "8.13.0")
+		repo := setupElasticRepository(t, es)
+		es.respond("POST", "/catalog/_search", `{"hits":{"total":{"value":2},"hits":[
+			{"_id":"a","_source":{"name":"Desk lamp"}},
+			{"_id":"b","_source":{"name":"Desk chair"}}]},
+			"suggest":{"did_you_mean":[{"text":"desk","offset":0,"length":4,"options":[]}]}}`)
+
+		suggestions, err := repo.SuggestProducts(ctx, "desk", 5)
+		require.NoError(t, err)
+		assert.Equal(t, []models.ProductSuggestion{
+			{ProductID: "a", Name: "Desk lamp"},
+			{ProductID: "b", Name: "Desk chair"},
+		}, suggestions.Products)
+		assert.Empty(t, suggestions.DidYouMean)
+
+		body := es.received("POST", "/catalog/_search")[0].decode(t)
+		assertJSON(t, `{"bool":{
+			"must":{"match":{"name.autocomplete":{"operator":"and","query":"desk"}}},
+			"filter":{"bool":{"must_not":{"terms":{"status":["draft","archived"]}}}}}}`, body["query"])
+		assertJSON(t, `{"includes":["name"]}`, body["_source"])
+		assertJSON(t, `{"did_you_mean":{"text":"desk","term":{"field":"name.words","size":1,"suggest_mode":"missing"}}}`, body["suggest"])
+		assert.Equal(t, 5.0, body["size"])
+	})
+
+	tests := []struct {
+		name     string
+		text     string
+		words    string
+		expected string
+	}{
+		{
+			name:     "misspelled words are corrected",
+			text:     "dsek lamp chiar",
+			words:    `{"text":"dsek","offset":0,"length":4,"options":[{"text":"desk","score":0.75,"freq":3}]},{"text":"lamp","offset":5,"length":4,"options":[]},{"text":"chiar","offset":10,"length":5,"options":[{"text":"chair","score":0.8,"freq":2}]}`,
+			expected: "desk lamp chair",
+		},
+		{
+			name:     "nothing to correct",
+			text:     "lamp",
+			words:    `{"text":"lamp","offset":0,"length":4,"options":[]}`,
+			expected: "",
+		},
+		{
+			// Offsets count UTF-16 code units, the emoji takes two
+			name:     "offsets after characters outside the BMP",
+			text:     "🙂 lmap",
+			words:    `{"text":"lmap","offset":3,"length":4,"options":[{"text":"lamp","score":0.75,"freq":3}]}`,
+			expected: "🙂 lamp",
+		},
+		{
+			name:     "words out of range are skipped",
+			text:     "lmap",
+			words:    `{"text":"lmap","offset":2,"length":4,"options":[{"text":"lamp","score":0.75,"freq":3}]}`,
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newFakeElasticsearch(t, "8.13.0")
+			repo := setupElasticRepository(t, es)
+			es.respond("POST", "/catalog/_search", `{"hits":{"total":{"value":0},"hits":[]},"suggest":{"did_you_mean":[`+tt.words+`]}}`)
+
+			suggestions, err := repo.SuggestProducts(ctx, tt.text, 5)
+			require.NoError(t, err)
+			assert.Empty(t, suggestions.Products)
+			assert.Equal(t, tt.expected, suggestions.DidYouMean)
+		})
+	}
+}
+
+func TestProductService_SuggestProducts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("blank text suggests nothing", func(t *testing.T) {
+		s := setupTestService(t)
+		suggestions, err := s.SuggestProducts(ctx, "   ", 5)
+		require.NoError(t, err)
+		assert.Empty(t, suggestions.Products)
+		s.repo.AssertNotCalled(t, "SuggestProducts", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("text is trimmed and size bounded", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("SuggestProducts", ctx, "lamp", 8).Return(&models.Suggestions{}, nil).Once()
+		s.repo.On("SuggestProducts", ctx, "lamp", 20).Return(&models.Suggestions{}, nil).Once()
+
+		_, err := s.SuggestProducts(ctx, "  lamp ", 0)
+		require.NoError(t, err)
+		_, err = s.SuggestProducts(ctx, "lamp", 500)
+		require.NoError(t, err)
+		s.repo.AssertExpectations(t)
+	})
+
+	t.Run("long text is cut by character", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("SuggestProducts", ctx, strings.Repeat("é", 100), 8).Return(&models.Suggestions{}, nil).Once()
+
+		_, err := s.SuggestProducts(ctx, strings.Repeat("é", 150), 0)
+		require.NoError(t, err)
+		s.repo.AssertExpectations(t)
+	})
+}
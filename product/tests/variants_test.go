@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasadov/EcommerceAPI/product/internal"
+	"github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sizeOption  = models.ProductOption{Name: "Size", Values: []string{"S", "M"}}
+	colorOption = models.ProductOption{Name: "Color", Values: []string{"Red", "Blue"}}
+)
+
+func variant(sku string, price float64, options ...string) models.Variant {
+	v := models.Variant{SKU: sku, Price: price}
+	for i := 0; i+1 < len(options); i += 2 {
+		v.Options = append(v.Options, models.VariantOption{Name: options[i], Value: options[i+1]})
+	}
+	return v
+}
+
+func TestProductService_SetProductVariants_Validation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		options  []models.ProductOption
+		variants []models.Variant
+		err      error
+	}{
+		{
+			name:    "valid",
+			options: []models.ProductOption{sizeOption, colorOption},
+			variants: []models.Variant{
+				variant("S-RED", 10, "Size", "S", "Color", "Red"),
+				variant("M-BLUE", 12, "Color", "Blue", "Size", "M"),
+			},
+		},
+		{
+			name: "no options or variants",
+		},
+		{
+			name:    "options without variants",
+			options: []models.ProductOption{sizeOption},
+		},
+		{
+			name:    "option without name",
+			options: []models.ProductOption{{Values: []string{"S"}}},
+			err:     internal.ErrInvalidOption,
+		},
+		{
+			name:    "option without values",
+			options: []models.ProductOption{{Name: "Size"}},
+			err:     internal.ErrInvalidOption,
+		},
+		{
+			name:    "duplicate option",
+			options: []models.ProductOption{sizeOption, sizeOption},
+			err:     internal.ErrInvalidOption,
+		},
+		{
+			name:    "duplicate option value",
+			options: []models.ProductOption{{Name: "Size", Values: []string{"S", "S"}}},
+			err:     internal.ErrInvalidOption,
+		},
+		{
+			name:    "empty option value",
+			options: []models.ProductOption{{Name: "Size", Values: []string{"S", ""}}},
+			err:     internal.ErrInvalidOption,
+		},
+		{
+			name:     "variants without options",
+			variants: []models.Variant{variant("S", 10)},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "variant without SKU",
+			options:  []models.ProductOption{sizeOption},
+			variants: []models.Variant{variant("", 10, "Size", "S")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "duplicate SKU",
+			options:  []models.ProductOption{sizeOption},
+			variants: []models.Variant{variant("SKU", 10, "Size", "S"), variant("SKU", 10, "Size", "M")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "price not positive",
+			options:  []models.ProductOption{sizeOption},
+			variants: []models.Variant{variant("S", 0, "Size", "S")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "missing option",
+			options:  []models.ProductOption{sizeOption, colorOption},
+			variants: []models.Variant{variant("S", 10, "Size", "S")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "option repeated instead of another",
+			options:  []models.ProductOption{sizeOption, colorOption},
+			variants: []models.Variant{variant("S", 10, "Size", "S", "Size", "M")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "unknown option",
+			options:  []models.ProductOption{sizeOption},
+			variants: []models.Variant{variant("S", 10, "Fit", "S")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:     "unknown value",
+			options:  []models.ProductOption{sizeOption},
+			variants: []models.Variant{variant("XL", 10, "Size", "XL")},
+			err:      internal.ErrInvalidVariant,
+		},
+		{
+			name:    "same options in another order",
+			options: []models.ProductOption{sizeOption, colorOption},
+			variants: []models.Variant{
+				variant("S-RED", 10, "Size", "S", "Color", "Red"),
+				variant("RED-S", 10, "Color", "Red", "Size", "S"),
+			},
+			err: internal.ErrDuplicateVariant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupTestService(t)
+			s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+			if tt.err == nil {
+				s.repo.On("SetProductVariants", ctx, "product-1", tt.options, tt.variants).Return(nil).Once()
+			}
+
+			product, err := s.SetProductVariants(ctx, "product-1", tt.options, tt.variants, 7)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				s.repo.AssertNotCalled(t, "SetProductVariants", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.variants, product.Variants)
+			s.repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProductService_SetProductVariants(t *testing.T) {
+	ctx := context.Background()
+	options := []models.ProductOption{sizeOption}
+	small := variant("S", 10, "Size", "S")
+	medium := variant("M", 12, "Size", "M")
+
+	t.Run("stock of removed variants is deleted", func(t *testing.T) {
+		s := setupTestService(t)
+		product := createSampleProduct(models.StatusPublished)
+		product.Options = options
+		product.Variants = []models.Variant{small, medium}
+		s.repo.On("GetProductById", ctx, "product-1").Return(product, nil)
+		s.repo.On("SetProductVariants", ctx, "product-1", options, []models.Variant{medium}).Return(nil).Once()
+		_, err := s.inventory.SetStock(ctx, "product-1", "S", 3)
+		require.NoError(t, err)
+		_, err = s.inventory.SetStock(ctx, "product-1", "M", 4)
+		require.NoError(t, err)
+
+		_, err = s.SetProductVariants(ctx, "product-1", options, []models.Variant{medium}, 7)
+		require.NoError(t, err)
+
+		stock, err := s.GetStock(ctx, []string{"product-1"})
+		require.NoError(t, err)
+		require.Len(t, stock, 1)
+		assert.Equal(t, "M", stock[0].SKU)
+		assert.Equal(t, 4, stock[0].OnHand)
+	})
+
+	t.Run("other seller", func(t *testing.T) {
+		s := setupTestService(t)
+		s.repo.On("GetProductById", ctx, "product-1").Return(createSampleProduct(models.StatusPublished), nil)
+		_, err := s.SetProductVariants(ctx, "product-1", options, []models.Variant{small}, 8)
+		assert.Error(t, err)
+		s.repo.AssertNotCalled(t, "SetProductVariants", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("stock is set per variant", func(t *testing.T) {
+		s := setupTestService(t)
+		product := createSampleProduct(models.StatusPublished)
+		product.Options = options
+		product.Variants = []models.Variant{small}
+		s.repo.On("GetProductById", ctx, "product-1").Return(product, nil)
+
+		_, err := s.SetStock(ctx, "product-1", "", 5, 7)
+		assert.ErrorIs(t, err, internal.ErrVariantRequired)
+		_, err = s.SetStock(ctx, "product-1", "XL", 5, 7)
+		assert.ErrorIs(t, err, internal.ErrUnknownVariant)
+		stock, err := s.SetStock(ctx, "product-1", "S", 5, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "S", stock.SKU)
+		assert.Equal(t, 5, stock.OnHand)
+	})
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	"github.com/rasadov/EcommerceAPI/review/models"
+	"github.com/rasadov/EcommerceAPI/review/proto/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var ErrInvalidStatus = errors.New("unknown review status")
+
+var (
+	statusToProto = map[models.Status]pb.ReviewStatus{
+		models.StatusPublished: pb.ReviewStatus_PUBLISHED,
+		models.StatusPending:   pb.ReviewStatus_PENDING,
+		models.StatusRejected:  pb.ReviewStatus_REJECTED,
+	}
+	statusFromProto = map[pb.ReviewStatus]models.Status{
+		pb.ReviewStatus_PUBLISHED: models.StatusPublished,
+		pb.ReviewStatus_PENDING:   models.StatusPending,
+		pb.ReviewStatus_REJECTED:  models.StatusRejected,
+	}
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.ReviewServiceClient
+}
+
+func NewClient(url string) (*Client, error) {
+	conn, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(middleware.UnaryClientAuthInterceptor()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	client := pb.NewReviewServiceClient(conn)
+	return &Client{conn, client}, nil
+}
+
+func (client *Client) Close() {
+	err := client.conn.Close()
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// PostReview reviews a product as the caller, who must have paid for it.
+func (client *Client) PostReview(ctx context.Context, productID string, rating int, text string) (*models.Review, error) {
+	res, err := client.service.PostReview(ctx, &pb.PostReviewRequest{
+		ProductId: productID,
+		Rating:    int32(rating),
+		Text:      text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewFromProto(res.Review)
+}
+
+func (client *Client) UpdateReview(ctx context.Context, id uint64, rating int, text string) (*models.Review, error) {
+	res, err := client.service.UpdateReview(ctx, &pb.UpdateReviewRequest{
+		Id:     id,
+		Rating: int32(rating),
+		Text:   text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewFromProto(res.Review)
+}
+
+func (client *Client) DeleteReview(ctx context.Context, id uint64) error {
+	_, err := client.service.DeleteReview(ctx, &wrapperspb.UInt64Value{Value: id})
+	return err
+}
+
+func (client *Client) ReplyToReview(ctx context.Context, id uint64, text string) (*models.Review, error) {
+	res, err := client.service.ReplyToReview(ctx, &pb.ReplyToReviewRequest{
+		Id:   id,
+		Text: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewFromProto(res.Review)
+}
+
+func (client *Client) ModerateReview(ctx context.Context, id uint64, reviewStatus models.Status, note string) (*models.Review, error) {
+	protoStatus, ok := statusToProto[reviewStatus]
+	if !ok {
+		return nil, ErrInvalidStatus
+	}
+	res, err := client.service.ModerateReview(ctx, &pb.ModerateReviewRequest{
+		Id:     id,
+		Status: protoStatus,
+		Note:   note,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewFromProto(res.Review)
+}
+
+func (client *Client) ListReviews(ctx context.Context, productID string, skip, take uint64) ([]*models.Review, error) {
+	res, err := client.service.ListReviews(ctx, &pb.ListReviewsRequest{
+		ProductId: productID,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewsFromProto(res.Reviews)
+}
+
+func (client *Client) ListReviewsForModeration(ctx context.Context, reviewStatus models.Status, skip, take uint64) ([]*models.Review, error) {
+	protoStatus, ok := statusToProto[reviewStatus]
+	if !ok {
+		return nil, ErrInvalidStatus
+	}
+	res, err := client.service.ListReviewsForModeration(ctx, &pb.ListReviewsForModerationRequest{
+		Status: protoStatus,
+		Skip:   skip,
+		Take:   take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewsFromProto(res.Reviews)
+}
+
+func reviewFromProto(r *pb.Review) (*models.Review, error) {
+	review := &models.Review{
+		ID:             r.Id,
+		ProductID:      r.ProductId,
+		AccountID:      r.AccountId,
+		Rating:         int(r.Rating),
+		Text:           r.Text,
+		Status:         statusFromProto[r.Status],
+		ModerationNote: r.ModerationNote,
+		Reply:          r.Reply,
+	}
+	if len(r.RepliedAt) > 0 {
+		repliedAt := time.Time{}
+		if err := repliedAt.UnmarshalBinary(r.RepliedAt); err != nil {
+			return nil, err
+		}
+		review.RepliedAt = &repliedAt
+	}
+	if err := review.CreatedAt.UnmarshalBinary(r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := review.UpdatedAt.UnmarshalBinary(r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func reviewsFromProto(reviews []*pb.Review) ([]*models.Review, error) {
+	res := make([]*models.Review, 0, len(reviews))
+	for _, r := range reviews {
+		review, err := reviewFromProto(r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, review)
+	}
+	return res, nil
+}
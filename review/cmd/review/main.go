@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	order "github.com/rasadov/EcommerceAPI/order/client"
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	product "github.com/rasadov/EcommerceAPI/product/client"
+	"github.com/rasadov/EcommerceAPI/review/config"
+	"github.com/rasadov/EcommerceAPI/review/internal"
+	"github.com/tinrab/retry"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	var repository internal.Repository
+
+	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
+		db, err := gorm.Open(postgres.Open(config.DatabaseUrl), &gorm.Config{})
+		if err != nil {
+			log.Println(err)
+		}
+		repository, err = internal.NewPostgresRepository(db)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	})
+	defer repository.Close()
+
+	orderClient, err := order.NewClient(config.OrderUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer orderClient.Close()
+
+	productClient, err := product.NewClient(config.ProductUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer productClient.Close()
+
+	log.Println("Listening on port 8080...")
+	service := internal.NewReviewService(repository, orderClient, productClient)
+	keys := auth.NewRemoteKeySet(auth.HTTPJWKSFetcher(config.JWKSURL))
+	log.Fatal(internal.ListenGRPC(service, keys, 8080))
+}
@@ -0,0 +1,19 @@
+package config
+
+import "os"
+
+var (
+	DatabaseUrl string
+	OrderUrl    string
+	// ProductUrl is the internal listener of the product service, which serves SetProductRating
+	ProductUrl string
+	// JWKSURL is where the account service publishes the keys that sign access tokens
+	JWKSURL string
+)
+
+func init() {
+	DatabaseUrl = os.Getenv("DATABASE_URL")
+	OrderUrl = os.Getenv("ORDER_SERVICE_URL")
+	ProductUrl = os.Getenv("PRODUCT_SERVICE_URL")
+	JWKSURL = os.Getenv("JWKS_URL")
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rasadov/EcommerceAPI/review/models"
+)
+
+var (
+	ErrNotFound        = errors.New("review not found")
+	ErrAlreadyReviewed = errors.New("account already reviewed this product")
+)
+
+type Repository interface {
+	Close()
+	CreateReview(ctx context.Context, review *models.Review) error
+	GetReview(ctx context.Context, id uint64) (*models.Review, error)
+	UpdateReview(ctx context.Context, review *models.Review) error
+	DeleteReview(ctx context.Context, id uint64) error
+	ListReviews(ctx context.Context, productID string, status models.Status, skip, take uint64) ([]*models.Review, error)
+	ListReviewsByStatus(ctx context.Context, status models.Status, skip, take uint64) ([]*models.Review, error)
+	GetRating(ctx context.Context, productID string) (*models.Rating, error)
+}
+
+type postgresRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresRepository(db *gorm.DB) (Repository, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlDB.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Review{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresRepository{db}, nil
+}
+
+func (repository *postgresRepository) Close() {
+	sqlDB, err := repository.db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+		if err != nil {
+			log.Println("Error closing postgres repository")
+			log.Println(err)
+		}
+	}
+}
+
+// CreateReview saves a new review, or returns ErrAlreadyReviewed when the
+// account reviewed the product before.
+func (repository *postgresRepository) CreateReview(ctx context.Context, review *models.Review) error {
+	res := repository.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(review)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlreadyReviewed
+	}
+	return nil
+}
+
+func (repository *postgresRepository) GetReview(ctx context.Context, id uint64) (*models.Review, error) {
+	review := &models.Review{}
+	err := repository.db.WithContext(ctx).First(review, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (repository *postgresRepository) UpdateReview(ctx context.Context, review *models.Review) error {
+	return repository.db.WithContext(ctx).Save(review).Error
+}
+
+func (repository *postgresRepository) DeleteReview(ctx context.Context, id uint64) error {
+	res := repository.db.WithContext(ctx).Delete(&models.Review{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListReviews returns the reviews of a product in a moderation state, newest first.
+func (repository *postgresRepository) ListReviews(ctx context.Context, productID string, status models.Status, skip, take uint64) ([]*models.Review, error) {
+	var reviews []*models.Review
+	err := repository.db.WithContext(ctx).
+		Where("product_id = ? AND status = ?", productID, status).
+		Order("created_at DESC, id DESC").
+		Offset(int(skip)).
+		Limit(int(take)).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// ListReviewsByStatus returns the reviews of all products in a moderation state,
+// oldest first, which is the order moderators work through them.
+func (repository *postgresRepository) ListReviewsByStatus(ctx context.Context, status models.Status, skip, take uint64) ([]*models.Review, error) {
+	var reviews []*models.Review
+	err := repository.db.WithContext(ctx).
+		Where("status = ?", status).
+		Order("updated_at, id").
+		Offset(int(skip)).
+		Limit(int(take)).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// GetRating averages the published reviews of a product.
+func (repository *postgresRepository) GetRating(ctx context.Context, productID string) (*models.Rating, error) {
+	rating := &models.Rating{}
+	err := repository.db.WithContext(ctx).
+		Model(&models.Review{}).
+		Select("CAST(COALESCE(AVG(rating), 0) AS DOUBLE PRECISION) AS average, COUNT(*) AS count").
+		Where("product_id = ? AND status = ?", productID, models.StatusPublished).
+		Scan(rating).Error
+	if err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/rasadov/EcommerceAPI/pkg/auth"
+	"github.com/rasadov/EcommerceAPI/pkg/middleware"
+	"github.com/rasadov/EcommerceAPI/review/models"
+	"github.com/rasadov/EcommerceAPI/review/proto/pb"
+)
+
+// methodRoles lists the RPCs that need a caller, every other RPC is public.
+var methodRoles = middleware.MethodRoles{
+	pb.ReviewService_PostReview_FullMethodName:               {},
+	pb.ReviewService_UpdateReview_FullMethodName:             {},
+	pb.ReviewService_DeleteReview_FullMethodName:             {},
+	pb.ReviewService_ReplyToReview_FullMethodName:            {auth.RoleSeller},
+	pb.ReviewService_ModerateReview_FullMethodName:           {auth.RoleAdmin},
+	pb.ReviewService_ListReviewsForModeration_FullMethodName: {auth.RoleAdmin},
+}
+
+var (
+	statusToProto = map[models.Status]pb.ReviewStatus{
+		models.StatusPublished: pb.ReviewStatus_PUBLISHED,
+		models.StatusPending:   pb.ReviewStatus_PENDING,
+		models.StatusRejected:  pb.ReviewStatus_REJECTED,
+	}
+	statusFromProto = map[pb.ReviewStatus]models.Status{
+		pb.ReviewStatus_PUBLISHED: models.StatusPublished,
+		pb.ReviewStatus_PENDING:   models.StatusPending,
+		pb.ReviewStatus_REJECTED:  models.StatusRejected,
+	}
+)
+
+type grpcServer struct {
+	pb.UnimplementedReviewServiceServer
+	service Service
+}
+
+func ListenGRPC(s Service, keys auth.KeyProvider, port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	serv := grpc.NewServer(
+		grpc.UnaryInterceptor(middleware.UnaryServerAuthInterceptor(keys, methodRoles)),
+	)
+
+	pb.RegisterReviewServiceServer(serv, &grpcServer{
+		UnimplementedReviewServiceServer: pb.UnimplementedReviewServiceServer{},
+		service:                          s,
+	})
+	reflection.Register(serv)
+	return serv.Serve(lis)
+}
+
+func (s *grpcServer) PostReview(ctx context.Context, r *pb.PostReviewRequest) (*pb.ReviewResponse, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	review, err := s.service.PostReview(ctx, accountID, r.ProductId, int(r.Rating), r.Text)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) UpdateReview(ctx context.Context, r *pb.UpdateReviewRequest) (*pb.ReviewResponse, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	review, err := s.service.UpdateReview(ctx, r.Id, accountID, int(r.Rating), r.Text)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+// DeleteReview deletes a review of the caller, admins delete any review.
+func (s *grpcServer) DeleteReview(ctx context.Context, r *wrapperspb.UInt64Value) (*emptypb.Empty, error) {
+	accountID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role, _ := auth.GetRole(ctx)
+	if err = s.service.DeleteReview(ctx, r.Value, accountID, role == auth.RoleAdmin); err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) ReplyToReview(ctx context.Context, r *pb.ReplyToReviewRequest) (*pb.ReviewResponse, error) {
+	sellerID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	review, err := s.service.ReplyToReview(ctx, r.Id, sellerID, r.Text)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) ModerateReview(ctx context.Context, r *pb.ModerateReviewRequest) (*pb.ReviewResponse, error) {
+	reviewStatus, ok := statusFromProto[r.Status]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidStatus.Error())
+	}
+	review, err := s.service.ModerateReview(ctx, r.Id, reviewStatus, r.Note)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return &pb.ReviewResponse{Review: reviewToProto(review)}, nil
+}
+
+func (s *grpcServer) ListReviews(ctx context.Context, r *pb.ListReviewsRequest) (*pb.ReviewsResponse, error) {
+	reviews, err := s.service.ListReviews(ctx, r.ProductId, r.Skip, r.Take)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return reviewsToProto(reviews), nil
+}
+
+func (s *grpcServer) ListReviewsForModeration(ctx context.Context, r *pb.ListReviewsForModerationRequest) (*pb.ReviewsResponse, error) {
+	reviewStatus, ok := statusFromProto[r.Status]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidStatus.Error())
+	}
+	reviews, err := s.service.ListReviewsForModeration(ctx, reviewStatus, r.Skip, r.Take)
+	if err != nil {
+		log.Println(err)
+		return nil, serviceError(err)
+	}
+	return reviewsToProto(reviews), nil
+}
+
+func reviewToProto(review *models.Review) *pb.Review {
+	res := &pb.Review{
+		Id:             review.ID,
+		ProductId:      review.ProductID,
+		AccountId:      review.AccountID,
+		Rating:         int32(review.Rating),
+		Text:           review.Text,
+		Status:         statusToProto[review.Status],
+		ModerationNote: review.ModerationNote,
+		Reply:          review.Reply,
+	}
+	if review.RepliedAt != nil {
+		res.RepliedAt, _ = review.RepliedAt.MarshalBinary()
+	}
+	res.CreatedAt, _ = review.CreatedAt.MarshalBinary()
+	res.UpdatedAt, _ = review.UpdatedAt.MarshalBinary()
+	return res
+}
+
+func reviewsToProto(reviews []*models.Review) *pb.ReviewsResponse {
+	res := &pb.ReviewsResponse{Reviews: make([]*pb.Review, 0, len(reviews))}
+	for _, review := range reviews {
+		res.Reviews = append(res.Reviews, reviewToProto(review))
+	}
+	return res
+}
+
+// callerID returns the account authenticated by the interceptor.
+func callerID(ctx context.Context) (uint64, error) {
+	accountID, err := auth.GetUserIdInt(ctx, false)
+	if err != nil {
+		return 0, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return uint64(accountID), nil
+}
+
+// serviceError maps the errors of the service to gRPC status codes.
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidRating), errors.Is(err, ErrTextTooLong), errors.Is(err, ErrInvalidStatus):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrAlreadyReviewed):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrNotPurchased):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err.Error() == "unauthorized":
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/rasadov/EcommerceAPI/review/models"
+)
+
+var (
+	ErrInvalidRating = errors.New("rating must be from 1 to 5 stars")
+	ErrTextTooLong   = errors.New("review text is too long")
+	ErrNotPurchased  = errors.New("only customers who bought the product can review it")
+	ErrInvalidStatus = errors.New("unknown review status")
+)
+
+const (
+	// maxTextLength is the longest review or reply, in characters
+	maxTextLength = 5000
+	// maxPageSize is the most reviews listed at once
+	maxPageSize = 100
+)
+
+// Purchases verifies that an account bought a product, the order client does.
+type Purchases interface {
+	VerifyPurchase(ctx context.Context, accountID uint64, productID string) (*orderModels.Order, error)
+}
+
+// Catalog finds the seller of a product and records its rating, the product
+// client does.
+type Catalog interface {
+	GetProduct(ctx context.Context, id string) (*productModels.Product, error)
+	SetProductRating(ctx context.Context, productID string, rating productModels.Rating) error
+}
+
+type Service interface {
+	PostReview(ctx context.Context, accountID uint64, productID string, rating int, text string) (*models.Review, error)
+	UpdateReview(ctx context.Context, id, accountID uint64, rating int, text string) (*models.Review, error)
+	DeleteReview(ctx context.Context, id, accountID uint64, moderator bool) error
+	ReplyToReview(ctx context.Context, id, sellerID uint64, text string) (*models.Review, error)
+	ModerateReview(ctx context.Context, id uint64, reviewStatus models.Status, note string) (*models.Review, error)
+	ListReviews(ctx context.Context, productID string, skip, take uint64) ([]*models.Review, error)
+	ListReviewsForModeration(ctx context.Context, reviewStatus models.Status, skip, take uint64) ([]*models.Review, error)
+}
+
+type reviewService struct {
+	repository Repository
+	purchases  Purchases
+	catalog    Catalog
+}
+
+func NewReviewService(repository Repository, purchases Purchases, catalog Catalog) Service {
+	return &reviewService{repository, purchases, catalog}
+}
+
+// PostReview publishes the review of a customer who paid for the product.
+func (service reviewService) PostReview(ctx context.Context, accountID uint64, productID string, rating int, text string) (*models.Review, error) {
+	text, err := validateReview(rating, text)
+	if err != nil {
+		return nil, err
+	}
+	order, err := service.purchases.VerifyPurchase(ctx, accountID, productID)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotPurchased
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	review := &models.Review{
+		ProductID: productID,
+		AccountID: accountID,
+		OrderID:   uint64(order.ID),
+		Rating:    rating,
+		Text:      text,
+		Status:    models.StatusPublished,
+	}
+	if err = service.repository.CreateReview(ctx, review); err != nil {
+		return nil, err
+	}
+	service.updateRating(ctx, productID)
+	return review, nil
+}
+
+// UpdateReview changes the stars and text of a review by its author. A rejected
+// review goes back to the moderators.
+func (service reviewService) UpdateReview(ctx context.Context, id, accountID uint64, rating int, text string) (*models.Review, error) {
+	text, err := validateReview(rating, text)
+	if err != nil {
+		return nil, err
+	}
+	review, err := service.repository.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if review.AccountID != accountID {
+		return nil, errors.New("unauthorized")
+	}
+
+	review.Rating = rating
+	review.Text = text
+	if review.Status == models.StatusRejected {
+		review.Status = models.StatusPending
+	}
+	if err = service.repository.UpdateReview(ctx, review); err != nil {
+		return nil, err
+	}
+	service.updateRating(ctx, review.ProductID)
+	return review, nil
+}
+
+// DeleteReview deletes a review by its author, or by a moderator.
+func (service reviewService) DeleteReview(ctx context.Context, id, accountID uint64, moderator bool) error {
+	review, err := service.repository.GetReview(ctx, id)
+	if err != nil {
+		return err
+	}
+	if review.AccountID != accountID && !moderator {
+		return errors.New("unauthorized")
+	}
+	if err = service.repository.DeleteReview(ctx, id); err != nil {
+		return err
+	}
+	service.updateRating(ctx, review.ProductID)
+	return nil
+}
+
+// ReplyToReview sets the answer of the seller of the product, an empty text
+// removes it.
+func (service reviewService) ReplyToReview(ctx context.Context, id, sellerID uint64, text string) (*models.Review, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return nil, ErrTextTooLong
+	}
+	review, err := service.repository.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	product, err := service.catalog.GetProduct(ctx, review.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(product.AccountID) != sellerID {
+		return nil, errors.New("unauthorized")
+	}
+
+	review.Reply = text
+	review.RepliedAt = nil
+	if text != "" {
+		now := time.Now().UTC()
+		review.RepliedAt = &now
+	}
+	if err = service.repository.UpdateReview(ctx, review); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// ModerateReview publishes or rejects a review, the note tells the author why.
+func (service reviewService) ModerateReview(ctx context.Context, id uint64, reviewStatus models.Status, note string) (*models.Review, error) {
+	if reviewStatus != models.StatusPublished && reviewStatus != models.StatusRejected {
+		return nil, ErrInvalidStatus
+	}
+	review, err := service.repository.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	changed := review.Status != reviewStatus
+	review.Status = reviewStatus
+	review.ModerationNote = strings.TrimSpace(note)
+	if err = service.repository.UpdateReview(ctx, review); err != nil {
+		return nil, err
+	}
+	if changed {
+		service.updateRating(ctx, review.ProductID)
+	}
+	return review, nil
+}
+
+// ListReviews returns the published reviews of a product, newest first.
+func (service reviewService) ListReviews(ctx context.Context, productID string, skip, take uint64) ([]*models.Review, error) {
+	return service.repository.ListReviews(ctx, productID, models.StatusPublished, skip, pageSize(take))
+}
+
+// ListReviewsForModeration returns the reviews in a moderation state, oldest first.
+func (service reviewService) ListReviewsForModeration(ctx context.Context, reviewStatus models.Status, skip, take uint64) ([]*models.Review, error) {
+	switch reviewStatus {
+	case models.StatusPublished, models.StatusPending, models.StatusRejected:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	return service.repository.ListReviewsByStatus(ctx, reviewStatus, skip, pageSize(take))
+}
+
+// updateRating records the rating of a product from its published reviews on
+// the product. A failure is only logged, the next change of the reviews of the
+// product sets it again.
+func (service reviewService) updateRating(ctx context.Context, productID string) {
+	rating, err := service.repository.GetRating(ctx, productID)
+	if err != nil {
+		log.Println("Failed to compute the rating of", productID, err)
+		return
+	}
+	err = service.catalog.SetProductRating(ctx, productID, productModels.Rating{
+		Average: rating.Average,
+		Count:   rating.Count,
+	})
+	if err != nil {
+		log.Println("Failed to update the rating of", productID, err)
+	}
+}
+
+func validateReview(rating int, text string) (string, error) {
+	if rating < 1 || rating > 5 {
+		return "", ErrInvalidRating
+	}
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return "", ErrTextTooLong
+	}
+	return text, nil
+}
+
+func pageSize(take uint64) uint64 {
+	if take == 0 || take > maxPageSize {
+		return maxPageSize
+	}
+	return take
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Status is the moderation state of a review. Only published reviews are shown
+// and counted in the rating of their product.
+type Status string
+
+const (
+	StatusPublished Status = "published"
+	// StatusPending marks a rejected review edited by its author, until a
+	// moderator looks at it again
+	StatusPending  Status = "pending"
+	StatusRejected Status = "rejected"
+)
+
+// Review is the opinion of a customer on a product they bought. A customer
+// reviews a product once, and edits that review afterwards.
+type Review struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	ProductID string `gorm:"not null;uniqueIndex:idx_reviews_product_account;index:idx_reviews_product_status"`
+	AccountID uint64 `gorm:"not null;uniqueIndex:idx_reviews_product_account"`
+	// OrderID is the paid order the product was bought in
+	OrderID uint64
+	// Rating is from 1 to 5 stars
+	Rating int
+	Text   string
+	Status Status `gorm:"not null;index:idx_reviews_product_status"`
+	// ModerationNote tells the author why the review was rejected
+	ModerationNote string
+	// Reply is the answer of the seller of the product
+	Reply     string
+	RepliedAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Rating sums up the published reviews of a product.
+type Rating struct {
+	Average float64
+	Count   int
+}
@@ -0,0 +1,339 @@
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	orderModels "github.com/rasadov/EcommerceAPI/order/models"
+	productModels "github.com/rasadov/EcommerceAPI/product/models"
+	"github.com/rasadov/EcommerceAPI/review/internal"
+	"github.com/rasadov/EcommerceAPI/review/models"
+)
+
+// MockPurchases implements the Purchases interface for testing
+type MockPurchases struct {
+	mock.Mock
+}
+
+func (m *MockPurchases) VerifyPurchase(ctx context.Context, accountID uint64, productID string) (*orderModels.Order, error) {
+	args := m.Called(ctx, accountID, productID)
+	order, _ := args.Get(0).(*orderModels.Order)
+	return order, args.Error(1)
+}
+
+// MockCatalog implements the Catalog interface for testing
+type MockCatalog struct {
+	mock.Mock
+}
+
+func (m *MockCatalog) GetProduct(ctx context.Context, id string) (*productModels.Product, error) {
+	args := m.Called(ctx, id)
+	product, _ := args.Get(0).(*productModels.Product)
+	return product, args.Error(1)
+}
+
+func (m *MockCatalog) SetProductRating(ctx context.Context, productID string, rating productModels.Rating) error {
+	args := m.Called(ctx, productID, rating)
+	return args.Error(0)
+}
+
+type testService struct {
+	internal.Service
+	repository internal.Repository
+	purchases  *MockPurchases
+	catalog    *MockCatalog
+}
+
+// setupTestService runs the service on the Postgres repository over SQLite.
+// Every account bought lamp in order 10 unless the test says otherwise, and
+// the ratings are recorded.
+func setupTestService(t *testing.T) *testService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "review.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	repository, err := internal.NewPostgresRepository(db)
+	require.NoError(t, err)
+	t.Cleanup(repository.Close)
+
+	s := &testService{
+		repository: repository,
+		purchases:  &MockPurchases{},
+		catalog:    &MockCatalog{},
+	}
+	s.Service = internal.NewReviewService(repository, s.purchases, s.catalog)
+	return s
+}
+
+func (s *testService) expectPurchases() {
+	s.purchases.On("VerifyPurchase", mock.Anything, mock.Anything, "lamp").
+		Return(&orderModels.Order{ID: 10}, nil)
+	s.catalog.On("SetProductRating", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+}
+
+// lastRating returns the rating last recorded on a product.
+func (s *testService) lastRating(t *testing.T, productID string) productModels.Rating {
+	t.Helper()
+	var rating *productModels.Rating
+	for _, call := range s.catalog.Calls {
+		if call.Method == "SetProductRating" && call.Arguments.String(1) == productID {
+			r := call.Arguments.Get(2).(productModels.Rating)
+			rating = &r
+		}
+	}
+	require.NotNil(t, rating, "no rating recorded for %s", productID)
+	return *rating
+}
+
+func TestReviewService_PostReview(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("verified purchase", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+
+		review, err := s.PostReview(ctx, 1, "lamp", 4, "  Bright enough ")
+		require.NoError(t, err)
+		assert.NotZero(t, review.ID)
+		assert.Equal(t, uint64(10), review.OrderID)
+		assert.Equal(t, "Bright enough", review.Text)
+		assert.Equal(t, models.StatusPublished, review.Status)
+		assert.Equal(t, productModels.Rating{Average: 4, Count: 1}, s.lastRating(t, "lamp"))
+	})
+
+	t.Run("without a paid order", func(t *testing.T) {
+		s := setupTestService(t)
+		s.purchases.On("VerifyPurchase", mock.Anything, uint64(1), "lamp").
+			Return(nil, status.Error(codes.NotFound, "no paid order"))
+
+		_, err := s.PostReview(ctx, 1, "lamp", 4, "")
+		assert.ErrorIs(t, err, internal.ErrNotPurchased)
+		reviews, err := s.ListReviews(ctx, "lamp", 0, 0)
+		require.NoError(t, err)
+		assert.Empty(t, reviews)
+		s.catalog.AssertNotCalled(t, "SetProductRating", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("order service unavailable", func(t *testing.T) {
+		s := setupTestService(t)
+		unavailable := status.Error(codes.Unavailable, "connection refused")
+		s.purchases.On("VerifyPurchase", mock.Anything, uint64(1), "lamp").Return(nil, unavailable)
+
+		_, err := s.PostReview(ctx, 1, "lamp", 4, "")
+		assert.Equal(t, unavailable, err)
+	})
+
+	t.Run("one review per account", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+
+		_, err := s.PostReview(ctx, 1, "lamp", 4, "")
+		require.NoError(t, err)
+		_, err = s.PostReview(ctx, 1, "lamp", 1, "Changed my mind")
+		assert.ErrorIs(t, err, internal.ErrAlreadyReviewed)
+		_, err = s.PostReview(ctx, 2, "lamp", 2, "")
+		require.NoError(t, err)
+
+		reviews, err := s.ListReviews(ctx, "lamp", 0, 0)
+		require.NoError(t, err)
+		require.Len(t, reviews, 2)
+		assert.Equal(t, productModels.Rating{Average: 3, Count: 2}, s.lastRating(t, "lamp"))
+	})
+
+	invalid := []struct {
+		name   string
+		rating int
+		text   string
+		err    error
+	}{
+		{"no stars", 0, "", internal.ErrInvalidRating},
+		{"six stars", 6, "", internal.ErrInvalidRating},
+		{"text too long", 5, string(make([]rune, 5001)), internal.ErrTextTooLong},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupTestService(t)
+			_, err := s.PostReview(ctx, 1, "lamp", tt.rating, tt.text)
+			assert.ErrorIs(t, err, tt.err)
+			s.purchases.AssertNotCalled(t, "VerifyPurchase", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestReviewService_Moderation(t *testing.T) {
+	ctx := context.Background()
+
+	post := func(t *testing.T, s *testService, accountID uint64, rating int) *models.Review {
+		t.Helper()
+		review, err := s.PostReview(ctx, accountID, "lamp", rating, "")
+		require.NoError(t, err)
+		return review
+	}
+	shown := func(t *testing.T, s *testService) []uint64 {
+		t.Helper()
+		reviews, err := s.ListReviews(ctx, "lamp", 0, 0)
+		require.NoError(t, err)
+		ids := []uint64{}
+		for _, review := range reviews {
+			ids = append(ids, review.ID)
+		}
+		return ids
+	}
+
+	t.Run("rejected reviews are hidden until published again", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+		good := post(t, s, 1, 5)
+		bad := post(t, s, 2, 1)
+
+		rejected, err := s.ModerateReview(ctx, bad.ID, models.StatusRejected, " Offensive ")
+		require.NoError(t, err)
+		assert.Equal(t, "Offensive", rejected.ModerationNote)
+		assert.Equal(t, []uint64{good.ID}, shown(t, s))
+		assert.Equal(t, productModels.Rating{Average: 5, Count: 1}, s.lastRating(t, "lamp"))
+
+		queue, err := s.ListReviewsForModeration(ctx, models.StatusRejected, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+		assert.Equal(t, bad.ID, queue[0].ID)
+
+		// Editing a rejected review sends it back to the moderators
+		edited, err := s.UpdateReview(ctx, bad.ID, 2, 2, "Toned down")
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPending, edited.Status)
+		assert.Equal(t, []uint64{good.ID}, shown(t, s))
+		queue, err = s.ListReviewsForModeration(ctx, models.StatusPending, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+
+		_, err = s.ModerateReview(ctx, bad.ID, models.StatusPublished, "")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uint64{good.ID, bad.ID}, shown(t, s))
+		assert.Equal(t, productModels.Rating{Average: 3.5, Count: 2}, s.lastRating(t, "lamp"))
+	})
+
+	t.Run("editing a published review keeps it published", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+		review := post(t, s, 1, 5)
+
+		edited, err := s.UpdateReview(ctx, review.ID, 1, 3, "")
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPublished, edited.Status)
+		assert.Equal(t, productModels.Rating{Average: 3, Count: 1}, s.lastRating(t, "lamp"))
+	})
+
+	t.Run("moderating without a change keeps the rating", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+		review := post(t, s, 1, 5)
+
+		_, err := s.ModerateReview(ctx, review.ID, models.StatusPublished, "")
+		require.NoError(t, err)
+		s.catalog.AssertNumberOfCalls(t, "SetProductRating", 1)
+	})
+
+	t.Run("moderators publish or reject", func(t *testing.T) {
+		s := setupTestService(t)
+		s.expectPurchases()
+		review := post(t, s, 1, 5)
+
+		_, err := s.ModerateReview(ctx, review.ID, models.StatusPending, "")
+		assert.ErrorIs(t, err, internal.ErrInvalidStatus)
+		_, err = s.ModerateReview(ctx, review.ID+1, models.StatusRejected, "")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		_, err = s.ListReviewsForModeration(ctx, models.Status("hidden"), 0, 0)
+		assert.ErrorIs(t, err, internal.ErrInvalidStatus)
+	})
+}
+
+func TestReviewService_Rating(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestService(t)
+	s.expectPurchases()
+	s.purchases.On("VerifyPurchase", mock.Anything, mock.Anything, "chair").Return(&orderModels.Order{ID: 11}, nil)
+
+	var reviews []*models.Review
+	for i, rating := range []int{5, 4, 4, 2} {
+		review, err := s.PostReview(ctx, uint64(i+1), "lamp", rating, "")
+		require.NoError(t, err)
+		reviews = append(reviews, review)
+	}
+	_, err := s.PostReview(ctx, 1, "chair", 1, "")
+	require.NoError(t, err)
+
+	// Reviews of other products do not count
+	assert.Equal(t, productModels.Rating{Average: 3.75, Count: 4}, s.lastRating(t, "lamp"))
+	assert.Equal(t, productModels.Rating{Average: 1, Count: 1}, s.lastRating(t, "chair"))
+
+	require.NoError(t, s.DeleteReview(ctx, reviews[3].ID, 4, false))
+	assert.Equal(t, 13.0/3, s.lastRating(t, "lamp").Average)
+
+	// Only their author or a moderator deletes reviews
+	assert.EqualError(t, s.DeleteReview(ctx, reviews[0].ID, 2, false), "unauthorized")
+	require.NoError(t, s.DeleteReview(ctx, reviews[0].ID, 2, true))
+	require.NoError(t, s.DeleteReview(ctx, reviews[1].ID, 2, false))
+	require.NoError(t, s.DeleteReview(ctx, reviews[2].ID, 3, false))
+	assert.Equal(t, productModels.Rating{Average: 0, Count: 0}, s.lastRating(t, "lamp"))
+
+	rating, err := s.repository.GetRating(ctx, "unreviewed")
+	require.NoError(t, err)
+	assert.Equal(t, &models.Rating{}, rating)
+}
+
+func TestReviewService_ReplyToReview(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestService(t)
+	s.expectPurchases()
+	s.catalog.On("GetProduct", mock.Anything, "lamp").Return(&productModels.Product{ID: "lamp", AccountID: 7}, nil)
+	review, err := s.PostReview(ctx, 1, "lamp", 2, "Too dim")
+	require.NoError(t, err)
+
+	_, err = s.ReplyToReview(ctx, review.ID, 8, "Not our lamp")
+	assert.EqualError(t, err, "unauthorized")
+	_, err = s.UpdateReview(ctx, review.ID, 7, 5, "")
+	assert.EqualError(t, err, "unauthorized")
+
+	replied, err := s.ReplyToReview(ctx, review.ID, 7, " Try the 60W bulb ")
+	require.NoError(t, err)
+	assert.Equal(t, "Try the 60W bulb", replied.Reply)
+	assert.NotNil(t, replied.RepliedAt)
+
+	removed, err := s.ReplyToReview(ctx, review.ID, 7, "")
+	require.NoError(t, err)
+	assert.Empty(t, removed.Reply)
+	assert.Nil(t, removed.RepliedAt)
+}
+
+func TestReviewService_ListReviews(t *testing.T) {
+	ctx := context.Background()
+	s := setupTestService(t)
+	s.expectPurchases()
+	for i := range 3 {
+		_, err := s.PostReview(ctx, uint64(i+1), "lamp", 5, "")
+		require.NoError(t, err)
+	}
+
+	reviews, err := s.ListReviews(ctx, "lamp", 0, 2)
+	require.NoError(t, err)
+	require.Len(t, reviews, 2)
+	// Newest first
+	assert.Equal(t, uint64(3), reviews[0].AccountID)
+	assert.Equal(t, uint64(2), reviews[1].AccountID)
+
+	reviews, err = s.ListReviews(ctx, "lamp", 2, 1000)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.Equal(t, uint64(1), reviews[0].AccountID)
+}